@@ -0,0 +1,234 @@
+// HTTP approval gateway: lets a person decide SUPERVISED HUMAN and PAUSE
+// steps of an agent served with --http, optionally notifying webhooks.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vinayprograms/agent/internal/checkpoint"
+	"github.com/vinayprograms/agent/internal/supervision"
+)
+
+// approvalWebhookTimeout bounds each webhook notification.
+const approvalWebhookTimeout = 10 * time.Second
+
+// pendingApproval is a human decision waiting on the HTTP gateway.
+type pendingApproval struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	supervision.HumanRequest
+	PreCheckpoint  *checkpoint.PreCheckpoint  `json:"pre_checkpoint,omitempty"`
+	PostCheckpoint *checkpoint.PostCheckpoint `json:"post_checkpoint,omitempty"`
+
+	reply chan<- string
+}
+
+// approvalDecision is the body of POST /approvals/{id}.
+type approvalDecision struct {
+	Decision string `json:"decision"` // approve, reject or correct
+	Message  string `json:"message,omitempty"`
+}
+
+// response renders the decision in the form supervision.ParseHumanResponse reads.
+func (d approvalDecision) response() (string, error) {
+	switch strings.ToLower(strings.TrimSpace(d.Decision)) {
+	case supervision.HumanApprove:
+		return supervision.HumanApprove, nil
+	case supervision.HumanReject:
+		return strings.TrimSpace(supervision.HumanReject + " " + d.Message), nil
+	case supervision.HumanCorrect:
+		if strings.TrimSpace(d.Message) == "" {
+			return "", fmt.Errorf("correct requires a message")
+		}
+		return supervision.HumanCorrect + ": " + d.Message, nil
+	}
+	return "", fmt.Errorf("unknown decision %q (want approve, reject or correct)", d.Decision)
+}
+
+// httpApprover serves pending human decisions on /approvals. Steps of
+// concurrent goals and tasks wait side by side, each addressed by its
+// approval ID.
+type httpApprover struct {
+	humanBridge // answers to requests without a reply channel of their own
+	timeout     time.Duration
+	webhooks    []string
+	client      *http.Client
+
+	mu        sync.Mutex
+	approvals map[string]*pendingApproval // by ID, until answered or abandoned
+}
+
+func newHTTPApprover(timeout time.Duration, webhooks []string) *httpApprover {
+	return &httpApprover{
+		humanBridge: newHumanBridge(),
+		timeout:     timeout,
+		webhooks:    webhooks,
+		client:      &http.Client{Timeout: approvalWebhookTimeout},
+		approvals:   make(map[string]*pendingApproval),
+	}
+}
+
+func (h *httpApprover) request(req supervision.HumanRequest) {
+	now := time.Now()
+	approval := &pendingApproval{
+		ID:             "apr-" + generateShortID(),
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(h.timeout),
+		HumanRequest:   req,
+		PreCheckpoint:  req.Pre,
+		PostCheckpoint: req.Post,
+		reply:          req.Reply,
+	}
+	if approval.reply == nil {
+		approval.reply = h.answers()
+	}
+
+	h.mu.Lock()
+	// A repeated request keeps its ID, so links already sent stay valid
+	for id, a := range h.approvals {
+		if req.Reply != nil && a.reply == req.Reply {
+			approval.ID, approval.CreatedAt = id, a.CreatedAt
+		}
+	}
+	h.approvals[approval.ID] = approval
+	h.mu.Unlock()
+	if req.Done != nil {
+		go func() {
+			<-req.Done
+			h.remove(approval.ID)
+		}()
+	}
+
+	fmt.Fprintf(os.Stderr, "⏸ Approval %s waiting for step %q (POST /approvals/%s)\n", approval.ID, req.StepID, approval.ID)
+	for _, url := range h.webhooks {
+		go h.notify(url, approval)
+	}
+}
+
+// pending returns the approvals waiting for a decision, oldest first.
+func (h *httpApprover) pending() []*pendingApproval {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	list := make([]*pendingApproval, 0, len(h.approvals))
+	for _, a := range h.approvals {
+		if now.Before(a.ExpiresAt) {
+			list = append(list, a)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// get returns a pending approval by ID, or nil.
+func (h *httpApprover) get(id string) *pendingApproval {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if a := h.approvals[id]; a != nil && time.Now().Before(a.ExpiresAt) {
+		return a
+	}
+	return nil
+}
+
+// decide delivers a response to a pending approval. Returns false if it
+// is no longer pending.
+func (h *httpApprover) decide(id, response string) bool {
+	h.mu.Lock()
+	a := h.approvals[id]
+	delete(h.approvals, id)
+	h.mu.Unlock()
+	if a == nil || time.Now().After(a.ExpiresAt) {
+		return false
+	}
+	select {
+	case a.reply <- response:
+	default:
+	}
+	return true
+}
+
+// remove drops an approval the supervisor stopped waiting for.
+func (h *httpApprover) remove(id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.approvals, id)
+}
+
+// notify posts the pending approval to a webhook.
+func (h *httpApprover) notify(url string, approval *pendingApproval) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"event":    "approval.pending",
+		"approval": approval,
+		"path":     "/approvals/" + approval.ID,
+	})
+	resp, err := h.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: approval webhook %s failed: %v\n", url, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		fmt.Fprintf(os.Stderr, "warning: approval webhook %s returned %s\n", url, resp.Status)
+	}
+}
+
+// register adds the /approvals endpoints to mux:
+//
+//	GET  /approvals       list pending approvals
+//	GET  /approvals/{id}  show one approval
+//	POST /approvals/{id}  decide: {"decision": "approve|reject|correct", "message": "..."}
+func (h *httpApprover) register(mux *http.ServeMux) {
+	mux.HandleFunc("/approvals", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(h.pending())
+	})
+
+	mux.HandleFunc("/approvals/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/approvals/")
+		p := h.get(id)
+		if p == nil {
+			http.Error(w, "approval not found or no longer pending", http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(p)
+		case http.MethodPost:
+			var d approvalDecision
+			if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+				http.Error(w, fmt.Sprintf("invalid decision: %v", err), http.StatusBadRequest)
+				return
+			}
+			response, err := d.response()
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid decision: %v", err), http.StatusBadRequest)
+				return
+			}
+			if !h.decide(id, response) {
+				http.Error(w, "approval no longer pending", http.StatusConflict)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"id": id, "status": "accepted"})
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func (h *httpApprover) close() {}
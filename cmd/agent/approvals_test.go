@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vinayprograms/agent/internal/checkpoint"
+	"github.com/vinayprograms/agent/internal/supervision"
+)
+
+func TestApprovalDecisionResponse(t *testing.T) {
+	tests := []struct {
+		d       approvalDecision
+		want    string
+		wantErr bool
+	}{
+		{approvalDecision{Decision: "approve"}, "approve", false},
+		{approvalDecision{Decision: "REJECT", Message: "too risky"}, "reject too risky", false},
+		{approvalDecision{Decision: "reject"}, "reject", false},
+		{approvalDecision{Decision: "correct", Message: "use staging"}, "correct: use staging", false},
+		{approvalDecision{Decision: "correct"}, "", true},
+		{approvalDecision{Decision: "maybe"}, "", true},
+	}
+	for _, tt := range tests {
+		got, err := tt.d.response()
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("%+v: got %q, %v", tt.d, got, err)
+		}
+	}
+}
+
+func TestHTTPApprover(t *testing.T) {
+	hooked := make(chan map[string]interface{}, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		hooked <- body
+	}))
+	defer webhook.Close()
+
+	h := newHTTPApprover(time.Minute, []string{webhook.URL})
+	mux := http.NewServeMux()
+	h.register(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	list := func() []pendingApproval {
+		resp, err := http.Get(srv.URL + "/approvals")
+		if err != nil {
+			t.Fatalf("GET /approvals: %v", err)
+		}
+		defer resp.Body.Close()
+		var out []pendingApproval
+		json.NewDecoder(resp.Body).Decode(&out)
+		return out
+	}
+
+	if got := list(); len(got) != 0 {
+		t.Fatalf("expected no pending approvals, got %d", len(got))
+	}
+
+	h.request(supervision.HumanRequest{
+		StepID:   "deploy",
+		Question: "Ship it?",
+		Pre:      &checkpoint.PreCheckpoint{StepID: "deploy", Approach: "rolling restart"},
+	})
+
+	pending := list()
+	if len(pending) != 1 || pending[0].StepID != "deploy" || pending[0].Question != "Ship it?" {
+		t.Fatalf("unexpected pending approvals: %+v", pending)
+	}
+	if pending[0].PreCheckpoint == nil || pending[0].PreCheckpoint.Approach != "rolling restart" {
+		t.Errorf("expected pre checkpoint in approval, got %+v", pending[0].PreCheckpoint)
+	}
+
+	select {
+	case body := <-hooked:
+		if body["event"] != "approval.pending" || body["path"] != "/approvals/"+pending[0].ID {
+			t.Errorf("unexpected webhook body: %v", body)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("webhook not notified")
+	}
+
+	post := func(id, body string) (int, string) {
+		resp, err := http.Post(srv.URL+"/approvals/"+id, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST: %v", err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(data)
+	}
+
+	if code, _ := post("apr-unknown", `{"decision":"approve"}`); code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown approval, got %d", code)
+	}
+	if code, _ := post(pending[0].ID, `{"decision":"maybe"}`); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid decision, got %d", code)
+	}
+	if code, body := post(pending[0].ID, `{"decision":"correct","message":"canary first"}`); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", code, body)
+	}
+	if answer := <-h.answers(); answer != "correct: canary first" {
+		t.Errorf("unexpected answer %q", answer)
+	}
+	if got := list(); len(got) != 0 {
+		t.Errorf("expected approval to be cleared after decision, got %d", len(got))
+	}
+}
+
+func TestHTTPApprover_Expires(t *testing.T) {
+	h := newHTTPApprover(time.Millisecond, nil)
+	h.request(supervision.HumanRequest{StepID: "deploy"})
+	time.Sleep(5 * time.Millisecond)
+	if len(h.pending()) != 0 {
+		t.Error("expected approval to expire after the human timeout")
+	}
+}
+
+func TestHTTPApprover_ListsEveryPendingApproval(t *testing.T) {
+	h := newHTTPApprover(time.Minute, nil)
+	mux := http.NewServeMux()
+	h.register(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	deployReply, docsReply := make(chan string, 1), make(chan string, 1)
+	docsDone := make(chan struct{})
+	h.request(supervision.HumanRequest{StepID: "deploy", Reply: deployReply})
+	h.request(supervision.HumanRequest{StepID: "docs", Reply: docsReply, Done: docsDone})
+
+	list := func() []pendingApproval {
+		resp, err := http.Get(srv.URL + "/approvals")
+		if err != nil {
+			t.Fatalf("GET /approvals: %v", err)
+		}
+		defer resp.Body.Close()
+		var out []pendingApproval
+		json.NewDecoder(resp.Body).Decode(&out)
+		return out
+	}
+	pending := list()
+	if len(pending) != 2 || pending[0].StepID != "deploy" || pending[1].StepID != "docs" {
+		t.Fatalf("expected both approvals, oldest first, got %+v", pending)
+	}
+
+	// Each decision reaches the step it was addressed to
+	resp, err := http.Post(srv.URL+"/approvals/"+pending[1].ID, "application/json", strings.NewReader(`{"decision":"approve"}`))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST docs approval: %v %v", resp, err)
+	}
+	resp.Body.Close()
+	if answer := <-docsReply; answer != "approve" {
+		t.Errorf("unexpected docs answer %q", answer)
+	}
+	select {
+	case answer := <-deployReply:
+		t.Errorf("deploy got the docs decision %q", answer)
+	default:
+	}
+	if got := list(); len(got) != 1 || got[0].ID != pending[0].ID {
+		t.Errorf("expected only the deploy approval left, got %+v", got)
+	}
+
+	// A repeated request keeps its ID; an abandoned one disappears
+	h.request(supervision.HumanRequest{StepID: "deploy", Reply: deployReply, Retry: "unrecognized"})
+	if got := list(); len(got) != 1 || got[0].ID != pending[0].ID || got[0].Retry == "" {
+		t.Errorf("expected the re-prompt to replace the deploy approval, got %+v", got)
+	}
+	close(docsDone)
+	h.request(supervision.HumanRequest{StepID: "docs", Reply: docsReply, Done: docsDone})
+	time.Sleep(10 * time.Millisecond)
+	if got := list(); len(got) != 1 || got[0].StepID != "deploy" {
+		t.Errorf("expected the abandoned approval removed, got %+v", got)
+	}
+}
@@ -22,6 +22,7 @@ type CLI struct {
 	Keygen   KeygenCmd
 	Setup    SetupCmd
 	Replay   ReplayCmd
+	Rollback RollbackCmd
 	Version  VersionCmd
 }
 
@@ -33,6 +34,9 @@ type RunCmd struct {
 	Workspace string
 	Goal      string
 	Debug     bool
+	Approvals string
+	Resume    string
+	DryRun    bool
 	File      string
 }
 
@@ -109,6 +113,13 @@ type ReplayCmd struct {
 	Cost    []string
 }
 
+// RollbackCmd restores a session's workspace from a snapshot.
+type RollbackCmd struct {
+	Session string
+	To      string
+	Config  string
+}
+
 // VersionCmd shows version information.
 type VersionCmd struct{}
 
@@ -138,6 +149,9 @@ func buildRunCmd(cli *CLI, action func() error) *cobra.Command {
 	cmd.Flags().StringVar(&cli.Run.Workspace, "workspace", "", "Workspace directory")
 	cmd.Flags().StringVar(&cli.Run.Goal, "goal", "", "Inline goal description (skips Agentfile)")
 	cmd.Flags().BoolVar(&cli.Run.Debug, "debug", false, "Enable verbose logging (prompts, responses, tool outputs)")
+	cmd.Flags().StringVar(&cli.Run.Resume, "resume", "", "Resume an interrupted run by session ID, skipping completed goals")
+	cmd.Flags().BoolVar(&cli.Run.DryRun, "dry-run", false, "Record side-effecting tool calls in a plan instead of executing them")
+	cmd.Flags().StringVar(&cli.Run.Approvals, "approvals", "", "Human approvals for SUPERVISED HUMAN: terminal, file:<path>, socket:<path> or none")
 	return cmd
 }
 
@@ -326,6 +340,25 @@ func buildReplayCmd(cli *CLI, action func() error) *cobra.Command {
 	return cmd
 }
 
+// buildRollbackCmd creates the rollback subcommand.
+func buildRollbackCmd(cli *CLI, action func() error) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rollback <session>",
+		Short: "Restore the workspace to its snapshot before a step",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cli.Rollback.Session = args[0]
+			if action != nil {
+				return action()
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&cli.Rollback.To, "to", "", "Step name or snapshot ID to restore (omit to list snapshots)")
+	cmd.Flags().StringVar(&cli.Rollback.Config, "config", "", "Config file path (for the state location)")
+	return cmd
+}
+
 // buildVersionCmd creates the version subcommand.
 func buildVersionCmd(cli *CLI, action func() error) *cobra.Command {
 	cmd := &cobra.Command{
@@ -364,6 +397,7 @@ func newRootCmd() (*cobra.Command, *CLI) {
 		buildKeygenCmd(cli, func() error { return cli.Keygen.Run(rctx) }),
 		buildSetupCmd(cli, func() error { return cli.Setup.Run(rctx) }),
 		buildReplayCmd(cli, func() error { return cli.Replay.Run(rctx) }),
+		buildRollbackCmd(cli, func() error { return cli.Rollback.Run(rctx) }),
 		buildVersionCmd(cli, func() error { return cli.Version.Run(rctx) }),
 	)
 	return root, cli
@@ -389,6 +423,7 @@ func parseTestRoot() (*cobra.Command, *CLI) {
 		buildKeygenCmd(cli, nil),
 		buildSetupCmd(cli, nil),
 		buildReplayCmd(cli, nil),
+		buildRollbackCmd(cli, nil),
 		buildVersionCmd(cli, nil),
 	)
 	return root, cli
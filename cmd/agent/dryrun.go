@@ -0,0 +1,55 @@
+// Dry runs: the plan of intended mutations recorded by `agent run --dry-run`.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/vinayprograms/agent/internal/executor"
+)
+
+// statePlan is the session state key holding a dry run's plan.
+const statePlan = "plan"
+
+// recordPlan stores the plan of a dry run in the session state, persisted
+// with the session footer, and prints it for review.
+func (rt *runtime) recordPlan() {
+	plan := rt.exec.Plan()
+	if plan == nil {
+		return
+	}
+	if rt.sess.State == nil {
+		rt.sess.State = make(map[string]interface{})
+	}
+	rt.sess.State[statePlan] = plan
+	printPlan(os.Stderr, plan)
+}
+
+func printPlan(w io.Writer, plan *executor.Plan) {
+	fmt.Fprintf(w, "\nDry run plan (nothing was changed):\n")
+	for _, g := range plan.Goals {
+		fmt.Fprintf(w, "\n  %s\n", g.Goal)
+		if g.Interpretation != "" {
+			fmt.Fprintf(w, "    intent:   %s\n", g.Interpretation)
+		}
+		if g.Approach != "" {
+			fmt.Fprintf(w, "    approach: %s\n", g.Approach)
+		}
+		if len(g.Actions) == 0 {
+			fmt.Fprintf(w, "    (no side effects)\n")
+		}
+		for _, a := range g.Actions {
+			summary := a.Summary
+			if a.Agent != "" {
+				summary = fmt.Sprintf("[%s] %s", a.Agent, summary)
+			}
+			if a.Denied != "" {
+				fmt.Fprintf(w, "    ✗ %s (denied: %s)\n", summary, a.Denied)
+			} else {
+				fmt.Fprintf(w, "    • %s\n", summary)
+			}
+		}
+	}
+	fmt.Fprintf(w, "\nCalls allowed by policy: %d (run without --dry-run to execute them)\n", plan.Mutations())
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/vinayprograms/agent/internal/executor"
+)
+
+func TestRunCmd_DryRun(t *testing.T) {
+	cli, err := parseArgs([]string{"run", "--dry-run", "build.agent"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cli.Run.DryRun || cli.Run.File != "build.agent" {
+		t.Errorf("unexpected run args: %+v", cli.Run)
+	}
+}
+
+func TestPrintPlan(t *testing.T) {
+	plan := &executor.Plan{Goals: []*executor.PlanGoal{
+		{Goal: "fetch", Interpretation: "Download the data"},
+		{Goal: "build", Actions: []executor.PlannedAction{
+			{Tool: "write", Summary: "write main.go (12 bytes)"},
+			{Tool: "bash", Summary: "bash: go test ./...", Agent: "tester"},
+			{Tool: "rm", Summary: "rm /etc", Denied: "path /etc is outside allowed directories"},
+		}},
+	}}
+	var buf bytes.Buffer
+	printPlan(&buf, plan)
+	out := buf.String()
+	for _, want := range []string{
+		"intent:   Download the data",
+		"(no side effects)",
+		"• write main.go (12 bytes)",
+		"• [tester] bash: go test ./...",
+		"✗ rm /etc (denied: path /etc is outside allowed directories)",
+		"Calls allowed by policy: 2",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("plan output missing %q:\n%s", want, out)
+		}
+	}
+}
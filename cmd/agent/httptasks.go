@@ -0,0 +1,501 @@
+// Asynchronous task API for agent serve --http: tasks are queued, run in
+// the background and tracked by ID, so long workflows outlive proxy
+// timeouts and can be cancelled. Task records are persisted as JSON files
+// so they survive a restart.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vinayprograms/agent/internal/session"
+	"github.com/vinayprograms/agentkit/tasks"
+)
+
+// Task lifecycle states.
+const (
+	taskQueued    = "queued"
+	taskRunning   = "running"
+	taskSucceeded = "succeeded"
+	taskFailed    = "failed"
+	taskCancelled = "cancelled"
+)
+
+// finishedTaskRetention is how long the records of finished tasks are kept.
+const finishedTaskRetention = 7 * 24 * time.Hour
+
+var (
+	errTaskNotFound = errors.New("task not found")
+	errTaskExists   = errors.New("task already exists")
+	errTaskFinished = errors.New("task already finished")
+	errQueueClosed  = errors.New("agent is draining, not accepting tasks")
+)
+
+// asyncTask is the persisted record of a submitted task.
+type asyncTask struct {
+	ID         string             `json:"id"`
+	Status     string             `json:"status"`
+	Task       *tasks.TaskMessage `json:"task"`
+	Result     *tasks.TaskResult  `json:"result,omitempty"`
+	Error      string             `json:"error,omitempty"`
+	CreatedAt  time.Time          `json:"created_at"`
+	StartedAt  *time.Time         `json:"started_at,omitempty"`
+	FinishedAt *time.Time         `json:"finished_at,omitempty"`
+
+	cancelRequested bool
+}
+
+// finished reports whether the task has reached a final state.
+func (t *asyncTask) finished() bool {
+	return t.Status == taskSucceeded || t.Status == taskFailed || t.Status == taskCancelled
+}
+
+// expired reports whether a finished task is past finishedTaskRetention.
+func (t *asyncTask) expired() bool {
+	if !t.finished() {
+		return false
+	}
+	at := t.CreatedAt
+	if t.FinishedAt != nil {
+		at = *t.FinishedAt
+	}
+	return time.Since(at) > finishedTaskRetention
+}
+
+// taskRunner executes one task; the context is cancelled on DELETE.
+// onEvent receives the task's session events as they are recorded.
+type taskRunner func(ctx context.Context, task *tasks.TaskMessage, onEvent func(session.Event)) *tasks.TaskResult
+
+// taskQueue runs submitted tasks in submission order on a fixed number of
+// workers.
+type taskQueue struct {
+	dir        string // one <id>.json per task
+	capability string // default capability for submitted tasks
+	run        taskRunner
+
+	mu      sync.Mutex
+	tasks   map[string]*asyncTask
+	pending []string // queued task IDs, oldest first
+	cancels map[string]context.CancelFunc
+	streams map[string]*eventStream // live events of queued, running and recently finished tasks
+	ended   []string                // finished task IDs that still have a stream, oldest first
+	closed  bool
+	wake    chan struct{}
+}
+
+// newTaskQueue loads the task records in dir. Queued tasks are queued
+// again; tasks that were running when the agent stopped are marked failed.
+// Records of tasks that finished more than finishedTaskRetention ago are
+// deleted.
+func newTaskQueue(dir, capability string, run taskRunner) (*taskQueue, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating task directory: %w", err)
+	}
+	q := &taskQueue{
+		dir:        dir,
+		capability: capability,
+		run:        run,
+		tasks:      make(map[string]*asyncTask),
+		cancels:    make(map[string]context.CancelFunc),
+		streams:    make(map[string]*eventStream),
+		wake:       make(chan struct{}, 1),
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading task directory: %w", err)
+	}
+	var queued []*asyncTask
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		var t asyncTask
+		if err := json.Unmarshal(data, &t); err != nil || t.ID == "" {
+			fmt.Fprintf(os.Stderr, "warning: skipping unreadable task record %s\n", entry.Name())
+			continue
+		}
+		switch t.Status {
+		case taskQueued:
+			queued = append(queued, &t)
+		case taskRunning:
+			now := time.Now()
+			t.Status = taskFailed
+			t.Error = "interrupted: agent stopped while the task was running"
+			t.FinishedAt = &now
+			q.save(&t)
+		}
+		if t.expired() {
+			os.Remove(filepath.Join(dir, entry.Name()))
+			continue
+		}
+		q.tasks[t.ID] = &t
+	}
+	sort.Slice(queued, func(i, j int) bool { return queued[i].CreatedAt.Before(queued[j].CreatedAt) })
+	for _, t := range queued {
+		q.pending = append(q.pending, t.ID)
+		q.streams[t.ID] = newEventStream()
+	}
+	return q, nil
+}
+
+// start runs queued tasks on the given number of workers until ctx is done.
+func (q *taskQueue) start(ctx context.Context, workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				if id, ok := q.next(); ok {
+					q.execute(ctx, id)
+					continue
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-q.wake:
+				}
+			}
+		}()
+	}
+}
+
+// next pops the oldest queued task, unless the queue is closed.
+func (q *taskQueue) next() (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed || len(q.pending) == 0 {
+		return "", false
+	}
+	id := q.pending[0]
+	q.pending = q.pending[1:]
+	if len(q.pending) > 0 {
+		q.signal() // another worker may be idle
+	}
+	return id, true
+}
+
+// execute runs one task and records its outcome.
+func (q *taskQueue) execute(ctx context.Context, id string) {
+	q.mu.Lock()
+	t := q.tasks[id]
+	if t == nil || t.Status != taskQueued {
+		q.mu.Unlock()
+		return
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	now := time.Now()
+	t.Status = taskRunning
+	t.StartedAt = &now
+	q.cancels[id] = cancel
+	q.save(t)
+	task := t.Task
+	stream := q.streams[id]
+	q.mu.Unlock()
+
+	result := q.run(runCtx, task, stream.publish)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.cancels, id)
+	finished := time.Now()
+	t.Result = result
+	t.FinishedAt = &finished
+	switch {
+	case t.cancelRequested:
+		t.Status = taskCancelled
+	case result != nil && result.Status == tasks.ResultSuccess:
+		t.Status = taskSucceeded
+	default:
+		t.Status = taskFailed
+		if result != nil {
+			t.Error = result.Error
+		}
+	}
+	q.save(t)
+	q.endStream(id)
+	q.prune()
+}
+
+// submit queues a task. A missing task ID is generated and a missing
+// capability defaults to the agent's.
+func (q *taskQueue) submit(task *tasks.TaskMessage) (*asyncTask, error) {
+	if task.TaskID == "" {
+		task.TaskID = "task-" + generateShortID()
+	}
+	if task.Capability == "" {
+		task.Capability = q.capability
+	}
+	if err := task.Validate(); err != nil {
+		return nil, err
+	}
+	if !validTaskID(task.TaskID) {
+		return nil, fmt.Errorf("task_id may only contain letters, digits, '.', '_' and '-', got %q", task.TaskID)
+	}
+	if task.SubmittedAt.IsZero() {
+		task.SubmittedAt = time.Now()
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil, errQueueClosed
+	}
+	if _, exists := q.tasks[task.TaskID]; exists {
+		return nil, errTaskExists
+	}
+	t := &asyncTask{
+		ID:        task.TaskID,
+		Status:    taskQueued,
+		Task:      task,
+		CreatedAt: time.Now(),
+	}
+	q.tasks[t.ID] = t
+	q.pending = append(q.pending, t.ID)
+	q.streams[t.ID] = newEventStream()
+	q.save(t)
+
+	q.signal()
+	cp := *t
+	return &cp, nil
+}
+
+// validTaskID reports whether a task ID is safe to use as a file name and
+// URL path segment.
+func validTaskID(id string) bool {
+	if id == "" || id == "." || id == ".." {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '.', r == '_', r == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// signal wakes an idle worker.
+func (q *taskQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// get returns a copy of a task record.
+func (q *taskQueue) get(id string) (*asyncTask, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	t, ok := q.tasks[id]
+	if !ok {
+		return nil, errTaskNotFound
+	}
+	cp := *t
+	return &cp, nil
+}
+
+// list returns copies of all task records with the given status (all if
+// empty), newest first.
+func (q *taskQueue) list(status string) []*asyncTask {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	list := make([]*asyncTask, 0, len(q.tasks))
+	for _, t := range q.tasks {
+		if status != "" && t.Status != status {
+			continue
+		}
+		cp := *t
+		list = append(list, &cp)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
+
+// cancel stops a task. A queued task is cancelled at once; a running task
+// has its context cancelled and is marked cancelled when its run returns.
+func (q *taskQueue) cancel(id string) (*asyncTask, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	t, ok := q.tasks[id]
+	if !ok {
+		return nil, errTaskNotFound
+	}
+	if t.finished() {
+		return nil, errTaskFinished
+	}
+	t.cancelRequested = true
+	switch t.Status {
+	case taskQueued:
+		for i, pid := range q.pending {
+			if pid == id {
+				q.pending = append(q.pending[:i], q.pending[i+1:]...)
+				break
+			}
+		}
+		now := time.Now()
+		t.Status = taskCancelled
+		t.FinishedAt = &now
+		q.save(t)
+		q.endStream(id)
+		q.prune()
+	case taskRunning:
+		if cancel := q.cancels[id]; cancel != nil {
+			cancel()
+		}
+	}
+	cp := *t
+	return &cp, nil
+}
+
+// stream returns a task's event stream, or nil if its events were not kept.
+func (q *taskQueue) stream(id string) *eventStream {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.streams[id]
+}
+
+// endStream closes a finished task's event stream, keeping the streams of
+// the most recently finished tasks for late subscribers. Callers hold q.mu.
+func (q *taskQueue) endStream(id string) {
+	stream, ok := q.streams[id]
+	if !ok {
+		return
+	}
+	stream.close()
+	q.ended = append(q.ended, id)
+	for len(q.ended) > finishedTaskStreams {
+		delete(q.streams, q.ended[0])
+		q.ended = q.ended[1:]
+	}
+}
+
+// prune deletes the records of tasks that finished more than
+// finishedTaskRetention ago, so a long-running agent doesn't keep every
+// task it ever ran. Callers hold q.mu.
+func (q *taskQueue) prune() {
+	for id, t := range q.tasks {
+		if !t.expired() {
+			continue
+		}
+		delete(q.tasks, id)
+		delete(q.streams, id)
+		if err := os.Remove(filepath.Join(q.dir, id+".json")); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "warning: failed to delete task record %s: %v\n", id, err)
+		}
+	}
+}
+
+// close stops accepting and starting tasks. Queued tasks stay on disk and
+// run after the next start.
+func (q *taskQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+}
+
+// save writes a task record atomically. Callers hold q.mu.
+func (q *taskQueue) save(t *asyncTask) {
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err == nil {
+		path := filepath.Join(q.dir, t.ID+".json")
+		tmp := path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0644); err == nil {
+			err = os.Rename(tmp, path)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to persist task %s: %v\n", t.ID, err)
+	}
+}
+
+// register adds the task endpoints to mux:
+//
+//	POST   /tasks       submit a task, returns 202 with its ID
+//	GET    /tasks       list tasks (?status=queued|running|succeeded|failed|cancelled)
+//	GET    /tasks/{id}         task status and result
+//	DELETE /tasks/{id}         cancel a queued or running task
+//	GET    /tasks/{id}/events  live events (SSE, or WebSocket on upgrade)
+func (q *taskQueue) register(mux *http.ServeMux) {
+	mux.HandleFunc("/tasks", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, q.list(r.URL.Query().Get("status")))
+		case http.MethodPost:
+			var task tasks.TaskMessage
+			if err := json.NewDecoder(r.Body).Decode(&task); err != nil {
+				http.Error(w, fmt.Sprintf("invalid task: %v", err), http.StatusBadRequest)
+				return
+			}
+			t, err := q.submit(&task)
+			switch {
+			case errors.Is(err, errQueueClosed):
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			case errors.Is(err, errTaskExists):
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			case err != nil:
+				http.Error(w, fmt.Sprintf("invalid task: %v", err), http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Location", "/tasks/"+t.ID)
+			writeJSON(w, http.StatusAccepted, t)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/tasks/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/tasks/")
+		if taskID, ok := strings.CutSuffix(id, "/events"); ok {
+			q.serveEvents(w, r, taskID)
+			return
+		}
+		var t *asyncTask
+		var err error
+		status := http.StatusOK
+		switch r.Method {
+		case http.MethodGet:
+			t, err = q.get(id)
+		case http.MethodDelete:
+			t, err = q.cancel(id)
+			status = http.StatusAccepted
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		switch {
+		case errors.Is(err, errTaskNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, errTaskFinished):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			writeJSON(w, status, t)
+		}
+	})
+}
+
+// writeJSON writes v as a JSON response with the given status.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vinayprograms/agent/internal/session"
+	"github.com/vinayprograms/agentkit/tasks"
+)
+
+// blockingRunner runs tasks until released or cancelled.
+type blockingRunner struct {
+	started chan string
+	release chan struct{}
+}
+
+func newBlockingRunner() *blockingRunner {
+	return &blockingRunner{started: make(chan string, 10), release: make(chan struct{})}
+}
+
+func (b *blockingRunner) run(ctx context.Context, task *tasks.TaskMessage, onEvent func(session.Event)) *tasks.TaskResult {
+	b.started <- task.TaskID
+	if onEvent != nil {
+		onEvent(session.Event{SeqID: 1, Type: session.EventGoalStart, Goal: "run", Content: task.Inputs["msg"]})
+	}
+	select {
+	case <-b.release:
+		result := tasks.NewTaskResult(task.TaskID, "agent-1", tasks.ResultSuccess)
+		result.Outputs = map[string]string{"echo": task.Inputs["msg"]}
+		return result
+	case <-ctx.Done():
+		result := tasks.NewTaskResult(task.TaskID, "agent-1", tasks.ResultFailed)
+		result.Error = ctx.Err().Error()
+		return result
+	}
+}
+
+func waitForStatus(t *testing.T, q *taskQueue, id, status string) *asyncTask {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if task, err := q.get(id); err == nil && task.Status == status {
+			return task
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	task, _ := q.get(id)
+	t.Fatalf("task %s: expected status %s, got %+v", id, status, task)
+	return nil
+}
+
+func TestTaskQueue_HTTP(t *testing.T) {
+	runner := newBlockingRunner()
+	q, err := newTaskQueue(t.TempDir(), "echo", runner.run)
+	if err != nil {
+		t.Fatalf("newTaskQueue: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.start(ctx, 1)
+
+	mux := http.NewServeMux()
+	q.register(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/tasks", "application/json", strings.NewReader(`{"inputs": {"msg": "hi"}}`))
+	if err != nil {
+		t.Fatalf("POST /tasks: %v", err)
+	}
+	var submitted asyncTask
+	json.NewDecoder(resp.Body).Decode(&submitted)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted || submitted.ID == "" {
+		t.Fatalf("expected 202 with an ID, got %d %+v", resp.StatusCode, submitted)
+	}
+	if resp.Header.Get("Location") != "/tasks/"+submitted.ID {
+		t.Errorf("unexpected Location %q", resp.Header.Get("Location"))
+	}
+	if submitted.Task.Capability != "echo" {
+		t.Errorf("expected default capability, got %q", submitted.Task.Capability)
+	}
+
+	<-runner.started
+	close(runner.release)
+	waitForStatus(t, q, submitted.ID, taskSucceeded)
+
+	resp, err = http.Get(srv.URL + "/tasks/" + submitted.ID)
+	if err != nil {
+		t.Fatalf("GET /tasks/{id}: %v", err)
+	}
+	var got asyncTask
+	json.NewDecoder(resp.Body).Decode(&got)
+	resp.Body.Close()
+	if got.Result == nil || got.FinishedAt == nil {
+		t.Fatalf("expected a finished task with a result, got %+v", got)
+	}
+	if outputs, _ := got.Result.Outputs.(map[string]interface{}); outputs["echo"] != "hi" {
+		t.Errorf("unexpected outputs %v", got.Result.Outputs)
+	}
+
+	resp, _ = http.Get(srv.URL + "/tasks?status=succeeded")
+	var list []asyncTask
+	json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if len(list) != 1 || list[0].ID != submitted.ID {
+		t.Errorf("expected one succeeded task, got %+v", list)
+	}
+
+	// Finished tasks can't be cancelled; unknown tasks are 404
+	req, _ := http.NewRequest(http.MethodDelete, srv.URL+"/tasks/"+submitted.ID, nil)
+	if resp, _ := http.DefaultClient.Do(req); resp.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409 cancelling a finished task, got %d", resp.StatusCode)
+	}
+	if resp, _ := http.Get(srv.URL + "/tasks/nope"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", resp.StatusCode)
+	}
+
+	// Duplicate IDs are rejected
+	body := `{"task_id": "` + submitted.ID + `", "inputs": {}}`
+	if resp, _ := http.Post(srv.URL+"/tasks", "application/json", strings.NewReader(body)); resp.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409 for duplicate task ID, got %d", resp.StatusCode)
+	}
+
+	// IDs become file names: anything that could leave the task directory
+	// is rejected
+	for _, id := range []string{"../../x", "a/b", "..", `a\\b`} {
+		body := `{"task_id": "` + id + `", "inputs": {}}`
+		if resp, _ := http.Post(srv.URL+"/tasks", "application/json", strings.NewReader(body)); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected 400 for task ID %q, got %d", id, resp.StatusCode)
+		}
+	}
+}
+
+func TestTaskQueue_Cancel(t *testing.T) {
+	runner := newBlockingRunner()
+	q, err := newTaskQueue(t.TempDir(), "echo", runner.run)
+	if err != nil {
+		t.Fatalf("newTaskQueue: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.start(ctx, 1)
+
+	running, _ := q.submit(&tasks.TaskMessage{TaskID: "t1"})
+	queued, _ := q.submit(&tasks.TaskMessage{TaskID: "t2"})
+	<-runner.started
+
+	// A queued task is cancelled at once and never runs
+	if got, err := q.cancel(queued.ID); err != nil || got.Status != taskCancelled {
+		t.Fatalf("cancel queued: %+v, %v", got, err)
+	}
+
+	// A running task has its context cancelled
+	if _, err := q.cancel(running.ID); err != nil {
+		t.Fatalf("cancel running: %v", err)
+	}
+	waitForStatus(t, q, running.ID, taskCancelled)
+
+	select {
+	case id := <-runner.started:
+		t.Errorf("cancelled task %s should not run", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestTaskQueue_SurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	runner := newBlockingRunner()
+	q, err := newTaskQueue(dir, "echo", runner.run)
+	if err != nil {
+		t.Fatalf("newTaskQueue: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	q.start(ctx, 1)
+
+	q.submit(&tasks.TaskMessage{TaskID: "running", Inputs: map[string]string{}})
+	q.submit(&tasks.TaskMessage{TaskID: "queued", Inputs: map[string]string{"msg": "later"}})
+	<-runner.started
+	q.close()
+	cancel()
+	waitForStatus(t, q, "running", taskFailed)
+
+	if _, err := os.Stat(filepath.Join(dir, "queued.json")); err != nil {
+		t.Fatalf("expected task record on disk: %v", err)
+	}
+
+	// Simulate a crash mid-task: the record still says running
+	data, _ := os.ReadFile(filepath.Join(dir, "running.json"))
+	var rec asyncTask
+	json.Unmarshal(data, &rec)
+	rec.Status = taskRunning
+	rec.Result = nil
+	data, _ = json.Marshal(rec)
+	os.WriteFile(filepath.Join(dir, "running.json"), data, 0644)
+
+	runner2 := newBlockingRunner()
+	close(runner2.release)
+	q2, err := newTaskQueue(dir, "echo", runner2.run)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	interrupted, _ := q2.get("running")
+	if interrupted.Status != taskFailed || !strings.Contains(interrupted.Error, "interrupted") {
+		t.Errorf("expected interrupted task marked failed, got %+v", interrupted)
+	}
+
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	q2.start(ctx2, 1)
+	done := waitForStatus(t, q2, "queued", taskSucceeded)
+	if outputs, _ := done.Result.Outputs.(map[string]string); outputs["echo"] != "later" {
+		t.Errorf("unexpected outputs %v", done.Result.Outputs)
+	}
+}
+
+func TestTaskQueue_PrunesFinishedTasks(t *testing.T) {
+	dir := t.TempDir()
+	longAgo := time.Now().Add(-finishedTaskRetention - time.Hour)
+	recently := time.Now().Add(-time.Hour)
+	for _, rec := range []asyncTask{
+		{ID: "old", Status: taskSucceeded, CreatedAt: longAgo, FinishedAt: &longAgo},
+		{ID: "recent", Status: taskFailed, CreatedAt: recently, FinishedAt: &recently},
+		{ID: "waiting", Status: taskQueued, CreatedAt: longAgo, Task: &tasks.TaskMessage{TaskID: "waiting"}},
+	} {
+		data, _ := json.Marshal(rec)
+		os.WriteFile(filepath.Join(dir, rec.ID+".json"), data, 0644)
+	}
+
+	runner := newBlockingRunner()
+	close(runner.release)
+	q, err := newTaskQueue(dir, "echo", runner.run)
+	if err != nil {
+		t.Fatalf("newTaskQueue: %v", err)
+	}
+	if _, err := q.get("old"); err != errTaskNotFound {
+		t.Error("expected the expired task dropped on load")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.json")); !os.IsNotExist(err) {
+		t.Error("expected the expired task record deleted")
+	}
+	if _, err := q.get("recent"); err != nil {
+		t.Error("expected the recently finished task kept")
+	}
+
+	// Expire the recent task; the next task to finish prunes it
+	q.mu.Lock()
+	q.tasks["recent"].FinishedAt = &longAgo
+	q.mu.Unlock()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.start(ctx, 1)
+	waitForStatus(t, q, "waiting", taskSucceeded)
+
+	if _, err := q.get("recent"); err != errTaskNotFound {
+		t.Error("expected the expired task pruned")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "recent.json")); !os.IsNotExist(err) {
+		t.Error("expected the expired task record deleted")
+	}
+	if _, err := q.get("waiting"); err != nil {
+		t.Error("expected the queued task kept however old")
+	}
+}
+
+func TestTaskQueue_Workers(t *testing.T) {
+	runner := newBlockingRunner()
+	q, err := newTaskQueue(t.TempDir(), "echo", runner.run)
+	if err != nil {
+		t.Fatalf("newTaskQueue: %v", err)
+	}
+	// Submitted before start, so one wake-up has to reach both workers
+	q.submit(&tasks.TaskMessage{TaskID: "a"})
+	q.submit(&tasks.TaskMessage{TaskID: "b"})
+	q.submit(&tasks.TaskMessage{TaskID: "c"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.start(ctx, 2)
+
+	got := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case id := <-runner.started:
+			got[id] = true
+		case <-time.After(2 * time.Second):
+			t.Fatalf("expected two tasks running at once, got %v", got)
+		}
+	}
+	if !got["a"] || !got["b"] {
+		t.Errorf("expected the two oldest tasks to run first, got %v", got)
+	}
+	if task, _ := q.get("c"); task.Status != taskQueued {
+		t.Errorf("third task should wait for a free worker, got %s", task.Status)
+	}
+
+	close(runner.release)
+	waitForStatus(t, q, "c", taskSucceeded)
+}
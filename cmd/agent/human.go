@@ -0,0 +1,334 @@
+// Human-in-the-loop input for SUPERVISED HUMAN: an interactive terminal
+// prompt, or a watched file / unix socket for non-interactive runs (CI).
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vinayprograms/agent/internal/supervision"
+)
+
+// humanFilePollInterval is how often the file approver checks for an answer.
+const humanFilePollInterval = 500 * time.Millisecond
+
+// humanInput delivers human decisions to the supervisor. request presents
+// a pending decision without blocking; the answer arrives on answers().
+type humanInput interface {
+	request(req supervision.HumanRequest)
+	answers() chan string
+	close()
+}
+
+// parseHumanInputSpec parses "terminal", "file:<path>", "socket:<path>" or
+// "none" into a mode and path.
+func parseHumanInputSpec(spec string) (mode, path string, err error) {
+	mode, path, _ = strings.Cut(spec, ":")
+	switch mode {
+	case "terminal", "none":
+		if path != "" {
+			return "", "", fmt.Errorf("human input %q takes no path", mode)
+		}
+	case "file", "socket":
+		if path == "" {
+			return "", "", fmt.Errorf("human input %q requires a path (%s:<path>)", mode, mode)
+		}
+	default:
+		return "", "", fmt.Errorf("unknown human input %q (want terminal, file:<path>, socket:<path> or none)", spec)
+	}
+	return mode, path, nil
+}
+
+// newHumanInput creates the human input for a parsed spec. Returns nil for "none".
+func newHumanInput(mode, path string) (humanInput, error) {
+	switch mode {
+	case "terminal":
+		return newTerminalApprover(os.Stdin, os.Stderr), nil
+	case "file":
+		return newFileApprover(path)
+	case "socket":
+		return newSocketApprover(path)
+	}
+	return nil, nil
+}
+
+// stdinIsTerminal reports whether stdin is attached to a terminal.
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// humanBridge tracks the pending request and hands answers to the
+// supervisor. Shared by all human inputs.
+type humanBridge struct {
+	mu      sync.Mutex
+	pending *supervision.HumanRequest
+	ch      chan string
+}
+
+func newHumanBridge() humanBridge {
+	return humanBridge{ch: make(chan string, 1)}
+}
+
+func (b *humanBridge) answers() chan string { return b.ch }
+
+// present records req as pending, dropping any answer left over from a
+// request the supervisor stopped waiting for.
+func (b *humanBridge) present(req supervision.HumanRequest) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	select {
+	case <-b.ch:
+	default:
+	}
+	b.pending = &req
+}
+
+// current returns the pending request, or nil.
+func (b *humanBridge) current() *supervision.HumanRequest {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.pending
+}
+
+// answer delivers a response to the pending request.
+// Returns false if nothing is pending.
+func (b *humanBridge) answer(response string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pending == nil {
+		return false
+	}
+	b.pending = nil
+	select {
+	case b.ch <- response:
+	default:
+	}
+	return true
+}
+
+// formatHumanRequest renders a request for a person to read.
+func formatHumanRequest(req supervision.HumanRequest) string {
+	var sb strings.Builder
+	label := "Supervisor needs a decision"
+	if req.HumanRequired {
+		label = "Human approval required"
+	}
+	fmt.Fprintf(&sb, "\n━━━ %s: %s ━━━\n", label, req.StepID)
+	if req.Retry != "" {
+		fmt.Fprintf(&sb, "Previous answer refused: %s\n", req.Retry)
+	}
+	if req.Question != "" {
+		fmt.Fprintf(&sb, "Question: %s\n", req.Question)
+	}
+	rec := string(req.Recommendation)
+	if req.Correction != "" {
+		rec += " — " + req.Correction
+	}
+	fmt.Fprintf(&sb, "Supervisor recommends: %s\n", rec)
+	if len(req.Triggers) > 0 {
+		fmt.Fprintf(&sb, "Triggers: %s\n", strings.Join(req.Triggers, ", "))
+	}
+	if req.Diff != "" {
+		sb.WriteString("Commitment (-) vs outcome (+):\n")
+		for _, line := range strings.Split(req.Diff, "\n") {
+			fmt.Fprintf(&sb, "  %s\n", line)
+		}
+	}
+	return sb.String()
+}
+
+// terminalApprover prompts on the terminal and reads the decision from stdin.
+type terminalApprover struct {
+	humanBridge
+	in        io.Reader
+	out       io.Writer
+	startOnce sync.Once
+}
+
+func newTerminalApprover(in io.Reader, out io.Writer) *terminalApprover {
+	return &terminalApprover{humanBridge: newHumanBridge(), in: in, out: out}
+}
+
+const terminalPrompt = "[a]pprove, [r]eject <reason>, or [c]orrect <guidance>: "
+
+func (t *terminalApprover) request(req supervision.HumanRequest) {
+	t.present(req)
+	fmt.Fprint(t.out, formatHumanRequest(req))
+	fmt.Fprint(t.out, terminalPrompt)
+	// stdin is only read once a decision is actually needed
+	t.startOnce.Do(func() { go t.readLoop() })
+}
+
+// readLoop reads decisions from stdin for as long as the run lasts.
+func (t *terminalApprover) readLoop() {
+	scanner := bufio.NewScanner(t.in)
+	awaitingCorrection := false
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if t.current() == nil {
+			continue
+		}
+		if awaitingCorrection {
+			if line == "" {
+				fmt.Fprint(t.out, "Correction: ")
+				continue
+			}
+			awaitingCorrection = false
+			t.answer(supervision.HumanCorrect + ": " + line)
+			continue
+		}
+		switch strings.ToLower(line) {
+		case "":
+			fmt.Fprint(t.out, terminalPrompt)
+			continue
+		case "c", supervision.HumanCorrect:
+			awaitingCorrection = true
+			fmt.Fprint(t.out, "Correction: ")
+			continue
+		}
+		if _, err := supervision.ParseHumanResponse(line); err != nil {
+			fmt.Fprintf(t.out, "%v\n%s", err, terminalPrompt)
+			continue
+		}
+		t.answer(line)
+	}
+}
+
+func (t *terminalApprover) close() {}
+
+// fileApprover publishes the pending request next to a watched file and
+// takes the decision from the file's contents. The file is removed once
+// read, so each decision is used once.
+type fileApprover struct {
+	humanBridge
+	path string
+	stop chan struct{}
+}
+
+func newFileApprover(path string) (*fileApprover, error) {
+	f := &fileApprover{humanBridge: newHumanBridge(), path: path, stop: make(chan struct{})}
+	// A stale answer from an earlier run must not approve this one
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("clearing human input file: %w", err)
+	}
+	go f.watch()
+	return f, nil
+}
+
+// pendingPath is where the pending request is published as JSON.
+func (f *fileApprover) pendingPath() string { return f.path + ".pending.json" }
+
+func (f *fileApprover) request(req supervision.HumanRequest) {
+	f.present(req)
+	data, _ := json.MarshalIndent(req, "", "  ")
+	if err := os.WriteFile(f.pendingPath(), data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to publish pending approval: %v\n", err)
+	}
+	fmt.Fprintf(os.Stderr, "⏸ Waiting for a decision on %q: write approve, reject <reason> or correct <guidance> to %s\n",
+		req.StepID, f.path)
+}
+
+// watch polls the file for a decision while a request is pending.
+func (f *fileApprover) watch() {
+	ticker := time.NewTicker(humanFilePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+		}
+		if f.current() == nil {
+			continue
+		}
+		data, err := os.ReadFile(f.path)
+		if err != nil || strings.TrimSpace(string(data)) == "" {
+			continue
+		}
+		os.Remove(f.path)
+		os.Remove(f.pendingPath())
+		f.answer(strings.TrimSpace(string(data)))
+	}
+}
+
+func (f *fileApprover) close() {
+	close(f.stop)
+	os.Remove(f.pendingPath())
+}
+
+// socketApprover serves decisions over a unix socket. On connect the
+// server writes the pending request as one JSON line (or {"pending":false}),
+// then reads one decision line and replies "ok" or "error: ...".
+type socketApprover struct {
+	humanBridge
+	path string
+	ln   net.Listener
+}
+
+func newSocketApprover(path string) (*socketApprover, error) {
+	os.Remove(path) // stale socket from an earlier run
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("listening on human input socket: %w", err)
+	}
+	s := &socketApprover{humanBridge: newHumanBridge(), path: path, ln: ln}
+	go s.serve()
+	return s, nil
+}
+
+func (s *socketApprover) request(req supervision.HumanRequest) {
+	s.present(req)
+	fmt.Fprintf(os.Stderr, "⏸ Waiting for a decision on %q via socket %s\n", req.StepID, s.path)
+}
+
+func (s *socketApprover) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return // listener closed
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *socketApprover) handle(conn net.Conn) {
+	defer conn.Close()
+
+	if req := s.current(); req != nil {
+		data, _ := json.Marshal(req)
+		fmt.Fprintf(conn, "%s\n", data)
+	} else {
+		fmt.Fprintln(conn, `{"pending":false}`)
+	}
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	line = strings.TrimSpace(line)
+	if line == "" {
+		if err == nil {
+			fmt.Fprintln(conn, "error: empty decision")
+		}
+		return
+	}
+	if _, err := supervision.ParseHumanResponse(line); err != nil {
+		fmt.Fprintf(conn, "error: %v\n", err)
+		return
+	}
+	if !s.answer(line) {
+		fmt.Fprintln(conn, "error: no approval pending")
+		return
+	}
+	fmt.Fprintln(conn, "ok")
+}
+
+func (s *socketApprover) close() {
+	s.ln.Close()
+	os.Remove(s.path)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vinayprograms/agent/internal/agentfile"
+	"github.com/vinayprograms/agent/internal/config"
+	"github.com/vinayprograms/agent/internal/supervision"
+)
+
+func TestParseHumanInputSpec(t *testing.T) {
+	tests := []struct {
+		spec, mode, path string
+		wantErr          bool
+	}{
+		{"terminal", "terminal", "", false},
+		{"none", "none", "", false},
+		{"file:/tmp/answer", "file", "/tmp/answer", false},
+		{"socket:/tmp/agent.sock", "socket", "/tmp/agent.sock", false},
+		{"file", "", "", true},
+		{"terminal:/dev/tty", "", "", true},
+		{"slack", "", "", true},
+	}
+	for _, tt := range tests {
+		mode, path, err := parseHumanInputSpec(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: err = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if mode != tt.mode || path != tt.path {
+			t.Errorf("%q: got (%q, %q), want (%q, %q)", tt.spec, mode, path, tt.mode, tt.path)
+		}
+	}
+}
+
+func TestCreateHumanInput_TerminalRequiresRun(t *testing.T) {
+	rt := &runtime{
+		cfg:       &config.Config{},
+		wf:        &agentfile.Workflow{Name: "test"},
+		approvals: "terminal",
+	}
+	if _, err := rt.createHumanInput(); err == nil {
+		t.Error("expected terminal approvals to be rejected outside agent run")
+	}
+
+	rt.approvals = ""
+	human, err := rt.createHumanInput()
+	if err != nil || human != nil {
+		t.Errorf("expected no human input by default when serving, got %v, %v", human, err)
+	}
+}
+
+func TestTerminalApprover(t *testing.T) {
+	in := strings.NewReader("\nlgtm\nc\nonly touch docs/\n")
+	var out strings.Builder
+	ta := newTerminalApprover(in, &out)
+
+	ta.request(supervision.HumanRequest{StepID: "docs", Question: "Proceed?", Recommendation: supervision.VerdictPause, Diff: "- approach: edit"})
+	select {
+	case answer := <-ta.answers():
+		if answer != "correct: only touch docs/" {
+			t.Errorf("unexpected answer %q", answer)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no answer from terminal")
+	}
+	for _, want := range []string{"docs", "Proceed?", "- approach: edit", "[a]pprove", `unrecognized response "lgtm"`} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("prompt missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestFileApprover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "approval")
+	os.WriteFile(path, []byte("approve"), 0644) // stale answer from an earlier run
+
+	fa, err := newFileApprover(path)
+	if err != nil {
+		t.Fatalf("newFileApprover: %v", err)
+	}
+	defer fa.close()
+
+	fa.request(supervision.HumanRequest{StepID: "deploy", HumanRequired: true})
+	data, err := os.ReadFile(fa.pendingPath())
+	if err != nil {
+		t.Fatalf("pending request not published: %v", err)
+	}
+	var pending supervision.HumanRequest
+	if err := json.Unmarshal(data, &pending); err != nil || pending.StepID != "deploy" {
+		t.Fatalf("unexpected pending request %s (%v)", data, err)
+	}
+
+	os.WriteFile(path, []byte("reject not today\n"), 0644)
+	select {
+	case answer := <-fa.answers():
+		if answer != "reject not today" {
+			t.Errorf("unexpected answer %q", answer)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("no answer from file")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("expected answer file to be consumed")
+	}
+}
+
+func TestSocketApprover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "approvals.sock")
+	sa, err := newSocketApprover(path)
+	if err != nil {
+		t.Fatalf("newSocketApprover: %v", err)
+	}
+	defer sa.close()
+
+	send := func(decision string) (string, string) {
+		conn, err := net.Dial("unix", path)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		pending, _ := r.ReadString('\n')
+		conn.Write([]byte(decision + "\n"))
+		reply, _ := r.ReadString('\n')
+		return strings.TrimSpace(pending), strings.TrimSpace(reply)
+	}
+
+	if pending, reply := send("approve"); pending != `{"pending":false}` || !strings.HasPrefix(reply, "error") {
+		t.Errorf("expected no pending request, got %q / %q", pending, reply)
+	}
+
+	sa.request(supervision.HumanRequest{StepID: "deploy"})
+	if _, reply := send("ship it"); !strings.HasPrefix(reply, "error: unrecognized response") {
+		t.Errorf("expected free text to be refused, got %q", reply)
+	}
+	pending, reply := send("approve")
+	if !strings.Contains(pending, `"step_id":"deploy"`) || reply != "ok" {
+		t.Errorf("unexpected exchange %q / %q", pending, reply)
+	}
+	if answer := <-sa.answers(); answer != "approve" {
+		t.Errorf("unexpected answer %q", answer)
+	}
+}
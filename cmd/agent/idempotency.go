@@ -0,0 +1,171 @@
+// Idempotent task execution for service agents: tasks carrying an
+// idempotency_key run at most once per key. Successful results are kept on
+// disk, so a resubmission after a restart gets the earlier result instead
+// of repeating the work and its side effects.
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vinayprograms/agentkit/tasks"
+)
+
+// idempotencyRetention is how long a cached result answers duplicates.
+const idempotencyRetention = 7 * 24 * time.Hour
+
+// idempotencyEntry is the persisted result for one key.
+type idempotencyEntry struct {
+	Key      string            `json:"key"`
+	Result   *tasks.TaskResult `json:"result"`
+	StoredAt time.Time         `json:"stored_at"`
+}
+
+// inflightRun is an execution that duplicates can attach to.
+type inflightRun struct {
+	done   chan struct{}
+	result *tasks.TaskResult
+}
+
+// idempotencyStore deduplicates tasks by idempotency key.
+type idempotencyStore struct {
+	dir     string // one <sha256(key)>.json per completed key
+	agentID string
+
+	mu       sync.Mutex
+	inflight map[string]*inflightRun
+}
+
+// newIdempotencyStore opens the store in dir and drops expired entries.
+func newIdempotencyStore(dir, agentID string) (*idempotencyStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating idempotency directory: %w", err)
+	}
+	s := &idempotencyStore{dir: dir, agentID: agentID, inflight: make(map[string]*inflightRun)}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading idempotency directory: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if e, ok := readIdempotencyEntry(path); !ok || time.Since(e.StoredAt) > idempotencyRetention {
+			os.Remove(path)
+		}
+	}
+	return s, nil
+}
+
+// do returns the result for task's idempotency key. A key with a stored
+// result returns it without running; a key that is already running waits
+// for that execution; otherwise run is called and a successful result is
+// stored. Failures are not stored, so a failed task can be resubmitted.
+func (s *idempotencyStore) do(ctx context.Context, task *tasks.TaskMessage, run func() *tasks.TaskResult) *tasks.TaskResult {
+	key := task.IdempotencyKey
+
+	s.mu.Lock()
+	if e, ok := s.lookup(key); ok {
+		s.mu.Unlock()
+		fmt.Fprintf(os.Stderr, "  ↺ Task %s duplicates %s (idempotency key %q), returning cached result\n", task.TaskID, e.Result.TaskID, key)
+		return duplicateResult(task, e.Result)
+	}
+	if r, ok := s.inflight[key]; ok {
+		s.mu.Unlock()
+		fmt.Fprintf(os.Stderr, "  ↺ Task %s duplicates a running task (idempotency key %q), waiting for it\n", task.TaskID, key)
+		select {
+		case <-r.done:
+			return duplicateResult(task, r.result)
+		case <-ctx.Done():
+			result := tasks.NewTaskResult(task.TaskID, s.agentID, tasks.ResultFailed)
+			result.CorrelationID = task.CorrelationID
+			result.Attempt = task.Attempt
+			result.Error = ctx.Err().Error()
+			return result
+		}
+	}
+	r := &inflightRun{done: make(chan struct{})}
+	s.inflight[key] = r
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.inflight, key)
+		s.mu.Unlock()
+		close(r.done)
+	}()
+	r.result = run()
+	if r.result.Status == tasks.ResultSuccess {
+		if err := s.store(key, r.result); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: failed to persist result for idempotency key %q: %v\n", key, err)
+		}
+	}
+	return r.result
+}
+
+// lookup returns the unexpired stored result for key. Callers hold s.mu.
+func (s *idempotencyStore) lookup(key string) (*idempotencyEntry, bool) {
+	e, ok := readIdempotencyEntry(s.path(key))
+	if !ok || e.Key != key || e.Result == nil || time.Since(e.StoredAt) > idempotencyRetention {
+		return nil, false
+	}
+	return e, true
+}
+
+func (s *idempotencyStore) store(key string, result *tasks.TaskResult) error {
+	data, err := json.MarshalIndent(idempotencyEntry{Key: key, Result: result, StoredAt: time.Now()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := s.path(key)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// path hashes the key so any string is a safe file name.
+func (s *idempotencyStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func readIdempotencyEntry(path string) (*idempotencyEntry, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	var e idempotencyEntry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, false
+	}
+	return &e, true
+}
+
+// duplicateResult readdresses the original result to the duplicate task,
+// recording which task produced it.
+func duplicateResult(task *tasks.TaskMessage, original *tasks.TaskResult) *tasks.TaskResult {
+	result := *original
+	result.TaskID = task.TaskID
+	result.CorrelationID = task.CorrelationID
+	result.Attempt = task.Attempt
+	result.Metadata = make(map[string]string, len(original.Metadata)+1)
+	for k, v := range original.Metadata {
+		result.Metadata[k] = v
+	}
+	if original.TaskID != task.TaskID {
+		result.Metadata["deduplicated_from"] = original.TaskID
+	}
+	return &result
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vinayprograms/agentkit/tasks"
+)
+
+func TestIdempotencyStore_CachedResult(t *testing.T) {
+	dir := t.TempDir()
+	store, err := newIdempotencyStore(dir, "agent-1")
+	if err != nil {
+		t.Fatalf("newIdempotencyStore: %v", err)
+	}
+
+	var runs int32
+	run := func() *tasks.TaskResult {
+		atomic.AddInt32(&runs, 1)
+		r := tasks.NewTaskResult("t1", "agent-1", tasks.ResultSuccess)
+		r.Outputs = "42"
+		return r
+	}
+	first := store.do(context.Background(), &tasks.TaskMessage{TaskID: "t1", IdempotencyKey: "k"}, run)
+	if first.Outputs != "42" {
+		t.Fatalf("unexpected first result %+v", first)
+	}
+
+	// A reopened store answers from disk without running
+	store, _ = newIdempotencyStore(dir, "agent-1")
+	dup := store.do(context.Background(), &tasks.TaskMessage{TaskID: "t2", IdempotencyKey: "k", CorrelationID: "c2"}, run)
+	if runs != 1 {
+		t.Errorf("expected one run, got %d", runs)
+	}
+	if dup.TaskID != "t2" || dup.CorrelationID != "c2" || dup.Outputs != "42" {
+		t.Errorf("expected cached result readdressed to t2, got %+v", dup)
+	}
+	if dup.Metadata["deduplicated_from"] != "t1" {
+		t.Errorf("expected deduplicated_from=t1, got %v", dup.Metadata)
+	}
+
+	store.do(context.Background(), &tasks.TaskMessage{TaskID: "t3", IdempotencyKey: "other"}, run)
+	if runs != 2 {
+		t.Errorf("a different key should run, got %d runs", runs)
+	}
+}
+
+func TestIdempotencyStore_FailuresNotCached(t *testing.T) {
+	store, _ := newIdempotencyStore(t.TempDir(), "agent-1")
+	var runs int32
+	run := func() *tasks.TaskResult {
+		atomic.AddInt32(&runs, 1)
+		return tasks.NewTaskResult("t", "agent-1", tasks.ResultFailed)
+	}
+	store.do(context.Background(), &tasks.TaskMessage{TaskID: "t1", IdempotencyKey: "k"}, run)
+	store.do(context.Background(), &tasks.TaskMessage{TaskID: "t2", IdempotencyKey: "k"}, run)
+	if runs != 2 {
+		t.Errorf("failed tasks should run again, got %d runs", runs)
+	}
+}
+
+func TestIdempotencyStore_AttachesToInflight(t *testing.T) {
+	store, _ := newIdempotencyStore(t.TempDir(), "agent-1")
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var runs int32
+	run := func() *tasks.TaskResult {
+		atomic.AddInt32(&runs, 1)
+		close(started)
+		<-release
+		r := tasks.NewTaskResult("t1", "agent-1", tasks.ResultSuccess)
+		r.Outputs = "42"
+		return r
+	}
+
+	go store.do(context.Background(), &tasks.TaskMessage{TaskID: "t1", IdempotencyKey: "k"}, run)
+	<-started
+
+	got := make(chan *tasks.TaskResult)
+	go func() {
+		got <- store.do(context.Background(), &tasks.TaskMessage{TaskID: "t2", IdempotencyKey: "k"}, run)
+	}()
+	select {
+	case r := <-got:
+		t.Fatalf("duplicate returned before the original finished: %+v", r)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+
+	select {
+	case r := <-got:
+		if r.TaskID != "t2" || r.Outputs != "42" {
+			t.Errorf("unexpected attached result %+v", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("duplicate never returned")
+	}
+	if runs != 1 {
+		t.Errorf("expected one run, got %d", runs)
+	}
+
+	// A waiter whose context ends gives up without affecting the run
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	store2, _ := newIdempotencyStore(t.TempDir(), "agent-1")
+	block := make(chan struct{})
+	begun := make(chan struct{})
+	go store2.do(context.Background(), &tasks.TaskMessage{TaskID: "a", IdempotencyKey: "k"}, func() *tasks.TaskResult {
+		close(begun)
+		<-block
+		return tasks.NewTaskResult("a", "agent-1", tasks.ResultSuccess)
+	})
+	<-begun
+	if r := store2.do(ctx, &tasks.TaskMessage{TaskID: "b", IdempotencyKey: "k"}, run); r.Status != tasks.ResultFailed {
+		t.Errorf("expected cancelled waiter to fail, got %+v", r)
+	}
+	close(block)
+}
@@ -69,6 +69,9 @@ func printWorkflowInfo(wf *agentfile.Workflow) {
 			if len(goal.UsingAgent) > 0 {
 				fmt.Printf(" [using: %s]", strings.Join(goal.UsingAgent, ", "))
 			}
+			if goal.HasFailurePolicy() {
+				fmt.Printf(" [%s]", goalPolicy(goal))
+			}
 			fmt.Println()
 		}
 		fmt.Println()
@@ -77,14 +80,52 @@ func printWorkflowInfo(wf *agentfile.Workflow) {
 	if len(wf.Steps) > 0 {
 		fmt.Println("Steps:")
 		for _, step := range wf.Steps {
-			printStep(step)
+			printStep(wf, step)
 		}
 	}
 }
 
-func printStep(step agentfile.Step) {
-	if step.Type == agentfile.StepRUN {
+// goalPolicy describes a goal's RETRY/TIMEOUT/ON FAILURE modifiers.
+func goalPolicy(goal agentfile.Goal) string {
+	var parts []string
+	if goal.Retry > 0 {
+		parts = append(parts, fmt.Sprintf("retry %d", goal.Retry))
+	}
+	if goal.Timeout > 0 {
+		parts = append(parts, fmt.Sprintf("timeout %s", goal.Timeout))
+	}
+	if goal.OnFailure != "" {
+		parts = append(parts, fmt.Sprintf("on failure: %s", goal.OnFailure))
+	}
+	if goal.MaxTurns > 0 {
+		parts = append(parts, fmt.Sprintf("max %d turns", goal.MaxTurns))
+	}
+	if goal.MaxTokens > 0 {
+		parts = append(parts, fmt.Sprintf("max %d tokens", goal.MaxTokens))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func printStep(wf *agentfile.Workflow, step agentfile.Step) {
+	switch step.Type {
+	case agentfile.StepRUN:
 		fmt.Printf("  RUN %s: %s\n", step.Name, strings.Join(step.UsingGoals, ", "))
+	case agentfile.StepLOOP:
+		within := "$" + step.WithinVar
+		if step.WithinLimit != nil {
+			within = fmt.Sprintf("%d", *step.WithinLimit)
+		}
+		fmt.Printf("  LOOP %s: %s (within %s)\n", step.Name, strings.Join(step.UsingGoals, ", "), within)
+	case agentfile.StepPARALLEL:
+		fmt.Printf("  PARALLEL %s: %s\n", step.Name, strings.Join(step.UsingGoals, ", "))
+		deps := wf.GoalDependencies(step.UsingGoals)
+		for _, goal := range step.UsingGoals {
+			if len(deps[goal]) == 0 {
+				fmt.Printf("    %s\n", goal)
+			} else {
+				fmt.Printf("    %s <- %s\n", goal, strings.Join(deps[goal], ", "))
+			}
+		}
 	}
 }
 
@@ -153,6 +194,11 @@ func printPackageOutputs(m *packaging.Manifest) {
 	fmt.Println("Outputs:")
 	for name, output := range m.Outputs {
 		fmt.Printf("  - %s", name)
+		if len(output.Enum) > 0 {
+			fmt.Printf(" (%s: %s)", output.Type, strings.Join(output.Enum, ", "))
+		} else if output.Type != "" {
+			fmt.Printf(" (%s)", output.Type)
+		}
 		if output.Description != "" {
 			fmt.Printf(": %s", output.Description)
 		}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/joho/godotenv"
 	"github.com/vinayprograms/agent/internal/agentfile"
+	"github.com/vinayprograms/agent/internal/sandbox"
 	"github.com/vinayprograms/agentkit/credentials"
 )
 
@@ -22,6 +23,11 @@ var (
 var globalCreds *credentials.Credentials
 
 func init() {
+	// Sandboxed bash commands re-execute this binary as their init; it must
+	// take over before loading credentials or .env. The sandbox passes
+	// commands only PATH, HOME, LANG and TERM, so API keys don't leak in
+	sandbox.Init()
+
 	// Load credentials from standard locations
 	// Priority: credentials.toml > env vars (handled by GetAPIKey)
 	creds, path, err := credentials.Load()
@@ -59,6 +65,10 @@ func (c *RunCmd) Run(ctx *runContext) error {
 		policyPath:    c.Policy,
 		workspacePath: c.Workspace,
 		debug:         c.Debug,
+		approvals:     c.Approvals,
+		interactive:   true,
+		resumeID:      c.Resume,
+		dryRun:        c.DryRun,
 	}
 
 	// Handle inline goal (skip Agentfile if provided)
@@ -158,6 +168,11 @@ func (c *ReplayCmd) Run(ctx *runContext) error {
 	return runReplay(c.Session, c.Verbose, c.NoPager, c.Cost)
 }
 
+// Run executes the rollback command.
+func (c *RollbackCmd) Run(ctx *runContext) error {
+	return runRollback(c)
+}
+
 // Run executes the version command.
 func (c *VersionCmd) Run(ctx *runContext) error {
 	fmt.Printf("agent version %s (commit: %s, built: %s)\n", version, commit, buildTime)
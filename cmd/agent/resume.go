@@ -0,0 +1,68 @@
+// Resuming interrupted runs: reload the session, restore inputs, and let
+// the executor skip goals that already completed.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/vinayprograms/agent/internal/executor"
+	"github.com/vinayprograms/agent/internal/session"
+)
+
+// Session state keys recorded so a run can be resumed.
+const (
+	stateAgentfileHash = "agentfile_hash"
+	stateInputs        = "inputs"
+)
+
+// recordRunState stores what a resume needs beyond the event log: the
+// Agentfile hash and the run's inputs. Persisted with the session footer.
+func (rt *runtime) recordRunState() {
+	if rt.sess.State == nil {
+		rt.sess.State = make(map[string]interface{})
+	}
+	if rt.agentfileHash != "" {
+		rt.sess.State[stateAgentfileHash] = rt.agentfileHash
+	}
+	if len(rt.inputs) > 0 {
+		rt.sess.State[stateInputs] = rt.inputs
+	}
+}
+
+// resumeSession loads the session to continue and rebuilds its progress.
+// Inputs not given on the command line are restored from the session.
+func (rt *runtime) resumeSession() (*executor.Resume, error) {
+	sess, err := rt.sessionMgr.Get(rt.resumeID)
+	if err != nil {
+		return nil, fmt.Errorf("loading session %s to resume: %w", rt.resumeID, err)
+	}
+	if sess.WorkflowName != "" && sess.WorkflowName != rt.wf.Name {
+		return nil, fmt.Errorf("session %s belongs to workflow %q, not %q", rt.resumeID, sess.WorkflowName, rt.wf.Name)
+	}
+
+	if prev, _ := sess.State[stateAgentfileHash].(string); prev != "" && rt.agentfileHash != "" && prev != rt.agentfileHash {
+		fmt.Fprintf(os.Stderr, "⚠ Agentfile has changed since session %s started; completed goals will not be re-run\n", sess.ID)
+	}
+
+	if saved, ok := sess.State[stateInputs].(map[string]interface{}); ok {
+		if rt.inputs == nil {
+			rt.inputs = make(map[string]string)
+		}
+		for k, v := range saved {
+			if _, set := rt.inputs[k]; !set {
+				if s, ok := v.(string); ok {
+					rt.inputs[k] = s
+				}
+			}
+		}
+	}
+
+	sess.Status = session.StatusRunning
+	sess.Error = ""
+	rt.sess = sess
+
+	resume := executor.ResumeFromSession(sess)
+	fmt.Fprintf(os.Stderr, "↻ Resuming session %s (%d goals already completed)\n", sess.ID, resume.Completed())
+	return resume, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/vinayprograms/agent/internal/agentfile"
+	"github.com/vinayprograms/agent/internal/session"
+)
+
+func TestResumeSession(t *testing.T) {
+	mgr := session.NewFileManager(t.TempDir())
+	first := &runtime{
+		wf:            &agentfile.Workflow{Name: "report"},
+		inputs:        map[string]string{"topic": "rust", "depth": "shallow"},
+		agentfileHash: "abc",
+		sessionMgr:    mgr,
+	}
+	sess, err := mgr.Create("report")
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	first.sess = sess
+	first.recordRunState()
+	sess.AddEvent(session.Event{Type: session.EventGoalEnd, Goal: "fetch"})
+	sess.SetOutput("fetch", "data")
+	sess.Status = session.StatusFailed
+	mgr.Update(sess)
+
+	rt := &runtime{
+		wf:            &agentfile.Workflow{Name: "report"},
+		inputs:        map[string]string{"depth": "deep"},
+		agentfileHash: "abc",
+		sessionMgr:    mgr,
+		resumeID:      sess.ID,
+	}
+	resume, err := rt.resumeSession()
+	if err != nil {
+		t.Fatalf("resumeSession: %v", err)
+	}
+	if resume.Completed() != 1 {
+		t.Errorf("expected 1 completed goal, got %d", resume.Completed())
+	}
+	if rt.inputs["topic"] != "rust" || rt.inputs["depth"] != "deep" {
+		t.Errorf("expected saved inputs with CLI override, got %v", rt.inputs)
+	}
+	if rt.sess.ID != sess.ID || rt.sess.Status != session.StatusRunning {
+		t.Errorf("expected resumed session to be running, got %s %s", rt.sess.ID, rt.sess.Status)
+	}
+
+	rt.wf.Name = "other"
+	if _, err := rt.resumeSession(); err == nil {
+		t.Error("expected error resuming another workflow's session")
+	}
+	rt.resumeID = "missing"
+	if _, err := rt.resumeSession(); err == nil {
+		t.Error("expected error for unknown session")
+	}
+}
@@ -0,0 +1,100 @@
+// Rolling back the workspace to a snapshot taken before a supervised step.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vinayprograms/agent/internal/config"
+	"github.com/vinayprograms/agent/internal/snapshot"
+)
+
+// runRollback restores the workspace of a session to the snapshot taken
+// before step (a step name or snapshot ID). Without a step, it lists the
+// session's snapshots.
+func runRollback(c *RollbackCmd) error {
+	dir, err := findSnapshotDir(c.Session, c.Config)
+	if err != nil {
+		return err
+	}
+	store, err := snapshot.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	if c.To == "" {
+		list, err := store.List()
+		if err != nil {
+			return err
+		}
+		printSnapshots(store.Workspace(), list)
+		return nil
+	}
+
+	snap, err := store.Find(c.To)
+	if err != nil {
+		return err
+	}
+	res, err := store.Restore(snap.ID)
+	if err != nil {
+		return fmt.Errorf("rollback failed: %w", err)
+	}
+	fmt.Printf("✓ Restored %s to snapshot %s (before %q, %s)\n",
+		store.Workspace(), snap.ID, snap.Step, snap.Timestamp.Format("2006-01-02 15:04:05"))
+	fmt.Printf("  %d files written, %d removed\n", len(res.Written), len(res.Removed))
+	return nil
+}
+
+// findSnapshotDir locates a session's snapshots. ref is a session file
+// (as given to `agent replay`) or a session ID, looked up under the
+// state location of agent.toml.
+func findSnapshotDir(ref, configPath string) (string, error) {
+	if info, err := os.Stat(ref); err == nil && !info.IsDir() {
+		id := strings.TrimSuffix(filepath.Base(ref), filepath.Ext(ref))
+		return filepath.Join(filepath.Dir(ref), "snapshots", id), nil
+	}
+
+	cfg, err := loadRollbackConfig(configPath)
+	if err != nil {
+		return "", err
+	}
+	storage := cfg.State.Location
+	if storage == "" {
+		storage = "~/.local/grid"
+	}
+	sessions := filepath.Join(expandAbsPath(storage), "sessions")
+	matches, _ := filepath.Glob(filepath.Join(sessions, "*", "snapshots", ref))
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no snapshots for session %s under %s", ref, sessions)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("session %s is ambiguous: %s", ref, strings.Join(matches, ", "))
+	}
+}
+
+// loadRollbackConfig loads agent.toml for its state location, like `agent run`.
+func loadRollbackConfig(path string) (*config.Config, error) {
+	if path != "" {
+		return config.LoadFile(path)
+	}
+	cfg, err := config.LoadFile("agent.toml")
+	if errors.Is(err, fs.ErrNotExist) {
+		return config.Default(), nil
+	}
+	return cfg, err
+}
+
+func printSnapshots(workspace string, list []*snapshot.Snapshot) {
+	fmt.Printf("Snapshots of %s:\n", workspace)
+	for _, snap := range list {
+		fmt.Printf("  %s  %s  %-24s %d files\n",
+			snap.ID, snap.Timestamp.Format("2006-01-02 15:04:05"), snap.Step, len(snap.Files))
+	}
+	fmt.Println("\nRestore with: agent rollback <session> --to <step|id>")
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vinayprograms/agent/internal/snapshot"
+)
+
+func TestRollbackCmd(t *testing.T) {
+	cli, err := parseArgs([]string{"rollback", "abc123", "--to", "build"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cli.Rollback.Session != "abc123" || cli.Rollback.To != "build" {
+		t.Errorf("unexpected rollback args: %+v", cli.Rollback)
+	}
+	if _, err := parseArgs([]string{"rollback"}); err == nil {
+		t.Error("expected error without a session")
+	}
+}
+
+func TestRunRollback(t *testing.T) {
+	state := t.TempDir()
+	ws := t.TempDir()
+	notes := filepath.Join(ws, "notes.txt")
+	os.WriteFile(notes, []byte("v1"), 0644)
+
+	store, err := snapshot.NewStore(filepath.Join(state, "sessions", "report", "snapshots", "sess1"), ws, snapshot.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Take("fetch")
+	os.WriteFile(notes, []byte("v2"), 0644)
+	store.Take("analyze")
+	os.WriteFile(notes, []byte("v3"), 0644)
+
+	configPath := filepath.Join(t.TempDir(), "agent.toml")
+	os.WriteFile(configPath, []byte("[state]\nlocation = \""+state+"\"\n"), 0644)
+
+	if err := runRollback(&RollbackCmd{Session: "sess1", To: "analyze", Config: configPath}); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	if data, _ := os.ReadFile(notes); string(data) != "v2" {
+		t.Errorf("expected v2 after rollback to analyze, got %q", data)
+	}
+
+	// A session file path finds the snapshots next to it
+	sessFile := filepath.Join(state, "sessions", "report", "sess1.jsonl")
+	os.WriteFile(sessFile, nil, 0644)
+	if err := runRollback(&RollbackCmd{Session: sessFile, To: "0001"}); err != nil {
+		t.Fatalf("rollback by path: %v", err)
+	}
+	if data, _ := os.ReadFile(notes); string(data) != "v1" {
+		t.Errorf("expected v1 after rollback to 0001, got %q", data)
+	}
+
+	if err := runRollback(&RollbackCmd{Session: "sess1", To: "report", Config: configPath}); err == nil {
+		t.Error("expected error for a step without a snapshot")
+	}
+	if err := runRollback(&RollbackCmd{Session: "missing", Config: configPath}); err == nil {
+		t.Error("expected error for unknown session")
+	}
+}
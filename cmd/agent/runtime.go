@@ -15,10 +15,14 @@ import (
 	localtools "github.com/vinayprograms/agent/internal/tools"
 	"github.com/vinayprograms/agent/internal/checkpoint"
 	"github.com/vinayprograms/agent/internal/config"
+	"github.com/vinayprograms/agent/internal/dataflow"
 	"github.com/vinayprograms/agent/internal/executor"
 	"github.com/vinayprograms/agent/internal/hooks"
+	"github.com/vinayprograms/agent/internal/sandbox"
 	"github.com/vinayprograms/agent/internal/session"
+	"github.com/vinayprograms/agent/internal/snapshot"
 	"github.com/vinayprograms/agent/internal/supervision"
+	"github.com/vinayprograms/agent/internal/toolmeta"
 	"github.com/vinayprograms/agentkit/credentials"
 	"github.com/vinayprograms/agentkit/llm"
 	"github.com/vinayprograms/agentkit/mcp"
@@ -34,16 +38,29 @@ type runtime struct {
 	wf     *agentfile.Workflow
 	cfg    *config.Config
 	pol    *policy.Policy
+	flow   *dataflow.Policy
+	meta   *toolmeta.Catalog
+	sandbox *sandbox.Config // bash sandbox (nil = built-in bash)
 	creds  *credentials.Credentials
 	inputs map[string]string
 	debug        bool
 	sessionLabel string // Override session directory name
+	approvals    string // CLI --approvals override
+	interactive  bool   // attached to a user (agent run), not serving
+	human        humanInput // preset by serve --http; otherwise from createHumanInput
+	resumeID     string     // session to continue (agent run --resume)
+	dryRun       bool       // simulate side-effecting tools (agent run --dry-run)
+	agentfileHash string
 
 	// Components
 	provider       llm.Provider
 	smallLLM       llm.Provider
 	registry       *tools.Registry
+	summarizer     *llm.Summarizer // small_llm summarizer (nil if no small_llm)
+	scratchpad     tools.MemoryStore // session scratchpad, also holds compacted context
+	bashChecker    *policy.BashChecker
 	bashLLMChecker *policy.SmallLLMChecker
+	bashTool       *localtools.BashTool // replaces the built-in bash (nil = bash disabled)
 	telem          telemetry.Exporter
 	otelProvider   *telemetry.Provider // OpenTelemetry tracing provider
 	exec           *executor.Executor
@@ -51,6 +68,8 @@ type runtime struct {
 	sessionMgr     session.SessionManager
 	sess           *session.Session
 	secVerifier    *security.Verifier
+	secCfg         *security.Config // nil if the verifier could not be created
+	execCfg        executor.Config  // template for per-task executors (serve)
 
 	// Storage
 	storagePath string
@@ -67,10 +86,18 @@ func newRuntime(w *workflow, creds *credentials.Credentials) *runtime {
 		wf:           w.wf,
 		cfg:          w.cfg,
 		pol:          w.pol,
+		flow:         w.flow,
+		meta:         w.toolMeta,
+		sandbox:      w.sandbox,
 		creds:        creds,
 		inputs:       w.inputs,
 		debug:        w.debug,
 		sessionLabel: w.sessionLabel,
+		approvals:    w.approvals,
+		interactive:  w.interactive,
+		resumeID:     w.resumeID,
+		dryRun:       w.dryRun,
+		agentfileHash: w.agentfileHash,
 	}
 	rt.resolveStoragePath()
 	return rt
@@ -107,7 +134,9 @@ func (rt *runtime) setup() error {
 	if err := rt.createSmallLLM(); err != nil {
 		return err
 	}
-	rt.setupRegistry()
+	if err := rt.setupRegistry(); err != nil {
+		return err
+	}
 	if err := rt.setupMemory(); err != nil {
 		return err
 	}
@@ -117,7 +146,7 @@ func (rt *runtime) setup() error {
 	if err := rt.createExecutor(); err != nil {
 		return err
 	}
-	rt.setupCallbacks()
+	rt.setupCallbacks(rt.exec)
 	return nil
 }
 
@@ -146,6 +175,8 @@ func (rt *runtime) createProvider() error {
 	if err != nil {
 		return fmt.Errorf("creating LLM provider: %w", err)
 	}
+	// Supervision and wrap-ups count toward max_cost_per_run too
+	rt.provider = executor.MeterProvider(rt.provider)
 	return nil
 }
 
@@ -173,12 +204,14 @@ func (rt *runtime) createSmallLLM() error {
 	if err != nil {
 		return fmt.Errorf("failed to create small_llm (model=%s, provider=%s): %w", rt.cfg.SmallLLM.Model, smallProvider, err)
 	}
+	// Summaries, compaction and triage count toward max_cost_per_run
+	rt.smallLLM = executor.MeterProvider(rt.smallLLM)
 	fmt.Fprintf(os.Stderr, "✓ Small LLM: %s via %s (for summarization and security triage)\n", rt.cfg.SmallLLM.Model, smallProvider)
 	return nil
 }
 
 // setupRegistry creates and configures the tool registry.
-func (rt *runtime) setupRegistry() {
+func (rt *runtime) setupRegistry() error {
 	rt.registry = tools.NewRegistry(rt.pol)
 
 	// Bash is controlled by policy — set up security if enabled
@@ -187,25 +220,54 @@ func (rt *runtime) setupRegistry() {
 		rt.setupBashChecker()
 		if rt.smallLLM != nil {
 			rt.bashLLMChecker = policy.NewSmallLLMChecker(policy.LLMProviderFromChatProvider(rt.smallLLM))
-			rt.registry.SetBashLLMChecker(rt.bashLLMChecker)
+			rt.bashChecker.SetLLMChecker(rt.bashLLMChecker)
+		}
+		if err := rt.setupBashSandbox(); err != nil {
+			return err
 		}
 	}
 
-	var summarizer *llm.Summarizer
 	if rt.smallLLM != nil {
-		summarizer = llm.NewSummarizer(rt.smallLLM)
-		rt.registry.SetSummarizer(summarizer)
+		rt.summarizer = llm.NewSummarizer(rt.smallLLM)
+		rt.registry.SetSummarizer(rt.summarizer)
 	}
-	rt.registry.Register(localtools.NewWebFetch(rt.pol, summarizer))
+	rt.registry.Register(localtools.NewWebFetch(rt.pol, rt.summarizer))
 	rt.registry.Register(localtools.NewWebSearch(rt.pol, rt.cfg.Timeouts.SearchCooldownMS, rt.creds))
 	rt.registry.SetCredentials(rt.creds)
+	return nil
 }
 
 // setupBashChecker configures bash security with fail-close defaults.
 func (rt *runtime) setupBashChecker() {
 	bashPolicy := rt.pol.GetToolPolicy("bash")
-	bashChecker := policy.NewBashChecker(rt.pol, bashPolicy.Denylist)
-	rt.registry.SetBashChecker(bashChecker)
+	rt.bashChecker = policy.NewBashChecker(rt.pol, bashPolicy.Denylist)
+	// The full check runs in localtools.BashTool, which wraps the built-in
+	// bash; the built-in one only repeats the denylist
+	rt.registry.SetBashChecker(policy.NewBashChecker(rt.pol, bashPolicy.Denylist))
+}
+
+// setupBashSandbox replaces the built-in bash with localtools.BashTool,
+// sandboxed when policy.toml configures a sandbox. Fails closed: if the
+// sandbox cannot run on this host, neither does the agent.
+func (rt *runtime) setupBashSandbox() error {
+	if rt.sandbox == nil {
+		rt.bashTool = localtools.WrapBash(rt.registry.Get("bash"), rt.pol, rt.bashChecker)
+		rt.registry.Register(rt.bashTool)
+		return nil
+	}
+	sb, err := sandbox.New(*rt.sandbox, rt.cfg.Agent.Workspace)
+	if err != nil {
+		return fmt.Errorf("bash sandbox: %w", err)
+	}
+	rt.bashTool = localtools.NewBash(rt.pol, rt.bashChecker, sb)
+	rt.registry.Register(rt.bashTool)
+
+	network := "off"
+	if rt.sandbox.Network {
+		network = "on"
+	}
+	fmt.Printf("🔒 Bash sandbox: %s (network %s)\n", rt.sandbox.Backend, network)
+	return nil
 }
 
 // setupMemory configures scratchpad and semantic memory.
@@ -216,6 +278,7 @@ func (rt *runtime) setupMemory() error {
 	// Scratchpad: ephemeral (in-memory only, cleared each run)
 	kvStore := tools.NewInMemoryStore()
 	rt.registry.SetScratchpad(kvStore, false)
+	rt.scratchpad = kvStore
 
 	// BM25 semantic memory: always persistent
 	var err error
@@ -314,10 +377,18 @@ func (rt *runtime) createExecutor() error {
 	// --- Session ---
 	rt.sessionMgr = session.NewFileManager(rt.sessionPath)
 	var err error
-	rt.sess, err = rt.sessionMgr.Create(rt.wf.Name)
-	if err != nil {
-		return fmt.Errorf("creating session: %w", err)
+	var resume *executor.Resume
+	if rt.resumeID != "" {
+		if resume, err = rt.resumeSession(); err != nil {
+			return err
+		}
+	} else {
+		rt.sess, err = rt.sessionMgr.Create(rt.wf.Name)
+		if err != nil {
+			return fmt.Errorf("creating session: %w", err)
+		}
 	}
+	rt.recordRunState()
 
 	// --- Security ---
 	var secVerifier *security.Verifier
@@ -325,18 +396,20 @@ func (rt *runtime) createExecutor() error {
 	mode, scope, userTrust := rt.determineSecurityConfig()
 	triageProvider := rt.createTriageProvider()
 
-	verifier, verErr := security.NewVerifier(security.Config{
+	secCfg := security.Config{
 		Mode:               mode,
 		ResearchScope:      scope,
 		UserTrust:          userTrust,
 		TriageProvider:     triageProvider,
 		SupervisorProvider: rt.provider,
-	}, rt.sess.ID)
+	}
+	verifier, verErr := security.NewVerifier(secCfg, rt.sess.ID)
 	if verErr != nil {
 		fmt.Fprintf(os.Stderr, "warning: failed to create security verifier: %v\n", verErr)
 	} else {
 		secVerifier = verifier
 		rt.secVerifier = verifier
+		rt.secCfg = &secCfg
 		rt.addCloser(func() { verifier.Destroy() })
 
 		if mode == security.ModeResearch {
@@ -353,17 +426,33 @@ func (rt *runtime) createExecutor() error {
 	// --- Supervision ---
 	var checkpointStore checkpoint.CheckpointStore
 	var supervisor supervision.Supervisor
+	var snapshots *snapshot.Store
+	var human humanInput
 	if rt.wf.HasSupervisedGoals() {
 		checkpointDir := filepath.Join(rt.sessionPath, "checkpoints", rt.sess.ID)
 		cs, csErr := checkpoint.NewStore(checkpointDir)
 		if csErr != nil {
 			fmt.Fprintf(os.Stderr, "warning: failed to create checkpoint store: %v\n", csErr)
 		} else {
+			human, err = rt.createHumanInput()
+			if err != nil {
+				return err
+			}
+			supCfg := supervision.Config{
+				Provider:          rt.provider,
+				HumanInputTimeout: time.Duration(rt.cfg.Supervision.HumanTimeoutSeconds) * time.Second,
+			}
+			if human != nil {
+				supCfg.HumanAvailable = true
+				supCfg.HumanInputChan = human.answers()
+				supCfg.OnHumanRequest = human.request
+				// The HTTP gateway lists every waiting step by ID
+				_, supCfg.ConcurrentHumanRequests = human.(*httpApprover)
+			}
 			checkpointStore = cs
-			supervisor = supervision.NewLLMSupervisor(supervision.Config{
-				Provider: rt.provider,
-			})
+			supervisor = supervision.NewLLMSupervisor(supCfg)
 			fmt.Fprintf(os.Stderr, "👁 Supervision: enabled (four-phase execution)\n")
+			snapshots = rt.createSnapshotStore()
 		}
 	}
 
@@ -401,21 +490,56 @@ func (rt *runtime) createExecutor() error {
 		MCPManager:            mcpMgr,
 		Session:               rt.sess,
 		SessionManager:        rt.sessionMgr,
+		Resume:                resume,
 		SecurityVerifier:      secVerifier,
 		SecurityResearchScope: secResearchScope,
+		FlowPolicy:            rt.flow,
+		ToolMeta:              rt.meta,
 		TimeoutMCP:            rt.cfg.Timeouts.MCP,
 		TimeoutWebSearch:      rt.cfg.Timeouts.WebSearch,
 		TimeoutWebFetch:       rt.cfg.Timeouts.WebFetch,
+		MaxTurns:              rt.cfg.Budget.MaxTurns,
+		MaxTokensPerGoal:      rt.cfg.Budget.MaxTokensPerGoal,
+		MaxCostPerRun:         rt.cfg.Budget.MaxCostPerRun,
+		InputCostPer1M:        rt.cfg.Budget.InputCostPer1M,
+		OutputCostPer1M:       rt.cfg.Budget.OutputCostPer1M,
+		ContextWindows:        rt.cfg.Context.Windows,
+		CompactAt:             rt.cfg.Context.CompactAt,
+		KeepRecent:            rt.cfg.Context.KeepRecent,
+		ContextStore:          rt.scratchpad,
 		CheckpointStore:       checkpointStore,
 		Supervisor:            supervisor,
+		Snapshots:             snapshots,
+		RestoreOnReorient:     snapshots != nil && rt.cfg.Supervision.RestoreOnReorient,
+		ActiveGoals:           &executor.ActiveGoals{},
+		DryRun:                rt.dryRun,
 		ObservationExtractor:  obsExtractor,
 		ObservationStore:      obsStore,
 		WorkspaceContext:      wsCtx,
 	}
+	if human != nil {
+		cfg.HumanAvailable = true
+		cfg.HumanInputChan = human.answers()
+	}
+	if rt.summarizer != nil {
+		cfg.ContextSummarizer = rt.summarizer
+	}
+	rt.execCfg = cfg
 	rt.exec = executor.New(cfg)
-
-	// Wire bash security callback (needs exec reference)
-	rt.registry.SetBashSecurityCallback(rt.exec.LogBashSecurity)
+	if rt.dryRun {
+		fmt.Fprintf(os.Stderr, "🧪 Dry run: side-effecting tools are recorded in a plan, not executed\n")
+	}
+
+	// Wire bash security callbacks (need exec reference). Per-task
+	// executors share the tool, so LogBashSecurity logs to the executor
+	// running the command, found through ctx.
+	if rt.bashTool != nil {
+		logSecurity := rt.exec.LogBashSecurity
+		rt.bashTool.OnDecision = logSecurity
+		rt.bashTool.OnViolation = func(ctx context.Context, command, reason string, durationMs int64) {
+			logSecurity(ctx, command, "sandbox", false, reason, durationMs, 0, 0)
+		}
+	}
 
 	// Set HTTP client timeout to max of configured timeouts
 	maxTimeout := rt.cfg.Timeouts.MCP
@@ -432,6 +556,72 @@ func (rt *runtime) createExecutor() error {
 	return nil
 }
 
+// createSnapshotStore opens the session's workspace snapshot store when
+// [supervision] snapshots is on. Returns nil when off or on failure.
+func (rt *runtime) createSnapshotStore() *snapshot.Store {
+	sup := rt.cfg.Supervision
+	if !sup.Snapshots {
+		if sup.RestoreOnReorient {
+			fmt.Fprintf(os.Stderr, "warning: restore_on_reorient needs [supervision] snapshots = true\n")
+		}
+		return nil
+	}
+	dir := filepath.Join(rt.sessionPath, "snapshots", rt.sess.ID)
+	// Sessions, checkpoints and memory may live in the workspace; a restore
+	// must not roll them back
+	store, err := snapshot.NewStore(dir, rt.cfg.Agent.Workspace, snapshot.Options{
+		Exclude: sup.SnapshotExclude,
+		Protect: []string{rt.storagePath},
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to create snapshot store: %v\n", err)
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "📸 Snapshots: %s (rollback with: agent rollback %s --to <step>)\n", store.Workspace(), rt.sess.ID)
+	return store
+}
+
+// createHumanInput sets up where SUPERVISED HUMAN decisions come from:
+// a preset input (serve --http), --approvals, then [supervision] human_input,
+// then the terminal when `agent run` is attached to one. Returns nil when
+// no human is available.
+func (rt *runtime) createHumanInput() (humanInput, error) {
+	if rt.human != nil {
+		return rt.human, nil
+	}
+	spec := rt.approvals
+	if spec == "" && rt.cfg.Supervision.HumanInput != "" {
+		spec = rt.cfg.Supervision.HumanInput
+		if path := rt.cfg.Supervision.HumanInputPath; path != "" {
+			spec += ":" + path
+		}
+	}
+	if spec == "" {
+		spec = "none"
+		if rt.interactive && stdinIsTerminal() {
+			spec = "terminal"
+		}
+	}
+
+	mode, path, err := parseHumanInputSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	if mode == "terminal" && !rt.interactive {
+		return nil, fmt.Errorf("human input %q is only available with agent run", mode)
+	}
+	human, err := newHumanInput(mode, path)
+	if err != nil {
+		return nil, err
+	}
+	if human == nil {
+		return nil, nil
+	}
+	rt.addCloser(human.close)
+	fmt.Fprintf(os.Stderr, "🙋 Human approvals: %s\n", spec)
+	return human, nil
+}
+
 // profileProviderFactory creates providers based on capability profiles.
 type profileProviderFactory struct {
 	mu       sync.Mutex
@@ -526,34 +716,34 @@ func (rt *runtime) createTriageProvider() llm.Provider {
 			IsOAuthToken: triageCred.IsOAuthToken,
 			MaxTokens:    triageCfg.MaxTokens,
 		})
-		return provider
+		return executor.MeterProvider(provider)
 	}
 	return rt.smallLLM // May be nil
 }
 
 // setupCallbacks wires up telemetry and progress callbacks via hooks.
-func (rt *runtime) setupCallbacks() {
-	rt.exec.Hooks().On(hooks.SubAgentStart, func(_ context.Context, evt hooks.Event) {
+func (rt *runtime) setupCallbacks(exec *executor.Executor) {
+	exec.Hooks().On(hooks.SubAgentStart, func(_ context.Context, evt hooks.Event) {
 		name := evt.Data["name"].(string)
 		fmt.Fprintf(os.Stderr, "  ⊕ Spawning sub-agent: %s\n", name)
 		rt.telem.LogEvent("subagent_start", map[string]interface{}{"role": name})
 	})
-	rt.exec.Hooks().On(hooks.SubAgentComplete, func(_ context.Context, evt hooks.Event) {
+	exec.Hooks().On(hooks.SubAgentComplete, func(_ context.Context, evt hooks.Event) {
 		name := evt.Data["name"].(string)
 		fmt.Fprintf(os.Stderr, "  ⊖ Sub-agent complete: %s\n", name)
 		rt.telem.LogEvent("subagent_complete", map[string]interface{}{"role": name})
 	})
-	rt.exec.Hooks().On(hooks.GoalStart, func(_ context.Context, evt hooks.Event) {
+	exec.Hooks().On(hooks.GoalStart, func(_ context.Context, evt hooks.Event) {
 		name := evt.Data["name"].(string)
 		fmt.Fprintf(os.Stderr, "▶ Starting goal: %s\n", name)
 		rt.telem.LogEvent("goal_started", map[string]interface{}{"goal": name})
 	})
-	rt.exec.Hooks().On(hooks.GoalComplete, func(_ context.Context, evt hooks.Event) {
+	exec.Hooks().On(hooks.GoalComplete, func(_ context.Context, evt hooks.Event) {
 		name := evt.Data["name"].(string)
 		fmt.Fprintf(os.Stderr, "✓ Completed goal: %s\n", name)
 		rt.telem.LogEvent("goal_complete", map[string]interface{}{"goal": name})
 	})
-	rt.exec.Hooks().On(hooks.ToolCall, func(_ context.Context, evt hooks.Event) {
+	exec.Hooks().On(hooks.ToolCall, func(_ context.Context, evt hooks.Event) {
 		name := evt.Data["name"].(string)
 		args, _ := evt.Data["args"].(map[string]interface{})
 		agentRole, _ := evt.Data["agent_role"].(string)
@@ -564,7 +754,7 @@ func (rt *runtime) setupCallbacks() {
 		}
 		rt.telem.LogEvent("tool_call", map[string]interface{}{"tool": name, "args": args, "agent": agentRole})
 	})
-	rt.exec.Hooks().On(hooks.ToolError, func(_ context.Context, evt hooks.Event) {
+	exec.Hooks().On(hooks.ToolError, func(_ context.Context, evt hooks.Event) {
 		name := evt.Data["name"].(string)
 		err := evt.Data["error"].(error)
 		agentRole, _ := evt.Data["agent_role"].(string)
@@ -575,25 +765,25 @@ func (rt *runtime) setupCallbacks() {
 		}
 		rt.telem.LogEvent("tool_error", map[string]interface{}{"tool": name, "error": err.Error(), "agent": agentRole})
 	})
-	rt.exec.Hooks().On(hooks.MCPToolCall, func(_ context.Context, evt hooks.Event) {
+	exec.Hooks().On(hooks.MCPToolCall, func(_ context.Context, evt hooks.Event) {
 		server := evt.Data["server"].(string)
 		tool := evt.Data["tool"].(string)
 		args, _ := evt.Data["args"].(map[string]interface{})
 		fmt.Fprintf(os.Stderr, "  → MCP Tool: %s/%s\n", server, tool)
 		rt.telem.LogEvent("mcp_tool_call", map[string]interface{}{"server": server, "tool": tool, "args": args})
 	})
-	rt.exec.Hooks().On(hooks.SkillLoaded, func(_ context.Context, evt hooks.Event) {
+	exec.Hooks().On(hooks.SkillLoaded, func(_ context.Context, evt hooks.Event) {
 		name := evt.Data["name"].(string)
 		fmt.Fprintf(os.Stderr, "  → Skill loaded: %s\n", name)
 		rt.telem.LogEvent("skill_loaded", map[string]interface{}{"skill": name})
 	})
-	rt.exec.Hooks().On(hooks.SupervisionEvent, func(_ context.Context, evt hooks.Event) {
+	exec.Hooks().On(hooks.SupervisionEvent, func(_ context.Context, evt hooks.Event) {
 		stepID := evt.Data["step_id"].(string)
 		phase := evt.Data["phase"].(string)
 		fmt.Fprintf(os.Stderr, "  ⊙ Supervision [%s]: %s\n", stepID, phase)
 		rt.telem.LogEvent("supervision_"+phase, map[string]interface{}{"step": stepID})
 	})
-	rt.exec.Hooks().On(hooks.LLMError, func(_ context.Context, evt hooks.Event) {
+	exec.Hooks().On(hooks.LLMError, func(_ context.Context, evt hooks.Event) {
 		err := evt.Data["error"].(error)
 		fmt.Fprintf(os.Stderr, "  ✗ LLM error: %v\n", err)
 		rt.telem.LogEvent("llm_error", map[string]interface{}{"error": err.Error()})
@@ -605,6 +795,7 @@ func (rt *runtime) run(ctx context.Context) int {
 	fmt.Fprintf(os.Stderr, "Running workflow: %s (session: %s)\n\n", rt.wf.Name, rt.sess.ID)
 
 	result, err := rt.exec.Run(ctx, rt.inputs)
+	rt.recordPlan()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "\nerror: %v\n", err)
 		rt.sess.Status = "failed"
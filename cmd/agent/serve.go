@@ -9,7 +9,9 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -44,13 +46,23 @@ type serviceAgent struct {
 	serviceRuntime *runtime
 
 	// Runtime state
-	status       string // "idle", "busy", "draining"
-	currentTask  *tasks.TaskMessage
-	taskDone     chan struct{}
-	drainTimeout time.Duration
+	maxConcurrent int           // [service] max_concurrent_tasks
+	slots         chan struct{} // one token per running task
+	activeMu      sync.Mutex
+	active        map[string]*executor.InterruptBuffer // running task ID -> corrections buffer (nil outside bus mode)
+	busySince     time.Time
+	draining      bool
+	taskDone      chan struct{} // signalled when a task finishes
+	drainTimeout  time.Duration
+	publishEvent  func(session.Event)       // bus mode: session events to NATS
+	metrics       executor.MetricsCollector // bus mode: heartbeat metrics
 
 	// HTTP server (for local mode)
 	httpServer *http.Server
+	approvals  *httpApprover // /approvals gateway (nil if human input is configured elsewhere)
+	taskQueue  *taskQueue    // async /tasks API
+
+	idempotency *idempotencyStore // results by idempotency key (nil if unavailable)
 
 	// Bus mode components
 	bus         bus.MessageBus
@@ -130,12 +142,32 @@ func (cmd *ServeCmd) Run() error {
 
 	// Create service-level runtime (one session for entire service lifetime)
 	serviceRt := newRuntime(wf, creds)
+
+	// HTTP mode takes human approvals on /approvals unless configured otherwise
+	var approvals *httpApprover
+	if wf.cfg.Service.BusURL == "" && wf.cfg.Service.HTTPAddr != "" && wf.cfg.Supervision.HumanInput == "" {
+		approvals = newHTTPApprover(
+			time.Duration(wf.cfg.Supervision.HumanTimeoutSeconds)*time.Second,
+			wf.cfg.Supervision.ApprovalWebhooks,
+		)
+		serviceRt.human = approvals
+	}
 	if err := serviceRt.setup(); err != nil {
 		return fmt.Errorf("setting up service runtime: %w", err)
 	}
 	// Session persists across tasks — Run() flushes, doesn't close
 	serviceRt.exec.SetPersistentSession(true)
 
+	// Concurrent tasks would race for the same human answers
+	maxConcurrent := wf.cfg.Service.MaxConcurrentTasks
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+	if maxConcurrent > 1 && serviceRt.execCfg.HumanAvailable && wf.wf.HasSupervisedGoals() {
+		fmt.Fprintf(os.Stderr, "⚠️  max_concurrent_tasks=%d ignored: human approvals are taken one task at a time\n", maxConcurrent)
+		maxConcurrent = 1
+	}
+
 	// Agent ID uses session ID (or config if specified)
 	agentID := wf.cfg.Agent.ID
 	if agentID == "" {
@@ -178,9 +210,20 @@ func (cmd *ServeCmd) Run() error {
 		capabilitiesStr: capabilitiesStr,
 		capability:      capability,
 		serviceRuntime:  serviceRt,
-		status:          "idle",
-		taskDone:        make(chan struct{}),
+		maxConcurrent:   maxConcurrent,
+		slots:           make(chan struct{}, maxConcurrent),
+		active:          make(map[string]*executor.InterruptBuffer),
+		taskDone:        make(chan struct{}, 1),
 		drainTimeout:    drainTimeout,
+		approvals:       approvals,
+	}
+
+	// Tasks with an idempotency key run once; duplicates get the stored result
+	idemDir := filepath.Join(serviceRt.storagePath, "idempotency", filepath.Base(serviceRt.sessionPath))
+	if store, err := newIdempotencyStore(idemDir, agentID); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: idempotency keys not enforced: %v\n", err)
+	} else {
+		agent.idempotency = store
 	}
 
 	// Ensure cleanup on exit
@@ -204,7 +247,7 @@ func (a *serviceAgent) runHTTPMode() error {
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"status":     a.status,
+			"status":     a.currentStatus(),
 			"capability": a.capability.Name,
 		})
 	})
@@ -223,7 +266,7 @@ func (a *serviceAgent) runHTTPMode() error {
 		}
 
 		// Check if draining
-		if a.status == "draining" {
+		if a.currentStatus() == "draining" {
 			http.Error(w, "agent is draining, not accepting tasks", http.StatusServiceUnavailable)
 			return
 		}
@@ -252,15 +295,30 @@ func (a *serviceAgent) runHTTPMode() error {
 		json.NewEncoder(w).Encode(result)
 	})
 
-	a.httpServer = &http.Server{
-		Addr:    a.wf.cfg.Service.HTTPAddr,
-		Handler: mux,
+	// Human approvals for supervised goals
+	if a.approvals != nil {
+		a.approvals.register(mux)
 	}
 
 	// Handle shutdown signals
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Asynchronous tasks, persisted next to the service's sessions
+	taskDir := filepath.Join(a.serviceRuntime.storagePath, "tasks", filepath.Base(a.serviceRuntime.sessionPath))
+	queue, err := newTaskQueue(taskDir, a.capability.Name, a.runTask)
+	if err != nil {
+		return err
+	}
+	a.taskQueue = queue
+	queue.register(mux)
+	queue.start(ctx, a.maxConcurrent)
+
+	a.httpServer = &http.Server{
+		Addr:    a.wf.cfg.Service.HTTPAddr,
+		Handler: mux,
+	}
+
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
 
@@ -272,10 +330,22 @@ func (a *serviceAgent) runHTTPMode() error {
 
 	fmt.Fprintf(os.Stderr, "Service agent: %s (ID: %s, capability: %s)\n", a.wf.wf.Name, a.agentID, a.capability.Name)
 	fmt.Fprintf(os.Stderr, "HTTP server listening on %s\n", a.wf.cfg.Service.HTTPAddr)
+	if a.maxConcurrent > 1 {
+		fmt.Fprintf(os.Stderr, "Concurrent tasks: %d\n", a.maxConcurrent)
+	}
 	fmt.Fprintf(os.Stderr, "Endpoints:\n")
 	fmt.Fprintf(os.Stderr, "  GET  /health     - Health check\n")
 	fmt.Fprintf(os.Stderr, "  GET  /capability - Capability schema\n")
-	fmt.Fprintf(os.Stderr, "  POST /task       - Submit task\n")
+	fmt.Fprintf(os.Stderr, "  POST /task       - Submit task and wait for the result\n")
+	fmt.Fprintf(os.Stderr, "  POST /tasks      - Submit task asynchronously\n")
+	fmt.Fprintf(os.Stderr, "  GET  /tasks      - List tasks\n")
+	fmt.Fprintf(os.Stderr, "  GET  /tasks/{id} - Task status and result\n")
+	fmt.Fprintf(os.Stderr, "  DELETE /tasks/{id} - Cancel task\n")
+	fmt.Fprintf(os.Stderr, "  GET  /tasks/{id}/events - Live task events (SSE/WebSocket)\n")
+	if a.approvals != nil {
+		fmt.Fprintf(os.Stderr, "  GET  /approvals  - Pending human approvals\n")
+		fmt.Fprintf(os.Stderr, "  POST /approvals/{id} - Approve, reject or correct\n")
+	}
 
 	if err := a.httpServer.ListenAndServe(); err != http.ErrServerClosed {
 		return fmt.Errorf("HTTP server error: %w", err)
@@ -346,17 +416,19 @@ func (a *serviceAgent) runBusMode() error {
 	// Wire metrics collector for dashboard reporting
 	mc := heartbeat.NewMetricsCollector(hbSender)
 	a.serviceRuntime.exec.SetMetricsCollector(mc)
+	a.metrics = mc
 
 	// Wire event publisher — streams structured session events to NATS
 	// for the swarm UI's real-time event log.
 	evtSubject := fmt.Sprintf("events.%s", a.displayName)
-	a.serviceRuntime.exec.SetEventPublisher(func(evt session.Event) {
+	a.publishEvent = func(evt session.Event) {
 		data, err := json.Marshal(evt)
 		if err != nil {
 			return
 		}
 		natsBus.Publish(evtSubject, data)
-	})
+	}
+	a.serviceRuntime.exec.SetEventPublisher(a.publishEvent)
 	defer a.serviceRuntime.exec.ClearEventPublisher()
 
 	// Add registry TTL touch to heartbeat callback.
@@ -472,25 +544,44 @@ func (a *serviceAgent) runBusMode() error {
 		fmt.Fprintf(os.Stderr, "Listening on: discuss.* (manager — monitoring workers)\n")
 	}
 	fmt.Fprintf(os.Stderr, "Heartbeat interval: %s\n", heartbeatInterval)
+	if a.maxConcurrent > 1 {
+		fmt.Fprintf(os.Stderr, "Concurrent tasks: %d\n", a.maxConcurrent)
+	}
 
 	// Main loop
 	a.runMainLoop(ctx, sigCh)
 	return nil
 }
 
+// workItem is a task message taken from the bus. done is called once the
+// task has been handled: it acks JetStream messages and frees intake.
+type workItem struct {
+	msg  *bus.Message
+	done func()
+}
+
 func (a *serviceAgent) runMainLoop(ctx context.Context, sigCh chan os.Signal) {
 	// Work channel — fed by either JetStream pull or queue group push
-	workCh := make(chan *bus.Message, 16)
+	workCh := make(chan *workItem, 16)
+
+	// Intake holds a token per task taken but not yet handled, so no more
+	// than max_concurrent_tasks are taken off the bus at once
+	intake := make(chan struct{}, a.maxConcurrent)
 
 	if a.workPullSub != nil {
-		// JetStream pull consumer: fetch one task at a time, ack after processing
-		go a.pullWorkLoop(ctx, workCh)
+		// JetStream pull consumer: fetch as many tasks as there are free slots, ack after processing
+		go a.pullWorkLoop(ctx, workCh, intake)
 	} else {
 		// Fallback: push-based queue group subscriptions
 		for _, sub := range a.taskSubs {
 			go func(s bus.Subscription) {
 				for msg := range s.Messages() {
-					workCh <- msg
+					select {
+					case intake <- struct{}{}:
+					case <-ctx.Done():
+						return
+					}
+					workCh <- &workItem{msg: msg, done: func() { <-intake }}
 				}
 			}(sub)
 		}
@@ -530,11 +621,16 @@ func (a *serviceAgent) runMainLoop(ctx context.Context, sigCh chan os.Signal) {
 			a.initiateBusShutdown(ctx)
 			return
 
-		case msg, ok := <-workCh:
+		case item, ok := <-workCh:
 			if !ok {
 				return
 			}
-			a.handleBusTask(ctx, msg)
+			// Tasks run alongside the loop so corrections and shutdown
+			// signals are handled while they execute
+			go func() {
+				a.handleBusTask(ctx, item.msg)
+				item.done()
+			}()
 
 		case msg, ok := <-instanceCh:
 			if !ok {
@@ -558,10 +654,11 @@ func (a *serviceAgent) runMainLoop(ctx context.Context, sigCh chan os.Signal) {
 // handleInstanceMessage processes a corrective guidance message from
 // work.<instance-id>.* and pushes it into the interrupt buffer.
 func (a *serviceAgent) handleInstanceMessage(msg *bus.Message) {
-	buf := a.serviceRuntime.exec.InterruptBuffer()
+	taskID := extractTaskIDFromSubject(msg.Subject)
+	buf := a.interruptBuffer(taskID)
 	if buf == nil {
-		// Not currently executing — log and discard
-		fmt.Fprintf(os.Stderr, "  ⚠️  Correction received while idle (discarded): %s\n", string(msg.Data))
+		// Not executing the task it is addressed to — log and discard
+		fmt.Fprintf(os.Stderr, "  ⚠️  Correction received for no running task (discarded): %s\n", string(msg.Data))
 		return
 	}
 
@@ -586,7 +683,7 @@ func (a *serviceAgent) handleInstanceMessage(msg *bus.Message) {
 		From:      from,
 		Timestamp: time.Now(),
 		Content:   content,
-		TaskID:    extractTaskIDFromSubject(msg.Subject),
+		TaskID:    taskID,
 	})
 	fmt.Fprintf(os.Stderr, "  📨 Correction received from %s → interrupt buffer\n", from)
 }
@@ -731,14 +828,35 @@ func buildTaskText(task *tasks.TaskMessage) string {
 	return strings.Join(parts, "\n")
 }
 
-// pullWorkLoop fetches tasks from the JetStream pull consumer one at a time.
-// Each message is acked only after the worker finishes processing it,
-// guaranteeing exactly-once delivery across the worker pool.
-func (a *serviceAgent) pullWorkLoop(ctx context.Context, workCh chan<- *bus.Message) {
+// pullWorkLoop fetches tasks from the JetStream pull consumer, up to one
+// per free intake slot. Each message is acked only after the worker
+// finishes processing it, guaranteeing exactly-once delivery across the
+// worker pool.
+func (a *serviceAgent) pullWorkLoop(ctx context.Context, workCh chan<- *workItem, intake chan struct{}) {
 	consecutiveErrors := 0
 	for {
-		// Fetch one message at a time (blocks until available or timeout)
-		msgs, err := a.workPullSub.Fetch(1, nats.MaxWait(5*time.Second))
+		// Wait for a free slot, then claim any others that are free
+		select {
+		case intake <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		batch := 1
+	claim:
+		for batch < cap(intake) {
+			select {
+			case intake <- struct{}{}:
+				batch++
+			default:
+				break claim
+			}
+		}
+
+		// Fetch up to batch messages (blocks until available or timeout)
+		msgs, err := a.workPullSub.Fetch(batch, nats.MaxWait(5*time.Second))
+		for i := len(msgs); i < batch; i++ {
+			<-intake // release slots the fetch didn't fill
+		}
 		if err != nil {
 			if err == nats.ErrTimeout {
 				// No messages available — normal idle state
@@ -771,34 +889,32 @@ func (a *serviceAgent) pullWorkLoop(ctx context.Context, workCh chan<- *bus.Mess
 		}
 		consecutiveErrors = 0
 
-		for _, natsMsg := range msgs {
+		for i, natsMsg := range msgs {
+			natsMsg := natsMsg
 			// Convert to bus.Message for handleBusTask compatibility
-			busMsg := &bus.Message{
-				Subject: natsMsg.Subject,
-				Data:    natsMsg.Data,
+			item := &workItem{
+				msg: &bus.Message{
+					Subject: natsMsg.Subject,
+					Data:    natsMsg.Data,
+				},
+				// Ack once handled — NATS won't redeliver to any worker
+				done: func() {
+					if err := natsMsg.Ack(); err != nil {
+						fmt.Fprintf(os.Stderr, "  ⚠️  JetStream ack error: %v\n", err)
+					}
+					<-intake
+				},
 			}
 
 			// Send to work channel (blocks until main loop picks it up)
 			select {
-			case workCh <- busMsg:
-			case <-ctx.Done():
-				natsMsg.Nak()
-				return
-			}
-
-			// Wait for task processing to complete before acking.
-			// executeTask signals taskDone when it finishes.
-			select {
-			case <-a.taskDone:
+			case workCh <- item:
 			case <-ctx.Done():
-				natsMsg.Nak()
+				for _, m := range msgs[i:] {
+					m.Nak()
+				}
 				return
 			}
-
-			// Ack the message — NATS won't redeliver to any worker
-			if err := natsMsg.Ack(); err != nil {
-				fmt.Fprintf(os.Stderr, "  ⚠️  JetStream ack error: %v\n", err)
-			}
 		}
 	}
 }
@@ -814,36 +930,21 @@ func (a *serviceAgent) handleBusTask(ctx context.Context, msg *bus.Message) {
 
 	fmt.Fprintf(os.Stderr, "  → Task received: %s\n", task.TaskID)
 
-	// Update heartbeat status
-	if a.heartbeat != nil {
-		a.heartbeat.SetStatus("executing")
-		a.heartbeat.SetLoad(1.0)
-		a.heartbeat.SetMetadata("executing_since", fmt.Sprintf("%d", time.Now().UnixMilli()))
-		a.heartbeat.SetMetadata("current_task", task.TaskID)
-	}
-
-	// Set up interrupt buffer for corrective guidance from work.<instance-id>.*
-	interruptBuf := executor.NewInterruptBuffer()
-	a.serviceRuntime.exec.SetInterruptBuffer(interruptBuf)
-	defer a.serviceRuntime.exec.SetInterruptBuffer(nil)
-
-	// Set up discuss publisher — publishes non-tool-call LLM output to discuss.*
-	taskID := task.TaskID
-	a.serviceRuntime.exec.SetDiscussPublisher(func(goalName, content string) {
-		a.publishToDiscuss(taskID, goalName, content)
-	})
-	defer a.serviceRuntime.exec.ClearDiscussPublisher()
-
 	// Execute task
-	result := a.executeTask(ctx, task)
-
-	// Update heartbeat status
-	if a.heartbeat != nil {
-		a.heartbeat.SetStatus("idle")
-		a.heartbeat.SetLoad(0.0)
-		a.heartbeat.SetMetadata("executing_since", "")
-		a.heartbeat.SetMetadata("current_task", "")
-	}
+	result := a.execute(ctx, task, func(exec *executor.Executor) func() {
+		// Interrupt buffer for corrective guidance from work.<instance-id>.*
+		exec.SetInterruptBuffer(executor.NewInterruptBuffer())
+
+		// Discuss publisher — publishes non-tool-call LLM output to discuss.*
+		taskID := task.TaskID
+		exec.SetDiscussPublisher(func(goalName, content string) {
+			a.publishToDiscuss(taskID, goalName, content)
+		})
+		return func() {
+			exec.SetInterruptBuffer(nil)
+			exec.ClearDiscussPublisher()
+		}
+	})
 
 	// Publish result to done.<capability>.<task_id>
 	resultData, err := result.Marshal()
@@ -904,7 +1005,7 @@ func (a *serviceAgent) publishToDiscuss(taskID, goalName, content string) {
 
 // initiateBusShutdown handles graceful shutdown in bus mode.
 func (a *serviceAgent) initiateBusShutdown(ctx context.Context) {
-	a.status = "draining"
+	a.setDraining()
 
 	// Update heartbeat to draining
 	if a.heartbeat != nil {
@@ -934,40 +1035,86 @@ func (a *serviceAgent) initiateBusShutdown(ctx context.Context) {
 		a.controlSub.Unsubscribe()
 	}
 
-	// Wait for current task to complete (with timeout)
-	if a.currentTask != nil {
-		fmt.Fprintf(os.Stderr, "Waiting for current task to complete (timeout: %s)...\n", a.drainTimeout)
-		select {
-		case <-a.taskDone:
-			fmt.Fprintf(os.Stderr, "Task completed, shutting down.\n")
-		case <-time.After(a.drainTimeout):
-			fmt.Fprintf(os.Stderr, "Drain timeout reached, forcing shutdown.\n")
-		}
-	}
+	// Wait for running tasks to complete (with timeout)
+	a.waitForTasks()
 
 	// Heartbeat and bus will be closed by deferred calls in runBusMode
 }
 
 // executeTask runs a single task through the workflow.
 func (a *serviceAgent) executeTask(ctx context.Context, task *tasks.TaskMessage) *tasks.TaskResult {
-	start := time.Now()
-	a.status = "busy"
-	a.currentTask = task
-	defer func() {
-		a.status = "idle"
-		a.currentTask = nil
-		select {
-		case a.taskDone <- struct{}{}:
-		default:
+	return a.runTask(ctx, task, nil)
+}
+
+// runTask runs a task, passing its session events to onEvent if set.
+func (a *serviceAgent) runTask(ctx context.Context, task *tasks.TaskMessage, onEvent func(session.Event)) *tasks.TaskResult {
+	return a.execute(ctx, task, func(exec *executor.Executor) func() {
+		if onEvent == nil {
+			return func() {}
 		}
-	}()
+		exec.SetEventPublisher(onEvent)
+		return exec.ClearEventPublisher
+	})
+}
+
+// execute runs a task, or answers it from an earlier run with the same
+// idempotency key. wire attaches per-task callbacks to the executor and
+// returns a function that detaches them.
+func (a *serviceAgent) execute(ctx context.Context, task *tasks.TaskMessage, wire func(*executor.Executor) func()) *tasks.TaskResult {
+	if a.idempotency != nil && task.IdempotencyKey != "" {
+		return a.idempotency.do(ctx, task, func() *tasks.TaskResult {
+			return a.executeRun(ctx, task, wire)
+		})
+	}
+	return a.executeRun(ctx, task, wire)
+}
 
+// executeRun runs a task once one of the max_concurrent_tasks slots is
+// free, in an executor of its own so no conversation, scratchpad or goal
+// state carries over from earlier tasks.
+func (a *serviceAgent) executeRun(ctx context.Context, task *tasks.TaskMessage, wire func(*executor.Executor) func()) *tasks.TaskResult {
+	start := time.Now()
 	result := tasks.NewTaskResult(task.TaskID, a.agentID, tasks.ResultSuccess)
 	result.CorrelationID = task.CorrelationID
 	result.Attempt = task.Attempt
+	defer func() {
+		result.DurationMs = time.Since(start).Milliseconds()
+		if result.Metadata == nil {
+			result.Metadata = make(map[string]string)
+		}
+		result.Metadata["capability"] = a.capability.Name
+		result.Metadata["name"] = a.displayName
+	}()
+
+	select {
+	case a.slots <- struct{}{}:
+	case <-ctx.Done():
+		result.Status = tasks.ResultFailed
+		result.Error = ctx.Err().Error()
+		return result
+	}
+	defer func() { <-a.slots }()
 
-	// Execute workflow using service runtime's executor
-	// All tasks share the same session, provider, tools, etc.
+	te, err := a.serviceRuntime.newTaskExecutor(task)
+	if err != nil {
+		result.Status = tasks.ResultFailed
+		result.Error = err.Error()
+		fmt.Fprintf(os.Stderr, "  ✗ Execution error: %v\n", err)
+		return result
+	}
+	exec := te.exec
+	if a.metrics != nil {
+		exec.SetMetricsCollector(a.metrics)
+	}
+	if a.publishEvent != nil {
+		exec.SetEventPublisher(a.publishEvent)
+	}
+	unwire := wire(exec)
+	defer unwire()
+	a.beginTask(task, exec.InterruptBuffer())
+	defer a.endTask(task)
+
+	// Tasks share providers, tools and memory, not sessions
 	inputs := task.Inputs
 	// Inject revision context if present (discuss follow-up rounds)
 	if task.Metadata != nil && task.Metadata["revision_context"] != "" {
@@ -977,7 +1124,8 @@ func (a *serviceAgent) executeTask(ctx context.Context, task *tasks.TaskMessage)
 		}
 		inputs["_revision_context"] = task.Metadata["revision_context"]
 	}
-	execResult, err := a.serviceRuntime.exec.Run(ctx, inputs)
+	execResult, err := exec.Run(ctx, inputs)
+	te.finish(execResult, err)
 	if err != nil {
 		result.Status = tasks.ResultFailed
 		result.Error = err.Error()
@@ -993,31 +1141,19 @@ func (a *serviceAgent) executeTask(ctx context.Context, task *tasks.TaskMessage)
 	} else {
 		result.Outputs = execResult.Outputs
 	}
-
-	result.DurationMs = time.Since(start).Milliseconds()
-	if result.Metadata == nil {
-		result.Metadata = make(map[string]string)
-	}
-	result.Metadata["capability"] = a.capability.Name
-	result.Metadata["name"] = a.displayName
 	return result
 }
 
 // initiateShutdown handles graceful shutdown.
 func (a *serviceAgent) initiateShutdown(ctx context.Context) {
-	a.status = "draining"
-
-	// Wait for current task to complete (with timeout)
-	if a.currentTask != nil {
-		fmt.Fprintf(os.Stderr, "Waiting for current task to complete (timeout: %s)...\n", a.drainTimeout)
-		select {
-		case <-a.taskDone:
-			fmt.Fprintf(os.Stderr, "Task completed, shutting down.\n")
-		case <-time.After(a.drainTimeout):
-			fmt.Fprintf(os.Stderr, "Drain timeout reached, forcing shutdown.\n")
-		}
+	a.setDraining()
+	if a.taskQueue != nil {
+		a.taskQueue.close()
 	}
 
+	// Wait for running tasks to complete (with timeout)
+	a.waitForTasks()
+
 	// Shutdown HTTP server
 	if a.httpServer != nil {
 		shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
@@ -1051,7 +1187,7 @@ func extractCapabilitySchema(wf *agentfile.Workflow, name string) registry.Capab
 		for _, output := range goal.Outputs {
 			field := registry.FieldSchema{
 				Name: output,
-				Type: "string",
+				Type: capabilityFieldType(goal.FieldType(output)),
 			}
 			schema.Outputs = append(schema.Outputs, field)
 		}
@@ -1060,6 +1196,19 @@ func extractCapabilitySchema(wf *agentfile.Workflow, name string) registry.Capab
 	return schema
 }
 
+// capabilityFieldType maps a declared output type to a registry type hint.
+func capabilityFieldType(t agentfile.OutputType) string {
+	switch t.Kind {
+	case agentfile.OutputNumber, agentfile.OutputInteger:
+		return "number"
+	case agentfile.OutputBool:
+		return "boolean"
+	case agentfile.OutputList, agentfile.OutputObject:
+		return "json"
+	}
+	return "string"
+}
+
 // generateShortID generates a short random ID (8 hex chars).
 func generateShortID() string {
 	b := make([]byte, 4)
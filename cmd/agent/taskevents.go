@@ -0,0 +1,315 @@
+// Live execution events for tasks submitted to /tasks, streamed as
+// Server-Sent Events or over a WebSocket.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vinayprograms/agent/internal/session"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// taskEventHistory bounds the events kept per task for late subscribers.
+	taskEventHistory = 1000
+	// finishedTaskStreams is how many finished tasks keep their events.
+	finishedTaskStreams = 20
+	// sseKeepAlive is the interval between SSE keep-alive comments.
+	sseKeepAlive = 15 * time.Second
+)
+
+// eventStream fans a task's session events out to subscribers and keeps
+// recent history so clients that connect late still see the whole run.
+type eventStream struct {
+	mu      sync.Mutex
+	history []session.Event
+	subs    map[chan session.Event]struct{}
+	done    chan struct{}
+	closed  bool
+}
+
+func newEventStream() *eventStream {
+	return &eventStream{
+		subs: make(map[chan session.Event]struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+// publish records an event and delivers it to subscribers. A subscriber
+// that falls behind is dropped, its channel closed, rather than blocking
+// the executor or silently missing events.
+func (s *eventStream) publish(evt session.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.history = append(s.history, evt)
+	if len(s.history) > taskEventHistory {
+		s.history = s.history[len(s.history)-taskEventHistory:]
+	}
+	for ch := range s.subs {
+		select {
+		case ch <- evt:
+		default:
+			delete(s.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribe returns the history so far and a channel of later events.
+// The done channel closes when the task finishes; the events channel
+// closes if the subscriber falls behind.
+func (s *eventStream) subscribe() ([]session.Event, chan session.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	history := append([]session.Event(nil), s.history...)
+	ch := make(chan session.Event, 256)
+	if !s.closed {
+		s.subs[ch] = struct{}{}
+	}
+	return history, ch
+}
+
+func (s *eventStream) unsubscribe(ch chan session.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subs, ch)
+}
+
+// close marks the task finished and releases subscribers.
+func (s *eventStream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.subs = make(map[chan session.Event]struct{})
+	close(s.done)
+}
+
+// parseVerbosity reads ?verbosity= with the replay levels:
+// 0 (default), 1 (-v) or 2 (-vv). "v" and "vv" are accepted too.
+func parseVerbosity(s string) (int, error) {
+	switch s {
+	case "":
+		return 0, nil
+	case "v":
+		return 1, nil
+	case "vv":
+		return 2, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > 2 {
+		return 0, fmt.Errorf("verbosity must be 0, 1 or 2")
+	}
+	return n, nil
+}
+
+// filterEvent trims an event to what replay shows at the given verbosity:
+// 0 drops message content and tool arguments, 1 adds them back, and 2 also
+// keeps the full LLM exchange, commitments and taint lineage.
+func filterEvent(evt session.Event, verbosity int) session.Event {
+	if verbosity >= 2 {
+		return evt
+	}
+	if evt.Meta != nil {
+		meta := *evt.Meta
+		meta.Prompt = ""
+		meta.Response = ""
+		meta.Thinking = ""
+		meta.XMLBlock = ""
+		meta.TaintLineage = nil
+		meta.Commitment = ""
+		if verbosity == 0 {
+			meta.SubAgentTask = ""
+			meta.SubAgentOutput = ""
+			meta.SubAgentInputs = nil
+		}
+		evt.Meta = &meta
+	}
+	if verbosity == 0 {
+		evt.Args = nil
+		if evt.Type != session.EventWarning {
+			evt.Content = ""
+		}
+	}
+	return evt
+}
+
+// streamOverflow ends the stream of a client too slow to keep up. Events
+// after LastSeq were not sent; SSE clients reconnect with Last-Event-ID
+// to get them from the history.
+type streamOverflow struct {
+	ID      string `json:"id"`
+	LastSeq uint64 `json:"last_seq"`
+	Error   string `json:"error"`
+}
+
+// taskEnd is the last message of a stream.
+type taskEnd struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// serveEvents streams a task's events until it finishes or the client
+// goes away. WebSocket upgrade requests get one JSON event per message.
+func (q *taskQueue) serveEvents(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	verbosity, err := parseVerbosity(r.URL.Query().Get("verbosity"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := q.get(id); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		websocket.Server{
+			Handshake: func(_ *websocket.Config, r *http.Request) error { return checkOrigin(r) },
+			Handler: func(ws *websocket.Conn) {
+				q.streamEvents(ws.Request(), id, verbosity, func(name string, seq uint64, v interface{}) error {
+					data, _ := json.Marshal(v)
+					return websocket.Message.Send(ws, string(data))
+				})
+			},
+		}.ServeHTTP(w, r)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	q.streamEvents(r, id, verbosity, func(name string, seq uint64, v interface{}) error {
+		data, _ := json.Marshal(v)
+		if seq > 0 {
+			fmt.Fprintf(w, "id: %d\n", seq)
+		}
+		if name == "" {
+			_, err := fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+			return err
+		}
+		_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+		flusher.Flush()
+		return err
+	})
+}
+
+// checkOrigin rejects WebSocket requests from a web page of another site,
+// which could otherwise read task events through the operator's browser.
+// API clients send no Origin and are left to the listener's access control.
+func checkOrigin(r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil || !strings.EqualFold(u.Host, r.Host) {
+		return fmt.Errorf("origin %q not allowed", origin)
+	}
+	return nil
+}
+
+// streamEvents sends history and live events through send, then an "end"
+// message once the task has finished. Events at or before Last-Event-ID are
+// skipped so SSE clients can reconnect. A client that falls behind gets an
+// "overflow" message instead of the end. An empty name is a keep-alive.
+func (q *taskQueue) streamEvents(r *http.Request, id string, verbosity int, send func(name string, seq uint64, v interface{}) error) {
+	var lastSeq uint64
+	if last := r.Header.Get("Last-Event-ID"); last != "" {
+		lastSeq, _ = strconv.ParseUint(last, 10, 64)
+	}
+	emit := func(evt session.Event) error {
+		if evt.SeqID != 0 && evt.SeqID <= lastSeq {
+			return nil
+		}
+		if err := send(evt.Type, evt.SeqID, filterEvent(evt, verbosity)); err != nil {
+			return err
+		}
+		lastSeq = max(lastSeq, evt.SeqID)
+		return nil
+	}
+	overflow := func() {
+		send("overflow", 0, streamOverflow{ID: id, LastSeq: lastSeq, Error: "client too slow, events dropped"})
+	}
+
+	if stream := q.stream(id); stream != nil {
+		history, ch := stream.subscribe()
+		defer stream.unsubscribe(ch)
+		for _, evt := range history {
+			if emit(evt) != nil {
+				return
+			}
+		}
+
+		keepAlive := time.NewTicker(sseKeepAlive)
+		defer keepAlive.Stop()
+	live:
+		for {
+			select {
+			case evt, ok := <-ch:
+				if !ok {
+					overflow()
+					return
+				}
+				if emit(evt) != nil {
+					return
+				}
+			case <-stream.done:
+				// Deliver anything published just before the task finished
+				for {
+					select {
+					case evt, ok := <-ch:
+						if !ok {
+							overflow()
+							return
+						}
+						if emit(evt) != nil {
+							return
+						}
+					default:
+						break live
+					}
+				}
+			case <-keepAlive.C:
+				if send("", 0, nil) != nil {
+					return
+				}
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+
+	// Tasks whose events were not kept (finished before a restart, or
+	// evicted) get only the end message
+	t, err := q.get(id)
+	if err != nil {
+		return
+	}
+	send("end", 0, taskEnd{ID: t.ID, Status: t.Status, Error: t.Error})
+}
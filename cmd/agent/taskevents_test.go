@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vinayprograms/agent/internal/session"
+	"github.com/vinayprograms/agentkit/tasks"
+	"golang.org/x/net/websocket"
+)
+
+// sseMessage is one parsed Server-Sent Event.
+type sseMessage struct {
+	id, event, data string
+}
+
+// readSSE reads events from an SSE response until the "end" event.
+func readSSE(t *testing.T, resp *http.Response) []sseMessage {
+	t.Helper()
+	var msgs []sseMessage
+	var cur sseMessage
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if cur.event != "" {
+				msgs = append(msgs, cur)
+				if cur.event == "end" {
+					return msgs
+				}
+			}
+			cur = sseMessage{}
+		case strings.HasPrefix(line, "id: "):
+			cur.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			cur.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			cur.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	t.Fatalf("stream ended without an end event: %+v", msgs)
+	return nil
+}
+
+func newEventsServer(t *testing.T) (*taskQueue, *blockingRunner, *httptest.Server) {
+	t.Helper()
+	runner := newBlockingRunner()
+	q, err := newTaskQueue(t.TempDir(), "echo", runner.run)
+	if err != nil {
+		t.Fatalf("newTaskQueue: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	q.start(ctx, 1)
+
+	mux := http.NewServeMux()
+	q.register(mux)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return q, runner, srv
+}
+
+func TestTaskEvents_SSE(t *testing.T) {
+	q, runner, srv := newEventsServer(t)
+	task, _ := q.submit(&tasks.TaskMessage{TaskID: "t1", Inputs: map[string]string{"msg": "hi"}})
+
+	resp, err := http.Get(srv.URL + "/tasks/" + task.ID + "/events?verbosity=1")
+	if err != nil {
+		t.Fatalf("GET events: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	<-runner.started
+	close(runner.release)
+	msgs := readSSE(t, resp)
+	if len(msgs) != 2 {
+		t.Fatalf("expected goal_start and end, got %+v", msgs)
+	}
+	if msgs[0].event != session.EventGoalStart || msgs[0].id != "1" {
+		t.Errorf("unexpected first event %+v", msgs[0])
+	}
+	var evt session.Event
+	json.Unmarshal([]byte(msgs[0].data), &evt)
+	if evt.Content != "hi" {
+		t.Errorf("expected content at verbosity 1, got %+v", evt)
+	}
+	var end taskEnd
+	json.Unmarshal([]byte(msgs[1].data), &end)
+	if end.ID != task.ID || end.Status != taskSucceeded {
+		t.Errorf("unexpected end %+v", end)
+	}
+
+	// A late subscriber gets the history; Last-Event-ID skips what it has seen
+	resp2, _ := http.Get(srv.URL + "/tasks/" + task.ID + "/events")
+	if msgs := readSSE(t, resp2); len(msgs) != 2 {
+		t.Errorf("expected history replayed, got %+v", msgs)
+	}
+	resp2.Body.Close()
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/tasks/"+task.ID+"/events", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	resp3, _ := http.DefaultClient.Do(req)
+	if msgs := readSSE(t, resp3); len(msgs) != 1 || msgs[0].event != "end" {
+		t.Errorf("expected only the end event, got %+v", msgs)
+	}
+	resp3.Body.Close()
+
+	if resp, _ := http.Get(srv.URL + "/tasks/nope/events"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", resp.StatusCode)
+	}
+	if resp, _ := http.Get(srv.URL + "/tasks/" + task.ID + "/events?verbosity=9"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for bad verbosity, got %d", resp.StatusCode)
+	}
+}
+
+func TestTaskEvents_WebSocket(t *testing.T) {
+	q, runner, srv := newEventsServer(t)
+	task, _ := q.submit(&tasks.TaskMessage{TaskID: "t1", Inputs: map[string]string{"msg": "hi"}})
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/tasks/" + task.ID + "/events"
+	ws, err := websocket.Dial(url, "", srv.URL)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer ws.Close()
+
+	<-runner.started
+	close(runner.release)
+
+	var evt session.Event
+	if err := websocket.JSON.Receive(ws, &evt); err != nil {
+		t.Fatalf("receive event: %v", err)
+	}
+	if evt.Type != session.EventGoalStart || evt.Content != "" {
+		t.Errorf("expected goal_start without content at verbosity 0, got %+v", evt)
+	}
+	var end taskEnd
+	if err := websocket.JSON.Receive(ws, &end); err != nil {
+		t.Fatalf("receive end: %v", err)
+	}
+	if end.Status != taskSucceeded {
+		t.Errorf("unexpected end %+v", end)
+	}
+}
+
+func TestTaskEvents_WebSocketOrigin(t *testing.T) {
+	q, _, srv := newEventsServer(t)
+	task, _ := q.submit(&tasks.TaskMessage{TaskID: "t1", Inputs: map[string]string{"msg": "hi"}})
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/tasks/" + task.ID + "/events"
+	if ws, err := websocket.Dial(url, "", "https://evil.example"); err == nil {
+		ws.Close()
+		t.Fatal("expected a cross-site WebSocket request refused")
+	}
+}
+
+func TestEventStream_Overflow(t *testing.T) {
+	stream := newEventStream()
+	stream.publish(session.Event{SeqID: 1, Type: session.EventGoalStart})
+	q := &taskQueue{streams: map[string]*eventStream{"t1": stream}}
+
+	// The client stalls on the first event while the task keeps publishing
+	gate := make(chan struct{})
+	done := make(chan struct{})
+	var names []string
+	var overflow streamOverflow
+	go func() {
+		defer close(done)
+		req := httptest.NewRequest(http.MethodGet, "/tasks/t1/events", nil)
+		q.streamEvents(req, "t1", 0, func(name string, seq uint64, v interface{}) error {
+			if len(names) == 0 {
+				<-gate
+			}
+			names = append(names, name)
+			if o, ok := v.(streamOverflow); ok {
+				overflow = o
+			}
+			return nil
+		})
+	}()
+	for !subscribed(stream) {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 2; i <= 400; i++ {
+		stream.publish(session.Event{SeqID: uint64(i), Type: session.EventToolCall})
+	}
+	close(gate)
+	<-done
+
+	if len(names) == 0 || names[len(names)-1] != "overflow" {
+		t.Fatalf("expected the stream to end with an overflow message, got %d messages ending %v", len(names), names[len(names)-1:])
+	}
+	if overflow.ID != "t1" || overflow.LastSeq != uint64(len(names)-1) || overflow.LastSeq >= 400 {
+		t.Errorf("expected overflow at the last delivered event, got %+v after %d events", overflow, len(names)-1)
+	}
+	if subscribed(stream) {
+		t.Error("expected the slow subscriber dropped")
+	}
+}
+
+// subscribed reports whether the stream has a subscriber.
+func subscribed(s *eventStream) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.subs) > 0
+}
+
+func TestFilterEvent(t *testing.T) {
+	evt := session.Event{
+		Type:    session.EventAssistant,
+		Content: "answer",
+		Args:    map[string]interface{}{"path": "a.txt"},
+		Meta: &session.EventMeta{
+			Prompt:     "question",
+			Commitment: "{}",
+			Tokens:     42,
+		},
+	}
+
+	full := filterEvent(evt, 2)
+	if full.Meta.Prompt != "question" || full.Meta.Commitment != "{}" {
+		t.Errorf("verbosity 2 should keep everything, got %+v", full.Meta)
+	}
+
+	verbose := filterEvent(evt, 1)
+	if verbose.Content != "answer" || verbose.Args == nil {
+		t.Errorf("verbosity 1 should keep content and args, got %+v", verbose)
+	}
+	if verbose.Meta.Prompt != "" || verbose.Meta.Commitment != "" || verbose.Meta.Tokens != 42 {
+		t.Errorf("verbosity 1 should drop LLM detail only, got %+v", verbose.Meta)
+	}
+
+	normal := filterEvent(evt, 0)
+	if normal.Content != "" || normal.Args != nil {
+		t.Errorf("verbosity 0 should drop content and args, got %+v", normal)
+	}
+	if evt.Meta.Prompt != "question" {
+		t.Error("filterEvent must not modify the original event")
+	}
+
+	warning := filterEvent(session.Event{Type: session.EventWarning, Content: "careful"}, 0)
+	if warning.Content != "careful" {
+		t.Errorf("warnings keep their content, got %+v", warning)
+	}
+}
@@ -0,0 +1,240 @@
+// Task execution for service agents: each task runs in its own executor
+// built from the service runtime's shared providers, tool registry and
+// memory, one at a time or up to [service] max_concurrent_tasks at once.
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vinayprograms/agent/internal/checkpoint"
+	"github.com/vinayprograms/agent/internal/executor"
+	"github.com/vinayprograms/agent/internal/session"
+	"github.com/vinayprograms/agentkit/security"
+	"github.com/vinayprograms/agentkit/tasks"
+	"github.com/vinayprograms/agentkit/tools"
+)
+
+// stateTaskID records which service task a per-task session belongs to.
+const stateTaskID = "task_id"
+
+// taskExecutor is an executor dedicated to one service task.
+type taskExecutor struct {
+	exec    *executor.Executor
+	sess    *session.Session
+	mgr     session.SessionManager
+	closers []func()
+}
+
+// newTaskExecutor builds an executor for one task. It shares the runtime's
+// providers, tools, memory and MCP connections, but has its own session,
+// scratchpad, security verifier, checkpoints and interrupt buffer, so tasks
+// don't see each other's inputs, outputs, notes or corrections.
+func (rt *runtime) newTaskExecutor(task *tasks.TaskMessage) (*taskExecutor, error) {
+	sess, err := rt.sessionMgr.Create(rt.wf.Name)
+	if err != nil {
+		return nil, fmt.Errorf("creating task session: %w", err)
+	}
+	sess.State[stateTaskID] = task.TaskID
+	if rt.agentfileHash != "" {
+		sess.State[stateAgentfileHash] = rt.agentfileHash
+	}
+	te := &taskExecutor{sess: sess, mgr: rt.sessionMgr}
+
+	cfg := rt.execCfg
+	cfg.Session = sess
+	cfg.PersistentSession = false
+	cfg.Resume = nil
+	cfg.SharedRegistry = true
+	if rt.registry != nil && rt.registry.Has("scratchpad_write") {
+		scratchpad := tools.NewInMemoryStore()
+		cfg.Registry = rt.registry.Subset(toolNames(rt.registry))
+		cfg.Registry.SetScratchpad(scratchpad, false)
+		cfg.ContextStore = scratchpad
+	}
+	cfg.SecurityVerifier = nil
+	if rt.secCfg != nil {
+		verifier, err := security.NewVerifier(*rt.secCfg, sess.ID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: failed to create security verifier for task %s: %v\n", task.TaskID, err)
+		} else {
+			cfg.SecurityVerifier = verifier
+			te.closers = append(te.closers, verifier.Destroy)
+		}
+	}
+	if cfg.CheckpointStore != nil {
+		cs, err := checkpoint.NewStore(filepath.Join(rt.sessionPath, "checkpoints", sess.ID))
+		if err != nil {
+			te.release()
+			return nil, fmt.Errorf("creating checkpoint store: %w", err)
+		}
+		cfg.CheckpointStore = cs
+	}
+
+	te.exec = executor.New(cfg)
+	rt.setupCallbacks(te.exec)
+	return te, nil
+}
+
+// toolNames returns the names of a registry's enabled tools.
+func toolNames(reg *tools.Registry) []string {
+	var names []string
+	for _, d := range reg.Definitions() {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// finish records the task's outcome in its session and releases the
+// executor's resources.
+func (te *taskExecutor) finish(result *executor.Result, err error) {
+	switch {
+	case err != nil:
+		te.sess.Status = session.StatusFailed
+		te.sess.Error = err.Error()
+	case result != nil:
+		te.sess.Status = string(result.Status)
+		te.sess.Outputs = result.Outputs
+		te.sess.Error = result.Error
+	}
+	te.mgr.Update(te.sess)
+	te.release()
+}
+
+func (te *taskExecutor) release() {
+	te.sess.Close()
+	for i := len(te.closers) - 1; i >= 0; i-- {
+		te.closers[i]()
+	}
+}
+
+// beginTask marks a task as running. buf receives corrections addressed
+// to the task (nil outside bus mode).
+func (a *serviceAgent) beginTask(task *tasks.TaskMessage, buf *executor.InterruptBuffer) {
+	a.activeMu.Lock()
+	defer a.activeMu.Unlock()
+	if len(a.active) == 0 {
+		a.busySince = time.Now()
+	}
+	a.active[task.TaskID] = buf
+	a.reportLoad(task.TaskID)
+}
+
+// endTask marks a task as finished and wakes a draining shutdown.
+func (a *serviceAgent) endTask(task *tasks.TaskMessage) {
+	a.activeMu.Lock()
+	delete(a.active, task.TaskID)
+	a.reportLoad("")
+	a.activeMu.Unlock()
+
+	select {
+	case a.taskDone <- struct{}{}:
+	default:
+	}
+}
+
+// reportLoad publishes the agent's load in its heartbeat. Callers hold
+// a.activeMu.
+func (a *serviceAgent) reportLoad(latest string) {
+	if a.heartbeat == nil {
+		return
+	}
+	a.heartbeat.SetLoad(float64(len(a.active)) / float64(a.maxConcurrent))
+	switch {
+	case a.draining:
+		a.heartbeat.SetStatus("draining")
+	case len(a.active) == 0:
+		a.heartbeat.SetStatus("idle")
+	default:
+		a.heartbeat.SetStatus("executing")
+	}
+	if len(a.active) == 0 {
+		a.heartbeat.SetMetadata("executing_since", "")
+		a.heartbeat.SetMetadata("current_task", "")
+		a.heartbeat.SetMetadata("running_tasks", "")
+		return
+	}
+	a.heartbeat.SetMetadata("executing_since", fmt.Sprintf("%d", a.busySince.UnixMilli()))
+	if latest != "" {
+		a.heartbeat.SetMetadata("current_task", latest)
+	}
+	a.heartbeat.SetMetadata("running_tasks", strings.Join(a.runningTaskIDs(), ","))
+}
+
+// runningTaskIDs returns the IDs of running tasks, sorted. Callers hold
+// a.activeMu.
+func (a *serviceAgent) runningTaskIDs() []string {
+	ids := make([]string, 0, len(a.active))
+	for id := range a.active {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// activeCount returns how many tasks are running.
+func (a *serviceAgent) activeCount() int {
+	a.activeMu.Lock()
+	defer a.activeMu.Unlock()
+	return len(a.active)
+}
+
+// currentStatus reports "draining", "busy" while any task runs, or "idle".
+func (a *serviceAgent) currentStatus() string {
+	a.activeMu.Lock()
+	defer a.activeMu.Unlock()
+	switch {
+	case a.draining:
+		return "draining"
+	case len(a.active) > 0:
+		return "busy"
+	}
+	return "idle"
+}
+
+// setDraining stops the agent from reporting itself available.
+func (a *serviceAgent) setDraining() {
+	a.activeMu.Lock()
+	defer a.activeMu.Unlock()
+	a.draining = true
+}
+
+// interruptBuffer returns the interrupt buffer of the task a correction
+// is addressed to. Corrections without a known task ID go to the only
+// running task, if there is exactly one.
+func (a *serviceAgent) interruptBuffer(taskID string) *executor.InterruptBuffer {
+	a.activeMu.Lock()
+	defer a.activeMu.Unlock()
+	if buf, ok := a.active[taskID]; ok {
+		return buf
+	}
+	if len(a.active) == 1 {
+		for _, buf := range a.active {
+			return buf
+		}
+	}
+	return nil
+}
+
+// waitForTasks waits up to the drain timeout for running tasks to finish.
+func (a *serviceAgent) waitForTasks() {
+	n := a.activeCount()
+	if n == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Waiting for %d running task(s) to complete (timeout: %s)...\n", n, a.drainTimeout)
+	timeout := time.After(a.drainTimeout)
+	for a.activeCount() > 0 {
+		select {
+		case <-a.taskDone:
+		case <-timeout:
+			fmt.Fprintf(os.Stderr, "Drain timeout reached, forcing shutdown.\n")
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Tasks completed, shutting down.\n")
+}
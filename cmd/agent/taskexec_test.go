@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vinayprograms/agent/internal/agentfile"
+	"github.com/vinayprograms/agent/internal/executor"
+	"github.com/vinayprograms/agent/internal/session"
+	"github.com/vinayprograms/agentkit/llm"
+	"github.com/vinayprograms/agentkit/policy"
+	"github.com/vinayprograms/agentkit/tasks"
+	"github.com/vinayprograms/agentkit/telemetry"
+	"github.com/vinayprograms/agentkit/tools"
+)
+
+func TestServiceAgent_TaskTracking(t *testing.T) {
+	a := &serviceAgent{
+		maxConcurrent: 2,
+		active:        make(map[string]*executor.InterruptBuffer),
+		taskDone:      make(chan struct{}, 1),
+	}
+	if a.currentStatus() != "idle" {
+		t.Fatalf("expected idle, got %s", a.currentStatus())
+	}
+
+	t1 := &tasks.TaskMessage{TaskID: "t1"}
+	t2 := &tasks.TaskMessage{TaskID: "t2"}
+	buf1 := executor.NewInterruptBuffer()
+	buf2 := executor.NewInterruptBuffer()
+	a.beginTask(t1, buf1)
+
+	// With one task running, corrections without a known task go to it
+	if a.interruptBuffer("") != buf1 || a.interruptBuffer("t1") != buf1 {
+		t.Error("expected corrections routed to the only running task")
+	}
+
+	a.beginTask(t2, buf2)
+	if a.currentStatus() != "busy" || a.activeCount() != 2 {
+		t.Errorf("expected two running tasks, got %s/%d", a.currentStatus(), a.activeCount())
+	}
+	if a.interruptBuffer("t2") != buf2 {
+		t.Error("expected corrections routed by task ID")
+	}
+	if a.interruptBuffer("") != nil {
+		t.Error("corrections without a task ID are ambiguous with two tasks running")
+	}
+
+	a.endTask(t1)
+	a.endTask(t2)
+	if a.activeCount() != 0 || a.interruptBuffer("t2") != nil {
+		t.Error("expected no running tasks")
+	}
+	a.setDraining()
+	if a.currentStatus() != "draining" {
+		t.Errorf("expected draining, got %s", a.currentStatus())
+	}
+}
+
+// chatFunc is a provider that answers with a function. Unlike
+// llm.MockProvider it keeps no state, so concurrent tasks can share it.
+type chatFunc func(ctx context.Context, req llm.ChatRequest) (*llm.ChatResponse, error)
+
+func (f chatFunc) Chat(ctx context.Context, req llm.ChatRequest) (*llm.ChatResponse, error) {
+	return f(ctx, req)
+}
+
+// isolationAgent builds a service agent whose tasks each write a note to the
+// scratchpad, list the scratchpad, and answer. Every request a task sends is
+// recorded under its topic. ready, if set, runs before a task lists the
+// scratchpad.
+func isolationAgent(t *testing.T, maxConcurrent int, ready func()) (*serviceAgent, map[string][]string) {
+	t.Helper()
+	wf := &agentfile.Workflow{
+		Name:   "isolation",
+		Inputs: []agentfile.Input{{Name: "topic"}},
+		Steps:  []agentfile.Step{{Type: agentfile.StepRUN, Name: "main", UsingGoals: []string{"research"}}},
+		Goals:  []agentfile.Goal{{Name: "research", Outcome: "Research topic $topic"}},
+	}
+
+	var mu sync.Mutex
+	seen := make(map[string][]string)
+	provider := chatFunc(func(ctx context.Context, req llm.ChatRequest) (*llm.ChatResponse, error) {
+		var b strings.Builder
+		var topic string
+		var results int
+		for _, m := range req.Messages {
+			b.WriteString(m.Content)
+			b.WriteString("\n")
+			if i := strings.Index(m.Content, "Research topic "); i >= 0 && topic == "" {
+				topic = strings.Fields(m.Content[i+len("Research topic "):])[0]
+			}
+			if m.Role == "tool" {
+				results++
+			}
+		}
+		mu.Lock()
+		seen[topic] = append(seen[topic], b.String())
+		mu.Unlock()
+
+		switch results {
+		case 0:
+			return &llm.ChatResponse{ToolCalls: []llm.ToolCallResponse{{
+				ID: "w", Name: "scratchpad_write",
+				Args: map[string]interface{}{"key": "note-" + topic, "value": "secret-" + topic},
+			}}}, nil
+		case 1:
+			if ready != nil {
+				ready()
+			}
+			return &llm.ChatResponse{ToolCalls: []llm.ToolCallResponse{{
+				ID: "l", Name: "scratchpad_list", Args: map[string]interface{}{},
+			}}}, nil
+		}
+		return &llm.ChatResponse{Content: "findings on " + topic}, nil
+	})
+
+	pol := policy.New()
+	pol.Workspace = t.TempDir()
+	reg := tools.NewRegistry(pol)
+	scratchpad := tools.NewInMemoryStore()
+	reg.SetScratchpad(scratchpad, false)
+	rt := &runtime{
+		wf:       wf,
+		registry: reg,
+		execCfg: executor.Config{
+			Workflow:     wf,
+			Provider:     provider,
+			Registry:     reg,
+			Policy:       pol,
+			ContextStore: scratchpad,
+		},
+		sessionMgr:  session.NewFileManager(t.TempDir()),
+		sessionPath: t.TempDir(),
+		telem:       telemetry.NewNoopExporter(),
+	}
+	a := &serviceAgent{
+		serviceRuntime: rt,
+		maxConcurrent:  maxConcurrent,
+		slots:          make(chan struct{}, maxConcurrent),
+		active:         make(map[string]*executor.InterruptBuffer),
+		taskDone:       make(chan struct{}, 1),
+	}
+	return a, seen
+}
+
+func runIsolationTask(a *serviceAgent, topic string) *tasks.TaskResult {
+	task := &tasks.TaskMessage{TaskID: "task-" + topic, Inputs: map[string]string{"topic": topic}}
+	return a.executeRun(context.Background(), task, func(*executor.Executor) func() { return func() {} })
+}
+
+// assertIsolated checks that nothing of one task reached the other.
+func assertIsolated(t *testing.T, seen map[string][]string, results map[string]*tasks.TaskResult) {
+	t.Helper()
+	for topic, other := range map[string]string{"alpha": "beta", "beta": "alpha"} {
+		res := results[topic]
+		if res.Status != tasks.ResultSuccess {
+			t.Fatalf("task %s: %s %s", topic, res.Status, res.Error)
+		}
+		if out := fmt.Sprint(res.Outputs); !strings.Contains(out, topic) || strings.Contains(out, other) {
+			t.Errorf("task %s: unexpected outputs %s", topic, out)
+		}
+		if len(seen[topic]) != 3 {
+			t.Errorf("task %s: expected 3 requests, got %d", topic, len(seen[topic]))
+		}
+		for _, req := range seen[topic] {
+			if strings.Contains(req, other) {
+				t.Errorf("task %s saw state of task %s:\n%s", topic, other, req)
+				break
+			}
+		}
+	}
+}
+
+func TestServiceAgent_SequentialTasksIsolated(t *testing.T) {
+	a, seen := isolationAgent(t, 1, nil)
+	results := map[string]*tasks.TaskResult{
+		"alpha": runIsolationTask(a, "alpha"),
+	}
+	results["beta"] = runIsolationTask(a, "beta")
+	assertIsolated(t, seen, results)
+}
+
+func TestServiceAgent_ConcurrentTasksIsolated(t *testing.T) {
+	// Both tasks have written their note before either lists the scratchpad
+	var written sync.WaitGroup
+	written.Add(2)
+	ready := func() {
+		written.Done()
+		done := make(chan struct{})
+		go func() { written.Wait(); close(done) }()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Error("tasks did not run concurrently")
+		}
+	}
+	a, seen := isolationAgent(t, 2, ready)
+
+	var mu sync.Mutex
+	results := make(map[string]*tasks.TaskResult)
+	var wg sync.WaitGroup
+	for _, topic := range []string{"alpha", "beta"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := runIsolationTask(a, topic)
+			mu.Lock()
+			results[topic] = res
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	assertIsolated(t, seen, results)
+}
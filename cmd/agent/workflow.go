@@ -3,13 +3,19 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/vinayprograms/agent/internal/agentfile"
 	"github.com/vinayprograms/agent/internal/config"
+	"github.com/vinayprograms/agent/internal/dataflow"
+	"github.com/vinayprograms/agent/internal/sandbox"
+	"github.com/vinayprograms/agent/internal/toolmeta"
 	"github.com/vinayprograms/agentkit/policy"
 	"github.com/vinayprograms/agentkit/security"
 )
@@ -25,12 +31,20 @@ type workflow struct {
 	statePath     string // CLI --state override
 	debug         bool
 	sessionLabel  string // Override session directory name (default: Agentfile NAME)
+	approvals     string // CLI --approvals override (terminal, file:<path>, socket:<path>, none)
+	interactive   bool   // attached to a user (agent run), not serving
+	resumeID      string // CLI --resume: session to continue
+	dryRun        bool   // CLI --dry-run: simulate side-effecting tools
 
 	// Loaded artifacts
-	wf      *agentfile.Workflow
-	cfg     *config.Config
-	pol     *policy.Policy
-	baseDir string
+	wf            *agentfile.Workflow
+	cfg           *config.Config
+	pol           *policy.Policy
+	flow          *dataflow.Policy // [flow] rules from policy.toml (nil = none)
+	sandbox       *sandbox.Config  // [bash] sandbox from policy.toml (nil = unconfined or docker)
+	toolMeta      *toolmeta.Catalog
+	baseDir       string
+	agentfileHash string // sha256 of the Agentfile, to detect edits between resumes
 }
 
 // load loads config, agentfile, and policy.
@@ -130,6 +144,10 @@ func (w *workflow) loadAgentfile() error {
 		return err
 	}
 	w.baseDir = filepath.Dir(w.agentfilePath)
+	if src, err := os.ReadFile(w.agentfilePath); err == nil {
+		sum := sha256.Sum256(src)
+		w.agentfileHash = hex.EncodeToString(sum[:])
+	}
 	return nil
 }
 
@@ -140,11 +158,25 @@ func (w *workflow) loadPolicy() error {
 		policyPath = filepath.Join(w.baseDir, "policy.toml")
 	}
 
+	// Tool metadata from MCP server config; policy.toml overrides it
+	if err := w.declareMCPToolMeta(); err != nil {
+		return err
+	}
+
 	// Validate policy keys before parsing
 	if content, err := os.ReadFile(policyPath); err == nil {
 		if err := policy.ValidateKeys(string(content)); err != nil {
 			return fmt.Errorf("policy validation: %w", err)
 		}
+		if w.flow, err = dataflow.Parse(string(content)); err != nil {
+			return fmt.Errorf("policy validation: %w", err)
+		}
+		if err := w.toolMeta.ParsePolicy(string(content)); err != nil {
+			return fmt.Errorf("policy validation: %w", err)
+		}
+		if w.sandbox, err = sandbox.ParsePolicy(string(content)); err != nil {
+			return fmt.Errorf("policy validation: %w", err)
+		}
 	} else if w.policyPath != "" {
 		// Explicit path specified but can't read — error
 		return fmt.Errorf("failed to read policy file: %w", err)
@@ -171,6 +203,24 @@ func (w *workflow) loadPolicy() error {
 	return nil
 }
 
+// declareMCPToolMeta starts the tool metadata catalog with the trust and
+// scheduling declared in each MCP server's config.
+func (w *workflow) declareMCPToolMeta() error {
+	w.toolMeta = toolmeta.New()
+	names := make([]string, 0, len(w.cfg.MCP.Servers))
+	for name := range w.cfg.MCP.Servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		srv := w.cfg.MCP.Servers[name]
+		if err := w.toolMeta.DeclareMCPServer(name, srv.ToolMeta(), srv.Tools); err != nil {
+			return fmt.Errorf("config: %w", err)
+		}
+	}
+	return nil
+}
+
 // ensureWorkspaceInAllowedDirs guarantees the project workspace is always
 // in the policy's universal allowed_dirs list. The workspace comes from
 // agent.toml (cfg.Agent.Workspace), not from policy.toml.
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/nats-io/nats.go"
+	"github.com/vinayprograms/agentkit/registry"
+)
+
+// applyDebounce lets an editor finish writing before the manifest is
+// reloaded.
+const applyDebounce = 500 * time.Millisecond
+
+// specHash identifies what a replica was started with: its command line,
+// agent type and the contents of its Agentfile, config and policy. A
+// running replica whose hash differs from the manifest's is replaced.
+// SWARM_CAPABILITIES is left out: it follows the workers' replica counts,
+// and scaling a worker shouldn't replace the manager.
+func specHash(cmd *exec.Cmd, ag AgentSpec) string {
+	h := sha256.New()
+	fmt.Fprintln(h, strings.Join(cmd.Args, "\x00"))
+	for _, env := range cmd.Env {
+		if strings.HasPrefix(env, "AGENT_TYPE=") {
+			fmt.Fprintln(h, env)
+		}
+	}
+	for _, path := range []string{ag.Agentfile, ag.Config, ag.Policy} {
+		if path == "" {
+			continue
+		}
+		if data, err := os.ReadFile(path); err == nil {
+			h.Write(data)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// runningReplica is a replica found in the PID records or by heartbeat.
+type runningReplica struct {
+	name string
+	id   string // agent ID from heartbeats ("" if none seen)
+	pid  int    // 0 if not started by swarm
+	hash string // spec hash recorded at start ("" if unknown)
+}
+
+// applyPlan is the difference between the manifest and what is running.
+type applyPlan struct {
+	start   []restartTarget
+	replace []restartTarget
+	stop    []runningReplica
+	unknown []string // running replicas whose spec can't be compared
+}
+
+func (p *applyPlan) empty() bool {
+	return len(p.start) == 0 && len(p.replace) == 0 && len(p.stop) == 0
+}
+
+// planApply diffs the manifest's replicas against the running ones.
+// Running agents whose names don't belong to any manifest agent are left
+// alone.
+func planApply(m *Manifest, running map[string]runningReplica) (*applyPlan, error) {
+	up := map[string]bool{}
+	for name := range running {
+		up[name] = true
+	}
+	desired, err := restartTargets(m, nil, up)
+	if err != nil {
+		return nil, err
+	}
+	plan := &applyPlan{}
+	want := map[string]bool{}
+	for _, t := range desired {
+		want[t.name] = true
+		r, ok := running[t.name]
+		switch {
+		case !ok:
+			plan.start = append(plan.start, t)
+		case r.hash == "":
+			plan.unknown = append(plan.unknown, t.name)
+		case r.hash != specHash(agentCommand(m, t.spec, t.name, m.Agents), t.spec):
+			plan.replace = append(plan.replace, t)
+		}
+	}
+	for name, r := range running {
+		if !want[name] && (r.pid > 0 || belongsToManifest(m, name)) {
+			plan.stop = append(plan.stop, r)
+		}
+	}
+	// Scale down from the highest replica number
+	sort.Slice(plan.stop, func(i, j int) bool { return plan.stop[i].name > plan.stop[j].name })
+	sort.Strings(plan.unknown)
+	return plan, nil
+}
+
+// belongsToManifest reports whether name is an agent's name or one of its
+// numbered replicas.
+func belongsToManifest(m *Manifest, name string) bool {
+	for _, ag := range m.Agents {
+		if name == ag.Name {
+			return true
+		}
+		if n, ok := strings.CutPrefix(name, ag.Name+"-"); ok {
+			if _, err := strconv.Atoi(n); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Run reconciles the running swarm with the manifest, once or on every
+// change with --watch.
+func (c *ApplyCmd) Run(a *app) error {
+	manifestPath := c.File
+	if manifestPath == "" {
+		var err error
+		if manifestPath, err = findManifest(); err != nil {
+			return err
+		}
+	}
+	m, err := loadManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+
+	nc, err := nats.Connect(m.NATS.URL)
+	if err != nil {
+		return fmt.Errorf("connect nats: %w", err)
+	}
+	defer nc.Close()
+
+	var reg *registry.NATSRegistry
+	if reg, err = registry.NewNATSRegistry(nc, registry.DefaultNATSRegistryConfig()); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  Registry unavailable, confirming starts by heartbeat only: %v\n", err)
+		reg = nil
+	} else {
+		defer reg.Close()
+	}
+
+	if err := c.reconcile(a, nc, reg, m); err != nil && !c.Watch {
+		return err
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "✗ %v\n", err)
+	}
+	if !c.Watch {
+		return nil
+	}
+	return c.watch(a, nc, reg, manifestPath, m)
+}
+
+// reconcile starts missing replicas, replaces changed ones and stops
+// extras, in that order so capabilities keep their workers.
+func (c *ApplyCmd) reconcile(a *app, nc *nats.Conn, reg *registry.NATSRegistry, m *Manifest) error {
+	running := map[string]runningReplica{}
+	for _, r := range cleanStalePIDs(loadPIDRecords(a.dataDir)) {
+		running[r.Name] = runningReplica{name: r.Name, pid: r.PID, hash: r.SpecHash}
+	}
+	for _, ag := range discoverAgentsViaHeartbeat(nc, discoveryWindow) {
+		r := running[ag.name]
+		r.name, r.id = ag.name, ag.id
+		running[ag.name] = r
+	}
+
+	plan, err := planApply(m, running)
+	if err != nil {
+		return err
+	}
+	for _, name := range plan.unknown {
+		fmt.Printf("  ? %s was not started by swarm up/apply/restart; leaving it as is\n", name)
+	}
+	if plan.empty() {
+		fmt.Println("Swarm matches the manifest.")
+		return nil
+	}
+	for _, t := range plan.start {
+		fmt.Printf("  + %s (%s)\n", t.name, t.spec.Capability)
+	}
+	for _, t := range plan.replace {
+		fmt.Printf("  ~ %s (%s): spec changed\n", t.name, t.spec.Capability)
+	}
+	for _, r := range plan.stop {
+		fmt.Printf("  - %s\n", r.name)
+	}
+	if c.DryRun {
+		return nil
+	}
+
+	for _, t := range plan.start {
+		fmt.Printf("Starting %s\n", t.name)
+		rec, err := startReplica(m, t.spec, t.name, a.dataDir)
+		if err != nil {
+			return fmt.Errorf("start %s: %w", t.name, err)
+		}
+		if err := waitForRegistration(nc, reg, t.name, "", rec.PID, c.StartTimeout); err != nil {
+			return fmt.Errorf("start %s: %w", t.name, err)
+		}
+	}
+	for _, t := range plan.replace {
+		fmt.Printf("Replacing %s\n", t.name)
+		if err := replaceReplica(nc, reg, m, t, running[t.name].id, a.dataDir, c.DrainTimeout, c.StartTimeout); err != nil {
+			return fmt.Errorf("replace %s: %w", t.name, err)
+		}
+	}
+	for _, r := range plan.stop {
+		fmt.Printf("Stopping %s\n", r.name)
+		if err := stopReplica(nc, r, c.DrainTimeout); err != nil {
+			return fmt.Errorf("stop %s: %w", r.name, err)
+		}
+		forgetPID(a.dataDir, r.name)
+	}
+	fmt.Println("Apply complete.")
+	return nil
+}
+
+// stopReplica drains a replica found by heartbeat, or terminates one
+// known only by PID.
+func stopReplica(nc *nats.Conn, r runningReplica, timeout time.Duration) error {
+	if r.id != "" {
+		return drainReplica(nc, r.id, r.name, r.pid, timeout)
+	}
+	proc, err := os.FindProcess(r.pid)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("  → no heartbeat, SIGTERM pid %d\n", r.pid)
+	proc.Signal(syscall.SIGTERM)
+	for end := time.Now().Add(killGrace); time.Now().Before(end) && isProcessAlive(r.pid); {
+		time.Sleep(500 * time.Millisecond)
+	}
+	if isProcessAlive(r.pid) {
+		fmt.Printf("  ✗ pid %d didn't exit — SIGKILL\n", r.pid)
+		proc.Signal(syscall.SIGKILL)
+	}
+	return nil
+}
+
+// watch reconciles whenever the manifest or a file it references changes.
+func (c *ApplyCmd) watch(a *app, nc *nats.Conn, reg *registry.NATSRegistry, manifestPath string, m *Manifest) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	// Editors often replace files, so watch directories and filter by name
+	var watched map[string]bool
+	update := func(m *Manifest) {
+		watched = map[string]bool{}
+		paths := []string{manifestPath}
+		for _, ag := range m.Agents {
+			paths = append(paths, ag.Agentfile, ag.Config, ag.Policy)
+		}
+		for _, p := range paths {
+			if p == "" {
+				continue
+			}
+			abs, err := filepath.Abs(p)
+			if err != nil {
+				continue
+			}
+			watched[abs] = true
+			if err := watcher.Add(filepath.Dir(abs)); err != nil {
+				fmt.Fprintf(os.Stderr, "⚠️  Can't watch %s: %v\n", filepath.Dir(abs), err)
+			}
+		}
+	}
+	update(m)
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
+	fmt.Printf("Watching %s for changes. Press Ctrl+C to stop (agents keep running).\n", manifestPath)
+
+	var debounce <-chan time.Time
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			abs, _ := filepath.Abs(event.Name)
+			if watched[abs] && event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+				debounce = time.After(applyDebounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Fprintf(os.Stderr, "⚠️  Watch error: %v\n", err)
+		case <-debounce:
+			debounce = nil
+			fmt.Printf("\n%s changed, reconciling...\n", time.Now().Format("15:04:05"))
+			next, err := loadManifest(manifestPath)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "✗ %v (keeping the running swarm)\n", err)
+				continue
+			}
+			update(next)
+			if err := c.reconcile(a, nc, reg, next); err != nil {
+				fmt.Fprintf(os.Stderr, "✗ %v\n", err)
+			}
+		case <-sigCh:
+			fmt.Println("\nStopped watching.")
+			return nil
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// applyManifest has a manager, a worker with coderReplicas replicas and a
+// single writer with writerReplicas.
+func applyManifest(coderReplicas, writerReplicas int) *Manifest {
+	return &Manifest{
+		State: StateConfig{Location: "/tmp/swarm"},
+		Agents: []AgentSpec{
+			{Name: "lead", Type: "manager", Capability: "plan"},
+			{Name: "coder", Type: "worker", Capability: "code", Replicas: coderReplicas},
+			{Name: "writer", Type: "worker", Capability: "docs", Replicas: writerReplicas},
+		},
+	}
+}
+
+// runningFrom returns m's replicas as started by swarm, with their spec
+// hashes.
+func runningFrom(t *testing.T, m *Manifest) map[string]runningReplica {
+	t.Helper()
+	targets, err := restartTargets(m, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	running := map[string]runningReplica{}
+	for i, tg := range targets {
+		hash := specHash(agentCommand(m, tg.spec, tg.name, m.Agents), tg.spec)
+		running[tg.name] = runningReplica{name: tg.name, pid: 1000 + i, hash: hash}
+	}
+	return running
+}
+
+// planSummary lists a plan as +start, ~replace, -stop and ?unknown.
+func planSummary(p *applyPlan) []string {
+	var out []string
+	for _, t := range p.start {
+		out = append(out, "+"+t.name)
+	}
+	for _, t := range p.replace {
+		out = append(out, "~"+t.name)
+	}
+	for _, r := range p.stop {
+		out = append(out, "-"+r.name)
+	}
+	for _, n := range p.unknown {
+		out = append(out, "?"+n)
+	}
+	return out
+}
+
+func TestPlanApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		desired *Manifest
+		running func(t *testing.T) map[string]runningReplica
+		want    []string
+	}{
+		{
+			name:    "nothing running",
+			desired: applyManifest(2, 1),
+			running: func(t *testing.T) map[string]runningReplica { return nil },
+			want:    []string{"+lead", "+coder-1", "+coder-2", "+writer"},
+		},
+		{
+			name:    "up to date",
+			desired: applyManifest(2, 1),
+			running: func(t *testing.T) map[string]runningReplica { return runningFrom(t, applyManifest(2, 1)) },
+		},
+		{
+			name:    "spec changed",
+			desired: applyManifest(2, 1),
+			running: func(t *testing.T) map[string]runningReplica {
+				running := runningFrom(t, applyManifest(2, 1))
+				r := running["coder-2"]
+				r.hash = "stale"
+				running["coder-2"] = r
+				return running
+			},
+			want: []string{"~coder-2"},
+		},
+		{
+			name:    "not started by swarm",
+			desired: applyManifest(2, 1),
+			running: func(t *testing.T) map[string]runningReplica {
+				running := runningFrom(t, applyManifest(2, 1))
+				running["writer"] = runningReplica{name: "writer", id: "agent-w"}
+				return running
+			},
+			want: []string{"?writer"},
+		},
+		{
+			name:    "scale up",
+			desired: applyManifest(3, 1),
+			running: func(t *testing.T) map[string]runningReplica { return runningFrom(t, applyManifest(2, 1)) },
+			want:    []string{"+coder-3"},
+		},
+		{
+			name:    "scale down",
+			desired: applyManifest(2, 1),
+			running: func(t *testing.T) map[string]runningReplica { return runningFrom(t, applyManifest(4, 1)) },
+			want:    []string{"-coder-4", "-coder-3"},
+		},
+		{
+			name:    "one replica becomes several",
+			desired: applyManifest(2, 2),
+			running: func(t *testing.T) map[string]runningReplica { return runningFrom(t, applyManifest(2, 1)) },
+			want:    []string{"+writer-1", "+writer-2", "-writer"},
+		},
+		{
+			name:    "several replicas become one",
+			desired: applyManifest(1, 1),
+			running: func(t *testing.T) map[string]runningReplica { return runningFrom(t, applyManifest(2, 1)) },
+			want:    []string{"+coder", "-coder-2", "-coder-1"},
+		},
+		{
+			name:    "agents outside the manifest",
+			desired: applyManifest(2, 1),
+			running: func(t *testing.T) map[string]runningReplica {
+				running := runningFrom(t, applyManifest(2, 1))
+				running["other-team"] = runningReplica{name: "other-team", id: "agent-x"}
+				running["removed"] = runningReplica{name: "removed", pid: 42, hash: "abc"}
+				return running
+			},
+			want: []string{"-removed"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := planApply(tt.desired, tt.running(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := planSummary(plan); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBelongsToManifest(t *testing.T) {
+	m := applyManifest(2, 1)
+	for name, want := range map[string]bool{
+		"coder":       true,
+		"coder-7":     true,
+		"writer":      true,
+		"coder-x":     false,
+		"coders":      false,
+		"other-team":  false,
+		"lead-backup": false,
+	} {
+		if got := belongsToManifest(m, name); got != want {
+			t.Errorf("belongsToManifest(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestSpecHash_IgnoresWorkerReplicaCounts(t *testing.T) {
+	before, after := applyManifest(2, 1), applyManifest(5, 1)
+	lead := before.Agents[0]
+	if specHash(agentCommand(before, lead, "lead", before.Agents), lead) != specHash(agentCommand(after, lead, "lead", after.Agents), lead) {
+		t.Error("resizing a worker changed the manager's spec hash")
+	}
+
+	coder := before.Agents[1]
+	changed := coder
+	changed.Capability = "review"
+	if specHash(agentCommand(before, coder, "coder-1", before.Agents), coder) == specHash(agentCommand(before, changed, "coder-1", before.Agents), changed) {
+		t.Error("changing a worker's capability kept its spec hash")
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/vinayprograms/agent/internal/swarm"
+)
+
+// scaleDrainTimeout bounds how long a replica being scaled away may take
+// to finish its current task.
+const scaleDrainTimeout = 5 * time.Minute
+
+// scaledReplica is one running replica of an autoscaled agent.
+type scaledReplica struct {
+	name     string
+	index    int // replica number, 1-based
+	pid      int
+	draining bool
+}
+
+// replicaLoad is the last heartbeat seen from a replica.
+type replicaLoad struct {
+	id   string
+	load float64
+	at   time.Time
+}
+
+// autoscaler runs while `swarm up` does: for each agent with max_replicas
+// it compares the capability's queued work and its replicas' heartbeat load
+// against the scale policy, then starts replicas or drains them.
+type autoscaler struct {
+	nc      *nats.Conn
+	js      nats.JetStreamContext
+	db      *taskDB
+	dataDir string
+	start   func(AgentSpec, string) (pidRecord, bool)
+	drain   func(runningReplica) error
+
+	mu       sync.Mutex
+	replicas map[string][]*scaledReplica // agent name -> replicas
+	loads    map[string]replicaLoad      // replica name -> last heartbeat
+	sub      *nats.Subscription
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// startAutoscaler begins scaling the autoscaled agents among agents. It
+// returns nil without error when none of them autoscale.
+func startAutoscaler(nc *nats.Conn, db *taskDB, agents []AgentSpec, start func(AgentSpec, string) (pidRecord, bool), dataDir string) (*autoscaler, error) {
+	var scaled []AgentSpec
+	for _, ag := range agents {
+		if ag.Autoscaled() {
+			scaled = append(scaled, ag)
+		}
+	}
+	if len(scaled) == 0 {
+		return nil, nil
+	}
+
+	js, err := swarm.EnsureStream(nc)
+	if err != nil {
+		return nil, err
+	}
+	s := &autoscaler{
+		nc:       nc,
+		js:       js,
+		db:       db,
+		dataDir:  dataDir,
+		start:    start,
+		drain:    func(r runningReplica) error { return stopReplica(nc, r, scaleDrainTimeout) },
+		replicas: make(map[string][]*scaledReplica),
+		loads:    make(map[string]replicaLoad),
+		done:     make(chan struct{}),
+	}
+
+	// Adopt replicas already running, whoever started them
+	for _, rec := range cleanStalePIDs(loadPIDRecords(dataDir)) {
+		for _, ag := range scaled {
+			if idx := replicaIndex(ag, rec.Name); idx > 0 {
+				s.replicas[ag.Name] = append(s.replicas[ag.Name], &scaledReplica{name: rec.Name, index: idx, pid: rec.PID})
+			}
+		}
+	}
+
+	if s.sub, err = nc.Subscribe("heartbeat.>", s.handleHeartbeat); err != nil {
+		return nil, fmt.Errorf("subscribe heartbeat: %w", err)
+	}
+	for _, ag := range scaled {
+		s.wg.Add(1)
+		go s.run(ag)
+		fmt.Printf("  ↕ autoscaling %s between %d and %d replicas\n", ag.Name, ag.MinReplicas, ag.MaxReplicas)
+	}
+	return s, nil
+}
+
+// stop ends scaling. Drains already under way carry on.
+func (s *autoscaler) stop() {
+	close(s.done)
+	s.sub.Unsubscribe()
+	s.wg.Wait()
+}
+
+func (s *autoscaler) handleHeartbeat(msg *nats.Msg) {
+	var hb struct {
+		AgentID  string            `json:"agent_id"`
+		Load     float64           `json:"load"`
+		Metadata map[string]string `json:"metadata"`
+	}
+	if json.Unmarshal(msg.Data, &hb) != nil || hb.Metadata["name"] == "" {
+		return
+	}
+	s.mu.Lock()
+	s.loads[hb.Metadata["name"]] = replicaLoad{id: hb.AgentID, load: hb.Load, at: time.Now()}
+	s.mu.Unlock()
+}
+
+// run evaluates one agent's policy every interval.
+func (s *autoscaler) run(ag AgentSpec) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(ag.Scale.EvalInterval())
+	defer ticker.Stop()
+
+	var lastAction time.Time
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+
+		pending, err := swarm.PendingWork(s.js, ag.Capability)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  autoscale %s: %v\n", ag.Name, err)
+			continue
+		}
+		current, load := s.observe(ag)
+		desired, reason := ag.Scale.Decide(current, ag.MinReplicas, ag.MaxReplicas, pending, load)
+		if desired == current {
+			continue
+		}
+		// Replacing crashed replicas can't wait for the cooldown
+		if current >= ag.MinReplicas && time.Since(lastAction) < ag.Scale.CooldownPeriod() {
+			continue
+		}
+		lastAction = time.Now()
+
+		ev := scaleEvent{
+			Time:       lastAction,
+			Agent:      ag.Name,
+			Capability: ag.Capability,
+			From:       current,
+			To:         desired,
+			Pending:    pending,
+			Load:       load,
+			Reason:     reason,
+		}
+		fmt.Printf("  ↕ %s: %d → %d replicas (%s)\n", ag.Name, current, desired, reason)
+		if desired > current {
+			ev.To, err = s.scaleUp(ag, desired-current)
+		} else {
+			s.scaleDown(ag, current-desired)
+		}
+		if err != nil {
+			ev.Error = err.Error()
+			fmt.Fprintf(os.Stderr, "  ✗ autoscale %s: %v\n", ag.Name, err)
+		}
+		if s.db != nil {
+			if err := s.db.LogScaleEvent(ev); err != nil {
+				fmt.Fprintf(os.Stderr, "⚠️  Failed to log scaling: %v\n", err)
+			}
+		}
+	}
+}
+
+// observe drops replicas that have exited and returns how many are
+// serving with their average load. Replicas not heard from yet count as
+// busy, so a fresh start isn't scaled away.
+func (s *autoscaler) observe(ag AgentSpec) (int, float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var (
+		live  []*scaledReplica
+		count int
+		total float64
+	)
+	for _, r := range s.replicas[ag.Name] {
+		if !isProcessAlive(r.pid) {
+			continue
+		}
+		live = append(live, r)
+		if r.draining {
+			continue
+		}
+		count++
+		if hb, ok := s.loads[r.name]; ok && time.Since(hb.at) < heartbeatGoneAfter {
+			total += hb.load
+		} else {
+			total++
+		}
+	}
+	s.replicas[ag.Name] = live
+	if count == 0 {
+		return 0, 0
+	}
+	return count, total / float64(count)
+}
+
+// scaleUp starts n replicas on the lowest free replica numbers and
+// returns the resulting replica count.
+func (s *autoscaler) scaleUp(ag AgentSpec, n int) (int, error) {
+	var failed []string
+	for ; n > 0; n-- {
+		s.mu.Lock()
+		used := map[int]bool{}
+		for _, r := range s.replicas[ag.Name] {
+			used[r.index] = true
+		}
+		s.mu.Unlock()
+		idx := 1
+		for used[idx] {
+			idx++
+		}
+		name := replicaName(ag, ag.MaxReplicas, idx-1)
+		rec, ok := s.start(ag, name)
+		if !ok {
+			failed = append(failed, name)
+			continue
+		}
+		recordPID(s.dataDir, rec)
+		s.mu.Lock()
+		s.replicas[ag.Name] = append(s.replicas[ag.Name], &scaledReplica{name: name, index: idx, pid: rec.PID})
+		s.mu.Unlock()
+	}
+	count, _ := s.observe(ag)
+	if len(failed) > 0 {
+		return count, fmt.Errorf("failed to start %s", strings.Join(failed, ", "))
+	}
+	return count, nil
+}
+
+// scaleDown drains the n highest-numbered replicas in the background,
+// keeping at least min_replicas serving.
+func (s *autoscaler) scaleDown(ag AgentSpec, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	replicas := s.replicas[ag.Name]
+	serving := 0
+	for _, r := range replicas {
+		if !r.draining {
+			serving++
+		}
+	}
+	n = min(n, serving-ag.MinReplicas)
+	sort.Slice(replicas, func(i, j int) bool { return replicas[i].index > replicas[j].index })
+	for _, r := range replicas {
+		if n <= 0 {
+			break
+		}
+		if r.draining {
+			continue
+		}
+		r.draining = true
+		n--
+		target := runningReplica{name: r.name, id: s.loads[r.name].id, pid: r.pid}
+		go func() {
+			if err := s.drain(target); err != nil {
+				fmt.Fprintf(os.Stderr, "  ✗ autoscale: stop %s: %v\n", target.name, err)
+				return
+			}
+			forgetPID(s.dataDir, target.name)
+		}()
+	}
+}
+
+// replicaIndex returns the replica number in name if it is one of ag's
+// replicas, or 0.
+func replicaIndex(ag AgentSpec, name string) int {
+	n, ok := strings.CutPrefix(name, ag.Name+"-")
+	if !ok {
+		return 0
+	}
+	idx, err := strconv.Atoi(n)
+	if err != nil || idx < 1 || idx > ag.MaxReplicas {
+		return 0
+	}
+	return idx
+}
+
+func (c *ScalingCmd) Run(a *app) error {
+	db, err := a.db()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	events, err := db.ListScaleEvents(c.Agent, c.Limit)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		fmt.Println("No scaling actions recorded")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tAGENT\tREPLICAS\tPENDING\tLOAD\tREASON")
+	for _, ev := range events {
+		reason := ev.Reason
+		if ev.Error != "" {
+			reason += " (" + ev.Error + ")"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d → %d\t%d\t%.2f\t%s\n",
+			ev.Time.Format("2006-01-02 15:04:05"), ev.Agent, ev.From, ev.To, ev.Pending, ev.Load, reason)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var crawler = AgentSpec{Name: "crawler", Capability: "crawl", Replicas: 2, MinReplicas: 2, MaxReplicas: 4}
+
+// newTestAutoscaler returns an autoscaler whose starts succeed as this
+// test process and whose drains are sent to the returned channel.
+func newTestAutoscaler(t *testing.T) (*autoscaler, chan runningReplica) {
+	t.Helper()
+	drained := make(chan runningReplica, 8)
+	s := &autoscaler{
+		dataDir: t.TempDir(),
+		start: func(ag AgentSpec, name string) (pidRecord, bool) {
+			return pidRecord{Name: name, PID: os.Getpid(), Capability: ag.Capability}, true
+		},
+		drain: func(r runningReplica) error {
+			drained <- r
+			return nil
+		},
+		replicas: make(map[string][]*scaledReplica),
+		loads:    make(map[string]replicaLoad),
+	}
+	return s, drained
+}
+
+// addReplicas adds running replicas of crawler with the given numbers.
+func addReplicas(s *autoscaler, indexes ...int) {
+	for _, idx := range indexes {
+		name := replicaName(crawler, crawler.MaxReplicas, idx-1)
+		s.replicas[crawler.Name] = append(s.replicas[crawler.Name], &scaledReplica{name: name, index: idx, pid: os.Getpid()})
+	}
+}
+
+// exitedPID returns the PID of a process that has exited.
+func exitedPID(t *testing.T) int {
+	t.Helper()
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skipf("can't run true: %v", err)
+	}
+	return cmd.Process.Pid
+}
+
+func TestReplicaIndex(t *testing.T) {
+	for name, want := range map[string]int{
+		"crawler-1":   1,
+		"crawler-4":   4,
+		"crawler-0":   0,
+		"crawler-5":   0,
+		"crawler":     0,
+		"crawler-x":   0,
+		"crawler--1":  0,
+		"crawlers-1":  0,
+		"crawler-1-2": 0,
+	} {
+		if got := replicaIndex(crawler, name); got != want {
+			t.Errorf("replicaIndex(%q) = %d, want %d", name, got, want)
+		}
+	}
+}
+
+func TestAutoscaler_ScaleUpFillsLowestFreeIndex(t *testing.T) {
+	s, _ := newTestAutoscaler(t)
+	addReplicas(s, 1, 3)
+
+	count, err := s.scaleUp(crawler, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 4 {
+		t.Errorf("expected 4 replicas, got %d", count)
+	}
+	var names []string
+	for _, r := range s.replicas[crawler.Name] {
+		names = append(names, r.name)
+	}
+	if want := []string{"crawler-1", "crawler-3", "crawler-2", "crawler-4"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got replicas %v, want %v", names, want)
+	}
+	if pid := pidOf(s.dataDir, "crawler-2"); pid != os.Getpid() {
+		t.Errorf("expected crawler-2's PID recorded, got %d", pid)
+	}
+}
+
+func TestAutoscaler_ScaleUpReportsFailedStarts(t *testing.T) {
+	s, _ := newTestAutoscaler(t)
+	addReplicas(s, 1)
+	s.start = func(AgentSpec, string) (pidRecord, bool) { return pidRecord{}, false }
+
+	count, err := s.scaleUp(crawler, 1)
+	if err == nil || count != 1 {
+		t.Errorf("expected a failed start with 1 replica left, got %d, %v", count, err)
+	}
+}
+
+func TestAutoscaler_ScaleDownDrainsHighestIndex(t *testing.T) {
+	s, drained := newTestAutoscaler(t)
+	addReplicas(s, 2, 4, 1, 3)
+	s.loads["crawler-4"] = replicaLoad{id: "agent-4", at: time.Now()}
+
+	s.scaleDown(crawler, 1)
+	select {
+	case r := <-drained:
+		if r.name != "crawler-4" || r.id != "agent-4" {
+			t.Errorf("expected crawler-4 drained by its agent ID, got %+v", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("nothing drained")
+	}
+	if count, _ := s.observe(crawler); count != 3 {
+		t.Errorf("expected 3 replicas serving, got %d", count)
+	}
+	// The drained replica's PID record is dropped once it has stopped
+	for end := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(pidFilePath(s.dataDir)); err == nil {
+			break
+		}
+		if time.Now().After(end) {
+			t.Fatal("PID record of the drained replica not updated")
+		}
+	}
+}
+
+func TestAutoscaler_ScaleDownKeepsMin(t *testing.T) {
+	s, drained := newTestAutoscaler(t)
+	addReplicas(s, 1, 2, 3)
+	s.replicas[crawler.Name][2].draining = true
+
+	// crawler-3 is already draining, which leaves min_replicas serving
+	s.scaleDown(crawler, 3)
+	select {
+	case r := <-drained:
+		t.Errorf("drained %s at min_replicas", r.name)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	addReplicas(s, 4)
+	s.scaleDown(crawler, 3)
+	select {
+	case r := <-drained:
+		if r.name != "crawler-4" {
+			t.Errorf("expected crawler-4 drained, got %s", r.name)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("nothing drained")
+	}
+	select {
+	case r := <-drained:
+		t.Errorf("drained %s below min_replicas", r.name)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestAutoscaler_ObserveSkipsDrainingAndExited(t *testing.T) {
+	s, _ := newTestAutoscaler(t)
+	addReplicas(s, 1, 2, 3, 4)
+	s.replicas[crawler.Name][2].draining = true
+	s.replicas[crawler.Name][3].pid = exitedPID(t)
+	s.loads["crawler-1"] = replicaLoad{load: 0.5, at: time.Now()}
+	s.loads["crawler-3"] = replicaLoad{load: 0.9, at: time.Now()}
+
+	count, load := s.observe(crawler)
+	// crawler-2 hasn't sent a heartbeat and counts as busy
+	if count != 2 || load != 0.75 {
+		t.Errorf("expected 2 replicas at load 0.75, got %d at %.2f", count, load)
+	}
+	if n := len(s.replicas[crawler.Name]); n != 3 {
+		t.Errorf("expected the exited replica dropped and the draining one kept, got %d", n)
+	}
+}
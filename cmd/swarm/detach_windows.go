@@ -0,0 +1,9 @@
+//go:build windows
+
+package main
+
+import "os/exec"
+
+// detach is a no-op on Windows, where console signals aren't delivered by
+// process group.
+func detach(cmd *exec.Cmd) {}
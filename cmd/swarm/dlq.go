@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// DLQCmd manages tasks that failed for good (see retry policies in
+// swarm.yaml).
+type DLQCmd struct {
+	List   DLQListCmd   `cmd:"" help:"List dead-lettered tasks"`
+	Replay DLQReplayCmd `cmd:"" help:"Resubmit dead-lettered tasks with a fresh attempt count"`
+	Drop   DLQDropCmd   `cmd:"" help:"Discard dead-lettered tasks"`
+}
+
+type DLQListCmd struct {
+	Capability string `name:"capability" short:"c" help:"Filter by capability"`
+}
+
+type DLQReplayCmd struct {
+	TaskIDs    []string `arg:"" name:"task-id" optional:"" help:"Task IDs to replay"`
+	All        bool     `name:"all" help:"Replay every dead-lettered task (or all for --capability)"`
+	Capability string   `name:"capability" short:"c" help:"With --all, only this capability"`
+}
+
+type DLQDropCmd struct {
+	TaskIDs    []string `arg:"" name:"task-id" optional:"" help:"Task IDs to drop"`
+	All        bool     `name:"all" help:"Drop every dead-lettered task (or all for --capability)"`
+	Capability string   `name:"capability" short:"c" help:"With --all, only this capability"`
+}
+
+func (l *DLQListCmd) Run(a *app) error {
+	db, err := a.db()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return listDeadLetters(os.Stdout, db, l.Capability)
+}
+
+// listDeadLetters prints the dead-lettered tasks of one capability, or
+// all of them, as a table.
+func listDeadLetters(out io.Writer, db *taskDB, capability string) error {
+	letters, err := db.ListDeadLetters(capability)
+	if err != nil {
+		return err
+	}
+	if len(letters) == 0 {
+		fmt.Fprintln(out, "Dead-letter queue is empty.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TASK ID\tCAPABILITY\tATTEMPTS\tFAILED\tREASON")
+	for _, dl := range letters {
+		attempts := dl.Task.Attempt
+		if dl.Result != nil && dl.Result.Attempt > attempts {
+			attempts = dl.Result.Attempt
+		}
+		reason := dl.Reason
+		if dl.Result != nil && dl.Result.Error != "" {
+			reason += ": " + dl.Result.Error
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n",
+			dl.Task.TaskID, dl.Task.Capability, attempts,
+			dl.FailedAt.Format("2006-01-02 15:04"), truncate(reason, 60))
+	}
+	return w.Flush()
+}
+
+func (r *DLQReplayCmd) Run(a *app) error {
+	db, err := a.db()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ids, err := selectDeadLetters(db, r.TaskIDs, r.All, r.Capability)
+	if err != nil {
+		return err
+	}
+	nc, err := a.connect()
+	if err != nil {
+		return err
+	}
+	defer nc.Close()
+
+	if err := replayDeadLetters(db, nc, ids); err != nil {
+		return err
+	}
+	return nc.Flush()
+}
+
+// replayDeadLetters resubmits tasks as their first attempt and takes them
+// off the dead-letter queue.
+func replayDeadLetters(db *taskDB, nc publisher, ids []string) error {
+	for _, id := range ids {
+		dl, err := db.GetDeadLetter(id)
+		if err != nil {
+			return err
+		}
+		task := *dl.Task
+		task.Attempt = 1
+		task.SubmittedAt = time.Now()
+		data, err := task.Marshal()
+		if err != nil {
+			return fmt.Errorf("marshal task %s: %w", id, err)
+		}
+		if err := nc.Publish(fmt.Sprintf("work.%s.%s", task.Capability, task.TaskID), data); err != nil {
+			return fmt.Errorf("publish %s: %w", id, err)
+		}
+		if err := db.RemoveDeadLetter(id); err != nil {
+			return err
+		}
+		db.SetStatus(id, "pending")
+		fmt.Printf("  ↻ Replayed %s (%s)\n", id, task.Capability)
+	}
+	return nil
+}
+
+func (d *DLQDropCmd) Run(a *app) error {
+	db, err := a.db()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ids, err := selectDeadLetters(db, d.TaskIDs, d.All, d.Capability)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := db.RemoveDeadLetter(id); err != nil {
+			return err
+		}
+		db.SetStatus(id, "failed")
+		fmt.Printf("  ✗ Dropped %s\n", id)
+	}
+	return nil
+}
+
+// selectDeadLetters resolves explicit task IDs or --all [--capability].
+func selectDeadLetters(db *taskDB, ids []string, all bool, capability string) ([]string, error) {
+	if len(ids) > 0 && all {
+		return nil, fmt.Errorf("give task IDs or --all, not both")
+	}
+	if !all {
+		if len(ids) == 0 {
+			return nil, fmt.Errorf("no task IDs given (use --all for every dead-lettered task)")
+		}
+		return ids, nil
+	}
+	letters, err := db.ListDeadLetters(capability)
+	if err != nil {
+		return nil, err
+	}
+	for _, dl := range letters {
+		ids = append(ids, dl.Task.TaskID)
+	}
+	if len(ids) == 0 {
+		fmt.Println("Dead-letter queue is empty.")
+	}
+	return ids, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vinayprograms/agent/internal/swarm"
+	"github.com/vinayprograms/agentkit/tasks"
+)
+
+// deadLetterDB returns a task DB with t1 (code) and t2 (review)
+// dead-lettered.
+func deadLetterDB(t *testing.T) *taskDB {
+	t.Helper()
+	db := newTestTaskDB(t)
+	for _, task := range []*tasks.TaskMessage{
+		{TaskID: "t1", Capability: "code", Attempt: 3, Inputs: map[string]string{"file": "main.go"}},
+		{TaskID: "t2", Capability: "review", Attempt: 1},
+	} {
+		db.InsertTask(task, "dead")
+		result := &tasks.TaskResult{TaskID: task.TaskID, Status: tasks.ResultFailed, Attempt: task.Attempt, Error: "boom"}
+		if err := db.AddDeadLetter(&swarm.DeadLetter{Task: task, Result: result, Reason: "failed", FailedAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestDLQ_List(t *testing.T) {
+	db := deadLetterDB(t)
+
+	var out strings.Builder
+	if err := listDeadLetters(&out, db, "code"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "t1") || strings.Contains(out.String(), "t2") || !strings.Contains(out.String(), "failed: boom") {
+		t.Errorf("unexpected listing:\n%s", out.String())
+	}
+
+	out.Reset()
+	listDeadLetters(&out, db, "deploy")
+	if !strings.Contains(out.String(), "empty") {
+		t.Errorf("expected an empty queue, got:\n%s", out.String())
+	}
+}
+
+func TestDLQ_Replay(t *testing.T) {
+	db := deadLetterDB(t)
+	pub := newRecordingPublisher()
+
+	ids, err := selectDeadLetters(db, nil, true, "code")
+	if err != nil || len(ids) != 1 || ids[0] != "t1" {
+		t.Fatalf("expected t1 selected, got %v (%v)", ids, err)
+	}
+	if err := replayDeadLetters(db, pub, ids); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := pub.next(t)
+	task, err := tasks.UnmarshalTaskMessage(msg.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Subject != "work.code.t1" || task.Attempt != 1 || task.Inputs["file"] != "main.go" {
+		t.Errorf("unexpected replay %s: %+v", msg.Subject, task)
+	}
+	if _, err := db.GetDeadLetter("t1"); err == nil {
+		t.Error("expected t1 off the dead-letter queue")
+	}
+	if _, err := db.GetDeadLetter("t2"); err != nil {
+		t.Errorf("expected t2 left alone: %v", err)
+	}
+	if recs, _ := db.ListTasks(taskFilter{Status: "pending"}); len(recs) != 1 || recs[0].TaskID != "t1" {
+		t.Errorf("expected t1 pending, got %v", recs)
+	}
+}
+
+func TestDLQ_Drop(t *testing.T) {
+	db := deadLetterDB(t)
+	a := &app{dataDir: filepath.Dir(db.dbPath)}
+
+	if err := (&DLQDropCmd{TaskIDs: []string{"t2"}}).Run(a); err != nil {
+		t.Fatal(err)
+	}
+	if letters, _ := db.ListDeadLetters(""); len(letters) != 1 || letters[0].Task.TaskID != "t1" {
+		t.Errorf("expected only t1 left, got %v", letters)
+	}
+	if recs, _ := db.ListTasks(taskFilter{Status: "failed"}); len(recs) != 1 || recs[0].TaskID != "t2" {
+		t.Errorf("expected t2 failed, got %v", recs)
+	}
+
+	if err := (&DLQDropCmd{TaskIDs: []string{"t1"}, All: true}).Run(a); err == nil {
+		t.Error("expected task IDs and --all to be refused together")
+	}
+}
@@ -13,7 +13,9 @@ import (
 	"os/user"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -38,10 +40,15 @@ type CLI struct {
 	Up           UpCmd           `cmd:"" help:"Start swarm from swarm.yaml"`
 	Down         DownCmd         `cmd:"" help:"Stop swarm agents"`
 	Restart      RestartCmd      `cmd:"" help:"Restart swarm agents"`
+	Apply        ApplyCmd        `cmd:"" help:"Start or stop agents to match swarm.yaml"`
 	UI           UICmd           `cmd:"" help:"Interactive TUI dashboard"`
 	Replay       ReplayCmd       `cmd:"" help:"Replay task execution"`
 	Chain        ChainCmd        `cmd:"" help:"Chain tasks through multiple agents"`
+	Pipeline     PipelineCmd     `cmd:"" help:"Run multi-stage pipelines"`
 	Purge        PurgeCmd        `cmd:"" help:"Purge NATS stream (clear all replay history)"`
+	DLQ          DLQCmd          `cmd:"" name:"dlq" help:"Inspect and replay dead-lettered tasks"`
+	Scaling      ScalingCmd      `cmd:"" help:"Show autoscaling decisions"`
+	GC           GCCmd           `cmd:"" name:"gc" help:"Remove old tasks and compact the task database"`
 }
 
 type StatusCmd struct{}
@@ -53,6 +60,7 @@ type SubmitCmd struct {
 	File       string   `name:"file" short:"f" help:"Load inputs from JSON file" type:"existingfile"`
 	Task       string   `arg:"" optional:"" help:"Task description (used as 'task' input if no --input specified)"`
 	NoWait     bool     `name:"nowait" help:"Don't wait for result (fire-and-forget)"`
+	Key        string   `name:"idempotency-key" short:"k" help:"Run at most once per key: a repeat returns the earlier result or waits for the running task"`
 }
 type DiscussCmd struct {
 	Inputs []string `name:"input" short:"i" sep:"none" help:"Input as name=value (can repeat)"`
@@ -65,9 +73,22 @@ type ResultCmd struct {
 }
 type HistoryCmd struct {
 	Capability string `name:"capability" short:"c" help:"Filter by capability"`
-	Status     string `name:"status" short:"s" help:"Filter by status (pending, running, success, failed)"`
+	Status     string `name:"status" short:"s" help:"Filter by status (pending, running, retrying, success, failed, dead_letter)"`
+	Submitter  string `name:"submitter" short:"u" help:"Filter by submitter (user, manager agent, or 'human' for the web UI)"`
+	Since      string `name:"since" help:"Only tasks created at or after: a date (2006-01-02), a time (RFC 3339) or an age (24h, 7d)"`
+	Until      string `name:"until" help:"Only tasks created at or before, in the same forms as --since"`
 	Limit      int    `name:"limit" short:"l" help:"Max results" default:"20"`
 }
+type GCCmd struct {
+	File      string `name:"file" short:"f" help:"swarm.yaml with a retention section (default: auto-detect in CWD)"`
+	Completed string `name:"completed" help:"Remove successful tasks older than this (e.g. 30d; 'forever' keeps them)"`
+	Failed    string `name:"failed" help:"Remove failed and timed-out tasks older than this (default: keep)"`
+	NoCompact bool   `name:"no-compact" help:"Don't rewrite the database to reclaim space"`
+}
+type ScalingCmd struct {
+	Agent string `name:"agent" short:"a" help:"Filter by agent name"`
+	Limit int    `name:"limit" short:"l" help:"Max results" default:"20"`
+}
 type UpCmd struct {
 	Agents []string `name:"agent" short:"a" optional:"" help:"Specific agents to start (default: all)"`
 	File   string   `arg:"" optional:"" default:"swarm.yaml" help:"Manifest file"`
@@ -76,7 +97,17 @@ type DownCmd struct {
 	Agents []string `arg:"" optional:"" help:"Specific agents to stop (default: all)"`
 }
 type RestartCmd struct {
-	Agents []string `arg:"" optional:"" help:"Specific agents to restart (default: all)"`
+	Agents       []string      `arg:"" optional:"" help:"Specific agents or replicas to restart (default: all)"`
+	File         string        `name:"file" short:"f" help:"Manifest file (default: swarm.yaml in CWD)"`
+	DrainTimeout time.Duration `name:"drain-timeout" default:"5m" help:"How long a replica may take to drain before it is killed"`
+	StartTimeout time.Duration `name:"start-timeout" default:"1m" help:"How long to wait for a replacement to register"`
+}
+type ApplyCmd struct {
+	File         string        `arg:"" optional:"" help:"Manifest file (default: swarm.yaml in CWD)"`
+	Watch        bool          `name:"watch" short:"w" help:"Keep running and apply every change to the manifest or the files it references"`
+	DryRun       bool          `name:"dry-run" help:"Show what would change without doing it"`
+	DrainTimeout time.Duration `name:"drain-timeout" default:"5m" help:"How long a replica may take to drain before it is killed"`
+	StartTimeout time.Duration `name:"start-timeout" default:"1m" help:"How long to wait for a new replica to register"`
 }
 type UICmd struct {
 	Port    int    `name:"port" short:"p" default:"9090" help:"Web UI port"`
@@ -163,6 +194,9 @@ func (s *StatusCmd) Run(a *app) error {
 
 	fmt.Printf("Tasks: %d total (%d success, %d failed, %d pending, %d running)\n",
 		stats.Total, stats.Success, stats.Failed, stats.Pending, stats.Running)
+	if stats.Dead > 0 {
+		fmt.Printf("Dead-lettered: %d (see swarm dlq list)\n", stats.Dead)
+	}
 	return nil
 }
 
@@ -350,12 +384,39 @@ func (s *SubmitCmd) Run(a *app) error {
 		return fmt.Errorf("no inputs provided: use --input name=value or positional argument")
 	}
 
+	db, err := a.db()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// A key seen before attaches to that task instead of submitting again
+	if s.Key != "" {
+		if rec, ok := db.FindByIdempotencyKey(s.Capability, s.Key); ok {
+			fmt.Fprintf(os.Stderr, "Idempotency key %q already submitted as %s (%s)\n", s.Key, rec.TaskID, rec.Status)
+			fmt.Println(rec.TaskID)
+			if s.NoWait {
+				return nil
+			}
+			if res, err := db.GetResult(rec.TaskID); err == nil && res != nil {
+				return printResult(res)
+			}
+			result, err := waitForResult(nc, rec.TaskID, db)
+			if err != nil {
+				return err
+			}
+			return printResult(result)
+		}
+	}
+
 	task := tasks.TaskMessage{
-		TaskID:      taskID,
-		Capability:  s.Capability,
-		Inputs:      inputs,
-		Attempt:     1,
-		SubmittedAt: time.Now(),
+		TaskID:         taskID,
+		Capability:     s.Capability,
+		Inputs:         inputs,
+		IdempotencyKey: s.Key,
+		Attempt:        1,
+		SubmittedAt:    time.Now(),
+		SubmittedBy:    submitterName(),
 	}
 
 	data, err := task.Marshal()
@@ -381,12 +442,6 @@ func (s *SubmitCmd) Run(a *app) error {
 	}
 
 	// Record in DB
-	db, err := a.db()
-	if err != nil {
-		return err
-	}
-	defer db.Close()
-
 	if err := db.InsertTask(&task, "pending"); err != nil {
 		return err
 	}
@@ -469,6 +524,7 @@ func (d *DiscussCmd) Run(a *app) error {
 		Inputs:      inputs,
 		Attempt:     1,
 		SubmittedAt: time.Now(),
+		SubmittedBy: submitterName(),
 	}
 
 	data, err := task.Marshal()
@@ -545,7 +601,20 @@ func (h *HistoryCmd) Run(a *app) error {
 	}
 	defer db.Close()
 
-	tasks, err := db.ListTasks(h.Capability, h.Status, h.Limit)
+	filter := taskFilter{Capability: h.Capability, Status: h.Status, SubmittedBy: h.Submitter, Limit: h.Limit}
+	now := time.Now()
+	if h.Since != "" {
+		if filter.Since, err = parseTimeFlag(h.Since, now, false); err != nil {
+			return fmt.Errorf("--since: %w", err)
+		}
+	}
+	if h.Until != "" {
+		if filter.Until, err = parseTimeFlag(h.Until, now, true); err != nil {
+			return fmt.Errorf("--until: %w", err)
+		}
+	}
+
+	tasks, err := db.ListTasks(filter)
 	if err != nil {
 		return err
 	}
@@ -556,8 +625,94 @@ func (h *HistoryCmd) Run(a *app) error {
 	}
 
 	for _, t := range tasks {
-		fmt.Printf("%s\t%s\t%s\t%s\n", t.TaskID, t.Capability, t.Status, t.CreatedAt.Format("2006-01-02 15:04"))
+		fmt.Printf("%s\t%s\t%s\t%s\t%s\n", t.TaskID, t.Capability, t.Status, t.CreatedAt.Format("2006-01-02 15:04"), t.SubmittedBy)
+	}
+	return nil
+}
+
+// parseTimeFlag reads a --since/--until value: a date, an RFC 3339 time
+// or an age before now. A bare date used as an upper bound covers the
+// whole day.
+func parseTimeFlag(v string, now time.Time, endOfDay bool) (time.Time, error) {
+	if d, err := parseAge(v); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04", v, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not a date, time or age", v)
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
+
+// parseAge parses a Go duration, also accepting whole days ("30d").
+func parseAge(v string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q", v)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q", v)
+	}
+	return d, nil
+}
+
+func (g *GCCmd) Run(a *app) error {
+	policy := defaultRetention
+	manifestPath := g.File
+	if manifestPath == "" {
+		manifestPath, _ = findManifest()
+	}
+	if manifestPath != "" {
+		m, err := loadManifest(manifestPath)
+		if err != nil {
+			return err
+		}
+		policy = m.RetentionPolicy()
+	}
+	var err error
+	if g.Completed != "" {
+		if policy.Completed, err = parseRetention(g.Completed); err != nil {
+			return fmt.Errorf("--completed: %w", err)
+		}
+	}
+	if g.Failed != "" {
+		if policy.Failed, err = parseRetention(g.Failed); err != nil {
+			return fmt.Errorf("--failed: %w", err)
+		}
+	}
+
+	db, err := a.db()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	removed, err := db.Prune(policy, time.Now())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Removed %d tasks\n", removed)
+	if g.NoCompact {
+		return nil
+	}
+	before, after, err := db.Compact()
+	if err != nil {
+		return err
 	}
+	fmt.Printf("Compacted %s: %d KB → %d KB\n", db.dbPath, before/1024, after/1024)
 	return nil
 }
 
@@ -589,6 +744,28 @@ func (u *UpCmd) Run(a *app) error {
 		defer nc.Close()
 	}
 
+	// Retry failed tasks and dead-letter exhausted ones while the swarm runs
+	var db *taskDB
+	if nc != nil {
+		if db, err = a.db(); err != nil {
+			return err
+		}
+		defer db.Close()
+		sup, err := startRetrySupervisor(nc, m, db)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  Task retries unavailable: %v\n", err)
+		} else {
+			defer sup.stop()
+		}
+	}
+
+	// Apply task retention now and every few hours while the swarm runs
+	if db != nil {
+		stopPrune := make(chan struct{})
+		defer close(stopPrune)
+		go pruneTasks(db, m.RetentionPolicy(), stopPrune)
+	}
+
 	// Filter agents if specified
 	agents := m.Agents
 	if len(u.Agents) > 0 {
@@ -608,8 +785,60 @@ func (u *UpCmd) Run(a *app) error {
 	// Load existing PID records and clean stale entries
 	existingPIDs := cleanStalePIDs(loadPIDRecords(a.dataDir))
 
+	// start launches one replica with its output piped through this
+	// process. The autoscaler uses it too, so it may run concurrently.
+	var (
+		pidMu   sync.Mutex
+		newPIDs []pidRecord
+	)
+	start := func(ag AgentSpec, displayName string) (pidRecord, bool) {
+		fmt.Printf("  → %s [%s] (%s)\n", displayName, ag.Type, ag.Capability)
+		cmd := agentCommand(m, ag, displayName, agents)
+		// Prefix each agent's output with its name for multi-agent clarity
+		stdoutPipe, _ := cmd.StdoutPipe()
+		stderrPipe, _ := cmd.StderrPipe()
+		if err := cmd.Start(); err != nil {
+			fmt.Printf("  ✗ Failed to start %s: %v\n", displayName, err)
+			return pidRecord{}, false
+		}
+		go prefixLines(displayName, ag.Capability, stdoutPipe, os.Stdout, nc)
+		go prefixLines(displayName, ag.Capability, stderrPipe, os.Stderr, nc)
+
+		// Brief pause to catch immediate crashes (missing binary, bad config, etc.)
+		doneCh := make(chan error, 1)
+		go func() { doneCh <- cmd.Wait() }()
+		select {
+		case err := <-doneCh:
+			// Process already exited — it crashed
+			fmt.Printf("  ✗ %s exited immediately: %v\n", displayName, err)
+			if nc != nil {
+				payload, _ := json.Marshal(map[string]string{
+					"agent":      displayName,
+					"line":       fmt.Sprintf("FATAL: agent exited immediately: %v", err),
+					"capability": ag.Capability,
+				})
+				nc.Publish(fmt.Sprintf("log.%s", displayName), payload)
+			}
+			return pidRecord{}, false
+		case <-time.After(500 * time.Millisecond):
+			// Still running after 500ms — likely healthy
+		}
+
+		fmt.Printf("  ✓ Started %s (pid %d)\n", displayName, cmd.Process.Pid)
+		rec := pidRecord{
+			Name:       displayName,
+			PID:        cmd.Process.Pid,
+			Capability: ag.Capability,
+			StartedAt:  time.Now().Format(time.RFC3339),
+			SpecHash:   specHash(cmd, ag),
+		}
+		pidMu.Lock()
+		newPIDs = append(newPIDs, rec)
+		pidMu.Unlock()
+		return rec, true
+	}
+
 	// Start each agent (with replicas for workers)
-	var newPIDs []pidRecord
 	for _, ag := range agents {
 		replicas := ag.Replicas
 		if replicas < 1 {
@@ -621,83 +850,7 @@ func (u *UpCmd) Run(a *app) error {
 		}
 
 		for replica := 0; replica < replicas; replica++ {
-			displayName := ag.Name
-			if replicas > 1 {
-				displayName = fmt.Sprintf("%s-%d", ag.Name, replica+1)
-			}
-
-			fmt.Printf("  → %s [%s] (%s)\n", displayName, ag.Type, ag.Capability)
-			args := []string{"serve", "--bus", m.NATS.URL}
-			if ag.Config != "" {
-				args = append(args, "--config", ag.Config)
-			}
-			if ag.Policy != "" {
-				args = append(args, "--policy", ag.Policy)
-			}
-			if ag.Capability != "" {
-				args = append(args, "--capability", ag.Capability)
-			}
-			// Auto-isolate state per agent instance under swarm state location
-			agentState := ag.State
-			if agentState == "" {
-				agentState = filepath.Join(m.State.Location, "agents", displayName)
-			}
-			args = append(args, "--state", agentState)
-			args = append(args, "--session-label", displayName)
-			if ag.Agentfile != "" {
-				args = append(args, ag.Agentfile)
-			}
-
-			cmd := exec.Command("agent", args...)
-			// Pass agent type via environment variable
-			cmd.Env = append(os.Environ(), fmt.Sprintf("AGENT_TYPE=%s", ag.Type))
-			// For managers: pass worker capabilities so the dispatch tool knows targets
-			if ag.Type == "manager" {
-				var caps []string
-				for _, other := range agents {
-					if other.Type == "worker" && other.Capability != "" {
-						caps = append(caps, fmt.Sprintf("%s:%d", other.Capability, other.Replicas))
-					}
-				}
-				cmd.Env = append(cmd.Env, fmt.Sprintf("SWARM_CAPABILITIES=%s", strings.Join(caps, ",")))
-			}
-			// Prefix each agent's output with its name for multi-agent clarity
-			stdoutPipe, _ := cmd.StdoutPipe()
-			stderrPipe, _ := cmd.StderrPipe()
-			if err := cmd.Start(); err != nil {
-				fmt.Printf("  ✗ Failed to start %s: %v\n", displayName, err)
-				continue
-			}
-			go prefixLines(displayName, ag.Capability, stdoutPipe, os.Stdout, nc)
-			go prefixLines(displayName, ag.Capability, stderrPipe, os.Stderr, nc)
-
-			// Brief pause to catch immediate crashes (missing binary, bad config, etc.)
-			doneCh := make(chan error, 1)
-			go func() { doneCh <- cmd.Wait() }()
-			select {
-			case err := <-doneCh:
-				// Process already exited — it crashed
-				fmt.Printf("  ✗ %s exited immediately: %v\n", displayName, err)
-				if nc != nil {
-					payload, _ := json.Marshal(map[string]string{
-						"agent":      displayName,
-						"line":       fmt.Sprintf("FATAL: agent exited immediately: %v", err),
-						"capability": ag.Capability,
-					})
-					nc.Publish(fmt.Sprintf("log.%s", displayName), payload)
-				}
-				continue
-			case <-time.After(500 * time.Millisecond):
-				// Still running after 500ms — likely healthy
-			}
-
-			fmt.Printf("  ✓ Started %s (pid %d)\n", displayName, cmd.Process.Pid)
-			newPIDs = append(newPIDs, pidRecord{
-				Name:       displayName,
-				PID:        cmd.Process.Pid,
-				Capability: ag.Capability,
-				StartedAt:  time.Now().Format(time.RFC3339),
-			})
+			start(ag, replicaName(ag, replicas, replica))
 		}
 	}
 
@@ -707,6 +860,14 @@ func (u *UpCmd) Run(a *app) error {
 		fmt.Fprintf(os.Stderr, "⚠️  Failed to save PID records: %v\n", err)
 	}
 
+	// Follow the work queues of agents with min/max_replicas
+	var scaler *autoscaler
+	if nc != nil {
+		if scaler, err = startAutoscaler(nc, db, agents, start, a.dataDir); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  Autoscaling unavailable: %v\n", err)
+		}
+	}
+
 	fmt.Println("Swarm started. Press Ctrl+C to stop all agents.")
 
 	// Stay alive to pipe agent output and handle shutdown
@@ -714,6 +875,12 @@ func (u *UpCmd) Run(a *app) error {
 	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
 	<-sigCh
 
+	if scaler != nil {
+		scaler.stop()
+	}
+	pidMu.Lock()
+	defer pidMu.Unlock()
+
 	fmt.Println("\nShutting down agents...")
 	for _, r := range newPIDs {
 		if isProcessAlive(r.PID) {
@@ -741,6 +908,76 @@ func (u *UpCmd) Run(a *app) error {
 	return nil
 }
 
+// pruneInterval is how often `swarm up` applies task retention.
+const pruneInterval = 6 * time.Hour
+
+// pruneTasks removes tasks past retention until stop is closed.
+func pruneTasks(db *taskDB, policy retentionPolicy, stop <-chan struct{}) {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+	for {
+		if n, err := db.Prune(policy, time.Now()); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  Task cleanup failed: %v\n", err)
+		} else if n > 0 {
+			fmt.Printf("Removed %d tasks past retention\n", n)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// replicaName is the display name of one replica of an agent. Replicas
+// are numbered when there are several, or may be.
+func replicaName(ag AgentSpec, replicas, replica int) string {
+	if replicas > 1 || ag.Autoscaled() {
+		return fmt.Sprintf("%s-%d", ag.Name, replica+1)
+	}
+	return ag.Name
+}
+
+// agentCommand builds the `agent serve` process for one replica. agents
+// lists the workers a manager may dispatch to.
+func agentCommand(m *Manifest, ag AgentSpec, displayName string, agents []AgentSpec) *exec.Cmd {
+	args := []string{"serve", "--bus", m.NATS.URL}
+	if ag.Config != "" {
+		args = append(args, "--config", ag.Config)
+	}
+	if ag.Policy != "" {
+		args = append(args, "--policy", ag.Policy)
+	}
+	if ag.Capability != "" {
+		args = append(args, "--capability", ag.Capability)
+	}
+	// Auto-isolate state per agent instance under swarm state location
+	agentState := ag.State
+	if agentState == "" {
+		agentState = filepath.Join(m.State.Location, "agents", displayName)
+	}
+	args = append(args, "--state", agentState)
+	args = append(args, "--session-label", displayName)
+	if ag.Agentfile != "" {
+		args = append(args, ag.Agentfile)
+	}
+
+	cmd := exec.Command("agent", args...)
+	// Pass agent type via environment variable
+	cmd.Env = append(os.Environ(), fmt.Sprintf("AGENT_TYPE=%s", ag.Type))
+	// For managers: pass worker capabilities so the dispatch tool knows targets
+	if ag.Type == "manager" {
+		var caps []string
+		for _, other := range agents {
+			if other.Type == "worker" && other.Capability != "" {
+				caps = append(caps, fmt.Sprintf("%s:%d", other.Capability, other.Replicas))
+			}
+		}
+		cmd.Env = append(cmd.Env, fmt.Sprintf("SWARM_CAPABILITIES=%s", strings.Join(caps, ",")))
+	}
+	return cmd
+}
+
 func (d *DownCmd) Run(a *app) error {
 	// Phase 1: Try NATS discovery + control signal
 	natsOK := false
@@ -856,12 +1093,6 @@ func (d *DownCmd) Run(a *app) error {
 	return nil
 }
 
-func (r *RestartCmd) Run(a *app) error {
-	// Restart = down + up
-	// For now, just warn that this requires a manifest
-	fmt.Println("Restart requires a manifest file. Use: swarm down && swarm up")
-	return nil
-}
 
 func (u *UICmd) Run(a *app) error {
 	if u.TUI {
@@ -926,10 +1157,15 @@ func (u *UICmd) Run(a *app) error {
 }
 
 func (r *ReplayCmd) Run(a *app) error {
+	db, err := a.db()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
 	if r.Web {
-		return replayWeb(r.TaskID)
+		return replayWeb(db, r.TaskID)
 	}
-	return replayTask(r.TaskID)
+	return replayTask(db, r.TaskID)
 }
 
 func (c *ChainCmd) Run(a *app) error {
@@ -978,10 +1214,11 @@ func (c *ChainCmd) Run(a *app) error {
 		inputs := map[string]string{"task": prevOutput}
 
 		tm := tasks.TaskMessage{
-			TaskID:     taskID,
-			Capability: cap,
-			Inputs:     inputs,
-			Attempt:    1,
+			TaskID:      taskID,
+			Capability:  cap,
+			Inputs:      inputs,
+			Attempt:     1,
+			SubmittedBy: submitterName(),
 		}
 
 		data, err := tm.Marshal()
@@ -1056,252 +1293,13 @@ func truncate(s string, max int) string {
 	return s[:max] + "..."
 }
 
-// taskDB provides SQLite persistence for task history.
-type taskDB struct {
-	dbPath string
-}
-
-type taskRecord struct {
-	TaskID     string
-	Capability string
-	Status     string
-	CreatedAt  time.Time
-	DurationMs int64
-}
-
-type taskStats struct {
-	Total   int
-	Success int
-	Failed  int
-	Pending int
-	Running int
-}
-
-func openTaskDB(path string) (*taskDB, error) {
-	// Use modernc.org/sqlite (CGO-free) if available, else skip persistence
-	// For now, use a simple JSON file approach
-	return &taskDB{dbPath: path}, nil
-}
-
-func (d *taskDB) Close() error { return nil }
-
-func (d *taskDB) InsertTask(task *tasks.TaskMessage, status string) error {
-	records := d.loadRecords()
-
-	// Deduplicate — skip if task already recorded
-	for _, r := range records {
-		if r.TaskID == task.TaskID {
-			return nil
-		}
-	}
-
-	records = append(records, taskRecord{
-		TaskID:     task.TaskID,
-		Capability: task.Capability,
-		Status:     status,
-		CreatedAt:  time.Now(),
-	})
-	if err := d.saveRecords(records); err != nil {
-		return err
-	}
-
-	// Save full input message for later retrieval
-	inputDir := filepath.Join(filepath.Dir(d.dbPath), "tasks")
-	if err := os.MkdirAll(inputDir, 0755); err != nil {
-		return fmt.Errorf("create task input dir: %w", err)
-	}
-	data, err := task.Marshal()
-	if err != nil {
-		return fmt.Errorf("marshal task input: %w", err)
-	}
-	if err := os.WriteFile(filepath.Join(inputDir, task.TaskID+".input.json"), data, 0644); err != nil {
-		return fmt.Errorf("write task input: %w", err)
-	}
-	return nil
-}
-
-func (d *taskDB) GetTask(taskID string) (*tasks.TaskMessage, error) {
-	inputDir := filepath.Join(filepath.Dir(d.dbPath), "tasks")
-	data, err := os.ReadFile(filepath.Join(inputDir, taskID+".input.json"))
-	if err != nil {
-		return nil, err
-	}
-	return tasks.UnmarshalTaskMessage(data)
-}
-
-func (d *taskDB) UpdateResult(result *tasks.TaskResult) error {
-	// Update status in records
-	records := d.loadRecords()
-	for i, r := range records {
-		if r.TaskID == result.TaskID {
-			records[i].Status = string(result.Status)
-			records[i].DurationMs = result.DurationMs
-			break
-		}
-	}
-	if err := d.saveRecords(records); err != nil {
-		return err
-	}
-
-	// Save full result to file for replay
-	resultDir := filepath.Join(filepath.Dir(d.dbPath), "tasks")
-	if err := os.MkdirAll(resultDir, 0755); err != nil {
-		return fmt.Errorf("create result dir: %w", err)
-	}
-	resultPath := filepath.Join(resultDir, result.TaskID+".json")
-	data, err := json.MarshalIndent(result, "", "  ")
-	if err != nil {
-		return fmt.Errorf("marshal result: %w", err)
-	}
-	if err := os.WriteFile(resultPath, data, 0644); err != nil {
-		return fmt.Errorf("write result: %w", err)
-	}
-
-	return nil
-}
-
-func (d *taskDB) GetResult(taskID string) (*tasks.TaskResult, error) {
-	// Check result files
-	resultDir := filepath.Join(filepath.Dir(d.dbPath), "tasks")
-	data, err := os.ReadFile(filepath.Join(resultDir, taskID+".json"))
-	if err != nil {
-		return nil, err
-	}
-	var res tasks.TaskResult
-	if err := json.Unmarshal(data, &res); err != nil {
-		return nil, err
-	}
-	return &res, nil
-}
-
-func (d *taskDB) ListTasks(capability, status string, limit int) ([]taskRecord, error) {
-	records := d.loadRecords()
-
-	// Filter
-	filtered := make([]taskRecord, 0)
-	for _, r := range records {
-		if capability != "" && r.Capability != capability {
-			continue
-		}
-		if status != "" && r.Status != status {
-			continue
-		}
-		filtered = append(filtered, r)
-	}
-
-	// Sort by created desc
-	sort.Slice(filtered, func(i, j int) bool {
-		return filtered[i].CreatedAt.After(filtered[j].CreatedAt)
-	})
-
-	if len(filtered) > limit {
-		filtered = filtered[:limit]
-	}
-	return filtered, nil
-}
-
-func (d *taskDB) Stats() (taskStats, error) {
-	records := d.loadRecords()
-	var s taskStats
-	for _, r := range records {
-		s.Total++
-		switch r.Status {
-		case "success":
-			s.Success++
-		case "failed":
-			s.Failed++
-		case "pending":
-			s.Pending++
-		case "running":
-			s.Running++
-		}
-	}
-	return s, nil
-}
-
-func (d *taskDB) loadRecords() []taskRecord {
-	recordsPath := filepath.Join(filepath.Dir(d.dbPath), "tasks.json")
-	data, err := os.ReadFile(recordsPath)
-	if err != nil {
-		return nil
-	}
-	var records []taskRecord
-	json.Unmarshal(data, &records)
-	return records
-}
-
-func (d *taskDB) saveRecords(records []taskRecord) error {
-	dir := filepath.Dir(d.dbPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return err
-	}
-	recordsPath := filepath.Join(dir, "tasks.json")
-	data, err := json.MarshalIndent(records, "", "  ")
-	if err != nil {
-		return err
-	}
-	return os.WriteFile(recordsPath, data, 0644)
-}
-
-// threadEntry represents a single contribution in a discuss thread.
-type threadEntry struct {
-	AgentID    string    `json:"agent_id"`
-	Capability string    `json:"capability,omitempty"`
-	Name       string    `json:"name,omitempty"` // swarm agent display name (for @mentions)
-	Type       string    `json:"type"`           // "topic", "execute", "comment", "human"
-	Content    string    `json:"content"`
-	Round      int       `json:"round,omitempty"`
-	Timestamp  time.Time `json:"timestamp"`
-}
-
-// AppendThread adds an entry to a discuss thread (JSONL file).
-func (d *taskDB) AppendThread(taskID string, entry threadEntry) error {
-	threadDir := filepath.Join(filepath.Dir(d.dbPath), "tasks")
-	if err := os.MkdirAll(threadDir, 0755); err != nil {
-		return fmt.Errorf("create thread dir: %w", err)
-	}
-	threadPath := filepath.Join(threadDir, taskID+".thread.jsonl")
-	data, err := json.Marshal(entry)
-	if err != nil {
-		return fmt.Errorf("marshal thread entry: %w", err)
-	}
-	f, err := os.OpenFile(threadPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("open thread file: %w", err)
-	}
-	defer f.Close()
-	_, err = f.Write(append(data, '\n'))
-	return err
-}
-
-// GetThread returns all entries in a discuss thread.
-func (d *taskDB) GetThread(taskID string) ([]threadEntry, error) {
-	threadDir := filepath.Join(filepath.Dir(d.dbPath), "tasks")
-	threadPath := filepath.Join(threadDir, taskID+".thread.jsonl")
-	data, err := os.ReadFile(threadPath)
-	if err != nil {
-		return nil, err
-	}
-	var entries []threadEntry
-	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
-		if line == "" {
-			continue
-		}
-		var entry threadEntry
-		if err := json.Unmarshal([]byte(line), &entry); err != nil {
-			continue
-		}
-		entries = append(entries, entry)
-	}
-	return entries, nil
-}
-
 // pidRecord tracks a started agent process.
 type pidRecord struct {
 	Name       string `json:"name"`
 	PID        int    `json:"pid"`
 	Capability string `json:"capability"`
 	StartedAt  string `json:"started_at"`
+	SpecHash   string `json:"spec_hash,omitempty"` // see specHash; empty for older records
 }
 
 func pidFilePath(dataDir string) string {
@@ -1329,6 +1327,35 @@ func savePIDRecords(dataDir string, records []pidRecord) error {
 	return os.WriteFile(pidFilePath(dataDir), data, 0644)
 }
 
+// recordPID adds a replica's record, replacing any earlier one of the
+// same name.
+func recordPID(dataDir string, rec pidRecord) {
+	records := cleanStalePIDs(loadPIDRecords(dataDir))
+	kept := records[:0]
+	for _, r := range records {
+		if r.Name != rec.Name {
+			kept = append(kept, r)
+		}
+	}
+	if err := savePIDRecords(dataDir, append(kept, rec)); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  Failed to save PID records: %v\n", err)
+	}
+}
+
+// forgetPID removes a stopped replica's record.
+func forgetPID(dataDir, name string) {
+	records := cleanStalePIDs(loadPIDRecords(dataDir))
+	kept := records[:0]
+	for _, r := range records {
+		if r.Name != name {
+			kept = append(kept, r)
+		}
+	}
+	if err := savePIDRecords(dataDir, kept); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  Failed to save PID records: %v\n", err)
+	}
+}
+
 // isProcessAlive checks if a process exists using kill(pid, 0).
 func isProcessAlive(pid int) bool {
 	proc, err := os.FindProcess(pid)
@@ -1394,6 +1421,15 @@ func discoverAgentsViaHeartbeat(nc *nats.Conn, timeout time.Duration) []discover
 	return agents
 }
 
+// submitterName identifies tasks submitted from this CLI: the local user
+// name.
+func submitterName() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return "cli"
+}
+
 // getUserHome returns the current user's home directory.
 // prefixLines reads from r line-by-line and writes each line to w with a
 // [name] prefix. Uses bufio.Reader to stream without line-length limits —
@@ -6,7 +6,9 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/vinayprograms/agent/internal/swarm"
 	"gopkg.in/yaml.v3"
 )
 
@@ -15,11 +17,20 @@ type CollaborationConfig struct {
 	InterruptCheck *bool `yaml:"interrupt_check"` // default: true
 }
 
+// RetentionConfig sets how long finished tasks stay in the task database.
+// Values are ages such as 30d or 12h, or "forever".
+type RetentionConfig struct {
+	Completed string `yaml:"completed"` // successful tasks (default: 30d)
+	Failed    string `yaml:"failed"`    // failed and timed-out tasks (default: forever)
+}
+
 // Manifest represents a swarm.yaml deployment descriptor.
 type Manifest struct {
 	NATS          NATSConfig          `yaml:"nats"`
 	State         StateConfig         `yaml:"state"`
 	Collaboration CollaborationConfig `yaml:"collaboration"`
+	Retry         *swarm.RetryPolicy  `yaml:"retry"` // default for agents without their own
+	Retention     RetentionConfig     `yaml:"retention"`
 	Agents        []AgentSpec         `yaml:"agents"`
 
 	// Deprecated: use State instead. Parsed for backwards compat.
@@ -51,6 +62,52 @@ type AgentSpec struct {
 	State      string `yaml:"state"`
 	Type       string `yaml:"type"`     // "worker" (default) or "manager"
 	Replicas   int    `yaml:"replicas"` // Number of instances (default: 1, only for workers)
+
+	Retry *swarm.RetryPolicy `yaml:"retry"` // retries for failed tasks of this capability
+
+	// Autoscaling (workers only): replicas start at Replicas and follow the
+	// work queue within [MinReplicas, MaxReplicas]. Off unless MaxReplicas is set.
+	MinReplicas int                `yaml:"min_replicas"`
+	MaxReplicas int                `yaml:"max_replicas"`
+	Scale       *swarm.ScalePolicy `yaml:"scale"`
+}
+
+// Autoscaled reports whether the agent's replica count follows its queue.
+func (ag AgentSpec) Autoscaled() bool {
+	return ag.MaxReplicas > 0
+}
+
+// RetryPolicy returns the retry policy for a capability: the first agent
+// serving it that sets one, else the manifest default. Nil means failed
+// tasks are not retried.
+func (m *Manifest) RetryPolicy(capability string) *swarm.RetryPolicy {
+	for _, ag := range m.Agents {
+		if ag.Capability == capability && ag.Retry != nil {
+			return ag.Retry
+		}
+	}
+	return m.Retry
+}
+
+// RetentionPolicy returns the task retention from the manifest, with
+// defaults for unset fields. loadManifest has validated the values.
+func (m *Manifest) RetentionPolicy() retentionPolicy {
+	p := defaultRetention
+	if m.Retention.Completed != "" {
+		p.Completed, _ = parseRetention(m.Retention.Completed)
+	}
+	if m.Retention.Failed != "" {
+		p.Failed, _ = parseRetention(m.Retention.Failed)
+	}
+	return p
+}
+
+// parseRetention reads a retention age; "forever" (or 0) keeps tasks.
+func parseRetention(v string) (time.Duration, error) {
+	if v == "forever" {
+		return 0, nil
+	}
+	return parseAge(v)
 }
 
 // migrateStorage handles backwards compat: storage.root → state.location.
@@ -136,9 +193,66 @@ func loadManifest(path string) (*Manifest, error) {
 		return nil, fmt.Errorf("manifest defines %d managers; at most one is allowed", managerCount)
 	}
 
+	for _, v := range []string{m.Retention.Completed, m.Retention.Failed} {
+		if v == "" {
+			continue
+		}
+		if _, err := parseRetention(v); err != nil {
+			return nil, fmt.Errorf("retention: %w", err)
+		}
+	}
+	if m.Retry != nil {
+		if err := m.Retry.Validate(); err != nil {
+			return nil, fmt.Errorf("retry: %w", err)
+		}
+	}
+	for i := range m.Agents {
+		if err := m.Agents[i].validateScaling(); err != nil {
+			return nil, fmt.Errorf("agent %q: %w", m.Agents[i].Name, err)
+		}
+		if m.Agents[i].Retry != nil {
+			if err := m.Agents[i].Retry.Validate(); err != nil {
+				return nil, fmt.Errorf("agent %q: retry: %w", m.Agents[i].Name, err)
+			}
+		}
+	}
+
 	return &m, nil
 }
 
+// validateScaling checks the autoscaling bounds and keeps the initial
+// replica count within them.
+func (ag *AgentSpec) validateScaling() error {
+	if !ag.Autoscaled() {
+		if ag.MinReplicas > 0 || ag.Scale != nil {
+			return fmt.Errorf("min_replicas and scale need max_replicas")
+		}
+		return nil
+	}
+	if ag.Type == "manager" {
+		return fmt.Errorf("managers cannot autoscale")
+	}
+	if ag.MinReplicas < 1 {
+		ag.MinReplicas = 1
+	}
+	if ag.MaxReplicas < ag.MinReplicas {
+		return fmt.Errorf("max_replicas (%d) is below min_replicas (%d)", ag.MaxReplicas, ag.MinReplicas)
+	}
+	if ag.Replicas < ag.MinReplicas {
+		ag.Replicas = ag.MinReplicas
+	}
+	if ag.Replicas > ag.MaxReplicas {
+		ag.Replicas = ag.MaxReplicas
+	}
+	if ag.Scale == nil {
+		ag.Scale = &swarm.ScalePolicy{}
+	}
+	if err := ag.Scale.Validate(); err != nil {
+		return fmt.Errorf("scale: %w", err)
+	}
+	return nil
+}
+
 // resolveRelPath makes a relative path absolute by joining with baseDir.
 // Returns the path unchanged if it's empty or already absolute.
 func resolveRelPath(baseDir, path string) string {
@@ -0,0 +1,576 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/vinayprograms/agent/internal/swarm"
+	"github.com/vinayprograms/agentkit/tasks"
+)
+
+// PipelineCmd runs multi-stage pipeline files (see the swarm PRD).
+type PipelineCmd struct {
+	Run  PipelineRunCmd  `cmd:"" help:"Run a pipeline file"`
+	Show PipelineShowCmd `cmd:"" help:"Show a pipeline run, or list recent runs"`
+}
+
+type PipelineRunCmd struct {
+	File   string   `arg:"" help:"Pipeline file" type:"existingfile"`
+	Inputs []string `name:"input" short:"i" sep:"none" help:"Pipeline input as name=value (can repeat)"`
+}
+
+type PipelineShowCmd struct {
+	RunID string `arg:"" optional:"" help:"Pipeline run ID"`
+	Limit int    `name:"limit" short:"l" help:"Max runs to list" default:"20"`
+}
+
+// Stage statuses in a pipeline run. Tasks use the usual task statuses.
+const (
+	stagePending = "pending"
+	stageRunning = "running"
+	stageSuccess = "success"
+	stagePartial = "partial" // fan-out with on_failure: continue, some tasks failed
+	stageFailed  = "failed"
+	stageSkipped = "skipped"
+)
+
+// pipelineRun is the progress of one run, kept in the task DB.
+type pipelineRun struct {
+	RunID      string             `json:"run_id"`
+	Pipeline   string             `json:"pipeline"`
+	File       string             `json:"file"`
+	Status     string             `json:"status"` // running, success, partial, failed
+	Inputs     map[string]string  `json:"inputs,omitempty"`
+	StartedAt  time.Time          `json:"started_at"`
+	FinishedAt time.Time          `json:"finished_at,omitzero"`
+	Stages     []pipelineStageRun `json:"stages"`
+}
+
+type pipelineStageRun struct {
+	Name       string    `json:"name"`
+	Capability string    `json:"capability"`
+	Status     string    `json:"status"`
+	TaskIDs    []string  `json:"task_ids,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at,omitzero"`
+	FinishedAt time.Time `json:"finished_at,omitzero"`
+}
+
+// stageOutcome is what a finished stage reports back to the scheduler.
+type stageOutcome struct {
+	name    string
+	output  interface{}
+	taskIDs []string
+	failed  int // tasks that did not succeed
+	total   int
+	err     error
+}
+
+// pipelineRunner schedules a pipeline's stages as their needs finish.
+type pipelineRunner struct {
+	nc  *nats.Conn
+	db  *taskDB
+	p   *swarm.Pipeline
+	run *pipelineRun
+
+	mu sync.Mutex // guards run and db writes from stage goroutines
+}
+
+func (c *PipelineRunCmd) Run(a *app) error {
+	data, err := os.ReadFile(c.File)
+	if err != nil {
+		return fmt.Errorf("read pipeline: %w", err)
+	}
+	p, err := swarm.ParsePipeline(data)
+	if err != nil {
+		return err
+	}
+	if p.Name == "" {
+		p.Name = strings.TrimSuffix(filepath.Base(c.File), filepath.Ext(c.File))
+	}
+
+	inputs := map[string]string{}
+	for k, v := range p.Inputs {
+		inputs[k] = expandEnv(v)
+	}
+	for _, kv := range c.Inputs {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return fmt.Errorf("invalid input %q (expected name=value)", kv)
+		}
+		if _, declared := p.Inputs[k]; !declared {
+			return fmt.Errorf("input %q is not declared in the pipeline", k)
+		}
+		inputs[k] = v
+	}
+
+	nc, err := a.connect()
+	if err != nil {
+		return err
+	}
+	defer nc.Close()
+
+	db, err := a.db()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	r := &pipelineRunner{
+		nc: nc,
+		db: db,
+		p:  p,
+		run: &pipelineRun{
+			RunID:     fmt.Sprintf("p-%s", uuid.New().String()[:8]),
+			Pipeline:  p.Name,
+			File:      c.File,
+			Status:    "running",
+			Inputs:    inputs,
+			StartedAt: time.Now(),
+		},
+	}
+	for _, s := range p.Stages {
+		r.run.Stages = append(r.run.Stages, pipelineStageRun{Name: s.Name, Capability: s.Capability, Status: stagePending})
+	}
+	r.save()
+	fmt.Printf("Pipeline %s (run %s, %d stages)\n", p.Name, r.run.RunID, len(p.Stages))
+
+	state := &swarm.PipelineState{Inputs: inputs, Outputs: map[string]interface{}{}}
+	r.execute(state)
+
+	fmt.Printf("\nPipeline %s: %s\n", r.run.RunID, r.run.Status)
+	if r.run.Status == "failed" {
+		return fmt.Errorf("pipeline failed (see swarm pipeline show %s)", r.run.RunID)
+	}
+	// Print the final outputs: those of stages nothing else needs
+	needed := map[string]bool{}
+	for _, s := range p.Stages {
+		for _, n := range s.Needs {
+			needed[n] = true
+		}
+	}
+	for _, s := range p.Stages {
+		if out, ok := state.Outputs[s.Name]; ok && !needed[s.Name] {
+			fmt.Printf("\n[%s]\n%s\n", s.Name, swarm.OutputText(out))
+		}
+	}
+	return nil
+}
+
+// execute runs stages as soon as everything they need has finished. A
+// failed stage with on_failure: fail stops the run; skip leaves its
+// dependents out; continue lets them run on what succeeded.
+func (r *pipelineRunner) execute(state *swarm.PipelineState) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	byName := map[string]*swarm.Stage{}
+	status := map[string]string{}
+	for _, s := range r.p.Stages {
+		byName[s.Name] = s
+		status[s.Name] = stagePending
+	}
+
+	outcomes := make(chan stageOutcome)
+	running := 0
+	aborted := false
+	for {
+		// Skipping a stage can settle stages listed before it, so repeat
+		// until nothing changes
+		for changed := true; changed; {
+			changed = false
+			for _, s := range r.p.Stages {
+				if aborted || status[s.Name] != stagePending {
+					continue
+				}
+				ready, skip := true, false
+				for _, n := range s.Needs {
+					switch status[n] {
+					case stageSuccess, stagePartial:
+					case stageFailed:
+						if byName[n].OnFailure == swarm.OnFailureSkip {
+							skip = true
+						}
+					case stageSkipped:
+						skip = true
+					default:
+						ready = false
+					}
+				}
+				switch {
+				case skip:
+					status[s.Name] = stageSkipped
+					r.setStage(s.Name, stageSkipped, nil, "a stage it needs failed")
+					fmt.Printf("  ⤼ %s skipped\n", s.Name)
+					changed = true
+				case ready:
+					stageTasks, err := r.prepare(s, state)
+					status[s.Name] = stageRunning
+					r.setStage(s.Name, stageRunning, nil, "")
+					running++
+					go func() {
+						if err != nil {
+							outcomes <- stageOutcome{name: s.Name, err: err}
+							return
+						}
+						outcomes <- r.runStage(ctx, s, stageTasks)
+					}()
+				}
+			}
+		}
+		if running == 0 {
+			break
+		}
+
+		o := <-outcomes
+		running--
+		s := byName[o.name]
+		switch {
+		case o.err == nil && o.failed == 0:
+			status[s.Name] = stageSuccess
+			state.Outputs[s.Name] = o.output
+			fmt.Printf("  ✓ %s\n", s.Name)
+		case s.OnFailure == swarm.OnFailureContinue && s.FanOut != nil && o.failed < o.total:
+			status[s.Name] = stagePartial
+			state.Outputs[s.Name] = o.output
+			fmt.Printf("  ◐ %s: %d of %d tasks failed, continuing\n", s.Name, o.failed, o.total)
+		default:
+			status[s.Name] = stageFailed
+			if s.OnFailure == swarm.OnFailureContinue {
+				state.Outputs[s.Name] = o.output
+			}
+			fmt.Printf("  ✗ %s: %v\n", s.Name, o.err)
+			if s.OnFailure == swarm.OnFailureFail && !aborted {
+				aborted = true
+				cancel()
+			}
+		}
+		errMsg := ""
+		if o.err != nil {
+			errMsg = o.err.Error()
+		}
+		r.setStage(s.Name, status[s.Name], o.taskIDs, errMsg)
+	}
+
+	// Whatever never ran was cut short by a failure
+	result := "success"
+	for _, s := range r.p.Stages {
+		switch status[s.Name] {
+		case stagePending:
+			status[s.Name] = stageSkipped
+			r.setStage(s.Name, stageSkipped, nil, "pipeline stopped")
+			result = "failed"
+		case stageFailed:
+			if s.OnFailure == swarm.OnFailureFail {
+				result = "failed"
+			} else if result == "success" {
+				result = "partial"
+			}
+		case stagePartial, stageSkipped:
+			if result == "success" {
+				result = "partial"
+			}
+		}
+	}
+	r.mu.Lock()
+	r.run.Status = result
+	r.run.FinishedAt = time.Now()
+	r.mu.Unlock()
+	r.save()
+}
+
+// stageTask is one task of a stage, with its inputs rendered.
+type stageTask struct {
+	inputs map[string]string
+	prior  map[string]json.RawMessage
+}
+
+// prepare renders a stage's inputs: one task, or one per fan-out item.
+func (r *pipelineRunner) prepare(s *swarm.Stage, state *swarm.PipelineState) ([]stageTask, error) {
+	prior := map[string]json.RawMessage{}
+	for _, n := range s.Needs {
+		if out, ok := state.Outputs[n]; ok {
+			if b, err := json.Marshal(out); err == nil {
+				prior[n] = b
+			}
+		}
+	}
+	render := func(vars map[string]string) (stageTask, error) {
+		t := stageTask{inputs: map[string]string{}, prior: prior}
+		for k, tmpl := range s.Inputs {
+			v, err := state.Render(tmpl, vars)
+			if err != nil {
+				return t, err
+			}
+			t.inputs[k] = v
+		}
+		return t, nil
+	}
+
+	if s.FanOut == nil {
+		t, err := render(nil)
+		return []stageTask{t}, err
+	}
+	over, err := state.Render(s.FanOut.Over, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out []stageTask
+	for _, item := range swarm.FanOutItems(over) {
+		t, err := render(map[string]string{s.ItemName(): item})
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// runStage runs a stage's tasks within its timeout. A fan-out stage's
+// output lists the outputs of its successful tasks in item order.
+func (r *pipelineRunner) runStage(ctx context.Context, s *swarm.Stage, stageTasks []stageTask) stageOutcome {
+	ctx, cancel := context.WithTimeout(ctx, s.StageTimeout())
+	defer cancel()
+
+	o := stageOutcome{name: s.Name, total: len(stageTasks)}
+	results := make([]*tasks.TaskResult, len(stageTasks))
+	errs := make([]error, len(stageTasks))
+	o.taskIDs = make([]string, len(stageTasks))
+	for i := range stageTasks {
+		o.taskIDs[i] = fmt.Sprintf("t-%s", uuid.New().String()[:8])
+	}
+	r.setStage(s.Name, stageRunning, o.taskIDs, "")
+
+	parallel := len(stageTasks)
+	if s.FanOut != nil && s.FanOut.MaxParallel > 0 {
+		parallel = s.FanOut.MaxParallel
+	}
+	sem := make(chan struct{}, max(parallel, 1))
+	var wg sync.WaitGroup
+	for i, t := range stageTasks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+			results[i], errs[i] = r.runTask(ctx, s, o.taskIDs[i], t)
+		}()
+	}
+	wg.Wait()
+
+	var outputs []interface{}
+	for i, res := range results {
+		if res != nil && res.TaskID != "" {
+			o.taskIDs[i] = res.TaskID // the last resubmission
+		}
+		if errs[i] == nil && res.Status != tasks.ResultSuccess {
+			errs[i] = fmt.Errorf("%s: %s", res.Status, res.Error)
+		}
+		if errs[i] != nil {
+			o.failed++
+			if o.err == nil {
+				o.err = fmt.Errorf("task %s: %w", o.taskIDs[i], errs[i])
+			}
+			continue
+		}
+		outputs = append(outputs, res.Outputs)
+	}
+	if errors.Is(o.err, context.DeadlineExceeded) {
+		o.err = fmt.Errorf("stage timed out after %s", s.StageTimeout())
+	}
+	if s.FanOut != nil {
+		if outputs == nil {
+			outputs = []interface{}{}
+		}
+		o.output = outputs
+	} else if len(outputs) == 1 {
+		o.output = outputs[0]
+	}
+	return o
+}
+
+// runTask submits one task and waits for its final result, resubmitting
+// failed tasks up to the stage's retries. Each resubmission is a new task
+// (<task_id>-r<n>): the swarm's retry supervisor runs a capability's own
+// retry policy under the original ID, and reusing it would mix the two
+// attempt counts.
+func (r *pipelineRunner) runTask(ctx context.Context, s *swarm.Stage, taskID string, t stageTask) (*tasks.TaskResult, error) {
+	var res *tasks.TaskResult
+	id := taskID
+	for attempt := 0; attempt <= s.Retries; attempt++ {
+		tm := tasks.TaskMessage{
+			TaskID:         id,
+			CorrelationID:  r.run.RunID,
+			Capability:     s.Capability,
+			TimeoutSeconds: int(s.StageTimeout().Seconds()),
+			Inputs:         t.inputs,
+			PriorOutputs:   t.prior,
+			SubmittedBy:    submitterName(),
+			Metadata: map[string]string{
+				"pipeline":     r.p.Name,
+				"pipeline_run": r.run.RunID,
+				"stage":        s.Name,
+			},
+		}
+		if id != taskID {
+			tm.Metadata["retry_of"] = taskID
+		}
+		r.mu.Lock()
+		err := r.db.InsertTask(&tm, "pending")
+		r.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+
+		tm.SubmittedAt = time.Now()
+		res, err = awaitTask(ctx, r.nc, &tm)
+		if err != nil {
+			r.mu.Lock()
+			r.db.SetStatus(id, "timeout")
+			r.mu.Unlock()
+			return nil, err
+		}
+		r.mu.Lock()
+		r.db.UpdateResult(res)
+		r.mu.Unlock()
+		if res.Status == tasks.ResultSuccess {
+			break
+		}
+		if attempt < s.Retries {
+			next := fmt.Sprintf("%s-r%d", taskID, attempt+1)
+			fmt.Printf("  ↻ %s/%s failed (%s), retrying as %s\n", s.Name, id, res.Error, next)
+			id = next
+		}
+	}
+	return res, nil
+}
+
+// awaitTask publishes a task and waits for its result. Failed attempts
+// that the swarm's retry supervisor announces are waited through.
+func awaitTask(ctx context.Context, nc *nats.Conn, tm *tasks.TaskMessage) (*tasks.TaskResult, error) {
+	done := make(chan *nats.Msg, 4)
+	doneSub, err := nc.ChanSubscribe(fmt.Sprintf("done.%s.%s", tm.Capability, tm.TaskID), done)
+	if err != nil {
+		return nil, fmt.Errorf("subscribe result: %w", err)
+	}
+	defer doneSub.Unsubscribe()
+	retries := make(chan *nats.Msg, 4)
+	retrySub, err := nc.ChanSubscribe(fmt.Sprintf("retry.%s.%s", tm.Capability, tm.TaskID), retries)
+	if err != nil {
+		return nil, fmt.Errorf("subscribe retry: %w", err)
+	}
+	defer retrySub.Unsubscribe()
+
+	data, err := tm.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("marshal task: %w", err)
+	}
+	if err := nc.Publish(fmt.Sprintf("work.%s.%s", tm.Capability, tm.TaskID), data); err != nil {
+		return nil, fmt.Errorf("publish: %w", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case msg := <-done:
+			var res tasks.TaskResult
+			if err := json.Unmarshal(msg.Data, &res); err != nil {
+				return nil, fmt.Errorf("parse result: %w", err)
+			}
+			if res.Status != tasks.ResultSuccess {
+				select {
+				case <-retries:
+					continue
+				case <-time.After(retryNoticeGrace):
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			}
+			return &res, nil
+		}
+	}
+}
+
+// setStage records a stage's progress and saves the run.
+func (r *pipelineRunner) setStage(name, status string, taskIDs []string, errMsg string) {
+	r.mu.Lock()
+	for i := range r.run.Stages {
+		st := &r.run.Stages[i]
+		if st.Name != name {
+			continue
+		}
+		if status == stageRunning && st.StartedAt.IsZero() {
+			st.StartedAt = time.Now()
+		}
+		if status != stageRunning && status != stagePending {
+			st.FinishedAt = time.Now()
+		}
+		st.Status = status
+		if taskIDs != nil {
+			st.TaskIDs = taskIDs
+		}
+		st.Error = errMsg
+	}
+	r.mu.Unlock()
+	r.save()
+}
+
+func (r *pipelineRunner) save() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.db.SavePipelineRun(r.run); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  Failed to save pipeline progress: %v\n", err)
+	}
+}
+
+func (c *PipelineShowCmd) Run(a *app) error {
+	db, err := a.db()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if c.RunID == "" {
+		runs, err := db.ListPipelineRuns(c.Limit)
+		if err != nil {
+			return err
+		}
+		if len(runs) == 0 {
+			fmt.Println("No pipeline runs found")
+			return nil
+		}
+		fmt.Fprintln(w, "RUN ID\tPIPELINE\tSTATUS\tSTARTED")
+		for _, run := range runs {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", run.RunID, run.Pipeline, run.Status, run.StartedAt.Format("2006-01-02 15:04"))
+		}
+		return w.Flush()
+	}
+
+	run, err := db.GetPipelineRun(c.RunID)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s (%s): %s\n", run.Pipeline, run.RunID, run.Status)
+	fmt.Fprintln(w, "STAGE\tCAPABILITY\tSTATUS\tTASKS\tERROR")
+	for _, st := range run.Stages {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", st.Name, st.Capability, st.Status, strings.Join(st.TaskIDs, ","), truncate(st.Error, 60))
+	}
+	return w.Flush()
+}
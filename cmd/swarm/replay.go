@@ -55,27 +55,13 @@ func (r *replayTUI) View() string {
 	return b.String()
 }
 
-func replayTask(taskID string) error {
+func replayTask(db *taskDB, taskID string) error {
 	// Load task result
-	home, _ := os.UserHomeDir()
-	resultPath := filepath.Join(home, ".local", "share", "swarm", "tasks", taskID+".json")
-
-	data, err := os.ReadFile(resultPath)
+	result, err := db.GetResult(taskID)
 	if err != nil {
 		return fmt.Errorf("task not found: %s", taskID)
 	}
 
-	var result struct {
-		TaskID     string      `json:"task_id"`
-		Status     string      `json:"status"`
-		Outputs    interface{} `json:"outputs"`
-		Error      string      `json:"error"`
-		DurationMs int64       `json:"duration_ms"`
-	}
-	if err := json.Unmarshal(data, &result); err != nil {
-		return fmt.Errorf("parse result: %w", err)
-	}
-
 	fmt.Printf("Task: %s\n", taskID)
 	fmt.Printf("Status: %s\n", result.Status)
 	fmt.Printf("Duration: %dms\n", result.DurationMs)
@@ -92,14 +78,15 @@ func replayTask(taskID string) error {
 	return nil
 }
 
-func replayWeb(taskID string) error {
-	home, _ := os.UserHomeDir()
-	resultPath := filepath.Join(home, ".local", "share", "swarm", "tasks", taskID+".json")
-
-	data, err := os.ReadFile(resultPath)
+func replayWeb(db *taskDB, taskID string) error {
+	res, err := db.GetResult(taskID)
 	if err != nil {
 		return fmt.Errorf("task not found: %s", taskID)
 	}
+	data, err := json.Marshal(res)
+	if err != nil {
+		return fmt.Errorf("marshal result: %w", err)
+	}
 
 	var result map[string]interface{}
 	if err := json.Unmarshal(data, &result); err != nil {
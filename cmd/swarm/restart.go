@@ -0,0 +1,374 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/vinayprograms/agentkit/registry"
+)
+
+const (
+	// discoveryWindow covers the default 5s heartbeat interval, so every
+	// running replica is seen at least once.
+	discoveryWindow = 6 * time.Second
+	// heartbeatGoneAfter is how long without heartbeats before an agent
+	// with no known PID counts as stopped.
+	heartbeatGoneAfter = 15 * time.Second
+	// killGrace is how long SIGTERM gets before SIGKILL.
+	killGrace = 10 * time.Second
+)
+
+// restartTarget is one replica from the manifest.
+type restartTarget struct {
+	name     string
+	spec     AgentSpec
+	replicas int
+}
+
+// Run restarts replicas one at a time: drain the old instance through
+// control.<id>.shutdown, wait for its heartbeat to stop, start the
+// replacement and wait for it to register before moving on. Other
+// replicas of the capability keep serving throughout; the only replica of
+// a capability is replaced the other way round, so it is never unserved.
+func (r *RestartCmd) Run(a *app) error {
+	manifestPath := r.File
+	if manifestPath == "" {
+		var err error
+		if manifestPath, err = findManifest(); err != nil {
+			return err
+		}
+	}
+	m, err := loadManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+
+	nc, err := nats.Connect(m.NATS.URL)
+	if err != nil {
+		return fmt.Errorf("connect nats: %w", err)
+	}
+	defer nc.Close()
+
+	var reg *registry.NATSRegistry
+	if reg, err = registry.NewNATSRegistry(nc, registry.DefaultNATSRegistryConfig()); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  Registry unavailable, confirming restarts by heartbeat only: %v\n", err)
+		reg = nil
+	} else {
+		defer reg.Close()
+	}
+
+	fmt.Printf("Discovering running agents (%s)...\n", discoveryWindow)
+	running := map[string]string{} // display name -> agent ID
+	up := map[string]bool{}
+	for _, ag := range discoverAgentsViaHeartbeat(nc, discoveryWindow) {
+		running[ag.name] = ag.id
+		up[ag.name] = true
+	}
+
+	targets, err := restartTargets(m, r.Agents, up)
+	if err != nil {
+		return err
+	}
+
+	for i, t := range targets {
+		fmt.Printf("[%d/%d] %s (%s)\n", i+1, len(targets), t.name, t.spec.Capability)
+		if err := replaceReplica(nc, reg, m, t, running[t.name], a.dataDir, r.DrainTimeout, r.StartTimeout); err != nil {
+			return fmt.Errorf("restart %s: %w (rolling restart stopped; remaining agents untouched)", t.name, err)
+		}
+	}
+	fmt.Println("Restart complete.")
+	return nil
+}
+
+// replaceReplica drains the instance oldID (if running) and starts a
+// replacement, returning once the replacement has registered. The only
+// replica of a capability is drained once its replacement is up instead.
+func replaceReplica(nc *nats.Conn, reg *registry.NATSRegistry, m *Manifest, t restartTarget, oldID, dataDir string, drainTimeout, startTimeout time.Duration) error {
+	if oldID == "" {
+		fmt.Println("  → not running, starting it")
+	} else if t.replicas == 1 {
+		return replaceOnlyReplica(nc, reg, m, t, oldID, dataDir, drainTimeout, startTimeout)
+	} else if err := drainReplica(nc, oldID, t.name, pidOf(dataDir, t.name), drainTimeout); err != nil {
+		return err
+	}
+
+	rec, err := startReplica(m, t.spec, t.name, dataDir)
+	if err != nil {
+		return err
+	}
+	return waitForRegistration(nc, reg, t.name, oldID, rec.PID, startTimeout)
+}
+
+// replicaSteps are the operations of replacing an only replica. They are
+// separate so that the order they run in can be tested.
+type replicaSteps struct {
+	start    func() (pidRecord, error) // launch the replacement
+	register func(pid int) error       // wait for the replacement to register
+	stop     func(pid int)             // stop a replacement that didn't come up
+	drain    func(pid int) error       // drain the old instance
+}
+
+// replaceOnlyReplica starts the replacement of a capability's only
+// replica, waits for it to register and then drains the old instance. A
+// replacement that doesn't come up is stopped and the old instance keeps
+// serving.
+func replaceOnlyReplica(nc *nats.Conn, reg *registry.NATSRegistry, m *Manifest, t restartTarget, oldID, dataDir string, drainTimeout, startTimeout time.Duration) error {
+	fmt.Printf("  → only replica of %s, starting the replacement first\n", t.spec.Capability)
+	return swapOnlyReplica(dataDir, t.name, oldID, replicaSteps{
+		start: func() (pidRecord, error) { return startReplica(m, t.spec, t.name, dataDir) },
+		register: func(pid int) error {
+			return waitForRegistration(nc, reg, t.name, oldID, pid, startTimeout)
+		},
+		stop: func(pid int) {
+			if proc, err := os.FindProcess(pid); err == nil {
+				proc.Signal(syscall.SIGTERM)
+			}
+		},
+		drain: func(pid int) error { return drainReplica(nc, oldID, t.name, pid, drainTimeout) },
+	})
+}
+
+// swapOnlyReplica runs the steps of replaceOnlyReplica for the replica
+// name, whose running instance is oldID.
+func swapOnlyReplica(dataDir, name, oldID string, steps replicaSteps) error {
+	old, hasPID := pidRecordOf(dataDir, name)
+	rec, err := steps.start()
+	if err != nil {
+		return err
+	}
+	if err := steps.register(rec.PID); err != nil {
+		steps.stop(rec.PID)
+		// Starting the replacement replaced the old instance's PID record
+		if hasPID {
+			recordPID(dataDir, old)
+		} else {
+			forgetPID(dataDir, name)
+		}
+		return fmt.Errorf("%w; %s left running", err, oldID)
+	}
+	return steps.drain(old.PID)
+}
+
+// restartTargets lists the manifest's replicas, limited to the requested
+// agent or replica names. Autoscaled agents keep the replicas that are
+// running, within their min and max.
+func restartTargets(m *Manifest, names []string, running map[string]bool) ([]restartTarget, error) {
+	want := map[string]bool{}
+	for _, n := range names {
+		want[n] = false
+	}
+	var targets []restartTarget
+	for _, ag := range m.Agents {
+		var replicaNames []string
+		if ag.Autoscaled() {
+			replicaNames = scaledReplicaNames(ag, running)
+		} else {
+			replicas := ag.Replicas
+			if ag.Type == "manager" || replicas < 1 {
+				replicas = 1
+			}
+			for i := 0; i < replicas; i++ {
+				replicaNames = append(replicaNames, replicaName(ag, replicas, i))
+			}
+		}
+		replicas := len(replicaNames)
+		for _, name := range replicaNames {
+			if len(want) > 0 {
+				_, byAgent := want[ag.Name]
+				_, byReplica := want[name]
+				if !byAgent && !byReplica {
+					continue
+				}
+				if byAgent {
+					want[ag.Name] = true
+				}
+				if byReplica {
+					want[name] = true
+				}
+			}
+			targets = append(targets, restartTarget{name: name, spec: ag, replicas: replicas})
+		}
+	}
+	for n, found := range want {
+		if !found {
+			return nil, fmt.Errorf("no agent or replica named %q in the manifest", n)
+		}
+	}
+	return targets, nil
+}
+
+// scaledReplicaNames picks an autoscaled agent's replicas: the running
+// ones numbered up to max_replicas, topped up to min_replicas with the
+// lowest free numbers.
+func scaledReplicaNames(ag AgentSpec, running map[string]bool) []string {
+	var names []string
+	for i := 0; i < ag.MaxReplicas; i++ {
+		if name := replicaName(ag, ag.MaxReplicas, i); running[name] {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		for i := 0; i < ag.Replicas; i++ {
+			names = append(names, replicaName(ag, ag.Replicas, i))
+		}
+		return names
+	}
+	for i := 0; len(names) < ag.MinReplicas; i++ {
+		if name := replicaName(ag, ag.MaxReplicas, i); !running[name] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// drainReplica asks an agent to shut down gracefully and waits until it
+// has stopped: its process exits or, without a known PID, its heartbeats
+// stop. Agents that outlast the drain timeout are terminated.
+func drainReplica(nc *nats.Conn, id, name string, pid int, timeout time.Duration) error {
+	hbSub, err := nc.SubscribeSync("heartbeat." + id)
+	if err != nil {
+		return fmt.Errorf("subscribe heartbeat: %w", err)
+	}
+	defer hbSub.Unsubscribe()
+
+	if err := nc.Publish(fmt.Sprintf("control.%s.shutdown", id), []byte{}); err != nil {
+		return fmt.Errorf("signal shutdown: %w", err)
+	}
+	fmt.Printf("  → draining %s\n", id)
+
+	deadline := time.Now().Add(timeout)
+	lastHeartbeat := time.Now()
+	for time.Now().Before(deadline) {
+		if _, err := hbSub.NextMsg(time.Second); err == nil {
+			lastHeartbeat = time.Now()
+		}
+		if pid > 0 && !isProcessAlive(pid) {
+			fmt.Printf("  ✓ %s stopped\n", name)
+			return nil
+		}
+		if pid == 0 && time.Since(lastHeartbeat) > heartbeatGoneAfter {
+			fmt.Printf("  ✓ %s heartbeat gone\n", name)
+			return nil
+		}
+	}
+
+	if pid == 0 {
+		return fmt.Errorf("still sending heartbeats after %s and no PID to terminate", timeout)
+	}
+	fmt.Printf("  ✗ drain timeout reached — SIGTERM pid %d\n", pid)
+	if proc, err := os.FindProcess(pid); err == nil {
+		proc.Signal(syscall.SIGTERM)
+		for end := time.Now().Add(killGrace); time.Now().Before(end) && isProcessAlive(pid); {
+			time.Sleep(500 * time.Millisecond)
+		}
+		if isProcessAlive(pid) {
+			fmt.Printf("  ✗ pid %d didn't exit — SIGKILL\n", pid)
+			proc.Signal(syscall.SIGKILL)
+		}
+	}
+	return nil
+}
+
+// startReplica launches a replica with its output appended to
+// <data dir>/logs/<name>.log, since it outlives this command, and records
+// its PID for `swarm down`.
+func startReplica(m *Manifest, ag AgentSpec, name, dataDir string) (pidRecord, error) {
+	logDir := filepath.Join(dataDir, "logs")
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		return pidRecord{}, fmt.Errorf("create log dir: %w", err)
+	}
+	logPath := filepath.Join(logDir, name+".log")
+	logFile, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return pidRecord{}, fmt.Errorf("open log: %w", err)
+	}
+	defer logFile.Close()
+
+	cmd := agentCommand(m, ag, name, m.Agents)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	detach(cmd)
+	if err := cmd.Start(); err != nil {
+		return pidRecord{}, fmt.Errorf("start agent: %w", err)
+	}
+	go cmd.Wait()
+	fmt.Printf("  → started pid %d (log: %s)\n", cmd.Process.Pid, logPath)
+
+	rec := pidRecord{
+		Name:       name,
+		PID:        cmd.Process.Pid,
+		Capability: ag.Capability,
+		StartedAt:  time.Now().Format(time.RFC3339),
+		SpecHash:   specHash(cmd, ag),
+	}
+	recordPID(dataDir, rec)
+	return rec, nil
+}
+
+// waitForRegistration waits for a heartbeat from a new instance named
+// name, then for that instance to appear in the registry.
+func waitForRegistration(nc *nats.Conn, reg *registry.NATSRegistry, name, oldID string, pid int, timeout time.Duration) error {
+	hbSub, err := nc.SubscribeSync("heartbeat.>")
+	if err != nil {
+		return fmt.Errorf("subscribe heartbeat: %w", err)
+	}
+	defer hbSub.Unsubscribe()
+
+	deadline := time.Now().Add(timeout)
+	newID := ""
+	for newID == "" {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("no heartbeat within %s", timeout)
+		}
+		if !isProcessAlive(pid) {
+			return fmt.Errorf("replacement exited during startup")
+		}
+		msg, err := hbSub.NextMsg(time.Second)
+		if err != nil {
+			continue
+		}
+		var hb struct {
+			AgentID  string            `json:"agent_id"`
+			Metadata map[string]string `json:"metadata"`
+		}
+		if json.Unmarshal(msg.Data, &hb) == nil && hb.AgentID != oldID && hb.Metadata["name"] == name {
+			newID = hb.AgentID
+		}
+	}
+
+	if reg == nil {
+		fmt.Printf("  ✓ %s is up (%s)\n", name, newID)
+		return nil
+	}
+	for {
+		if _, err := reg.Get(newID); err == nil {
+			fmt.Printf("  ✓ %s registered (%s)\n", name, newID)
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s sends heartbeats but did not register within %s", newID, timeout)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// pidOf returns the recorded PID of a running replica, or 0.
+func pidOf(dataDir, name string) int {
+	rec, _ := pidRecordOf(dataDir, name)
+	return rec.PID
+}
+
+// pidRecordOf returns the PID record of a running replica.
+func pidRecordOf(dataDir, name string) (pidRecord, bool) {
+	for _, r := range cleanStalePIDs(loadPIDRecords(dataDir)) {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return pidRecord{}, false
+}
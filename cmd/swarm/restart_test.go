@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func restartManifest() *Manifest {
+	return &Manifest{Agents: []AgentSpec{
+		{Name: "lead", Type: "manager", Capability: "plan", Replicas: 3},
+		{Name: "coder", Capability: "code", Replicas: 2},
+		{Name: "writer", Capability: "docs"},
+		{Name: "crawler", Capability: "crawl", Replicas: 2, MinReplicas: 2, MaxReplicas: 4},
+	}}
+}
+
+func TestRestartTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		names   []string
+		running []string
+		want    []string // replica/replicas of its capability
+		wantErr string
+	}{
+		{
+			name: "everything",
+			want: []string{"lead/1", "coder-1/2", "coder-2/2", "writer/1", "crawler-1/2", "crawler-2/2"},
+		},
+		{
+			name:  "by agent name",
+			names: []string{"coder"},
+			want:  []string{"coder-1/2", "coder-2/2"},
+		},
+		{
+			name:  "by replica name",
+			names: []string{"coder-2"},
+			want:  []string{"coder-2/2"},
+		},
+		{
+			name:  "agent and one of its replicas",
+			names: []string{"coder-1", "coder"},
+			want:  []string{"coder-1/2", "coder-2/2"},
+		},
+		{
+			name:  "manager runs once",
+			names: []string{"lead"},
+			want:  []string{"lead/1"},
+		},
+		{
+			name:    "unknown name",
+			names:   []string{"writer", "ghost"},
+			wantErr: `no agent or replica named "ghost"`,
+		},
+		{
+			name:    "autoscaled keeps running replicas",
+			names:   []string{"crawler"},
+			running: []string{"crawler-1", "crawler-2", "crawler-4"},
+			want:    []string{"crawler-1/3", "crawler-2/3", "crawler-4/3"},
+		},
+		{
+			name:    "autoscaled tops up to min",
+			names:   []string{"crawler"},
+			running: []string{"crawler-3"},
+			want:    []string{"crawler-3/2", "crawler-1/2"},
+		},
+		{
+			name:    "autoscaled ignores replicas beyond max",
+			names:   []string{"crawler"},
+			running: []string{"crawler-1", "crawler-2", "crawler-5"},
+			want:    []string{"crawler-1/2", "crawler-2/2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			running := map[string]bool{}
+			for _, n := range tt.running {
+				running[n] = true
+			}
+			targets, err := restartTargets(restartManifest(), tt.names, running)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, tg := range targets {
+				got = append(got, fmt.Sprintf("%s/%d", tg.name, tg.replicas))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScaledReplicaNames_NoneRunning(t *testing.T) {
+	ag := AgentSpec{Name: "crawler", Replicas: 3, MinReplicas: 2, MaxReplicas: 4}
+	got := scaledReplicaNames(ag, nil)
+	if want := []string{"crawler-1", "crawler-2", "crawler-3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// recordingSteps returns replica steps that log each call. The old
+// instance of writer runs as this test process, the replacement as its
+// parent, so both PID records count as alive.
+func recordingSteps(t *testing.T, dataDir string, registerErr error) (replicaSteps, *[]string) {
+	t.Helper()
+	var calls []string
+	newPID := os.Getppid()
+	return replicaSteps{
+		start: func() (pidRecord, error) {
+			calls = append(calls, "start")
+			rec := pidRecord{Name: "writer", PID: newPID}
+			recordPID(dataDir, rec)
+			return rec, nil
+		},
+		register: func(pid int) error {
+			calls = append(calls, fmt.Sprintf("register %d", pid))
+			return registerErr
+		},
+		stop: func(pid int) {
+			calls = append(calls, fmt.Sprintf("stop %d", pid))
+		},
+		drain: func(pid int) error {
+			calls = append(calls, fmt.Sprintf("drain %d", pid))
+			return nil
+		},
+	}, &calls
+}
+
+func TestSwapOnlyReplica_StartsBeforeDraining(t *testing.T) {
+	dataDir := t.TempDir()
+	recordPID(dataDir, pidRecord{Name: "writer", PID: os.Getpid()})
+	steps, calls := recordingSteps(t, dataDir, nil)
+
+	if err := swapOnlyReplica(dataDir, "writer", "old-id", steps); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"start", fmt.Sprintf("register %d", os.Getppid()), fmt.Sprintf("drain %d", os.Getpid())}
+	if !reflect.DeepEqual(*calls, want) {
+		t.Errorf("got steps %v, want %v", *calls, want)
+	}
+	if pid := pidOf(dataDir, "writer"); pid != os.Getppid() {
+		t.Errorf("expected the replacement's PID recorded, got %d", pid)
+	}
+}
+
+func TestSwapOnlyReplica_KeepsOldWhenReplacementFails(t *testing.T) {
+	dataDir := t.TempDir()
+	recordPID(dataDir, pidRecord{Name: "writer", PID: os.Getpid()})
+	steps, calls := recordingSteps(t, dataDir, errors.New("no heartbeat"))
+
+	err := swapOnlyReplica(dataDir, "writer", "old-id", steps)
+	if err == nil || !strings.Contains(err.Error(), "old-id left running") {
+		t.Fatalf("expected the old instance left running, got %v", err)
+	}
+	want := []string{"start", fmt.Sprintf("register %d", os.Getppid()), fmt.Sprintf("stop %d", os.Getppid())}
+	if !reflect.DeepEqual(*calls, want) {
+		t.Errorf("got steps %v, want %v", *calls, want)
+	}
+	if pid := pidOf(dataDir, "writer"); pid != os.Getpid() {
+		t.Errorf("expected the old PID record restored, got %d", pid)
+	}
+}
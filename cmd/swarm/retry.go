@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/vinayprograms/agent/internal/swarm"
+	"github.com/vinayprograms/agentkit/tasks"
+)
+
+// maxDeliveriesAdvisory is published by JetStream when a work message
+// reaches the consumer's MaxDeliver without being acked.
+const maxDeliveriesAdvisory = "$JS.EVENT.ADVISORY.CONSUMER.MAX_DELIVERIES." + swarm.StreamName + ".>"
+
+// retryNotice is published on retry.<capability>.<task_id> when a failed
+// task is scheduled to run again, so waiting submitters keep waiting.
+type retryNotice struct {
+	TaskID  string `json:"task_id"`
+	Attempt int    `json:"attempt"` // the attempt that will run next
+	DelayMs int64  `json:"delay_ms"`
+	Error   string `json:"error,omitempty"` // why the previous attempt failed
+}
+
+// publisher sends messages; a *nats.Conn in practice.
+type publisher interface {
+	Publish(subject string, data []byte) error
+}
+
+// retrySupervisor applies the manifest's retry policies while `swarm up`
+// runs: failed results are resubmitted with the next attempt number after
+// a backoff, and tasks that fail for good are dead-lettered.
+type retrySupervisor struct {
+	nc publisher
+	js nats.JetStreamContext // nil without JetStream
+	m  *Manifest
+	db *taskDB
+
+	mu      sync.Mutex
+	handled map[string]map[string]bool // task_id -> attempts already acted on
+	timers  map[string]*time.Timer
+	subs    []*nats.Subscription
+}
+
+// startRetrySupervisor subscribes to work, results and delivery advisories.
+func startRetrySupervisor(nc *nats.Conn, m *Manifest, db *taskDB) (*retrySupervisor, error) {
+	s := &retrySupervisor{
+		nc:      nc,
+		m:       m,
+		db:      db,
+		handled: make(map[string]map[string]bool),
+		timers:  make(map[string]*time.Timer),
+	}
+	if js, err := swarm.EnsureStream(nc); err == nil {
+		s.js = js
+	} else {
+		fmt.Fprintf(os.Stderr, "⚠️  JetStream unavailable, exhausted deliveries won't be dead-lettered: %v\n", err)
+	}
+
+	handlers := map[string]nats.MsgHandler{
+		"work.*.*": s.handleWork,
+		"done.*.*": s.handleDone,
+	}
+	if s.js != nil {
+		handlers[maxDeliveriesAdvisory] = s.handleMaxDeliveries
+	}
+	for subject, h := range handlers {
+		sub, err := nc.Subscribe(subject, h)
+		if err != nil {
+			s.stop()
+			return nil, fmt.Errorf("subscribe %s: %w", subject, err)
+		}
+		s.subs = append(s.subs, sub)
+	}
+	return s, nil
+}
+
+// stop unsubscribes and cancels pending retries.
+func (s *retrySupervisor) stop() {
+	for _, sub := range s.subs {
+		sub.Unsubscribe()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, t := range s.timers {
+		t.Stop()
+		delete(s.timers, id)
+	}
+}
+
+// handleWork records task inputs so failed tasks can be resubmitted, no
+// matter who submitted them.
+func (s *retrySupervisor) handleWork(msg *nats.Msg) {
+	if !s.servesCapability(subjectPart(msg.Subject, 1)) {
+		return // corrections on work.<instance-id>.*
+	}
+	task, err := tasks.UnmarshalTaskMessage(msg.Data)
+	if err != nil {
+		return
+	}
+	s.db.InsertTask(task, "pending")
+}
+
+// handleDone retries or dead-letters a failed result.
+func (s *retrySupervisor) handleDone(msg *nats.Msg) {
+	capability := subjectPart(msg.Subject, 1)
+	policy := s.m.RetryPolicy(capability)
+	if policy == nil {
+		return
+	}
+	var result tasks.TaskResult
+	if err := json.Unmarshal(msg.Data, &result); err != nil {
+		return
+	}
+	if result.Status == tasks.ResultSuccess {
+		s.forget(result.TaskID)
+		return
+	}
+	// Workers echo the task's attempt; a task submitted without one is on
+	// its first
+	attempt := result.Attempt
+	if attempt < 1 {
+		attempt = 1
+	}
+	if !s.claim(result.TaskID, strconv.Itoa(attempt)) {
+		return
+	}
+
+	var reason string
+	switch {
+	case !policy.Retryable(&result):
+		reason = "error is not retryable"
+	case policy.Exhausted(attempt):
+		reason = fmt.Sprintf("failed after %d attempts", attempt)
+	default:
+		// Waiters take a failure as final unless a retry is announced
+		// within retryNoticeGrace, and the task DB may be held by another
+		// swarm process for up to taskDBLockTimeout: announce first
+		notice, _ := json.Marshal(retryNotice{TaskID: result.TaskID, Attempt: attempt + 1, DelayMs: policy.Delay(attempt).Milliseconds(), Error: result.Error})
+		s.nc.Publish(fmt.Sprintf("retry.%s.%s", capability, result.TaskID), notice)
+	}
+
+	task, err := s.db.GetTask(result.TaskID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  Can't retry %s: task input not recorded\n", result.TaskID)
+		s.forget(result.TaskID)
+		return
+	}
+	if reason != "" {
+		s.deadLetter(capability, task, &result, reason)
+		return
+	}
+	s.scheduleRetry(capability, task, attempt, policy)
+}
+
+// scheduleRetry resubmits the task after the policy's backoff. The retry
+// has already been announced.
+func (s *retrySupervisor) scheduleRetry(capability string, task *tasks.TaskMessage, attempt int, policy *swarm.RetryPolicy) {
+	delay := policy.Delay(attempt)
+	next := *task
+	next.Attempt = attempt + 1
+	next.MaxAttempts = policy.MaxAttempts
+
+	s.db.SetStatus(task.TaskID, "retrying")
+	fmt.Printf("  ↻ %s attempt %d/%d failed, retrying in %s\n", task.TaskID, attempt, policy.MaxAttempts, delay)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timers[task.TaskID] = time.AfterFunc(delay, func() {
+		s.mu.Lock()
+		delete(s.timers, task.TaskID)
+		s.mu.Unlock()
+
+		data, err := next.Marshal()
+		if err == nil {
+			err = s.nc.Publish(fmt.Sprintf("work.%s.%s", capability, task.TaskID), data)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  Retry of %s failed: %v\n", task.TaskID, err)
+			return
+		}
+		s.db.SetStatus(task.TaskID, "pending")
+	})
+}
+
+// handleMaxDeliveries dead-letters work messages JetStream gave up on.
+func (s *retrySupervisor) handleMaxDeliveries(msg *nats.Msg) {
+	var adv struct {
+		Consumer   string `json:"consumer"`
+		StreamSeq  uint64 `json:"stream_seq"`
+		Deliveries uint64 `json:"deliveries"`
+	}
+	if err := json.Unmarshal(msg.Data, &adv); err != nil || !strings.HasPrefix(adv.Consumer, "work-") {
+		return
+	}
+	raw, err := s.js.GetMsg(swarm.StreamName, adv.StreamSeq)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  Can't load undelivered message %d: %v\n", adv.StreamSeq, err)
+		return
+	}
+	task, err := tasks.UnmarshalTaskMessage(raw.Data)
+	if err != nil || !s.claim(task.TaskID, "undelivered") {
+		return
+	}
+	capability := strings.TrimPrefix(adv.Consumer, "work-")
+	s.deadLetter(capability, task, nil, fmt.Sprintf("not acknowledged after %d deliveries", adv.Deliveries))
+}
+
+// deadLetter records the task in the task DB and publishes it on
+// dlq.<capability>. The task is done with, so its claims are dropped.
+func (s *retrySupervisor) deadLetter(capability string, task *tasks.TaskMessage, result *tasks.TaskResult, reason string) {
+	defer s.forget(task.TaskID)
+	dl := &swarm.DeadLetter{Task: task, Result: result, Reason: reason, FailedAt: time.Now()}
+	if err := s.db.AddDeadLetter(dl); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  Failed to record dead letter %s: %v\n", task.TaskID, err)
+	}
+	data, _ := json.Marshal(dl)
+	s.nc.Publish(swarm.DLQSubject(capability), data)
+	fmt.Printf("  ✗ %s dead-lettered: %s\n", task.TaskID, reason)
+}
+
+// claim reports whether a task's attempt (or "undelivered") is seen for
+// the first time.
+func (s *retrySupervisor) claim(taskID, attempt string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.handled[taskID][attempt] {
+		return false
+	}
+	if s.handled[taskID] == nil {
+		s.handled[taskID] = make(map[string]bool)
+	}
+	s.handled[taskID][attempt] = true
+	return true
+}
+
+// forget drops the claims of a task that succeeded or was dead-lettered,
+// so the supervisor's memory doesn't grow with every task it has seen.
+func (s *retrySupervisor) forget(taskID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.handled, taskID)
+}
+
+func (s *retrySupervisor) servesCapability(capability string) bool {
+	for _, ag := range s.m.Agents {
+		if ag.Capability == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// subjectPart returns the i-th dot-separated token of subject.
+func subjectPart(subject string, i int) string {
+	parts := strings.Split(subject, ".")
+	if i < len(parts) {
+		return parts[i]
+	}
+	return ""
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/vinayprograms/agent/internal/swarm"
+	"github.com/vinayprograms/agentkit/tasks"
+	bolt "go.etcd.io/bbolt"
+)
+
+// recordingPublisher collects published messages.
+type recordingPublisher struct {
+	msgs chan *nats.Msg
+}
+
+func newRecordingPublisher() *recordingPublisher {
+	return &recordingPublisher{msgs: make(chan *nats.Msg, 16)}
+}
+
+func (p *recordingPublisher) Publish(subject string, data []byte) error {
+	p.msgs <- &nats.Msg{Subject: subject, Data: data}
+	return nil
+}
+
+// next returns the next published message, failing the test after a second.
+func (p *recordingPublisher) next(t *testing.T) *nats.Msg {
+	t.Helper()
+	select {
+	case msg := <-p.msgs:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("nothing published")
+		return nil
+	}
+}
+
+// newTestRetrySupervisor returns a supervisor for capability "code" with
+// task t1 recorded in its task DB.
+func newTestRetrySupervisor(t *testing.T, policy *swarm.RetryPolicy) (*retrySupervisor, *recordingPublisher) {
+	t.Helper()
+	if err := policy.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	db := newTestTaskDB(t)
+	db.InsertTask(&tasks.TaskMessage{TaskID: "t1", Capability: "code", Inputs: map[string]string{"file": "main.go"}}, "running")
+	pub := newRecordingPublisher()
+	s := &retrySupervisor{
+		nc:      pub,
+		m:       &Manifest{Agents: []AgentSpec{{Capability: "code", Retry: policy}}},
+		db:      db,
+		handled: make(map[string]map[string]bool),
+		timers:  make(map[string]*time.Timer),
+	}
+	t.Cleanup(s.stop)
+	return s, pub
+}
+
+func failedResult(attempt int, errMsg string) *nats.Msg {
+	data, _ := json.Marshal(tasks.TaskResult{TaskID: "t1", Status: tasks.ResultFailed, Attempt: attempt, Error: errMsg})
+	return &nats.Msg{Subject: "done.code.t1", Data: data}
+}
+
+func taskStatus(t *testing.T, db *taskDB, status string) bool {
+	t.Helper()
+	recs, err := db.ListTasks(taskFilter{Status: status})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(recs) == 1 && recs[0].TaskID == "t1"
+}
+
+func TestRetrySupervisor_ForgetsFinishedTasks(t *testing.T) {
+	s := &retrySupervisor{
+		m: &Manifest{Agents: []AgentSpec{
+			{Capability: "code", Retry: &swarm.RetryPolicy{MaxAttempts: 3}},
+		}},
+		handled: make(map[string]map[string]bool),
+	}
+
+	if !s.claim("t1", "1") || s.claim("t1", "1") {
+		t.Fatal("expected an attempt to be claimed once")
+	}
+	if !s.claim("t2", "1") {
+		t.Fatal("expected other tasks' attempts to be claimable")
+	}
+
+	// A successful attempt drops the task's claims, and only that task's
+	data, _ := json.Marshal(tasks.TaskResult{TaskID: "t1", Status: tasks.ResultSuccess, Attempt: 2})
+	s.handleDone(&nats.Msg{Subject: "done.code.t1", Data: data})
+	if _, ok := s.handled["t1"]; ok {
+		t.Errorf("expected claims of t1 dropped after success, got %v", s.handled)
+	}
+	if !s.handled["t2"]["1"] {
+		t.Errorf("expected claims of t2 kept, got %v", s.handled)
+	}
+
+	s.forget("t2")
+	if len(s.handled) != 0 {
+		t.Errorf("expected no claims left, got %v", s.handled)
+	}
+}
+
+func TestRetrySupervisor_SchedulesRetry(t *testing.T) {
+	s, pub := newTestRetrySupervisor(t, &swarm.RetryPolicy{MaxAttempts: 3, Backoff: "20ms"})
+
+	// Another swarm process holds the task DB: the retry must still be
+	// announced before waiters give up on it
+	lock, err := bolt.Open(s.db.dbPath, 0644, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		s.handleDone(failedResult(1, "rate limited"))
+		close(done)
+	}()
+	msg := pub.next(t)
+	lock.Close()
+	<-done
+
+	var notice retryNotice
+	json.Unmarshal(msg.Data, &notice)
+	if msg.Subject != "retry.code.t1" || notice.Attempt != 2 || notice.DelayMs != 20 || notice.Error != "rate limited" {
+		t.Errorf("unexpected retry notice %s: %s", msg.Subject, msg.Data)
+	}
+	if !taskStatus(t, s.db, "retrying") {
+		t.Error("expected task marked retrying")
+	}
+
+	msg = pub.next(t)
+	task, err := tasks.UnmarshalTaskMessage(msg.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Subject != "work.code.t1" || task.Attempt != 2 || task.MaxAttempts != 3 || task.Inputs["file"] != "main.go" {
+		t.Errorf("unexpected resubmission %s: %+v", msg.Subject, task)
+	}
+	time.Sleep(50 * time.Millisecond) // status is set after the publish
+	if !taskStatus(t, s.db, "pending") {
+		t.Error("expected task pending again after resubmission")
+	}
+
+	// The same failure delivered twice is acted on once
+	s.handleDone(failedResult(1, "rate limited"))
+	select {
+	case msg := <-pub.msgs:
+		t.Errorf("duplicate result acted on: %s", msg.Subject)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRetrySupervisor_DeadLettersExhausted(t *testing.T) {
+	s, pub := newTestRetrySupervisor(t, &swarm.RetryPolicy{MaxAttempts: 3, Backoff: "10ms"})
+
+	s.handleDone(failedResult(3, "still broken"))
+	msg := pub.next(t)
+	var dl swarm.DeadLetter
+	json.Unmarshal(msg.Data, &dl)
+	if msg.Subject != swarm.DLQSubject("code") || dl.Task.TaskID != "t1" || dl.Reason != "failed after 3 attempts" {
+		t.Errorf("unexpected dead letter %s: %s", msg.Subject, msg.Data)
+	}
+	letters, err := s.db.ListDeadLetters("code")
+	if err != nil || len(letters) != 1 || letters[0].Result.Error != "still broken" {
+		t.Errorf("expected dead letter recorded, got %v (%v)", letters, err)
+	}
+	if _, ok := s.handled["t1"]; ok {
+		t.Error("expected claims dropped once dead-lettered")
+	}
+	select {
+	case msg := <-pub.msgs:
+		t.Errorf("unexpected publish after dead-lettering: %s", msg.Subject)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRetrySupervisor_DeadLettersNonRetryable(t *testing.T) {
+	s, pub := newTestRetrySupervisor(t, &swarm.RetryPolicy{MaxAttempts: 3, RetryOn: []string{"timeout"}})
+
+	s.handleDone(failedResult(1, "invalid input"))
+	msg := pub.next(t)
+	if msg.Subject != swarm.DLQSubject("code") {
+		t.Fatalf("expected the first failure dead-lettered, got %s", msg.Subject)
+	}
+	if letters, _ := s.db.ListDeadLetters(""); len(letters) != 1 || letters[0].Reason != "error is not retryable" {
+		t.Errorf("unexpected dead letters %v", letters)
+	}
+}
@@ -0,0 +1,850 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vinayprograms/agent/internal/swarm"
+	"github.com/vinayprograms/agentkit/tasks"
+	bolt "go.etcd.io/bbolt"
+)
+
+// taskDBLockTimeout is how long an operation waits for another swarm
+// process to release the database.
+const taskDBLockTimeout = 10 * time.Second
+
+// Buckets in the task database. Index buckets hold keys only:
+// <prefix>\x00<created, big-endian unix nanos><task_id>, so a prefix scan
+// walks one capability, status or submitter in time order.
+var (
+	bucketTasks       = []byte("tasks")        // task_id -> taskRecord
+	bucketInputs      = []byte("inputs")       // task_id -> TaskMessage
+	bucketResults     = []byte("results")      // task_id -> TaskResult
+	bucketDeadLetters = []byte("dead_letters") // task_id -> swarm.DeadLetter
+	bucketThreads     = []byte("threads")      // task_id -> bucket of seq -> threadEntry
+	bucketScaling     = []byte("scaling")      // seq -> scaleEvent
+	bucketPipelines   = []byte("pipelines")    // run_id -> pipelineRun
+
+	idxTime        = []byte("idx_time")
+	idxCapability  = []byte("idx_capability")
+	idxStatus      = []byte("idx_status")
+	idxSubmitter   = []byte("idx_submitter")
+	idxIdempotency = []byte("idx_idempotency")
+
+	allBuckets = [][]byte{
+		bucketTasks, bucketInputs, bucketResults, bucketDeadLetters, bucketThreads,
+		bucketScaling, bucketPipelines,
+		idxTime, idxCapability, idxStatus, idxSubmitter, idxIdempotency,
+	}
+)
+
+// taskDBMu serializes database access within this process; bbolt's file
+// lock does the same across swarm processes.
+var taskDBMu sync.Mutex
+
+// taskDB is the swarm's task history: an embedded bbolt database at
+// <data dir>/swarm.db. It is opened per operation, so concurrent swarm
+// commands (up, ui, submit) take turns instead of failing.
+type taskDB struct {
+	dbPath string
+}
+
+type taskRecord struct {
+	TaskID         string
+	Capability     string
+	Status         string
+	CreatedAt      time.Time
+	CompletedAt    time.Time `json:",omitzero"`
+	DurationMs     int64
+	SubmittedBy    string `json:",omitempty"`
+	IdempotencyKey string `json:",omitempty"`
+}
+
+type taskStats struct {
+	Total   int
+	Success int
+	Failed  int
+	Pending int
+	Running int
+	Dead    int
+}
+
+// taskFilter selects tasks for ListTasks. Zero values match everything.
+type taskFilter struct {
+	Capability  string
+	Status      string
+	SubmittedBy string
+	Since       time.Time // created at or after
+	Until       time.Time // created at or before
+	Limit       int
+}
+
+// retentionPolicy says how long finished tasks are kept. Zero keeps them
+// forever.
+type retentionPolicy struct {
+	Completed time.Duration // success
+	Failed    time.Duration // failed, timeout
+}
+
+// defaultRetention keeps completed tasks for 30 days and failures until
+// removed by hand.
+var defaultRetention = retentionPolicy{Completed: 30 * 24 * time.Hour}
+
+func openTaskDB(path string) (*taskDB, error) {
+	d := &taskDB{dbPath: path}
+	var imported []string
+	err := d.update(func(tx *bolt.Tx) error {
+		for _, name := range allBuckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return fmt.Errorf("create bucket %s: %w", name, err)
+			}
+		}
+		var err error
+		imported, err = d.migrateLegacy(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Only once the import is committed, so a failed one is retried
+	for _, p := range imported {
+		os.Rename(p, p+".migrated")
+	}
+	return d, nil
+}
+
+func (d *taskDB) Close() error { return nil }
+
+// open opens the database once no other swarm process holds it. Compact
+// in another process replaces the file while holding the lock, so a
+// process that was waiting opened the old, now unlinked file: if the path
+// names a different file once the lock is taken, it opens again.
+func (d *taskDB) open(readOnly bool) (*bolt.DB, error) {
+	for attempt := 0; ; attempt++ {
+		before, statErr := os.Stat(d.dbPath)
+		db, err := bolt.Open(d.dbPath, 0644, &bolt.Options{Timeout: taskDBLockTimeout, ReadOnly: readOnly})
+		if errors.Is(err, bolt.ErrTimeout) {
+			return nil, fmt.Errorf("task database %s is locked by another swarm process", d.dbPath)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("open task database: %w", err)
+		}
+		// A file created by this open has nothing to compare with; the
+		// next attempt checks it
+		after, err := os.Stat(d.dbPath)
+		if statErr == nil && err == nil && os.SameFile(before, after) {
+			return db, nil
+		}
+		db.Close()
+		if attempt == 3 {
+			return nil, fmt.Errorf("open task database: %s keeps being replaced", d.dbPath)
+		}
+	}
+}
+
+func (d *taskDB) update(fn func(tx *bolt.Tx) error) error {
+	taskDBMu.Lock()
+	defer taskDBMu.Unlock()
+	db, err := d.open(false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.Update(fn)
+}
+
+func (d *taskDB) view(fn func(tx *bolt.Tx) error) error {
+	taskDBMu.Lock()
+	defer taskDBMu.Unlock()
+	db, err := d.open(true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.View(fn)
+}
+
+func (d *taskDB) InsertTask(task *tasks.TaskMessage, status string) error {
+	data, err := task.Marshal()
+	if err != nil {
+		return fmt.Errorf("marshal task input: %w", err)
+	}
+	return d.update(func(tx *bolt.Tx) error {
+		// Deduplicate — skip if task already recorded
+		if tx.Bucket(bucketTasks).Get([]byte(task.TaskID)) != nil {
+			return nil
+		}
+		rec := taskRecord{
+			TaskID:         task.TaskID,
+			Capability:     task.Capability,
+			Status:         status,
+			CreatedAt:      time.Now(),
+			SubmittedBy:    task.SubmittedBy,
+			IdempotencyKey: task.IdempotencyKey,
+		}
+		if err := putRecord(tx, nil, &rec); err != nil {
+			return err
+		}
+		return tx.Bucket(bucketInputs).Put([]byte(task.TaskID), data)
+	})
+}
+
+func (d *taskDB) GetTask(taskID string) (*tasks.TaskMessage, error) {
+	var data []byte
+	err := d.view(func(tx *bolt.Tx) error {
+		data = copyBytes(tx.Bucket(bucketInputs).Get([]byte(taskID)))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, fmt.Errorf("task %s not found", taskID)
+	}
+	return tasks.UnmarshalTaskMessage(data)
+}
+
+// UpdateResult stores a task's result and updates its status.
+func (d *taskDB) UpdateResult(result *tasks.TaskResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("marshal result: %w", err)
+	}
+	return d.update(func(tx *bolt.Tx) error {
+		if old, err := getRecord(tx, result.TaskID); err != nil {
+			return err
+		} else if old != nil {
+			rec := *old
+			rec.Status = string(result.Status)
+			rec.DurationMs = result.DurationMs
+			rec.CompletedAt = result.CompletedAt
+			if rec.CompletedAt.IsZero() {
+				rec.CompletedAt = time.Now()
+			}
+			if err := putRecord(tx, old, &rec); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(bucketResults).Put([]byte(result.TaskID), data)
+	})
+}
+
+func (d *taskDB) GetResult(taskID string) (*tasks.TaskResult, error) {
+	var data []byte
+	err := d.view(func(tx *bolt.Tx) error {
+		data = copyBytes(tx.Bucket(bucketResults).Get([]byte(taskID)))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, fmt.Errorf("no result for task %s", taskID)
+	}
+	var res tasks.TaskResult
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// SetStatus updates a task's status without touching its result.
+func (d *taskDB) SetStatus(taskID, status string) error {
+	return d.update(func(tx *bolt.Tx) error {
+		old, err := getRecord(tx, taskID)
+		if err != nil {
+			return err
+		}
+		if old == nil {
+			return fmt.Errorf("task %s not found", taskID)
+		}
+		rec := *old
+		rec.Status = status
+		return putRecord(tx, old, &rec)
+	})
+}
+
+// AddDeadLetter records a task that failed for good and marks it
+// dead_letter.
+func (d *taskDB) AddDeadLetter(dl *swarm.DeadLetter) error {
+	if err := d.InsertTask(dl.Task, "dead_letter"); err != nil {
+		return err
+	}
+	if err := d.SetStatus(dl.Task.TaskID, "dead_letter"); err != nil {
+		return err
+	}
+	data, err := json.Marshal(dl)
+	if err != nil {
+		return fmt.Errorf("marshal dead letter: %w", err)
+	}
+	return d.update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketDeadLetters).Put([]byte(dl.Task.TaskID), data)
+	})
+}
+
+// GetDeadLetter returns a dead-lettered task.
+func (d *taskDB) GetDeadLetter(taskID string) (*swarm.DeadLetter, error) {
+	var data []byte
+	err := d.view(func(tx *bolt.Tx) error {
+		data = copyBytes(tx.Bucket(bucketDeadLetters).Get([]byte(taskID)))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, fmt.Errorf("task %s is not in the dead-letter queue", taskID)
+	}
+	var dl swarm.DeadLetter
+	if err := json.Unmarshal(data, &dl); err != nil {
+		return nil, fmt.Errorf("parse dead letter %s: %w", taskID, err)
+	}
+	return &dl, nil
+}
+
+// ListDeadLetters returns dead-lettered tasks, newest first, optionally
+// for one capability.
+func (d *taskDB) ListDeadLetters(capability string) ([]*swarm.DeadLetter, error) {
+	var out []*swarm.DeadLetter
+	err := d.view(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketDeadLetters).ForEach(func(k, v []byte) error {
+			var dl swarm.DeadLetter
+			if json.Unmarshal(v, &dl) != nil || dl.Task == nil {
+				return nil
+			}
+			if capability == "" || dl.Task.Capability == capability {
+				out = append(out, &dl)
+			}
+			return nil
+		})
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].FailedAt.After(out[j].FailedAt) })
+	return out, err
+}
+
+// RemoveDeadLetter takes a task out of the dead-letter queue.
+func (d *taskDB) RemoveDeadLetter(taskID string) error {
+	return d.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketDeadLetters)
+		if b.Get([]byte(taskID)) == nil {
+			return fmt.Errorf("task %s is not in the dead-letter queue", taskID)
+		}
+		return b.Delete([]byte(taskID))
+	})
+}
+
+// FindByIdempotencyKey returns the newest task submitted to capability
+// with the given idempotency key that has not failed.
+func (d *taskDB) FindByIdempotencyKey(capability, key string) (*taskRecord, bool) {
+	var found *taskRecord
+	d.view(func(tx *bolt.Tx) error {
+		prefix := indexPrefix(capability, key)
+		return scanIndex(tx, idxIdempotency, prefix, time.Time{}, time.Time{}, func(id string) (bool, error) {
+			rec, err := getRecord(tx, id)
+			if err != nil || rec == nil {
+				return true, err
+			}
+			if rec.Status == "failed" || rec.Status == "timeout" || rec.Status == "dead_letter" {
+				return true, nil
+			}
+			found = rec
+			return false, nil
+		})
+	})
+	return found, found != nil
+}
+
+// ListTasks returns tasks matching f, newest first. The most selective
+// index among status, capability and submitter drives the scan.
+func (d *taskDB) ListTasks(f taskFilter) ([]taskRecord, error) {
+	idx, prefix := idxTime, []byte(nil)
+	switch {
+	case f.Status != "":
+		idx, prefix = idxStatus, indexPrefix(f.Status)
+	case f.Capability != "":
+		idx, prefix = idxCapability, indexPrefix(f.Capability)
+	case f.SubmittedBy != "":
+		idx, prefix = idxSubmitter, indexPrefix(f.SubmittedBy)
+	}
+
+	out := make([]taskRecord, 0)
+	err := d.view(func(tx *bolt.Tx) error {
+		return scanIndex(tx, idx, prefix, f.Since, f.Until, func(id string) (bool, error) {
+			rec, err := getRecord(tx, id)
+			if err != nil || rec == nil {
+				return true, err
+			}
+			if (f.Capability != "" && rec.Capability != f.Capability) ||
+				(f.Status != "" && rec.Status != f.Status) ||
+				(f.SubmittedBy != "" && rec.SubmittedBy != f.SubmittedBy) {
+				return true, nil
+			}
+			out = append(out, *rec)
+			return f.Limit <= 0 || len(out) < f.Limit, nil
+		})
+	})
+	return out, err
+}
+
+// Stats counts tasks by status from the status index alone.
+func (d *taskDB) Stats() (taskStats, error) {
+	var s taskStats
+	err := d.view(func(tx *bolt.Tx) error {
+		return tx.Bucket(idxStatus).ForEach(func(k, _ []byte) error {
+			status, _, ok := bytes.Cut(k, []byte{0})
+			if !ok {
+				return nil
+			}
+			s.Total++
+			switch string(status) {
+			case "success":
+				s.Success++
+			case "failed":
+				s.Failed++
+			case "pending":
+				s.Pending++
+			case "running":
+				s.Running++
+			case "dead_letter":
+				s.Dead++
+			}
+			return nil
+		})
+	})
+	return s, err
+}
+
+// Prune deletes finished tasks older than the retention policy allows,
+// with their inputs, results and threads. Dead-lettered tasks stay until
+// replayed or dropped. It returns how many tasks were removed.
+func (d *taskDB) Prune(p retentionPolicy, now time.Time) (int, error) {
+	removed := 0
+	err := d.update(func(tx *bolt.Tx) error {
+		for status, keep := range map[string]time.Duration{"success": p.Completed, "failed": p.Failed, "timeout": p.Failed} {
+			if keep <= 0 {
+				continue
+			}
+			var ids []string
+			err := scanIndex(tx, idxStatus, indexPrefix(status), time.Time{}, now.Add(-keep), func(id string) (bool, error) {
+				ids = append(ids, id)
+				return true, nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, id := range ids {
+				if err := deleteTask(tx, id); err != nil {
+					return err
+				}
+				removed++
+			}
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// Compact rewrites the database to release the space of deleted tasks,
+// returning the file size before and after.
+func (d *taskDB) Compact() (int64, int64, error) {
+	taskDBMu.Lock()
+	defer taskDBMu.Unlock()
+
+	before, err := os.Stat(d.dbPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	src, err := d.open(false)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer src.Close()
+
+	tmpPath := d.dbPath + ".compact"
+	os.Remove(tmpPath)
+	dst, err := bolt.Open(tmpPath, 0644, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("create compacted database: %w", err)
+	}
+	if err := bolt.Compact(dst, src, 64<<20); err != nil {
+		dst.Close()
+		os.Remove(tmpPath)
+		return 0, 0, fmt.Errorf("compact: %w", err)
+	}
+	dst.Close()
+	// Still holding src's lock, so no other process sees a partial swap.
+	// Processes waiting for the lock on the old file notice the swap and
+	// reopen (see open).
+	if err := os.Rename(tmpPath, d.dbPath); err != nil {
+		os.Remove(tmpPath)
+		return 0, 0, fmt.Errorf("replace database: %w", err)
+	}
+	after, err := os.Stat(d.dbPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	return before.Size(), after.Size(), nil
+}
+
+// threadEntry represents a single contribution in a discuss thread.
+type threadEntry struct {
+	AgentID    string    `json:"agent_id"`
+	Capability string    `json:"capability,omitempty"`
+	Name       string    `json:"name,omitempty"` // swarm agent display name (for @mentions)
+	Type       string    `json:"type"`           // "topic", "execute", "comment", "human"
+	Content    string    `json:"content"`
+	Round      int       `json:"round,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// AppendThread adds an entry to a discuss thread.
+func (d *taskDB) AppendThread(taskID string, entry threadEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("marshal thread entry: %w", err)
+	}
+	return d.update(func(tx *bolt.Tx) error {
+		return appendSeq(tx.Bucket(bucketThreads), []byte(taskID), data)
+	})
+}
+
+// GetThread returns all entries in a discuss thread.
+func (d *taskDB) GetThread(taskID string) ([]threadEntry, error) {
+	var entries []threadEntry
+	found := false
+	err := d.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketThreads).Bucket([]byte(taskID))
+		if b == nil {
+			return nil
+		}
+		found = true
+		return b.ForEach(func(_, v []byte) error {
+			var entry threadEntry
+			if json.Unmarshal(v, &entry) == nil {
+				entries = append(entries, entry)
+			}
+			return nil
+		})
+	})
+	if err == nil && !found {
+		err = fmt.Errorf("no thread for task %s", taskID)
+	}
+	return entries, err
+}
+
+// scaleEvent records one autoscaling action.
+type scaleEvent struct {
+	Time       time.Time `json:"time"`
+	Agent      string    `json:"agent"`
+	Capability string    `json:"capability"`
+	From       int       `json:"from"`
+	To         int       `json:"to"`
+	Pending    uint64    `json:"pending"`
+	Load       float64   `json:"load"`
+	Reason     string    `json:"reason"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// LogScaleEvent records an autoscaling action.
+func (d *taskDB) LogScaleEvent(ev scaleEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("marshal scale event: %w", err)
+	}
+	return d.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketScaling)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		return b.Put(binary.BigEndian.AppendUint64(nil, seq), data)
+	})
+}
+
+// ListScaleEvents returns the most recent autoscaling actions, newest first.
+func (d *taskDB) ListScaleEvents(agent string, limit int) ([]scaleEvent, error) {
+	var events []scaleEvent
+	err := d.view(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketScaling).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var ev scaleEvent
+			if json.Unmarshal(v, &ev) != nil || (agent != "" && ev.Agent != agent) {
+				continue
+			}
+			events = append(events, ev)
+			if limit > 0 && len(events) >= limit {
+				break
+			}
+		}
+		return nil
+	})
+	return events, err
+}
+
+// SavePipelineRun writes a pipeline run's progress.
+func (d *taskDB) SavePipelineRun(run *pipelineRun) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("marshal pipeline run: %w", err)
+	}
+	return d.update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketPipelines).Put([]byte(run.RunID), data)
+	})
+}
+
+// GetPipelineRun reads a pipeline run by ID.
+func (d *taskDB) GetPipelineRun(runID string) (*pipelineRun, error) {
+	var data []byte
+	err := d.view(func(tx *bolt.Tx) error {
+		data = copyBytes(tx.Bucket(bucketPipelines).Get([]byte(runID)))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, fmt.Errorf("pipeline run %s not found", runID)
+	}
+	var run pipelineRun
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, fmt.Errorf("parse pipeline run: %w", err)
+	}
+	return &run, nil
+}
+
+// ListPipelineRuns returns the most recent pipeline runs, newest first.
+func (d *taskDB) ListPipelineRuns(limit int) ([]*pipelineRun, error) {
+	var runs []*pipelineRun
+	err := d.view(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketPipelines).ForEach(func(_, v []byte) error {
+			var run pipelineRun
+			if json.Unmarshal(v, &run) == nil {
+				runs = append(runs, &run)
+			}
+			return nil
+		})
+	})
+	sort.Slice(runs, func(i, j int) bool { return runs[i].StartedAt.After(runs[j].StartedAt) })
+	if limit > 0 && len(runs) > limit {
+		runs = runs[:limit]
+	}
+	return runs, err
+}
+
+// getRecord reads a task record, or nil if there is none.
+func getRecord(tx *bolt.Tx, taskID string) (*taskRecord, error) {
+	data := tx.Bucket(bucketTasks).Get([]byte(taskID))
+	if data == nil {
+		return nil, nil
+	}
+	var rec taskRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("parse task %s: %w", taskID, err)
+	}
+	return &rec, nil
+}
+
+// putRecord writes rec and moves its index entries from old (nil for a
+// new task).
+func putRecord(tx *bolt.Tx, old, rec *taskRecord) error {
+	if old != nil {
+		if err := forEachIndex(old, tx.Bucket, (*bolt.Bucket).Delete); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("marshal task record: %w", err)
+	}
+	if err := tx.Bucket(bucketTasks).Put([]byte(rec.TaskID), data); err != nil {
+		return err
+	}
+	return forEachIndex(rec, tx.Bucket, func(b *bolt.Bucket, k []byte) error { return b.Put(k, nil) })
+}
+
+// forEachIndex applies fn to every index entry of rec.
+func forEachIndex(rec *taskRecord, bucket func([]byte) *bolt.Bucket, fn func(*bolt.Bucket, []byte) error) error {
+	suffix := append(binary.BigEndian.AppendUint64(nil, uint64(rec.CreatedAt.UnixNano())), rec.TaskID...)
+	entries := []struct {
+		idx    []byte
+		prefix []byte
+	}{
+		{idxTime, nil},
+		{idxCapability, indexPrefix(rec.Capability)},
+		{idxStatus, indexPrefix(rec.Status)},
+	}
+	if rec.SubmittedBy != "" {
+		entries = append(entries, struct{ idx, prefix []byte }{idxSubmitter, indexPrefix(rec.SubmittedBy)})
+	}
+	if rec.IdempotencyKey != "" {
+		entries = append(entries, struct{ idx, prefix []byte }{idxIdempotency, indexPrefix(rec.Capability, rec.IdempotencyKey)})
+	}
+	for _, e := range entries {
+		key := append(append([]byte{}, e.prefix...), suffix...)
+		if err := fn(bucket(e.idx), key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexPrefix joins index fields, each terminated by a zero byte.
+func indexPrefix(fields ...string) []byte {
+	var b []byte
+	for _, f := range fields {
+		b = append(append(b, f...), 0)
+	}
+	return b
+}
+
+// scanIndex visits task IDs under prefix from newest to oldest, limited
+// to creation times in [since, until] (zero means unbounded). fn returns
+// false to stop.
+func scanIndex(tx *bolt.Tx, idx, prefix []byte, since, until time.Time, fn func(id string) (bool, error)) error {
+	c := tx.Bucket(idx).Cursor()
+	upper := append(append([]byte{}, prefix...), 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+	if !until.IsZero() {
+		upper = append(binary.BigEndian.AppendUint64(append([]byte{}, prefix...), uint64(until.UnixNano())), 0xff)
+	}
+	k, _ := c.Seek(upper)
+	if k == nil {
+		k, _ = c.Last()
+	} else {
+		k, _ = c.Prev()
+	}
+	for ; k != nil && bytes.HasPrefix(k, prefix) && len(k) > len(prefix)+8; k, _ = c.Prev() {
+		created := int64(binary.BigEndian.Uint64(k[len(prefix):]))
+		if !since.IsZero() && created < since.UnixNano() {
+			break
+		}
+		more, err := fn(string(k[len(prefix)+8:]))
+		if err != nil || !more {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteTask removes a task and everything stored for it.
+func deleteTask(tx *bolt.Tx, taskID string) error {
+	rec, err := getRecord(tx, taskID)
+	if err != nil || rec == nil {
+		return err
+	}
+	if err := forEachIndex(rec, tx.Bucket, (*bolt.Bucket).Delete); err != nil {
+		return err
+	}
+	id := []byte(taskID)
+	for _, b := range [][]byte{bucketTasks, bucketInputs, bucketResults} {
+		if err := tx.Bucket(b).Delete(id); err != nil {
+			return err
+		}
+	}
+	if tx.Bucket(bucketThreads).Bucket(id) != nil {
+		return tx.Bucket(bucketThreads).DeleteBucket(id)
+	}
+	return nil
+}
+
+// appendSeq adds value to the nested bucket name under a sequence key.
+func appendSeq(parent *bolt.Bucket, name, value []byte) error {
+	b, err := parent.CreateBucketIfNotExists(name)
+	if err != nil {
+		return err
+	}
+	seq, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	return b.Put(binary.BigEndian.AppendUint64(nil, seq), value)
+}
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+// migrateLegacy imports the JSON files used before swarm.db (tasks.json
+// and tasks/<id>.*), returning the index files to set aside afterwards.
+func (d *taskDB) migrateLegacy(tx *bolt.Tx) ([]string, error) {
+	dir := filepath.Dir(d.dbPath)
+	legacyPath := filepath.Join(dir, "tasks.json")
+	data, err := os.ReadFile(legacyPath)
+	if err != nil {
+		return nil, nil
+	}
+	var records []taskRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("parse legacy %s: %w", legacyPath, err)
+	}
+	imported := []string{legacyPath}
+
+	taskDir := filepath.Join(dir, "tasks")
+	for i := range records {
+		rec := &records[i]
+		if tx.Bucket(bucketTasks).Get([]byte(rec.TaskID)) != nil {
+			continue
+		}
+		if err := putRecord(tx, nil, rec); err != nil {
+			return nil, err
+		}
+		id := []byte(rec.TaskID)
+		for bucket, suffix := range map[string]string{"inputs": ".input.json", "results": ".json", "dead_letters": ".dlq.json"} {
+			if raw, err := os.ReadFile(filepath.Join(taskDir, rec.TaskID+suffix)); err == nil {
+				if err := tx.Bucket([]byte(bucket)).Put(id, raw); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if raw, err := os.ReadFile(filepath.Join(taskDir, rec.TaskID+".thread.jsonl")); err == nil {
+			for _, line := range strings.Split(strings.TrimSpace(string(raw)), "\n") {
+				if line == "" {
+					continue
+				}
+				if err := appendSeq(tx.Bucket(bucketThreads), id, []byte(line)); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	scalingPath := filepath.Join(dir, "scaling.jsonl")
+	if raw, err := os.ReadFile(scalingPath); err == nil {
+		b := tx.Bucket(bucketScaling)
+		for _, line := range strings.Split(strings.TrimSpace(string(raw)), "\n") {
+			if line == "" {
+				continue
+			}
+			seq, err := b.NextSequence()
+			if err != nil {
+				return nil, err
+			}
+			if err := b.Put(binary.BigEndian.AppendUint64(nil, seq), []byte(line)); err != nil {
+				return nil, err
+			}
+		}
+		imported = append(imported, scalingPath)
+	}
+	paths, _ := filepath.Glob(filepath.Join(dir, "pipelines", "*.json"))
+	for _, p := range paths {
+		if raw, err := os.ReadFile(p); err == nil {
+			if err := tx.Bucket(bucketPipelines).Put([]byte(strings.TrimSuffix(filepath.Base(p), ".json")), raw); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Imported %d tasks from %s into %s\n", len(records), legacyPath, d.dbPath)
+	return imported, nil
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vinayprograms/agentkit/tasks"
+	bolt "go.etcd.io/bbolt"
+)
+
+func newTestTaskDB(t *testing.T) *taskDB {
+	t.Helper()
+	db, err := openTaskDB(filepath.Join(t.TempDir(), "swarm.db"))
+	if err != nil {
+		t.Fatalf("openTaskDB: %v", err)
+	}
+	return db
+}
+
+func TestTaskDB_OpenAfterCompact(t *testing.T) {
+	db := newTestTaskDB(t)
+	db.InsertTask(&tasks.TaskMessage{TaskID: "t1", Capability: "code"}, "pending")
+
+	// Another process holds the lock, as Compact does while it swaps in
+	// the compacted file
+	old, err := bolt.Open(db.dbPath, 0644, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened := make(chan error, 1)
+	go func() {
+		b, err := db.open(false)
+		if err == nil {
+			err = b.Update(func(tx *bolt.Tx) error {
+				return tx.Bucket(bucketTasks).Put([]byte("marker"), []byte("{}"))
+			})
+			b.Close()
+		}
+		opened <- err
+	}()
+	time.Sleep(100 * time.Millisecond) // let the open block on the old file
+
+	tmp := db.dbPath + ".compact"
+	dst, err := bolt.Open(tmp, 0644, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bolt.Compact(dst, old, 0); err != nil {
+		t.Fatal(err)
+	}
+	dst.Close()
+	if err := os.Rename(tmp, db.dbPath); err != nil {
+		t.Fatal(err)
+	}
+	old.Close()
+
+	if err := <-opened; err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	var found bool
+	db.view(func(tx *bolt.Tx) error {
+		found = tx.Bucket(bucketTasks).Get([]byte("marker")) != nil
+		return nil
+	})
+	if !found {
+		t.Error("a write by a process that waited out the swap went to the replaced file")
+	}
+}
+
+func TestTaskDB_Compact(t *testing.T) {
+	db := newTestTaskDB(t)
+	for i := 0; i < 200; i++ {
+		db.InsertTask(&tasks.TaskMessage{TaskID: fmt.Sprintf("t%d", i), Capability: "code"}, "success")
+	}
+	if _, err := db.Prune(retentionPolicy{Completed: time.Nanosecond}, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	before, after, err := db.Compact()
+	if err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	if after > before {
+		t.Errorf("expected compaction not to grow the file, %d -> %d", before, after)
+	}
+	if _, err := os.Stat(db.dbPath + ".compact"); !os.IsNotExist(err) {
+		t.Error("expected the temporary file to be gone")
+	}
+	if list, err := db.ListTasks(taskFilter{}); err != nil || len(list) != 0 {
+		t.Errorf("expected an empty, readable database after compaction, got %d tasks, %v", len(list), err)
+	}
+}
+
+// seedTasks writes task records with the given creation times, as
+// InsertTask would have at those times.
+func seedTasks(t *testing.T, db *taskDB, recs ...taskRecord) {
+	t.Helper()
+	err := db.update(func(tx *bolt.Tx) error {
+		for i := range recs {
+			if err := putRecord(tx, nil, &recs[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+}
+
+func taskIDs(recs []taskRecord) []string {
+	ids := make([]string, len(recs))
+	for i, r := range recs {
+		ids[i] = r.TaskID
+	}
+	return ids
+}
+
+func TestTaskDB_ListTasks(t *testing.T) {
+	db := newTestTaskDB(t)
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(h int) time.Time { return base.Add(time.Duration(h) * time.Hour) }
+	seedTasks(t, db,
+		taskRecord{TaskID: "a", Capability: "code", Status: "success", CreatedAt: at(0), SubmittedBy: "alice"},
+		taskRecord{TaskID: "b", Capability: "review", Status: "failed", CreatedAt: at(1), SubmittedBy: "bob"},
+		taskRecord{TaskID: "c", Capability: "code", Status: "failed", CreatedAt: at(2), SubmittedBy: "alice"},
+		taskRecord{TaskID: "d", Capability: "code", Status: "pending", CreatedAt: at(3)},
+		taskRecord{TaskID: "e", Capability: "review", Status: "success", CreatedAt: at(4), SubmittedBy: "alice"},
+	)
+
+	tests := []struct {
+		name   string
+		filter taskFilter
+		want   string
+	}{
+		{"all, newest first", taskFilter{}, "e,d,c,b,a"},
+		{"status index", taskFilter{Status: "failed"}, "c,b"},
+		{"capability index", taskFilter{Capability: "code"}, "d,c,a"},
+		{"submitter index", taskFilter{SubmittedBy: "alice"}, "e,c,a"},
+		{"status drives, capability filters", taskFilter{Status: "failed", Capability: "code"}, "c"},
+		{"capability drives, submitter filters", taskFilter{Capability: "review", SubmittedBy: "alice"}, "e"},
+		{"all three", taskFilter{Status: "success", Capability: "code", SubmittedBy: "alice"}, "a"},
+		{"since", taskFilter{Since: at(3)}, "e,d"},
+		{"until", taskFilter{Until: at(1)}, "b,a"},
+		{"window on an index", taskFilter{Capability: "code", Since: at(1), Until: at(3)}, "d,c"},
+		{"limit", taskFilter{Limit: 2}, "e,d"},
+		{"limit after filtering", taskFilter{Status: "success", SubmittedBy: "alice", Limit: 1}, "e"},
+		{"no match", taskFilter{Capability: "deploy"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.ListTasks(tt.filter)
+			if err != nil {
+				t.Fatalf("ListTasks: %v", err)
+			}
+			if ids := strings.Join(taskIDs(got), ","); ids != tt.want {
+				t.Errorf("got %q, want %q", ids, tt.want)
+			}
+		})
+	}
+
+	// Status changes move the index entry
+	if err := db.SetStatus("d", "success"); err != nil {
+		t.Fatalf("SetStatus: %v", err)
+	}
+	if got, _ := db.ListTasks(taskFilter{Status: "pending"}); len(got) != 0 {
+		t.Errorf("expected no pending tasks after the update, got %v", taskIDs(got))
+	}
+	if got, _ := db.ListTasks(taskFilter{Status: "success"}); strings.Join(taskIDs(got), ",") != "e,d,a" {
+		t.Errorf("expected d among successes, got %v", taskIDs(got))
+	}
+	if stats, _ := db.Stats(); stats.Total != 5 || stats.Success != 3 || stats.Failed != 2 || stats.Pending != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestTaskDB_FindByIdempotencyKey(t *testing.T) {
+	db := newTestTaskDB(t)
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	seedTasks(t, db,
+		taskRecord{TaskID: "old", Capability: "code", Status: "success", CreatedAt: base, IdempotencyKey: "k1"},
+		taskRecord{TaskID: "new", Capability: "code", Status: "pending", CreatedAt: base.Add(time.Hour), IdempotencyKey: "k1"},
+		taskRecord{TaskID: "other-cap", Capability: "review", Status: "success", CreatedAt: base, IdempotencyKey: "k2"},
+		taskRecord{TaskID: "failed", Capability: "code", Status: "failed", CreatedAt: base.Add(2 * time.Hour), IdempotencyKey: "k3"},
+	)
+
+	if rec, ok := db.FindByIdempotencyKey("code", "k1"); !ok || rec.TaskID != "new" {
+		t.Errorf("expected the newest task for k1, got %+v", rec)
+	}
+	if _, ok := db.FindByIdempotencyKey("code", "k2"); ok {
+		t.Error("keys are scoped to a capability")
+	}
+	if _, ok := db.FindByIdempotencyKey("code", "k3"); ok {
+		t.Error("a failed task should not satisfy the key, so it can be resubmitted")
+	}
+	if _, ok := db.FindByIdempotencyKey("code", "missing"); ok {
+		t.Error("expected no task for an unknown key")
+	}
+
+	// A key that is a prefix of another doesn't match it
+	seedTasks(t, db, taskRecord{TaskID: "long", Capability: "code", Status: "success", CreatedAt: base, IdempotencyKey: "k10"})
+	if rec, ok := db.FindByIdempotencyKey("code", "k1"); !ok || rec.TaskID != "new" {
+		t.Errorf("expected k1 to ignore k10, got %+v", rec)
+	}
+
+	// Once the newest fails, the older success still holds the key
+	if err := db.SetStatus("new", "failed"); err != nil {
+		t.Fatal(err)
+	}
+	if rec, ok := db.FindByIdempotencyKey("code", "k1"); !ok || rec.TaskID != "old" {
+		t.Errorf("expected the older success for k1, got %+v", rec)
+	}
+}
+
+func TestTaskDB_MigrateLegacy(t *testing.T) {
+	dir := t.TempDir()
+	created := time.Date(2026, 2, 1, 9, 0, 0, 0, time.UTC)
+	legacy := []taskRecord{
+		{TaskID: "t1", Capability: "code", Status: "success", CreatedAt: created, DurationMs: 1200},
+		{TaskID: "t2", Capability: "review", Status: "dead_letter", CreatedAt: created.Add(time.Minute)},
+	}
+	data, _ := json.Marshal(legacy)
+	os.WriteFile(filepath.Join(dir, "tasks.json"), data, 0644)
+	os.MkdirAll(filepath.Join(dir, "tasks"), 0755)
+	os.WriteFile(filepath.Join(dir, "tasks", "t1.input.json"), []byte(`{"task_id":"t1","capability":"code","inputs":{"msg":"hi"}}`), 0644)
+	os.WriteFile(filepath.Join(dir, "tasks", "t1.json"), []byte(`{"task_id":"t1","status":"success","outputs":{"out":"done"}}`), 0644)
+	os.WriteFile(filepath.Join(dir, "tasks", "t1.thread.jsonl"), []byte(`{"agent_id":"a","type":"comment","content":"one"}`+"\n"+`{"agent_id":"b","type":"comment","content":"two"}`+"\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "tasks", "t2.dlq.json"), []byte(`{"task":{"task_id":"t2","capability":"review"},"attempts":3}`), 0644)
+	os.WriteFile(filepath.Join(dir, "scaling.jsonl"), []byte(`{"agent":"coder","from":1,"to":2}`+"\n"), 0644)
+
+	db, err := openTaskDB(filepath.Join(dir, "swarm.db"))
+	if err != nil {
+		t.Fatalf("openTaskDB: %v", err)
+	}
+
+	list, err := db.ListTasks(taskFilter{})
+	if err != nil || strings.Join(taskIDs(list), ",") != "t2,t1" {
+		t.Fatalf("expected both legacy tasks, got %v, %v", taskIDs(list), err)
+	}
+	if !list[1].CreatedAt.Equal(created) || list[1].DurationMs != 1200 {
+		t.Errorf("legacy record fields not kept: %+v", list[1])
+	}
+	if got, _ := db.ListTasks(taskFilter{Capability: "review", Status: "dead_letter"}); len(got) != 1 {
+		t.Error("expected legacy tasks to be indexed")
+	}
+	if task, err := db.GetTask("t1"); err != nil || task.Inputs["msg"] != "hi" {
+		t.Errorf("expected t1's input, got %+v, %v", task, err)
+	}
+	if res, err := db.GetResult("t1"); err != nil || res.Status != "success" {
+		t.Errorf("expected t1's result, got %+v, %v", res, err)
+	}
+	if thread, err := db.GetThread("t1"); err != nil || len(thread) != 2 {
+		t.Errorf("expected two thread entries, got %d, %v", len(thread), err)
+	}
+	if dl, err := db.GetDeadLetter("t2"); err != nil || dl.Task.TaskID != "t2" {
+		t.Errorf("expected t2's dead letter, got %+v, %v", dl, err)
+	}
+	if events, _ := db.ListScaleEvents("", 10); len(events) != 1 {
+		t.Errorf("expected one scaling event, got %d", len(events))
+	}
+
+	// The JSON files are set aside, so a reopen doesn't import them again
+	if _, err := os.Stat(filepath.Join(dir, "tasks.json.migrated")); err != nil {
+		t.Errorf("expected tasks.json to be set aside: %v", err)
+	}
+	db, err = openTaskDB(filepath.Join(dir, "swarm.db"))
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if thread, _ := db.GetThread("t1"); len(thread) != 2 {
+		t.Errorf("expected the thread not to be imported twice, got %d entries", len(thread))
+	}
+}
+
+func TestTaskDB_Prune(t *testing.T) {
+	db := newTestTaskDB(t)
+	now := time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	seedTasks(t, db,
+		taskRecord{TaskID: "old-success", Capability: "code", Status: "success", CreatedAt: now.Add(-40 * day)},
+		taskRecord{TaskID: "new-success", Capability: "code", Status: "success", CreatedAt: now.Add(-10 * day)},
+		taskRecord{TaskID: "old-failed", Capability: "code", Status: "failed", CreatedAt: now.Add(-41 * day)},
+		taskRecord{TaskID: "old-timeout", Capability: "code", Status: "timeout", CreatedAt: now.Add(-40 * day)},
+		taskRecord{TaskID: "old-dead", Capability: "code", Status: "dead_letter", CreatedAt: now.Add(-90 * day)},
+		taskRecord{TaskID: "old-running", Capability: "code", Status: "running", CreatedAt: now.Add(-90 * day)},
+	)
+	db.UpdateResult(&tasks.TaskResult{TaskID: "old-success", Status: tasks.ResultSuccess})
+	db.AppendThread("old-success", threadEntry{AgentID: "a", Type: "comment", Content: "note"})
+
+	// The default keeps failures
+	removed, err := db.Prune(defaultRetention, now)
+	if err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("expected 1 task removed, got %d", removed)
+	}
+	got, _ := db.ListTasks(taskFilter{})
+	if ids := strings.Join(taskIDs(got), ","); ids != "new-success,old-timeout,old-failed,old-running,old-dead" {
+		t.Errorf("unexpected tasks after pruning: %s", ids)
+	}
+	if _, err := db.GetResult("old-success"); err == nil {
+		t.Error("expected the pruned task's result to be deleted")
+	}
+	if thread, _ := db.GetThread("old-success"); len(thread) != 0 {
+		t.Error("expected the pruned task's thread to be deleted")
+	}
+	if stats, _ := db.Stats(); stats.Total != 5 {
+		t.Errorf("expected the index to drop the pruned task, got %+v", stats)
+	}
+
+	// Failures and timeouts go with a failed retention; dead letters and
+	// unfinished tasks stay
+	removed, _ = db.Prune(retentionPolicy{Failed: 7 * day}, now)
+	got, _ = db.ListTasks(taskFilter{})
+	if ids := strings.Join(taskIDs(got), ","); removed != 2 || ids != "new-success,old-running,old-dead" {
+		t.Errorf("expected failures pruned, removed %d, left %s", removed, ids)
+	}
+}
@@ -13,6 +13,10 @@ import (
 // heartbeatTimeout is how long to wait after last heartbeat before declaring agents dead.
 const heartbeatTimeout = 30 * time.Second
 
+// retryNoticeGrace is how long a failed result waits for `swarm up` to
+// announce a retry before it is treated as final.
+const retryNoticeGrace = 2 * time.Second
+
 // waitForResult waits for a task result while monitoring agent heartbeats.
 // It only times out if ALL agents stop sending heartbeats (i.e., they're dead).
 // Returns the result when received, or error if all agents are gone.
@@ -24,6 +28,13 @@ func waitForResult(nc *nats.Conn, taskID string, db *taskDB) (*tasks.TaskResult,
 	}
 	defer resultSub.Unsubscribe()
 
+	// Retries of failed attempts are announced on retry.<cap>.<task_id>
+	retrySub, err := nc.SubscribeSync(fmt.Sprintf("retry.*.%s", taskID))
+	if err != nil {
+		return nil, fmt.Errorf("subscribe retry: %w", err)
+	}
+	defer retrySub.Unsubscribe()
+
 	// Subscribe to heartbeats
 	hbSub, err := nc.SubscribeSync("heartbeat.>")
 	if err != nil {
@@ -44,6 +55,18 @@ func waitForResult(nc *nats.Conn, taskID string, db *taskDB) (*tasks.TaskResult,
 				return nil, fmt.Errorf("parse result: %w", err)
 			}
 
+			// A failed attempt that will be retried isn't the final result
+			if result.Status != tasks.ResultSuccess {
+				if notice, err := retrySub.NextMsg(retryNoticeGrace); err == nil {
+					var rn retryNotice
+					json.Unmarshal(notice.Data, &rn)
+					fmt.Fprintf(os.Stderr, "Attempt failed (%s), retrying as attempt %d in %s...\n",
+						result.Error, rn.Attempt, time.Duration(rn.DelayMs)*time.Millisecond)
+					lastHeartbeat = time.Now()
+					continue
+				}
+			}
+
 			// Save to DB
 			if db != nil {
 				if err := db.UpdateResult(&result); err != nil {
@@ -88,7 +88,7 @@ func (s *webServer) start(ctx context.Context, addr string) error {
 	s.nc = nc
 
 	// Subscribe to all relevant subjects
-	subjects := []string{"heartbeat.>", "work.>", "done.>", "discuss.>", "control.>", "log.>", "events.>"}
+	subjects := []string{"heartbeat.>", "work.>", "done.>", "retry.>", "dlq.>", "discuss.>", "control.>", "log.>", "events.>"}
 	for _, subj := range subjects {
 		sub := subj
 		_, err := nc.Subscribe(sub, func(msg *nats.Msg) {
@@ -416,7 +416,7 @@ func (s *webServer) sendInitialState(conn *websocket.Conn) {
 	if s.db == nil {
 		return
 	}
-	records, err := s.db.ListTasks("", "", 50)
+	records, err := s.db.ListTasks(taskFilter{Limit: 50})
 	if err != nil {
 		return
 	}
@@ -534,7 +534,7 @@ func (s *webServer) handleRetryCommand(args []string) {
 	taskID := args[0]
 
 	// Look up capability from task records
-	records, err := s.db.ListTasks("", "", 100)
+	records, err := s.db.ListTasks(taskFilter{Limit: 100})
 	if err != nil {
 		log.Printf("Retry: cannot load tasks: %v", err)
 		return
@@ -1,5 +1,11 @@
 package agentfile
 
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
 // Node is the interface implemented by all AST nodes.
 type Node interface {
 	node()
@@ -46,28 +52,106 @@ type Agent struct {
 
 func (a *Agent) node() {}
 
+// Output field kinds for typed structured outputs (-> name:kind).
+const (
+	OutputString  = "string"
+	OutputNumber  = "number"
+	OutputInteger = "integer"
+	OutputBool    = "bool"
+	OutputList    = "list"
+	OutputObject  = "object"
+	OutputEnum    = "enum"
+)
+
+// OutputType is the declared type of a structured output field.
+type OutputType struct {
+	Kind string   // one of the Output* kinds
+	Enum []string // allowed values when Kind is OutputEnum
+}
+
+// String returns the type as written in an Agentfile, e.g. "enum(pass,fail)".
+func (t OutputType) String() string {
+	if t.Kind == OutputEnum {
+		return OutputEnum + "(" + strings.Join(t.Enum, ",") + ")"
+	}
+	return t.Kind
+}
+
+// HasTypedOutputs reports whether the goal declares output types or a SCHEMA,
+// in which case its output must validate.
+func (g *Goal) HasTypedOutputs() bool {
+	return len(g.OutputTypes) > 0 || g.Schema != nil
+}
+
+// FieldType returns the type of an output field: the -> declaration if
+// present, else the field's SCHEMA property, else string.
+func (g *Goal) FieldType(name string) OutputType {
+	if t, ok := g.OutputTypes[name]; ok {
+		return t
+	}
+	props, _ := g.Schema["properties"].(map[string]any)
+	prop, _ := props[name].(map[string]any)
+	if values, ok := prop["enum"].([]any); ok {
+		t := OutputType{Kind: OutputEnum}
+		for _, v := range values {
+			t.Enum = append(t.Enum, fmt.Sprint(v))
+		}
+		return t
+	}
+	switch prop["type"] {
+	case "number":
+		return OutputType{Kind: OutputNumber}
+	case "integer":
+		return OutputType{Kind: OutputInteger}
+	case "boolean":
+		return OutputType{Kind: OutputBool}
+	case "array":
+		return OutputType{Kind: OutputList}
+	case "object":
+		return OutputType{Kind: OutputObject}
+	}
+	return OutputType{Kind: OutputString}
+}
+
 // Goal represents a GOAL or CONVERGE declaration.
 type Goal struct {
 	Name        string
-	Outcome     string          // inline string content
-	FromPath    string          // path to outcome file (mutually exclusive with Outcome)
-	Outputs     []string        // structured output field names (after ->)
-	UsingAgent  []string        // agent names for multi-agent goals
-	IsConverge  bool            // true if this is a CONVERGE goal (iterative convergence)
-	WithinLimit *int            // max iterations for CONVERGE (nil if variable reference)
-	WithinVar   string          // variable name for CONVERGE limit (if not literal)
-	Supervision SupervisionMode // inherit/supervised/unsupervised
-	HumanOnly   bool            // requires human approval (SUPERVISED HUMAN)
+	Outcome     string                // inline string content
+	FromPath    string                // path to outcome file (mutually exclusive with Outcome)
+	Outputs     []string              // structured output field names (after ->)
+	OutputTypes map[string]OutputType // declared field types (-> name:type); untyped fields are absent
+	SchemaPath  string                // SCHEMA path to a JSON Schema for the output
+	Schema      map[string]any        // loaded SCHEMA document
+	UsingAgent  []string              // agent names for multi-agent goals
+	IsConverge  bool                  // true if this is a CONVERGE goal (iterative convergence)
+	WithinLimit *int                  // max iterations for CONVERGE (nil if variable reference)
+	WithinVar   string                // variable name for CONVERGE limit (if not literal)
+	When        *Condition            // WHEN clause (nil if unconditional)
+	Retry       int                   // extra attempts after a failure (RETRY n)
+	Timeout     time.Duration         // per-attempt time limit (0 = none)
+	OnFailure   string                // fallback goal run if every attempt fails
+	MaxTurns    int                   // tool-use turn budget override (0 = config default)
+	MaxTokens   int                   // token budget override (0 = config default)
+	Supervision SupervisionMode       // inherit/supervised/unsupervised
+	HumanOnly   bool                  // requires human approval (SUPERVISED HUMAN)
 	Line        int
 }
 
 func (g *Goal) node() {}
 
-// Step represents a RUN step.
+// HasFailurePolicy returns true if the goal declares RETRY, TIMEOUT, or ON FAILURE.
+func (g *Goal) HasFailurePolicy() bool {
+	return g.Retry > 0 || g.Timeout > 0 || g.OnFailure != ""
+}
+
+// Step represents a RUN, LOOP, or PARALLEL step.
 type Step struct {
 	Type        StepType
 	Name        string
 	UsingGoals  []string        // goal names to execute
+	WithinLimit *int            // max iterations for LOOP (nil if variable reference)
+	WithinVar   string          // variable name for LOOP limit (if not literal)
+	When        *Condition      // WHEN clause (nil if unconditional)
 	Supervision SupervisionMode // inherit/supervised/unsupervised
 	HumanOnly   bool            // requires human approval (SUPERVISED HUMAN)
 	Line        int
@@ -75,6 +159,16 @@ type Step struct {
 
 func (s *Step) node() {}
 
+// Condition represents a WHEN clause on a GOAL or RUN step.
+type Condition struct {
+	Var   string // variable name (without $)
+	Op    string // "" (truthy), "==", "!=", or "=~"
+	Value string // comparison value or regex pattern
+	Line  int
+}
+
+func (c *Condition) node() {}
+
 // IsSupervised returns true if this step should be supervised.
 // Checks step-level override first, then falls back to workflow default.
 func (s *Step) IsSupervised(wf *Workflow) bool {
@@ -0,0 +1,59 @@
+package agentfile
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Condition operators.
+const (
+	OpTruthy   = ""
+	OpEquals   = "=="
+	OpNotEqual = "!="
+	OpMatches  = "=~"
+)
+
+// falsy lists values a truthy WHEN clause treats as false (case-insensitive).
+var falsy = map[string]bool{
+	"":      true,
+	"false": true,
+	"no":    true,
+	"0":     true,
+	"off":   true,
+	"none":  true,
+	"null":  true,
+}
+
+// Eval evaluates the condition, resolving the variable with lookup.
+// An undefined variable is falsy and compares equal only to "".
+// Values are trimmed before comparison since goal outputs often end in a newline.
+func (c *Condition) Eval(lookup func(name string) (string, bool)) (bool, error) {
+	val, _ := lookup(c.Var)
+	val = strings.TrimSpace(val)
+
+	switch c.Op {
+	case OpTruthy:
+		return !falsy[strings.ToLower(val)], nil
+	case OpEquals:
+		return val == c.Value, nil
+	case OpNotEqual:
+		return val != c.Value, nil
+	case OpMatches:
+		re, err := regexp.Compile(c.Value)
+		if err != nil {
+			return false, fmt.Errorf("line %d: invalid WHEN pattern %q: %w", c.Line, c.Value, err)
+		}
+		return re.MatchString(val), nil
+	default:
+		return false, fmt.Errorf("line %d: unknown WHEN operator %q", c.Line, c.Op)
+	}
+}
+
+// String returns the clause as written in the Agentfile.
+func (c *Condition) String() string {
+	if c.Op == OpTruthy {
+		return "$" + c.Var
+	}
+	return fmt.Sprintf("$%s %s %q", c.Var, c.Op, c.Value)
+}
@@ -0,0 +1,56 @@
+package agentfile
+
+import "testing"
+
+func TestCondition_Eval(t *testing.T) {
+	vars := map[string]string{
+		"status": "pass\n",
+		"flag":   "yes",
+		"off":    "False",
+		"empty":  "",
+	}
+	lookup := func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+
+	tests := []struct {
+		name string
+		cond Condition
+		want bool
+	}{
+		{"equals", Condition{Var: "status", Op: OpEquals, Value: "pass"}, true},
+		{"equals mismatch", Condition{Var: "status", Op: OpEquals, Value: "fail"}, false},
+		{"not equal", Condition{Var: "status", Op: OpNotEqual, Value: "fail"}, true},
+		{"regex", Condition{Var: "status", Op: OpMatches, Value: "^pa"}, true},
+		{"regex mismatch", Condition{Var: "status", Op: OpMatches, Value: "^fail"}, false},
+		{"truthy", Condition{Var: "flag"}, true},
+		{"falsy word", Condition{Var: "off"}, false},
+		{"falsy empty", Condition{Var: "empty"}, false},
+		{"undefined", Condition{Var: "missing"}, false},
+		{"undefined equals empty", Condition{Var: "missing", Op: OpEquals, Value: ""}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.cond.Eval(lookup)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Eval(%s) = %v, want %v", tt.cond.String(), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCondition_String(t *testing.T) {
+	c := Condition{Var: "status", Op: OpEquals, Value: "pass"}
+	if got := c.String(); got != `$status == "pass"` {
+		t.Errorf("String() = %s", got)
+	}
+	c = Condition{Var: "ready"}
+	if got := c.String(); got != "$ready" {
+		t.Errorf("String() = %s", got)
+	}
+}
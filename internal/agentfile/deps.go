@@ -0,0 +1,141 @@
+package agentfile
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// varRefPattern matches $variable references in outcomes and prompts.
+var varRefPattern = regexp.MustCompile(`\$([a-zA-Z_][a-zA-Z0-9_]*)`)
+
+// VariableRefs returns the variables a goal reads: $refs in its outcome,
+// in the prompts of the agents it uses, its WITHIN variable, and its WHEN
+// clause.
+func (g *Goal) VariableRefs(wf *Workflow) []string {
+	texts := []string{g.Outcome}
+	for _, name := range g.UsingAgent {
+		for _, agent := range wf.Agents {
+			if agent.Name == name {
+				texts = append(texts, agent.Prompt)
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	var refs []string
+	add := func(name string) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			refs = append(refs, name)
+		}
+	}
+	for _, text := range texts {
+		for _, m := range varRefPattern.FindAllStringSubmatch(text, -1) {
+			add(m[1])
+		}
+	}
+	add(g.WithinVar)
+	if g.When != nil {
+		add(g.When.Var)
+	}
+	return refs
+}
+
+// Provides returns the variables a goal writes: its own name and any
+// structured output fields declared with ->.
+func (g *Goal) Provides() []string {
+	return append([]string{g.Name}, g.Outputs...)
+}
+
+// GoalDependencies derives a dependency DAG for the named goals.
+// Goal A depends on goal B when A references a variable that B provides.
+// Only dependencies among the given goals are returned; references to
+// inputs or goals outside the group are satisfied before the group runs.
+func (wf *Workflow) GoalDependencies(goalNames []string) map[string][]string {
+	providers := make(map[string][]string) // variable -> goals providing it
+	for _, name := range goalNames {
+		goal := wf.findGoal(name)
+		if goal == nil {
+			continue
+		}
+		for _, v := range goal.Provides() {
+			providers[v] = append(providers[v], name)
+		}
+	}
+
+	deps := make(map[string][]string, len(goalNames))
+	for _, name := range goalNames {
+		deps[name] = nil
+		goal := wf.findGoal(name)
+		if goal == nil {
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, ref := range goal.VariableRefs(wf) {
+			for _, provider := range providers[ref] {
+				if provider != name && !seen[provider] {
+					seen[provider] = true
+					deps[name] = append(deps[name], provider)
+				}
+			}
+		}
+	}
+	return deps
+}
+
+// DependencyCycle returns an error describing the first cycle found in a
+// dependency graph produced by GoalDependencies, or nil if it is acyclic.
+func DependencyCycle(goalNames []string, deps map[string][]string) error {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int, len(goalNames))
+	var path []string
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			start := 0
+			for i, n := range path {
+				if n == name {
+					start = i
+				}
+			}
+			cycle := append(append([]string{}, path[start:]...), name)
+			return fmt.Errorf("dependency cycle: %s", strings.Join(cycle, " -> "))
+		case done:
+			return nil
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range deps[name] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = done
+		return nil
+	}
+
+	for _, name := range goalNames {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findGoal returns the goal with the given name, or nil.
+func (wf *Workflow) findGoal(name string) *Goal {
+	for i := range wf.Goals {
+		if wf.Goals[i].Name == name {
+			return &wf.Goals[i]
+		}
+	}
+	return nil
+}
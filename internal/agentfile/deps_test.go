@@ -0,0 +1,52 @@
+package agentfile
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGoalDependencies(t *testing.T) {
+	input := `NAME test
+INPUT topic
+AGENT critic "Critique $draft"
+GOAL research "Research $topic" -> facts, sources
+GOAL outline "Outline $topic"
+GOAL draft "Write using $facts and $outline"
+GOAL review "Review the draft" USING critic
+PARALLEL write USING research, outline, draft, review`
+
+	wf, err := ParseString(input)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+
+	deps := wf.GoalDependencies(wf.Steps[0].UsingGoals)
+	want := map[string][]string{
+		"research": nil,
+		"outline":  nil,
+		"draft":    {"research", "outline"},
+		"review":   {"draft"},
+	}
+	if !reflect.DeepEqual(deps, want) {
+		t.Errorf("GoalDependencies() = %v, want %v", deps, want)
+	}
+	if err := DependencyCycle(wf.Steps[0].UsingGoals, deps); err != nil {
+		t.Errorf("unexpected cycle: %v", err)
+	}
+}
+
+func TestDependencyCycle(t *testing.T) {
+	deps := map[string][]string{
+		"a": {"c"},
+		"b": {"a"},
+		"c": {"b"},
+	}
+	err := DependencyCycle([]string{"a", "b", "c"}, deps)
+	if err == nil {
+		t.Fatal("expected cycle error")
+	}
+	if !strings.Contains(err.Error(), "a -> c -> b -> a") {
+		t.Errorf("unexpected cycle description: %v", err)
+	}
+}
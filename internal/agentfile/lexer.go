@@ -13,7 +13,7 @@ type Lexer struct {
 	line         int  // current line number (1-indexed)
 	column       int  // current column number (1-indexed)
 	startColumn  int  // column at start of current token
-	afterFrom    bool // true if previous token was FROM (for path parsing)
+	afterFrom    bool // true if previous token was FROM or SCHEMA (for path parsing)
 }
 
 // NewLexer creates a new lexer for the given input.
@@ -95,6 +95,15 @@ func (l *Lexer) NextToken() Token {
 	case ',':
 		tok = l.newToken(TokenComma, ",")
 		l.readChar()
+	case ':':
+		tok = l.newToken(TokenColon, ":")
+		l.readChar()
+	case '(':
+		tok = l.newToken(TokenLParen, "(")
+		l.readChar()
+	case ')':
+		tok = l.newToken(TokenRParen, ")")
+		l.readChar()
 	case '-':
 		if l.peekChar() == '>' {
 			l.readChar() // consume -
@@ -104,6 +113,29 @@ func (l *Lexer) NextToken() Token {
 			tok = l.newToken(TokenIllegal, string(l.ch))
 			l.readChar()
 		}
+	case '=':
+		switch l.peekChar() {
+		case '=':
+			l.readChar() // consume =
+			l.readChar() // consume =
+			tok = l.newToken(TokenEq, "==")
+		case '~':
+			l.readChar() // consume =
+			l.readChar() // consume ~
+			tok = l.newToken(TokenMatch, "=~")
+		default:
+			tok = l.newToken(TokenIllegal, string(l.ch))
+			l.readChar()
+		}
+	case '!':
+		if l.peekChar() == '=' {
+			l.readChar() // consume !
+			l.readChar() // consume =
+			tok = l.newToken(TokenNotEq, "!=")
+		} else {
+			tok = l.newToken(TokenIllegal, string(l.ch))
+			l.readChar()
+		}
 	case '"':
 		tok = l.readString()
 	case '$':
@@ -115,8 +147,8 @@ func (l *Lexer) NextToken() Token {
 			l.afterFrom = false
 		} else if isLetter(l.ch) || l.ch == '_' {
 			tok = l.readIdentifier()
-			// Check if it's FROM to set path parsing mode
-			if tok.Type == TokenFROM {
+			// FROM and SCHEMA are followed by a path
+			if tok.Type == TokenFROM || tok.Type == TokenSCHEMA {
 				l.afterFrom = true
 			}
 		} else if isDigit(l.ch) {
@@ -194,15 +226,23 @@ func (l *Lexer) readIdentifier() Token {
 	}
 }
 
-// readNumber reads a number literal.
+// readNumber reads a number literal, or a duration (e.g. 10m, 1h30m, 1.5h)
+// when the digits are immediately followed by a unit.
 func (l *Lexer) readNumber() Token {
 	l.startColumn = l.column
 	position := l.position
 	for isDigit(l.ch) {
 		l.readChar()
 	}
+	tokenType := TokenNumber
+	if isLetter(l.ch) || (l.ch == '.' && isDigit(l.peekChar())) {
+		tokenType = TokenDuration
+		for isLetter(l.ch) || isDigit(l.ch) || l.ch == '.' {
+			l.readChar()
+		}
+	}
 	return Token{
-		Type:    TokenNumber,
+		Type:    tokenType,
 		Literal: l.input[position:l.position],
 		Line:    l.line,
 		Column:  l.startColumn,
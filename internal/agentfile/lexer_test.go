@@ -444,3 +444,38 @@ This string never ends
 		t.Fatalf("expected TokenIllegal for unterminated triple-quote, got %s", tok.Type)
 	}
 }
+
+func TestLexer_ComparisonOperators(t *testing.T) {
+	l := NewLexer(`WHEN $a == "x" != =~`)
+	want := []TokenType{TokenWHEN, TokenVar, TokenEq, TokenString, TokenNotEq, TokenMatch, TokenEOF}
+	for i, tt := range want {
+		tok := l.NextToken()
+		if tok.Type != tt {
+			t.Fatalf("token %d: expected %s, got %s (%q)", i, tt, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestLexer_Duration(t *testing.T) {
+	for _, lit := range []string{"10m", "1h30m", "1.5h", "90s"} {
+		tok := NewLexer(lit).NextToken()
+		if tok.Type != TokenDuration || tok.Literal != lit {
+			t.Errorf("%s: expected DURATION, got %s (%q)", lit, tok.Type, tok.Literal)
+		}
+	}
+	if tok := NewLexer("42").NextToken(); tok.Type != TokenNumber {
+		t.Errorf("expected NUMBER for plain digits, got %s", tok.Type)
+	}
+}
+
+func TestLexer_TypedOutputs(t *testing.T) {
+	l := NewLexer(`-> verdict:enum(pass, fail) SCHEMA schemas/out.json`)
+	want := []TokenType{TokenArrow, TokenIdent, TokenColon, TokenIdent, TokenLParen, TokenIdent, TokenComma,
+		TokenIdent, TokenRParen, TokenSCHEMA, TokenPath, TokenEOF}
+	for i, tt := range want {
+		tok := l.NextToken()
+		if tok.Type != tt {
+			t.Fatalf("token %d: expected %s, got %s (%q)", i, tt, tok.Type, tok.Literal)
+		}
+	}
+}
@@ -1,9 +1,11 @@
 package agentfile
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/vinayprograms/agent/internal/skills"
@@ -68,6 +70,12 @@ func LoadFileWithOptions(path string, opts LoadOptions) (*Workflow, error) {
 			}
 			goal.Outcome = string(goalContent)
 		}
+		if goal.SchemaPath != "" {
+			if err := LoadGoalSchema(goal, baseDir); err != nil {
+				return nil, fmt.Errorf("line %d: failed to load schema %q: %w",
+					goal.Line, goal.SchemaPath, err)
+			}
+		}
 	}
 
 	// Validate the loaded workflow
@@ -78,6 +86,32 @@ func LoadFileWithOptions(path string, opts LoadOptions) (*Workflow, error) {
 	return wf, nil
 }
 
+// LoadGoalSchema reads a goal's SCHEMA file relative to baseDir. A goal
+// without a -> output list takes its fields from the schema's properties.
+func LoadGoalSchema(goal *Goal, baseDir string) error {
+	data, err := os.ReadFile(filepath.Join(baseDir, goal.SchemaPath))
+	if err != nil {
+		return err
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	goal.Schema = schema
+
+	if len(goal.Outputs) == 0 {
+		props, _ := schema["properties"].(map[string]any)
+		for name := range props {
+			goal.Outputs = append(goal.Outputs, name)
+		}
+		sort.Strings(goal.Outputs)
+	}
+	if len(goal.Outputs) == 0 {
+		return fmt.Errorf("schema declares no properties")
+	}
+	return nil
+}
+
 // resolveAgentFrom resolves an agent's FROM path using smart resolution:
 // 1. File exists + ends with .md → Load as prompt
 // 2. Directory exists + has SKILL.md → Load as skill
@@ -172,7 +206,7 @@ func Validate(wf *Workflow) error {
 		errs = append(errs, "NAME is required")
 	}
 
-	// R1.3.7: Verify at least one RUN step exists
+	// R1.3.7: Verify at least one RUN or LOOP step exists
 	if len(wf.Steps) == 0 {
 		errs = append(errs, "at least one RUN step is required")
 	}
@@ -198,7 +232,33 @@ func Validate(wf *Workflow) error {
 		}
 	}
 
-	// R1.3.2: Verify all goals referenced in RUN steps are defined
+	// Verify ON FAILURE fallbacks are defined and don't fall back in a circle
+	for _, goal := range wf.Goals {
+		if goal.OnFailure == "" {
+			continue
+		}
+		if !definedGoals[goal.OnFailure] {
+			errs = append(errs, fmt.Sprintf("line %d: undefined goal %q in ON FAILURE clause",
+				goal.Line, goal.OnFailure))
+			continue
+		}
+		seen := map[string]bool{goal.Name: true}
+		for next := goal.OnFailure; next != ""; {
+			if seen[next] {
+				errs = append(errs, fmt.Sprintf("line %d: ON FAILURE fallback of goal %q leads back to %q",
+					goal.Line, goal.Name, next))
+				break
+			}
+			seen[next] = true
+			fallback := wf.findGoal(next)
+			if fallback == nil {
+				break
+			}
+			next = fallback.OnFailure
+		}
+	}
+
+	// R1.3.2: Verify all goals referenced in RUN/LOOP steps are defined
 	for _, step := range wf.Steps {
 		for _, goalName := range step.UsingGoals {
 			if !definedGoals[goalName] {
@@ -206,6 +266,27 @@ func Validate(wf *Workflow) error {
 					step.Line, goalName, step.Type))
 			}
 		}
+		if step.Type == StepLOOP && step.WithinLimit != nil && *step.WithinLimit <= 0 {
+			errs = append(errs, fmt.Sprintf("line %d: LOOP %q WITHIN limit must be > 0",
+				step.Line, step.Name))
+		}
+		if step.Type == StepLOOP && step.WithinVar != "" && !wf.declaresVariable(step.WithinVar) {
+			errs = append(errs, fmt.Sprintf("line %d: LOOP %q WITHIN $%s is not an INPUT or goal output",
+				step.Line, step.Name, step.WithinVar))
+		}
+		if step.Type == StepPARALLEL {
+			listed := make(map[string]bool)
+			for _, goalName := range step.UsingGoals {
+				if listed[goalName] {
+					errs = append(errs, fmt.Sprintf("line %d: goal %q listed more than once in PARALLEL %q",
+						step.Line, goalName, step.Name))
+				}
+				listed[goalName] = true
+			}
+			if err := DependencyCycle(step.UsingGoals, wf.GoalDependencies(step.UsingGoals)); err != nil {
+				errs = append(errs, fmt.Sprintf("line %d: PARALLEL %q has a %v", step.Line, step.Name, err))
+			}
+		}
 	}
 
 	// Supervision downgrade validation: SUPERVISED HUMAN cannot be downgraded
@@ -239,6 +320,23 @@ func Validate(wf *Workflow) error {
 	return nil
 }
 
+// declaresVariable reports whether name is an INPUT or written by a goal.
+func (wf *Workflow) declaresVariable(name string) bool {
+	for _, input := range wf.Inputs {
+		if input.Name == name {
+			return true
+		}
+	}
+	for _, goal := range wf.Goals {
+		for _, v := range goal.Provides() {
+			if v == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // ValidateWithoutPaths validates the workflow without checking FROM paths.
 // Used for testing when file system is not available.
 func ValidateWithoutPaths(wf *Workflow) error {
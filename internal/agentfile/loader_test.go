@@ -195,3 +195,42 @@ RUN main USING main
 		t.Errorf("expected name 'test', got %q", wf.Name)
 	}
 }
+
+func TestLoadFile_GoalSchema(t *testing.T) {
+	tmpDir := t.TempDir()
+	schema := `{"type": "object", "properties": {"verdict": {"enum": ["pass", "fail"]}, "score": {"type": "number"}}, "required": ["verdict"]}`
+	os.WriteFile(filepath.Join(tmpDir, "review.json"), []byte(schema), 0644)
+
+	agentfile := `NAME test
+GOAL review "Review" SCHEMA review.json
+RUN main USING review
+`
+	os.WriteFile(filepath.Join(tmpDir, "Agentfile"), []byte(agentfile), 0644)
+
+	wf, err := LoadFile(filepath.Join(tmpDir, "Agentfile"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	goal := wf.Goals[0]
+	if goal.Schema == nil {
+		t.Fatal("expected schema to be loaded")
+	}
+	// Outputs come from the schema properties when no -> list is given
+	if strings.Join(goal.Outputs, ",") != "score,verdict" {
+		t.Errorf("expected outputs from schema, got %v", goal.Outputs)
+	}
+}
+
+func TestLoadFile_GoalSchemaInvalid(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "review.json"), []byte(`{not json`), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "Agentfile"), []byte(`NAME test
+GOAL review "Review" SCHEMA review.json
+RUN main USING review
+`), 0644)
+
+	_, err := LoadFile(filepath.Join(tmpDir, "Agentfile"))
+	if err == nil || !strings.Contains(err.Error(), "failed to load schema") {
+		t.Errorf("expected schema load error, got %v", err)
+	}
+}
@@ -2,7 +2,9 @@ package agentfile
 
 import (
 	"fmt"
+	"regexp"
 	"strconv"
+	"time"
 )
 
 // Parser parses Agentfile tokens into an AST.
@@ -107,6 +109,18 @@ func (p *Parser) Parse() (*Workflow, error) {
 				return nil, err
 			}
 			wf.Steps = append(wf.Steps, *step)
+		case TokenLOOP:
+			step, err := p.parseLoopStatement()
+			if err != nil {
+				return nil, err
+			}
+			wf.Steps = append(wf.Steps, *step)
+		case TokenPARALLEL:
+			step, err := p.parseParallelStatement()
+			if err != nil {
+				return nil, err
+			}
+			wf.Steps = append(wf.Steps, *step)
 		default:
 			return nil, fmt.Errorf("line %d: unexpected token %s", p.curToken.Line, p.curToken.Type)
 		}
@@ -192,10 +206,13 @@ func (p *Parser) parseAgentStatement() (*Agent, error) {
 
 	// Check for optional -> outputs
 	if p.curToken.Type == TokenArrow {
-		outputs, err := p.parseOutputList()
+		outputs, types, err := p.parseOutputList()
 		if err != nil {
 			return nil, err
 		}
+		if types != nil {
+			return nil, fmt.Errorf("line %d: typed outputs are only supported on GOAL and CONVERGE", line)
+		}
 		agent.Outputs = outputs
 	}
 
@@ -226,7 +243,7 @@ func (p *Parser) parseAgentStatement() (*Agent, error) {
 	return agent, nil
 }
 
-// parseGoalStatement parses: GOAL <identifier> (<string> | FROM <path>) [-> outputs] [USING <identifier_list>] [SUPERVISED [HUMAN] | UNSUPERVISED]
+// parseGoalStatement parses: GOAL <identifier> (<string> | FROM <path>) [-> outputs] [SCHEMA <path>] [USING <identifier_list>] [WHEN <condition>] [<policy>] [SUPERVISED [HUMAN] | UNSUPERVISED]
 func (p *Parser) parseGoalStatement() (*Goal, error) {
 	line := p.curToken.Line
 	p.nextToken() // consume GOAL
@@ -258,11 +275,19 @@ func (p *Parser) parseGoalStatement() (*Goal, error) {
 
 	// Check for optional -> outputs
 	if p.curToken.Type == TokenArrow {
-		outputs, err := p.parseOutputList()
+		outputs, types, err := p.parseOutputList()
 		if err != nil {
 			return nil, err
 		}
 		goal.Outputs = outputs
+		goal.OutputTypes = types
+	}
+
+	// Check for optional SCHEMA clause
+	if p.curToken.Type == TokenSCHEMA {
+		if err := p.parseSchemaClause(goal); err != nil {
+			return nil, err
+		}
 	}
 
 	// Check for optional USING clause
@@ -274,6 +299,20 @@ func (p *Parser) parseGoalStatement() (*Goal, error) {
 		goal.UsingAgent = agents
 	}
 
+	// Check for optional WHEN clause
+	if p.curToken.Type == TokenWHEN {
+		cond, err := p.parseWhenClause()
+		if err != nil {
+			return nil, err
+		}
+		goal.When = cond
+	}
+
+	// Check for optional failure policy and budget
+	if err := p.parseGoalPolicy(goal); err != nil {
+		return nil, err
+	}
+
 	// Check for optional supervision modifiers
 	if p.curToken.Type == TokenSUPERVISED {
 		goal.Supervision = SupervisionEnabled
@@ -291,7 +330,7 @@ func (p *Parser) parseGoalStatement() (*Goal, error) {
 	return goal, nil
 }
 
-// parseConvergeStatement parses: CONVERGE <identifier> (<string> | FROM <path>) [-> outputs] [USING <identifier_list>] WITHIN (<number> | <variable>) [SUPERVISED [HUMAN] | UNSUPERVISED]
+// parseConvergeStatement parses: CONVERGE <identifier> (<string> | FROM <path>) [-> outputs] [SCHEMA <path>] [USING <identifier_list>] WITHIN (<number> | <variable>) [<policy>] [SUPERVISED [HUMAN] | UNSUPERVISED]
 func (p *Parser) parseConvergeStatement() (*Goal, error) {
 	line := p.curToken.Line
 	p.nextToken() // consume CONVERGE
@@ -324,11 +363,19 @@ func (p *Parser) parseConvergeStatement() (*Goal, error) {
 
 	// Check for optional -> outputs (right after description)
 	if p.curToken.Type == TokenArrow {
-		outputs, err := p.parseOutputList()
+		outputs, types, err := p.parseOutputList()
 		if err != nil {
 			return nil, err
 		}
 		goal.Outputs = outputs
+		goal.OutputTypes = types
+	}
+
+	// Check for optional SCHEMA clause
+	if p.curToken.Type == TokenSCHEMA {
+		if err := p.parseSchemaClause(goal); err != nil {
+			return nil, err
+		}
 	}
 
 	// Check for optional USING clause (before WITHIN)
@@ -358,6 +405,11 @@ func (p *Parser) parseConvergeStatement() (*Goal, error) {
 		return nil, fmt.Errorf("line %d: expected number or variable after WITHIN, got %s", line, p.curToken.Type)
 	}
 
+	// Check for optional failure policy and budget
+	if err := p.parseGoalPolicy(goal); err != nil {
+		return nil, err
+	}
+
 	// Check for optional supervision modifiers
 	if p.curToken.Type == TokenSUPERVISED {
 		goal.Supervision = SupervisionEnabled
@@ -375,7 +427,7 @@ func (p *Parser) parseConvergeStatement() (*Goal, error) {
 	return goal, nil
 }
 
-// parseRunStatement parses: RUN <identifier> USING <identifier_list> [SUPERVISED [HUMAN] | UNSUPERVISED]
+// parseRunStatement parses: RUN <identifier> USING <identifier_list> [WHEN <condition>] [SUPERVISED [HUMAN] | UNSUPERVISED]
 func (p *Parser) parseRunStatement() (*Step, error) {
 	line := p.curToken.Line
 	p.nextToken() // consume RUN
@@ -401,6 +453,58 @@ func (p *Parser) parseRunStatement() (*Step, error) {
 	}
 	step.UsingGoals = goals
 
+	// Check for optional WHEN clause
+	if p.curToken.Type == TokenWHEN {
+		cond, err := p.parseWhenClause()
+		if err != nil {
+			return nil, err
+		}
+		step.When = cond
+	}
+
+	// Check for optional supervision modifiers
+	if p.curToken.Type == TokenSUPERVISED {
+		step.Supervision = SupervisionEnabled
+		p.nextToken()
+		if p.curToken.Type == TokenHUMAN {
+			step.HumanOnly = true
+			p.nextToken()
+		}
+	} else if p.curToken.Type == TokenUNSUPERVISED {
+		step.Supervision = SupervisionDisabled
+		p.nextToken()
+	}
+
+	p.skipNewline()
+	return step, nil
+}
+
+// parseParallelStatement parses: PARALLEL <identifier> USING <identifier_list> [SUPERVISED [HUMAN] | UNSUPERVISED]
+func (p *Parser) parseParallelStatement() (*Step, error) {
+	line := p.curToken.Line
+	p.nextToken() // consume PARALLEL
+
+	if !p.isIdentifier() {
+		return nil, fmt.Errorf("line %d: expected identifier after PARALLEL, got %s", line, p.curToken.Type)
+	}
+
+	step := &Step{
+		Type: StepPARALLEL,
+		Name: p.curToken.Literal,
+		Line: line,
+	}
+	p.nextToken()
+
+	if p.curToken.Type != TokenUSING {
+		return nil, fmt.Errorf("line %d: expected USING after PARALLEL name, got %s", line, p.curToken.Type)
+	}
+
+	goals, err := p.parseIdentifierList()
+	if err != nil {
+		return nil, err
+	}
+	step.UsingGoals = goals
+
 	// Check for optional supervision modifiers
 	if p.curToken.Type == TokenSUPERVISED {
 		step.Supervision = SupervisionEnabled
@@ -418,6 +522,164 @@ func (p *Parser) parseRunStatement() (*Step, error) {
 	return step, nil
 }
 
+// parseLoopStatement parses: LOOP <identifier> USING <identifier_list> WITHIN (<number> | <variable>) [SUPERVISED [HUMAN] | UNSUPERVISED]
+func (p *Parser) parseLoopStatement() (*Step, error) {
+	line := p.curToken.Line
+	p.nextToken() // consume LOOP
+
+	if !p.isIdentifier() {
+		return nil, fmt.Errorf("line %d: expected identifier after LOOP, got %s", line, p.curToken.Type)
+	}
+
+	step := &Step{
+		Type: StepLOOP,
+		Name: p.curToken.Literal,
+		Line: line,
+	}
+	p.nextToken()
+
+	if p.curToken.Type != TokenUSING {
+		return nil, fmt.Errorf("line %d: expected USING after LOOP name, got %s", line, p.curToken.Type)
+	}
+
+	goals, err := p.parseIdentifierList()
+	if err != nil {
+		return nil, err
+	}
+	step.UsingGoals = goals
+
+	// WITHIN is mandatory for LOOP
+	if p.curToken.Type != TokenWITHIN {
+		return nil, fmt.Errorf("line %d: LOOP requires WITHIN clause, got %s", line, p.curToken.Type)
+	}
+	p.nextToken() // consume WITHIN
+
+	// Either number or variable
+	if p.curToken.Type == TokenNumber {
+		val, _ := strconv.Atoi(p.curToken.Literal)
+		step.WithinLimit = &val
+		p.nextToken()
+	} else if p.curToken.Type == TokenVar {
+		step.WithinVar = p.curToken.Literal
+		p.nextToken()
+	} else {
+		return nil, fmt.Errorf("line %d: expected number or variable after WITHIN, got %s", line, p.curToken.Type)
+	}
+
+	// Check for optional supervision modifiers
+	if p.curToken.Type == TokenSUPERVISED {
+		step.Supervision = SupervisionEnabled
+		p.nextToken()
+		if p.curToken.Type == TokenHUMAN {
+			step.HumanOnly = true
+			p.nextToken()
+		}
+	} else if p.curToken.Type == TokenUNSUPERVISED {
+		step.Supervision = SupervisionDisabled
+		p.nextToken()
+	}
+
+	p.skipNewline()
+	return step, nil
+}
+
+// parseGoalPolicy parses failure-handling and budget modifiers, in any order:
+// [RETRY <number>] [TIMEOUT <duration>] [ON FAILURE <identifier>]
+// [MAX TURNS <number>] [MAX TOKENS <number>]
+func (p *Parser) parseGoalPolicy(goal *Goal) error {
+	for {
+		line := p.curToken.Line
+		switch p.curToken.Type {
+		case TokenRETRY:
+			p.nextToken() // consume RETRY
+			if p.curToken.Type != TokenNumber {
+				return fmt.Errorf("line %d: expected number after RETRY, got %s", line, p.curToken.Type)
+			}
+			goal.Retry, _ = strconv.Atoi(p.curToken.Literal)
+			p.nextToken()
+		case TokenTIMEOUT:
+			p.nextToken() // consume TIMEOUT
+			if p.curToken.Type != TokenDuration {
+				return fmt.Errorf("line %d: expected duration (e.g. 10m) after TIMEOUT, got %s", line, p.curToken.Type)
+			}
+			d, err := time.ParseDuration(p.curToken.Literal)
+			if err != nil || d <= 0 {
+				return fmt.Errorf("line %d: invalid TIMEOUT %q", line, p.curToken.Literal)
+			}
+			goal.Timeout = d
+			p.nextToken()
+		case TokenON:
+			p.nextToken() // consume ON
+			if p.curToken.Type != TokenFAILURE {
+				return fmt.Errorf("line %d: expected FAILURE after ON, got %s", line, p.curToken.Type)
+			}
+			p.nextToken() // consume FAILURE
+			if !p.isIdentifier() {
+				return fmt.Errorf("line %d: expected goal name after ON FAILURE, got %s", line, p.curToken.Type)
+			}
+			goal.OnFailure = p.curToken.Literal
+			p.nextToken()
+		case TokenMAX:
+			p.nextToken() // consume MAX
+			limit := p.curToken.Type
+			if limit != TokenTURNS && limit != TokenTOKENS {
+				return fmt.Errorf("line %d: expected TURNS or TOKENS after MAX, got %s", line, p.curToken.Type)
+			}
+			p.nextToken() // consume TURNS/TOKENS
+			if p.curToken.Type != TokenNumber {
+				return fmt.Errorf("line %d: expected number after MAX %s, got %s", line, limit, p.curToken.Type)
+			}
+			n, err := strconv.Atoi(p.curToken.Literal)
+			if err != nil || n <= 0 {
+				return fmt.Errorf("line %d: MAX %s must be > 0", line, limit)
+			}
+			if limit == TokenTURNS {
+				goal.MaxTurns = n
+			} else {
+				goal.MaxTokens = n
+			}
+			p.nextToken()
+		default:
+			return nil
+		}
+	}
+}
+
+// parseWhenClause parses: WHEN <variable> [(== | !=) <string> | =~ <string>]
+func (p *Parser) parseWhenClause() (*Condition, error) {
+	line := p.curToken.Line
+	p.nextToken() // consume WHEN
+
+	if p.curToken.Type != TokenVar {
+		return nil, fmt.Errorf("line %d: expected variable after WHEN, got %s", line, p.curToken.Type)
+	}
+
+	cond := &Condition{Var: p.curToken.Literal, Line: line}
+	p.nextToken()
+
+	switch p.curToken.Type {
+	case TokenEq, TokenNotEq, TokenMatch:
+		cond.Op = p.curToken.Literal
+		p.nextToken()
+	default:
+		return cond, nil // truthy check
+	}
+
+	if p.curToken.Type != TokenString {
+		return nil, fmt.Errorf("line %d: expected string after %s in WHEN clause, got %s", line, cond.Op, p.curToken.Type)
+	}
+	cond.Value = p.curToken.Literal
+	p.nextToken()
+
+	if cond.Op == OpMatches {
+		if _, err := regexp.Compile(cond.Value); err != nil {
+			return nil, fmt.Errorf("line %d: invalid WHEN pattern %q: %v", line, cond.Value, err)
+		}
+	}
+
+	return cond, nil
+}
+
 // parseIdentifierList parses: USING <identifier> [, <identifier>]*
 func (p *Parser) parseIdentifierList() ([]string, error) {
 	line := p.curToken.Line
@@ -444,30 +706,103 @@ func (p *Parser) parseIdentifierList() ([]string, error) {
 	return idents, nil
 }
 
-// parseOutputList parses: -> <identifier> [, <identifier>]*
-func (p *Parser) parseOutputList() ([]string, error) {
+// parseOutputList parses: -> <field> [, <field>]*
+// where <field> is <identifier> [: <type>]. Returns the field names and the
+// declared types (nil if no field is typed).
+func (p *Parser) parseOutputList() ([]string, map[string]OutputType, error) {
 	line := p.curToken.Line
 	p.nextToken() // consume ->
 
 	var outputs []string
+	var types map[string]OutputType
 
 	if !p.isIdentifier() {
-		return nil, fmt.Errorf("line %d: expected identifier after ->, got %s", line, p.curToken.Type)
+		return nil, nil, fmt.Errorf("line %d: expected identifier after ->, got %s", line, p.curToken.Type)
 	}
-	outputs = append(outputs, p.curToken.Literal)
-	p.nextToken()
+	for {
+		name := p.curToken.Literal
+		outputs = append(outputs, name)
+		p.nextToken()
 
-	// Continue while we see commas
-	for p.curToken.Type == TokenComma {
+		// Optional :<type>
+		if p.curToken.Type == TokenColon {
+			p.nextToken() // consume :
+			t, err := p.parseOutputType(line)
+			if err != nil {
+				return nil, nil, err
+			}
+			if types == nil {
+				types = make(map[string]OutputType)
+			}
+			types[name] = t
+		}
+
+		if p.curToken.Type != TokenComma {
+			break
+		}
 		p.nextToken() // consume comma
 		if !p.isIdentifier() {
-			return nil, fmt.Errorf("line %d: expected identifier after comma, got %s", line, p.curToken.Type)
+			return nil, nil, fmt.Errorf("line %d: expected identifier after comma, got %s", line, p.curToken.Type)
 		}
-		outputs = append(outputs, p.curToken.Literal)
+	}
+
+	return outputs, types, nil
+}
+
+// parseOutputType parses: string | number | integer | bool | list | object | enum(<value> [, <value>]*)
+func (p *Parser) parseOutputType(line int) (OutputType, error) {
+	if !p.isIdentifier() {
+		return OutputType{}, fmt.Errorf("line %d: expected output type after ':', got %s", line, p.curToken.Type)
+	}
+	kind := p.curToken.Literal
+	p.nextToken()
+
+	switch kind {
+	case OutputString, OutputNumber, OutputInteger, OutputBool, OutputList, OutputObject:
+		return OutputType{Kind: kind}, nil
+	case "boolean":
+		return OutputType{Kind: OutputBool}, nil
+	case OutputEnum:
+		// values follow
+	default:
+		return OutputType{}, fmt.Errorf("line %d: unknown output type %q", line, kind)
+	}
+
+	if p.curToken.Type != TokenLParen {
+		return OutputType{}, fmt.Errorf("line %d: expected ( after enum, got %s", line, p.curToken.Type)
+	}
+	p.nextToken() // consume (
+
+	t := OutputType{Kind: OutputEnum}
+	for {
+		if !p.isValue() {
+			return OutputType{}, fmt.Errorf("line %d: expected enum value, got %s", line, p.curToken.Type)
+		}
+		t.Enum = append(t.Enum, p.curToken.Literal)
 		p.nextToken()
+		if p.curToken.Type != TokenComma {
+			break
+		}
+		p.nextToken() // consume comma
 	}
 
-	return outputs, nil
+	if p.curToken.Type != TokenRParen {
+		return OutputType{}, fmt.Errorf("line %d: expected ) after enum values, got %s", line, p.curToken.Type)
+	}
+	p.nextToken() // consume )
+	return t, nil
+}
+
+// parseSchemaClause parses: SCHEMA <path>
+func (p *Parser) parseSchemaClause(goal *Goal) error {
+	line := p.curToken.Line
+	p.nextToken() // consume SCHEMA
+	if p.curToken.Type != TokenPath {
+		return fmt.Errorf("line %d: expected path after SCHEMA, got %s", line, p.curToken.Type)
+	}
+	goal.SchemaPath = p.curToken.Literal
+	p.nextToken()
+	return nil
 }
 
 // isIdentifier returns true if current token is an identifier (not a keyword used as value).
@@ -3,6 +3,7 @@ package agentfile
 import (
 	"strings"
 	"testing"
+	"time"
 )
 
 // R1.2.1: Parse NAME statement
@@ -1069,3 +1070,302 @@ RUN main USING refine`
 		t.Error("expected error for CONVERGE without WITHIN, got nil")
 	}
 }
+
+// R1.2.7: Parse LOOP statement with USING identifier list and WITHIN limit
+func TestParser_LoopStatement(t *testing.T) {
+	input := `NAME test
+GOAL implement "Implement the feature"
+GOAL run_tests "Run the tests"
+LOOP tdd USING implement, run_tests WITHIN 5 SUPERVISED`
+
+	wf, err := ParseString(input)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	if len(wf.Steps) != 1 {
+		t.Fatalf("expected 1 step, got %d", len(wf.Steps))
+	}
+	step := wf.Steps[0]
+	if step.Type != StepLOOP {
+		t.Errorf("step type wrong. expected=LOOP, got=%s", step.Type)
+	}
+	if step.Name != "tdd" {
+		t.Errorf("expected name 'tdd', got %q", step.Name)
+	}
+	if len(step.UsingGoals) != 2 || step.UsingGoals[1] != "run_tests" {
+		t.Errorf("expected UsingGoals=['implement', 'run_tests'], got %v", step.UsingGoals)
+	}
+	if step.WithinLimit == nil || *step.WithinLimit != 5 {
+		t.Errorf("expected WithinLimit=5, got %v", step.WithinLimit)
+	}
+	if step.Supervision != SupervisionEnabled {
+		t.Error("expected step to be supervised")
+	}
+}
+
+// R1.2.8: Support variable references in WITHIN clause
+func TestParser_LoopWithinVariable(t *testing.T) {
+	input := `NAME test
+INPUT max_iterations DEFAULT 3
+GOAL refine "Refine"
+RUN setup USING refine
+LOOP refine_loop USING refine WITHIN $max_iterations`
+
+	wf, err := ParseString(input)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	if len(wf.Steps) != 2 {
+		t.Fatalf("expected 2 steps, got %d", len(wf.Steps))
+	}
+	step := wf.Steps[1]
+	if step.WithinLimit != nil {
+		t.Errorf("expected nil WithinLimit, got %d", *step.WithinLimit)
+	}
+	if step.WithinVar != "max_iterations" {
+		t.Errorf("expected WithinVar 'max_iterations', got %q", step.WithinVar)
+	}
+}
+
+// TestParser_LoopMissingWithin tests that LOOP without WITHIN fails.
+func TestParser_LoopMissingWithin(t *testing.T) {
+	input := `NAME test
+GOAL refine "Refine"
+LOOP again USING refine`
+
+	_, err := ParseString(input)
+	if err == nil {
+		t.Error("expected error for LOOP without WITHIN, got nil")
+	}
+}
+
+func TestParser_ParallelStatement(t *testing.T) {
+	input := `NAME test
+GOAL a "Do a"
+GOAL b "Do b"
+PARALLEL fanout USING a, b SUPERVISED`
+
+	wf, err := ParseString(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(wf.Steps) != 1 {
+		t.Fatalf("expected 1 step, got %d", len(wf.Steps))
+	}
+	step := wf.Steps[0]
+	if step.Type != StepPARALLEL {
+		t.Errorf("expected StepPARALLEL, got %v", step.Type)
+	}
+	if step.Name != "fanout" {
+		t.Errorf("expected name 'fanout', got %q", step.Name)
+	}
+	if len(step.UsingGoals) != 2 || step.UsingGoals[0] != "a" || step.UsingGoals[1] != "b" {
+		t.Errorf("unexpected goals: %v", step.UsingGoals)
+	}
+	if step.Supervision != SupervisionEnabled {
+		t.Errorf("expected supervised step, got %v", step.Supervision)
+	}
+}
+
+func TestParser_WhenClause(t *testing.T) {
+	input := `NAME test
+GOAL test "Run the tests" -> status
+GOAL deploy "Deploy" WHEN $status == "pass" SUPERVISED
+GOAL notify "Notify" WHEN $status != "pass"
+GOAL tag "Tag release" WHEN $version =~ "^v[0-9]+"
+GOAL announce "Announce" WHEN $announce
+RUN ship USING deploy, tag WHEN $status == "pass"`
+
+	wf, err := ParseString(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []struct {
+		goal  string
+		cond  Condition
+		super SupervisionMode
+	}{
+		{"deploy", Condition{Var: "status", Op: OpEquals, Value: "pass", Line: 3}, SupervisionEnabled},
+		{"notify", Condition{Var: "status", Op: OpNotEqual, Value: "pass", Line: 4}, SupervisionInherit},
+		{"tag", Condition{Var: "version", Op: OpMatches, Value: "^v[0-9]+", Line: 5}, SupervisionInherit},
+		{"announce", Condition{Var: "announce", Line: 6}, SupervisionInherit},
+	}
+	for i, w := range want {
+		goal := wf.Goals[i+1]
+		if goal.Name != w.goal {
+			t.Fatalf("expected goal %q, got %q", w.goal, goal.Name)
+		}
+		if goal.When == nil || *goal.When != w.cond {
+			t.Errorf("goal %q: expected WHEN %+v, got %+v", w.goal, w.cond, goal.When)
+		}
+		if goal.Supervision != w.super {
+			t.Errorf("goal %q: expected supervision %v, got %v", w.goal, w.super, goal.Supervision)
+		}
+	}
+
+	step := wf.Steps[0]
+	if step.When == nil || step.When.Var != "status" || step.When.Op != OpEquals || step.When.Value != "pass" {
+		t.Errorf("unexpected RUN WHEN clause: %+v", step.When)
+	}
+}
+
+func TestParser_WhenClauseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"missing variable", `GOAL a "A" WHEN status`},
+		{"missing value", `GOAL a "A" WHEN $status ==`},
+		{"invalid regex", `GOAL a "A" WHEN $status =~ "("`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseString("NAME test\n" + tt.input); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestParser_GoalFailurePolicy(t *testing.T) {
+	input := `NAME test
+GOAL fetch "Fetch data" -> data RETRY 3 TIMEOUT 1h30m ON FAILURE cached SUPERVISED
+GOAL cached "Use cached data" TIMEOUT 90s
+CONVERGE polish "Polish" WITHIN 5 RETRY 1
+RUN main USING fetch, polish`
+
+	wf, err := ParseString(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fetch := wf.Goals[0]
+	if fetch.Retry != 3 || fetch.Timeout != 90*time.Minute || fetch.OnFailure != "cached" {
+		t.Errorf("unexpected policy: retry=%d timeout=%s on_failure=%q", fetch.Retry, fetch.Timeout, fetch.OnFailure)
+	}
+	if fetch.Supervision != SupervisionEnabled {
+		t.Error("expected SUPERVISED after policy modifiers")
+	}
+	if wf.Goals[1].Timeout != 90*time.Second || !wf.Goals[1].HasFailurePolicy() {
+		t.Errorf("unexpected timeout: %s", wf.Goals[1].Timeout)
+	}
+	if wf.Goals[2].Retry != 1 {
+		t.Errorf("expected CONVERGE retry 1, got %d", wf.Goals[2].Retry)
+	}
+}
+
+func TestParser_GoalFailurePolicyErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"retry without number", `GOAL a "A" RETRY`},
+		{"timeout without unit", `GOAL a "A" TIMEOUT 10`},
+		{"invalid duration", `GOAL a "A" TIMEOUT 10parsecs`},
+		{"on without failure", `GOAL a "A" ON b`},
+		{"on failure without goal", `GOAL a "A" ON FAILURE`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseString("NAME test\n" + tt.input); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestParser_GoalBudget(t *testing.T) {
+	input := `NAME test
+GOAL survey "Survey the repo" MAX TURNS 20 RETRY 1 MAX TOKENS 50000
+CONVERGE polish "Polish" WITHIN 5 MAX TURNS 8
+RUN main USING survey, polish`
+
+	wf, err := ParseString(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if wf.Goals[0].MaxTurns != 20 || wf.Goals[0].MaxTokens != 50000 || wf.Goals[0].Retry != 1 {
+		t.Errorf("unexpected budget: turns=%d tokens=%d retry=%d",
+			wf.Goals[0].MaxTurns, wf.Goals[0].MaxTokens, wf.Goals[0].Retry)
+	}
+	if wf.Goals[1].MaxTurns != 8 || wf.Goals[1].MaxTokens != 0 {
+		t.Errorf("unexpected CONVERGE budget: turns=%d tokens=%d", wf.Goals[1].MaxTurns, wf.Goals[1].MaxTokens)
+	}
+}
+
+func TestParser_GoalBudgetErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"max without limit", `GOAL a "A" MAX 10`},
+		{"max turns without number", `GOAL a "A" MAX TURNS`},
+		{"max tokens zero", `GOAL a "A" MAX TOKENS 0`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseString("NAME test\n" + tt.input); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestParser_TypedOutputs(t *testing.T) {
+	input := `NAME test
+GOAL review "Review the change" -> score:number, tags:list, verdict:enum(pass, fail), summary
+CONVERGE refine "Refine" -> draft:string SCHEMA schemas/refine.json WITHIN 3
+RUN main USING review, refine`
+
+	wf, err := ParseString(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	review := wf.Goals[0]
+	if len(review.Outputs) != 4 || review.Outputs[3] != "summary" {
+		t.Fatalf("unexpected outputs: %v", review.Outputs)
+	}
+	if review.OutputTypes["score"].Kind != OutputNumber || review.OutputTypes["tags"].Kind != OutputList {
+		t.Errorf("unexpected types: %v", review.OutputTypes)
+	}
+	if got := review.OutputTypes["verdict"].String(); got != "enum(pass,fail)" {
+		t.Errorf("expected enum(pass,fail), got %q", got)
+	}
+	if _, ok := review.OutputTypes["summary"]; ok {
+		t.Error("untyped field should have no declared type")
+	}
+
+	refine := wf.Goals[1]
+	if refine.SchemaPath != "schemas/refine.json" {
+		t.Errorf("expected schema path, got %q", refine.SchemaPath)
+	}
+	if !refine.HasTypedOutputs() {
+		t.Error("expected refine to have typed outputs")
+	}
+}
+
+func TestParser_TypedOutputErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"unknown type", `GOAL a "A" -> x:float`},
+		{"missing type", `GOAL a "A" -> x:`},
+		{"enum without values", `GOAL a "A" -> x:enum`},
+		{"unclosed enum", `GOAL a "A" -> x:enum(a, b`},
+		{"schema without path", `GOAL a "A" SCHEMA`},
+		{"typed agent outputs", `AGENT a "A" -> x:number`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseString("NAME test\n" + tt.input); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
@@ -17,6 +17,8 @@ const (
 	TokenGOAL
 	TokenCONVERGE
 	TokenRUN
+	TokenLOOP
+	TokenPARALLEL
 	TokenFROM
 	TokenUSING
 	TokenWITHIN
@@ -26,17 +28,33 @@ const (
 	TokenHUMAN
 	TokenUNSUPERVISED
 	TokenSECURITY
+	TokenWHEN
+	TokenRETRY
+	TokenTIMEOUT
+	TokenON
+	TokenFAILURE
+	TokenMAX
+	TokenTURNS
+	TokenTOKENS
+	TokenSCHEMA
 
 	// Literals
-	TokenIdent   // identifier
-	TokenString  // "quoted string"
-	TokenNumber  // 123
-	TokenPath    // path/to/file.md
-	TokenVar     // $variable
+	TokenIdent    // identifier
+	TokenString   // "quoted string"
+	TokenNumber   // 123
+	TokenPath     // path/to/file.md
+	TokenVar      // $variable
+	TokenDuration // 10m, 1h30m
 
 	// Punctuation
-	TokenComma // ,
-	TokenArrow // ->
+	TokenComma  // ,
+	TokenArrow  // ->
+	TokenEq     // ==
+	TokenNotEq  // !=
+	TokenMatch  // =~
+	TokenColon  // :
+	TokenLParen // (
+	TokenRParen // )
 )
 
 // String returns the string representation of the token type.
@@ -60,6 +78,10 @@ func (t TokenType) String() string {
 		return "CONVERGE"
 	case TokenRUN:
 		return "RUN"
+	case TokenLOOP:
+		return "LOOP"
+	case TokenPARALLEL:
+		return "PARALLEL"
 	case TokenFROM:
 		return "FROM"
 	case TokenUSING:
@@ -78,6 +100,24 @@ func (t TokenType) String() string {
 		return "UNSUPERVISED"
 	case TokenSECURITY:
 		return "SECURITY"
+	case TokenWHEN:
+		return "WHEN"
+	case TokenRETRY:
+		return "RETRY"
+	case TokenTIMEOUT:
+		return "TIMEOUT"
+	case TokenON:
+		return "ON"
+	case TokenFAILURE:
+		return "FAILURE"
+	case TokenMAX:
+		return "MAX"
+	case TokenTURNS:
+		return "TURNS"
+	case TokenTOKENS:
+		return "TOKENS"
+	case TokenSCHEMA:
+		return "SCHEMA"
 	case TokenIdent:
 		return "IDENT"
 	case TokenString:
@@ -88,10 +128,24 @@ func (t TokenType) String() string {
 		return "PATH"
 	case TokenVar:
 		return "VAR"
+	case TokenDuration:
+		return "DURATION"
 	case TokenComma:
 		return "COMMA"
 	case TokenArrow:
 		return "ARROW"
+	case TokenEq:
+		return "EQ"
+	case TokenNotEq:
+		return "NOT_EQ"
+	case TokenMatch:
+		return "MATCH"
+	case TokenColon:
+		return "COLON"
+	case TokenLParen:
+		return "LPAREN"
+	case TokenRParen:
+		return "RPAREN"
 	default:
 		return "UNKNOWN"
 	}
@@ -113,6 +167,8 @@ var keywords = map[string]TokenType{
 	"GOAL":         TokenGOAL,
 	"CONVERGE":     TokenCONVERGE,
 	"RUN":          TokenRUN,
+	"LOOP":         TokenLOOP,
+	"PARALLEL":     TokenPARALLEL,
 	"FROM":         TokenFROM,
 	"USING":        TokenUSING,
 	"WITHIN":       TokenWITHIN,
@@ -122,6 +178,15 @@ var keywords = map[string]TokenType{
 	"HUMAN":        TokenHUMAN,
 	"UNSUPERVISED": TokenUNSUPERVISED,
 	"SECURITY":     TokenSECURITY,
+	"WHEN":         TokenWHEN,
+	"RETRY":        TokenRETRY,
+	"TIMEOUT":      TokenTIMEOUT,
+	"ON":           TokenON,
+	"FAILURE":      TokenFAILURE,
+	"MAX":          TokenMAX,
+	"TURNS":        TokenTURNS,
+	"TOKENS":       TokenTOKENS,
+	"SCHEMA":       TokenSCHEMA,
 }
 
 // LookupIdent checks if an identifier is a keyword.
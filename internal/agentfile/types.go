@@ -42,17 +42,23 @@ func (s SupervisionMode) String() string {
 	}
 }
 
-// StepType indicates the step type (currently only RUN).
+// StepType indicates the step type (RUN, LOOP, or PARALLEL).
 type StepType int
 
 const (
 	StepRUN StepType = iota
+	StepLOOP
+	StepPARALLEL
 )
 
 func (s StepType) String() string {
 	switch s {
 	case StepRUN:
 		return "RUN"
+	case StepLOOP:
+		return "LOOP"
+	case StepPARALLEL:
+		return "PARALLEL"
 	default:
 		return "UNKNOWN"
 	}
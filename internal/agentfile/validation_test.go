@@ -282,3 +282,97 @@ RUN step USING analyze`,
 		})
 	}
 }
+
+// PARALLEL steps must form a DAG
+func TestValidation_ParallelDependencyCycle(t *testing.T) {
+	input := `NAME test
+GOAL a "Use $b"
+GOAL b "Use $a"
+PARALLEL both USING a, b`
+
+	wf, err := ParseString(input)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+
+	err = Validate(wf)
+	if err == nil {
+		t.Fatal("expected validation error for dependency cycle")
+	}
+	if !strings.Contains(err.Error(), "dependency cycle") {
+		t.Errorf("error should mention dependency cycle: %v", err)
+	}
+}
+
+func TestValidation_ParallelDuplicateGoal(t *testing.T) {
+	input := `NAME test
+GOAL a "Do a"
+PARALLEL twice USING a, a`
+
+	wf, err := ParseString(input)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+
+	err = Validate(wf)
+	if err == nil {
+		t.Fatal("expected validation error for duplicate goal")
+	}
+	if !strings.Contains(err.Error(), "more than once") {
+		t.Errorf("error should mention duplicate goal: %v", err)
+	}
+}
+
+func TestValidation_OnFailure(t *testing.T) {
+	tests := []struct {
+		name    string
+		goals   string
+		wantErr string
+	}{
+		{"undefined fallback", `GOAL a "A" ON FAILURE missing`, `undefined goal "missing"`},
+		{"fallback cycle", "GOAL a \"A\" ON FAILURE b\nGOAL b \"B\" ON FAILURE a", "leads back to"},
+		{"self fallback", `GOAL a "A" ON FAILURE a`, "leads back to"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wf, err := ParseString("NAME test\n" + tt.goals + "\nRUN main USING a")
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			err = Validate(wf)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidation_LoopWithinVar(t *testing.T) {
+	tests := []struct {
+		name    string
+		decls   string
+		wantErr string
+	}{
+		{"input", "INPUT rounds DEFAULT 3", ""},
+		{"goal output", `GOAL plan "Plan" -> rounds`, ""},
+		{"undeclared", "", `WITHIN $rounds is not an INPUT or goal output`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wf, err := ParseString("NAME test\n" + tt.decls + "\nGOAL work \"Work\"\nLOOP refine USING work WITHIN $rounds")
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			err = Validate(wf)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -36,6 +36,10 @@ type PreCheckpoint struct {
 	Metadata        map[string]string `json:"metadata,omitempty"`
 }
 
+// MetaSnapshot is the PreCheckpoint metadata key holding the ID of the
+// workspace snapshot taken before the step executed.
+const MetaSnapshot = "snapshot"
+
 // PostCheckpoint is created during the EXECUTE phase after execution.
 type PostCheckpoint struct {
 	StepID        string    `json:"step_id"`
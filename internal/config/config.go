@@ -7,23 +7,28 @@ import (
 	"path/filepath"
 
 	"github.com/BurntSushi/toml"
+
+	"github.com/vinayprograms/agent/internal/toolmeta"
 )
 
 // Config represents the agent configuration.
 type Config struct {
-	Agent     AgentConfig        `toml:"agent"`
-	LLM       LLMConfig          `toml:"llm"`       // Default LLM settings
-	SmallLLM  LLMConfig          `toml:"small_llm"` // Fast/cheap model for summarization
-	Profiles  map[string]Profile `toml:"profiles"`  // Capability profiles
-	Web       WebConfig          `toml:"web"`
-	Telemetry TelemetryConfig    `toml:"telemetry"`
-	State     StateConfig         `toml:"state"`     // Persistent state settings
-	MCP       MCPConfig          `toml:"mcp"`       // MCP tool servers
-	Skills    SkillsConfig       `toml:"skills"`    // Agent Skills
-	Security  SecurityConfig     `toml:"security"`  // Security framework
-	Timeouts  TimeoutsConfig     `toml:"timeouts"`  // Network operation timeouts
-	Embedding EmbeddingConfig    `toml:"embedding"` // Embedding provider for resume vectors
-	Service   ServiceConfig      `toml:"service"`   // Service agent settings (for `agent serve`)
+	Agent       AgentConfig        `toml:"agent"`
+	LLM         LLMConfig          `toml:"llm"`       // Default LLM settings
+	SmallLLM    LLMConfig          `toml:"small_llm"` // Fast/cheap model for summarization
+	Profiles    map[string]Profile `toml:"profiles"`  // Capability profiles
+	Web         WebConfig          `toml:"web"`
+	Telemetry   TelemetryConfig    `toml:"telemetry"`
+	State       StateConfig        `toml:"state"`       // Persistent state settings
+	MCP         MCPConfig          `toml:"mcp"`         // MCP tool servers
+	Skills      SkillsConfig       `toml:"skills"`      // Agent Skills
+	Security    SecurityConfig     `toml:"security"`    // Security framework
+	Timeouts    TimeoutsConfig     `toml:"timeouts"`    // Network operation timeouts
+	Embedding   EmbeddingConfig    `toml:"embedding"`   // Embedding provider for resume vectors
+	Service     ServiceConfig      `toml:"service"`     // Service agent settings (for `agent serve`)
+	Budget      BudgetConfig       `toml:"budget"`      // Turn, token, and cost limits
+	Context     ContextConfig      `toml:"context"`     // Context-window compaction
+	Supervision SupervisionConfig  `toml:"supervision"` // Human-in-the-loop settings
 }
 
 // AgentConfig contains agent identification settings.
@@ -97,6 +102,19 @@ type MCPServerConfig struct {
 	Args        []string          `toml:"args,omitempty"`
 	Env         map[string]string `toml:"env,omitempty"`
 	DeniedTools []string          `toml:"denied_tools,omitempty"` // Tools to exclude from LLM
+
+	// Metadata of the server's tools: trust of their output, side effects,
+	// parallel safety. Tools overrides it per tool (by the server's tool name).
+	Trust       string                   `toml:"trust,omitempty"`        // trusted, vetted, untrusted (default: untrusted)
+	SideEffects string                   `toml:"side_effects,omitempty"` // none, local, external
+	Parallel    *bool                    `toml:"parallel,omitempty"`
+	Async       *bool                    `toml:"async,omitempty"`
+	Tools       map[string]toolmeta.Decl `toml:"tools,omitempty"`
+}
+
+// ToolMeta returns the server-wide tool metadata declaration.
+func (s MCPServerConfig) ToolMeta() toolmeta.Decl {
+	return toolmeta.Decl{Trust: s.Trust, SideEffects: s.SideEffects, Parallel: s.Parallel, Async: s.Async}
 }
 
 // SkillsConfig contains Agent Skills configuration.
@@ -113,12 +131,62 @@ type SecurityConfig struct {
 
 // TimeoutsConfig contains timeout settings for network operations.
 type TimeoutsConfig struct {
-	MCP              int `toml:"mcp"`               // MCP tool call timeout in seconds (default 60)
-	WebSearch        int `toml:"web_search"`        // web_search timeout in seconds (default 30)
-	WebFetch         int `toml:"web_fetch"`         // web_fetch timeout in seconds (default 60)
+	MCP              int `toml:"mcp"`                // MCP tool call timeout in seconds (default 60)
+	WebSearch        int `toml:"web_search"`         // web_search timeout in seconds (default 30)
+	WebFetch         int `toml:"web_fetch"`          // web_fetch timeout in seconds (default 60)
 	SearchCooldownMS int `toml:"search_cooldown_ms"` // minimum ms between DDG queries (default 2000)
 }
 
+// BudgetConfig caps the work done by a goal's tool-use loop.
+// Zero means unlimited. Goals can override max_turns and max_tokens_per_goal
+// with MAX TURNS / MAX TOKENS in the Agentfile.
+type BudgetConfig struct {
+	MaxTurns         int     `toml:"max_turns"`           // LLM turns per goal (and per sub-agent)
+	MaxTokensPerGoal int     `toml:"max_tokens_per_goal"` // input+output tokens per goal
+	MaxCostPerRun    float64 `toml:"max_cost_per_run"`    // USD per workflow run; requires pricing below
+	InputCostPer1M   float64 `toml:"input_cost_per_1m"`   // USD per 1M input tokens
+	OutputCostPer1M  float64 `toml:"output_cost_per_1m"`  // USD per 1M output tokens
+}
+
+// ContextConfig controls how a goal's conversation is kept within the
+// model's context window. Older tool results are compacted (summarized by
+// small_llm, or moved to the scratchpad) once the estimated prompt size
+// crosses compact_at of the window.
+type ContextConfig struct {
+	Windows    map[string]int `toml:"windows"`     // model name or prefix -> context window in tokens
+	CompactAt  float64        `toml:"compact_at"`  // fraction of the window that triggers compaction (default 0.75)
+	KeepRecent int            `toml:"keep_recent"` // most recent tool results never compacted (default 4)
+}
+
+// SupervisionConfig contains human-in-the-loop settings for supervised goals.
+type SupervisionConfig struct {
+	// HumanTimeoutSeconds is how long to wait for a human decision (default 300).
+	HumanTimeoutSeconds int `toml:"human_timeout_seconds"`
+
+	// HumanInput selects where human decisions come from:
+	// "terminal" (interactive prompt; default for `agent run` on a TTY),
+	// "file" or "socket" (non-interactive, at HumanInputPath), or "none".
+	// `agent serve --http` uses its /approvals endpoints unless this is set.
+	HumanInput string `toml:"human_input"`
+
+	// HumanInputPath is the watched file or unix socket for "file"/"socket".
+	HumanInputPath string `toml:"human_input_path"`
+
+	// ApprovalWebhooks are notified (POST, JSON) when an approval is waiting
+	// on the /approvals endpoints of `agent serve --http`.
+	ApprovalWebhooks []string `toml:"approval_webhooks"`
+
+	// Snapshots keeps a copy of the workspace at each pre-checkpoint, so
+	// `agent rollback` can undo what later steps did. SnapshotExclude lists
+	// paths to leave out (default: .git, node_modules).
+	Snapshots       bool     `toml:"snapshots"`
+	SnapshotExclude []string `toml:"snapshot_exclude"`
+
+	// RestoreOnReorient restores the workspace from the step's snapshot
+	// before a REORIENT re-executes it. Requires Snapshots.
+	RestoreOnReorient bool `toml:"restore_on_reorient"`
+}
+
 // ServiceConfig contains settings for service agent mode (`agent serve`).
 type ServiceConfig struct {
 	// BusURL is the message bus URL for swarm mode (e.g., "nats://localhost:4222").
@@ -141,6 +209,11 @@ type ServiceConfig struct {
 	// Default: "30s"
 	DrainTimeout string `toml:"drain_timeout"`
 
+	// MaxConcurrentTasks is how many tasks the agent runs at once. Above 1,
+	// each task gets its own executor and session.
+	// Default: 1
+	MaxConcurrentTasks int `toml:"max_concurrent_tasks"`
+
 	// Capability override. If empty, capabilities are inferred from Agentfile.
 	Capability string `toml:"capability"`
 }
@@ -157,6 +230,13 @@ func New() *Config {
 		Telemetry: TelemetryConfig{
 			Protocol: "noop",
 		},
+		Supervision: SupervisionConfig{
+			HumanTimeoutSeconds: 300,
+		},
+		Context: ContextConfig{
+			CompactAt:  0.75,
+			KeepRecent: 4,
+		},
 		Timeouts: TimeoutsConfig{
 			MCP:              60,   // 60 seconds for MCP calls
 			WebSearch:        30,   // 30 seconds for web search
@@ -311,3 +311,122 @@ max_tokens = 2048
 		t.Errorf("unknown profile: should fall back to default, got %s", unknown.Model)
 	}
 }
+
+func TestConfig_Budget(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "agent.toml")
+	os.WriteFile(configPath, []byte(`
+[budget]
+max_turns = 40
+max_tokens_per_goal = 200000
+max_cost_per_run = 2.5
+input_cost_per_1m = 3.0
+output_cost_per_1m = 15.0
+`), 0644)
+
+	cfg, err := LoadFile(configPath)
+	if err != nil {
+		t.Fatalf("load error: %v", err)
+	}
+	b := cfg.Budget
+	if b.MaxTurns != 40 || b.MaxTokensPerGoal != 200000 || b.MaxCostPerRun != 2.5 {
+		t.Errorf("unexpected limits: %+v", b)
+	}
+	if b.InputCostPer1M != 3.0 || b.OutputCostPer1M != 15.0 {
+		t.Errorf("unexpected pricing: %+v", b)
+	}
+
+	// Unset budget means unlimited
+	if New().Budget != (BudgetConfig{}) {
+		t.Errorf("expected zero budget by default, got %+v", New().Budget)
+	}
+}
+
+func TestConfig_Context(t *testing.T) {
+	cfg := New()
+	if cfg.Context.CompactAt != 0.75 || cfg.Context.KeepRecent != 4 {
+		t.Errorf("unexpected context defaults: %+v", cfg.Context)
+	}
+
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "agent.toml")
+	os.WriteFile(configPath, []byte(`
+[context]
+compact_at = 0.6
+
+[context.windows]
+"llama3.1" = 32000
+`), 0644)
+
+	cfg, err := LoadFile(configPath)
+	if err != nil {
+		t.Fatalf("load error: %v", err)
+	}
+	if cfg.Context.CompactAt != 0.6 {
+		t.Errorf("compact_at: expected 0.6, got %v", cfg.Context.CompactAt)
+	}
+	if cfg.Context.KeepRecent != 4 {
+		t.Errorf("keep_recent: expected default 4, got %d", cfg.Context.KeepRecent)
+	}
+	if cfg.Context.Windows["llama3.1"] != 32000 {
+		t.Errorf("windows: expected llama3.1=32000, got %v", cfg.Context.Windows)
+	}
+}
+
+func TestConfig_Supervision(t *testing.T) {
+	cfg := New()
+	if cfg.Supervision.HumanTimeoutSeconds != 300 {
+		t.Errorf("expected default human timeout 300, got %d", cfg.Supervision.HumanTimeoutSeconds)
+	}
+
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "agent.toml")
+	os.WriteFile(configPath, []byte(`
+[supervision]
+human_input = "file"
+human_input_path = "/tmp/approval"
+approval_webhooks = ["https://hooks.example.com/approvals"]
+`), 0644)
+
+	cfg, err := LoadFile(configPath)
+	if err != nil {
+		t.Fatalf("load error: %v", err)
+	}
+	if cfg.Supervision.HumanInput != "file" || cfg.Supervision.HumanInputPath != "/tmp/approval" {
+		t.Errorf("unexpected supervision config: %+v", cfg.Supervision)
+	}
+	if len(cfg.Supervision.ApprovalWebhooks) != 1 {
+		t.Errorf("approval_webhooks: expected 1 URL, got %v", cfg.Supervision.ApprovalWebhooks)
+	}
+	if cfg.Supervision.HumanTimeoutSeconds != 300 {
+		t.Errorf("human_timeout_seconds: expected default 300, got %d", cfg.Supervision.HumanTimeoutSeconds)
+	}
+}
+
+func TestConfig_MCPToolMeta(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "agent.toml")
+	os.WriteFile(configPath, []byte(`
+[mcp.servers.notes]
+command = "notes-mcp"
+trust = "trusted"
+side_effects = "local"
+
+[mcp.servers.notes.tools.search]
+side_effects = "none"
+parallel = true
+`), 0644)
+
+	cfg, err := LoadFile(configPath)
+	if err != nil {
+		t.Fatalf("load error: %v", err)
+	}
+	server := cfg.MCP.Servers["notes"]
+	if d := server.ToolMeta(); d.Trust != "trusted" || d.SideEffects != "local" || d.Parallel != nil {
+		t.Errorf("unexpected server metadata: %+v", d)
+	}
+	search := server.Tools["search"]
+	if search.SideEffects != "none" || search.Parallel == nil || !*search.Parallel {
+		t.Errorf("unexpected tool metadata: %+v", search)
+	}
+}
@@ -0,0 +1,253 @@
+// Package dataflow decides where sensitive data may go. Tool results carry
+// sensitivity labels, tools that receive data have an exposure level, and
+// directional rules in policy.toml allow or deny a flow from one to the other.
+package dataflow
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Sensitivity labels attached to tool results.
+const (
+	Public      = "public"
+	Internal    = "internal"
+	PII         = "pii"
+	Financial   = "financial"
+	Credentials = "credentials"
+)
+
+// Exposure levels of tools that receive data.
+const (
+	ExposureLocal           = "local"
+	ExposureInternal        = "internal"
+	ExposureExternalPrivate = "external-private"
+	ExposureExternalPublic  = "external-public"
+)
+
+// Rule actions.
+const (
+	Allow = "allow"
+	Deny  = "deny"
+)
+
+var sensitivities = []string{Public, Internal, PII, Financial, Credentials}
+
+var exposures = []string{ExposureLocal, ExposureInternal, ExposureExternalPrivate, ExposureExternalPublic}
+
+// Rule allows or denies data with a sensitivity label reaching tools of an
+// exposure level. From is a label or "*"; To is an exposure level or a glob
+// such as "external-*". "*" also matches tools without an exposure.
+type Rule struct {
+	From   string `toml:"from"`
+	To     string `toml:"to"`
+	Action string `toml:"action"`
+}
+
+func (r Rule) String() string {
+	return fmt.Sprintf("%s → %s: %s", r.From, r.To, r.Action)
+}
+
+// Policy is the [flow] section of policy.toml. Sources and Sinks are keyed by
+// tool name or glob (MCP tools are named mcp_<server>_<tool>).
+type Policy struct {
+	Sources map[string][]string `toml:"sources"` // tool -> sensitivity labels of its results
+	Sinks   map[string]string   `toml:"sinks"`   // tool -> exposure level
+	Rules   []Rule              `toml:"rules"`   // first matching rule wins; no match allows
+}
+
+// Parse reads the [flow] section from policy.toml content. It returns nil
+// when the policy has no [flow] section.
+func Parse(content string) (*Policy, error) {
+	var doc struct {
+		Flow *Policy `toml:"flow"`
+	}
+	if _, err := toml.Decode(content, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse policy: %w", err)
+	}
+	if doc.Flow == nil {
+		return nil, nil
+	}
+	if err := doc.Flow.Validate(); err != nil {
+		return nil, fmt.Errorf("flow policy: %w", err)
+	}
+	return doc.Flow, nil
+}
+
+// Validate checks labels, exposure levels, patterns and rule actions.
+func (p *Policy) Validate() error {
+	for pattern, labels := range p.Sources {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("sources: invalid pattern %q", pattern)
+		}
+		for _, l := range labels {
+			if !slices.Contains(sensitivities, l) {
+				return fmt.Errorf("sources.%s: unknown sensitivity %q (want one of %s)", pattern, l, strings.Join(sensitivities, ", "))
+			}
+		}
+	}
+	for pattern, exposure := range p.Sinks {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("sinks: invalid pattern %q", pattern)
+		}
+		if !slices.Contains(exposures, exposure) {
+			return fmt.Errorf("sinks.%s: unknown exposure %q (want one of %s)", pattern, exposure, strings.Join(exposures, ", "))
+		}
+	}
+	for i, r := range p.Rules {
+		if r.From != "*" && !slices.Contains(sensitivities, r.From) {
+			return fmt.Errorf("rule %d: unknown sensitivity %q", i+1, r.From)
+		}
+		if _, err := path.Match(r.To, ""); err != nil || r.To == "" {
+			return fmt.Errorf("rule %d: invalid exposure %q", i+1, r.To)
+		}
+		if r.Action != Allow && r.Action != Deny {
+			return fmt.Errorf("rule %d: action must be allow or deny, got %q", i+1, r.Action)
+		}
+	}
+	return nil
+}
+
+// Labels returns the sensitivity labels of a tool's results, from every
+// matching source pattern.
+func (p *Policy) Labels(tool string) []string {
+	if p == nil {
+		return nil
+	}
+	var labels []string
+	for pattern, ls := range p.Sources {
+		if ok, _ := path.Match(pattern, tool); ok {
+			labels = Merge(labels, ls)
+		}
+	}
+	return labels
+}
+
+// Exposure returns the exposure level of a tool, from the most specific
+// (longest) matching sink pattern, or "" if none matches.
+func (p *Policy) Exposure(tool string) string {
+	if p == nil {
+		return ""
+	}
+	best, exposure := "", ""
+	for pattern, e := range p.Sinks {
+		if ok, _ := path.Match(pattern, tool); ok && (exposure == "" || len(pattern) > len(best) || len(pattern) == len(best) && pattern < best) {
+			best, exposure = pattern, e
+		}
+	}
+	return exposure
+}
+
+// Violation is a denied flow: data labeled Label reaching a tool of
+// exposure Exposure, denied by Rule.
+type Violation struct {
+	Label    string
+	Exposure string
+	Rule     Rule
+}
+
+func (v *Violation) String() string {
+	exposure := v.Exposure
+	if exposure == "" {
+		exposure = "unlabeled tool"
+	}
+	return fmt.Sprintf("flow %s → %s denied by rule %q", v.Label, exposure, v.Rule.String())
+}
+
+// Check returns the first flow of labels into exposure that the rules deny,
+// or nil if all are allowed.
+func (p *Policy) Check(labels []string, exposure string) *Violation {
+	if p == nil {
+		return nil
+	}
+	for _, l := range labels {
+		for _, r := range p.Rules {
+			if r.From != "*" && r.From != l {
+				continue
+			}
+			if ok, _ := path.Match(r.To, exposure); !ok {
+				continue
+			}
+			if r.Action == Deny {
+				return &Violation{Label: l, Exposure: exposure, Rule: r}
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// Merge returns the sorted union of label sets.
+func Merge(sets ...[]string) []string {
+	var out []string
+	for _, s := range sets {
+		for _, l := range s {
+			if !slices.Contains(out, l) {
+				out = append(out, l)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// minMatch is the shortest content or token matched; shorter values
+// (numbers, yes/no) would match unrelated arguments.
+const minMatch = 8
+
+// chunk is the window used to find long prose in arguments.
+const chunk = 50
+
+// Contains reports whether tool arguments carry data from content: the whole
+// content, any sensitive token of it (see sensitiveTokens) or, for long
+// content, any 50-character window. Matching is case-insensitive,
+// like the verifier's taint check.
+func Contains(args, content string) bool {
+	content = strings.TrimSpace(content)
+	if len(content) < minMatch {
+		return false
+	}
+	args = strings.ToLower(args)
+	content = strings.ToLower(content)
+	if strings.Contains(args, content) {
+		return true
+	}
+	for _, tok := range sensitiveTokens(content) {
+		if strings.Contains(args, tok) {
+			return true
+		}
+	}
+	for i := 0; i+chunk <= len(content); i += chunk / 2 {
+		if strings.Contains(args, content[i:i+chunk]) {
+			return true
+		}
+	}
+	return false
+}
+
+// sensitiveTokens returns the tokens of content that can identify it on
+// their own: at least minMatch long and not plain words, such as account
+// numbers, amounts, e-mail addresses, keys and tokens. Plain words are
+// left to the window match, as they occur in unrelated text.
+func sensitiveTokens(content string) []string {
+	fields := strings.FieldsFunc(content, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune("\"'`()[]{}<>;|", r)
+	})
+	var out []string
+	for _, f := range fields {
+		f = strings.Trim(f, ".,:!?")
+		if len(f) < minMatch || !strings.ContainsFunc(f, func(r rune) bool { return !unicode.IsLetter(r) }) {
+			continue
+		}
+		if !slices.Contains(out, f) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
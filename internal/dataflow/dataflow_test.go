@@ -0,0 +1,166 @@
+package dataflow
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testPolicy = `
+default_deny = true
+
+[bash]
+enabled = true
+
+[flow.sources]
+"mcp_bank_*" = ["financial"]
+"mcp_crm_*" = ["pii", "internal"]
+read = ["internal"]
+
+[flow.sinks]
+"mcp_email_*" = "external-private"
+web_fetch = "external-public"
+write = "local"
+"mcp_*" = "internal"
+
+[[flow.rules]]
+from = "credentials"
+to = "*"
+action = "deny"
+
+[[flow.rules]]
+from = "financial"
+to = "local"
+action = "allow"
+
+[[flow.rules]]
+from = "financial"
+to = "external-*"
+action = "deny"
+
+[[flow.rules]]
+from = "pii"
+to = "external-public"
+action = "deny"
+`
+
+func TestParse(t *testing.T) {
+	p, err := Parse(testPolicy)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if p == nil || len(p.Rules) != 4 {
+		t.Fatalf("expected 4 rules, got %+v", p)
+	}
+
+	none, err := Parse("default_deny = true\n")
+	if err != nil || none != nil {
+		t.Errorf("expected nil policy without [flow], got %+v, %v", none, err)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		toml   string
+		errMsg string
+	}{
+		{"bad label", "[flow.sources]\nread = [\"secret\"]\n", "unknown sensitivity"},
+		{"bad exposure", "[flow.sinks]\nwrite = \"disk\"\n", "unknown exposure"},
+		{"bad pattern", "[flow.sinks]\n\"mcp_[\" = \"local\"\n", "invalid pattern"},
+		{"bad rule label", "[[flow.rules]]\nfrom = \"secret\"\nto = \"*\"\naction = \"deny\"\n", "unknown sensitivity"},
+		{"missing to", "[[flow.rules]]\nfrom = \"pii\"\naction = \"deny\"\n", "invalid exposure"},
+		{"bad action", "[[flow.rules]]\nfrom = \"pii\"\nto = \"*\"\naction = \"warn\"\n", "allow or deny"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.toml)
+		if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.errMsg, err)
+		}
+	}
+}
+
+func TestPolicy_LabelsAndExposure(t *testing.T) {
+	p, err := Parse(testPolicy)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if got := p.Labels("mcp_bank_balance"); !reflect.DeepEqual(got, []string{"financial"}) {
+		t.Errorf("bank labels: %v", got)
+	}
+	if got := p.Labels("mcp_crm_lookup"); !reflect.DeepEqual(got, []string{"internal", "pii"}) {
+		t.Errorf("crm labels: %v", got)
+	}
+	if got := p.Labels("glob"); got != nil {
+		t.Errorf("expected no labels for glob, got %v", got)
+	}
+	tests := map[string]string{
+		"mcp_email_send":  "external-private", // more specific than mcp_*
+		"mcp_wiki_update": "internal",
+		"web_fetch":       "external-public",
+		"bash":            "",
+	}
+	for tool, expected := range tests {
+		if got := p.Exposure(tool); got != expected {
+			t.Errorf("Exposure(%s) = %q, want %q", tool, got, expected)
+		}
+	}
+
+	var nilPolicy *Policy
+	if nilPolicy.Labels("read") != nil || nilPolicy.Exposure("write") != "" || nilPolicy.Check([]string{"pii"}, "") != nil {
+		t.Error("nil policy should label nothing and allow everything")
+	}
+}
+
+func TestPolicy_Check(t *testing.T) {
+	p, err := Parse(testPolicy)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	tests := []struct {
+		labels   []string
+		exposure string
+		denied   string // violating label, "" if allowed
+	}{
+		{[]string{"financial"}, "local", ""},
+		{[]string{"financial"}, "external-private", "financial"},
+		{[]string{"financial"}, "internal", ""}, // no rule matches
+		{[]string{"pii"}, "external-private", ""},
+		{[]string{"internal", "pii"}, "external-public", "pii"},
+		{[]string{"credentials"}, "", "credentials"}, // "*" covers unlabeled tools
+		{[]string{"public"}, "external-public", ""},
+		{nil, "external-public", ""},
+	}
+	for _, tt := range tests {
+		v := p.Check(tt.labels, tt.exposure)
+		switch {
+		case tt.denied == "" && v != nil:
+			t.Errorf("%v → %q: expected allow, got %s", tt.labels, tt.exposure, v)
+		case tt.denied != "" && (v == nil || v.Label != tt.denied):
+			t.Errorf("%v → %q: expected %s to be denied, got %v", tt.labels, tt.exposure, tt.denied, v)
+		}
+	}
+}
+
+func TestContains(t *testing.T) {
+	long := strings.Repeat("account 1234-5678 balance 9,876.54 EUR; ", 5)
+	tests := []struct {
+		args    string
+		content string
+		want    bool
+	}{
+		{"map[body:Your balance is 9,876.54 EUR]", "9,876.54 EUR", true},
+		{"map[body:YOUR BALANCE IS 9,876.54 eur]", "9,876.54 EUR", true},
+		{"map[body:hello]", "9,876.54 EUR", false},
+		{"map[body:yes]", "yes", false}, // too short to attribute
+		{"map[body:fwd: " + long[60:140] + "]", long, true},
+		{"map[body:" + long[:30] + "]", long, true}, // account number copied out
+		{"map[to:ops@example.com]", long + "contact ops@example.com.", true},
+		{"map[body:account balance]", long, false}, // plain words only
+	}
+	for _, tt := range tests {
+		if got := Contains(tt.args, tt.content); got != tt.want {
+			t.Errorf("Contains(%q, %q) = %v, want %v", tt.args, tt.content, got, tt.want)
+		}
+	}
+}
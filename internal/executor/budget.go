@@ -0,0 +1,210 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vinayprograms/agent/internal/agentfile"
+	"github.com/vinayprograms/agent/internal/hooks"
+	"github.com/vinayprograms/agent/internal/session"
+	"github.com/vinayprograms/agentkit/llm"
+)
+
+// BudgetWrapUpPrompt is sent when a tool-use loop exhausts its budget.
+// The model gets one final turn to summarize instead of being cut off.
+const BudgetWrapUpPrompt = `[BUDGET EXCEEDED] %s.
+
+Do not call any more tools. Wrap up now: give your best final answer from the work done so far, and state clearly what is unfinished.`
+
+// ErrBudgetExceeded is returned once the run cost limit is spent. RETRY
+// does not re-attempt a goal that failed with it.
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// defaultSubAgentTurns caps sub-agent loops when no max_turns is configured.
+const defaultSubAgentTurns = 30
+
+// loopBudget tracks the turns and tokens spent by one tool-use loop
+// (a goal's EXECUTE phase or a sub-agent).
+type loopBudget struct {
+	maxTurns  int
+	maxTokens int
+	turns     int
+	tokens    int
+}
+
+// goalBudget returns the budget for a goal, applying its MAX TURNS and
+// MAX TOKENS overrides on top of the configured defaults.
+func (e *Executor) goalBudget(goal *agentfile.Goal) *loopBudget {
+	b := &loopBudget{maxTurns: e.maxTurns, maxTokens: e.maxTokensPerGoal}
+	if goal != nil {
+		if goal.MaxTurns > 0 {
+			b.maxTurns = goal.MaxTurns
+		}
+		if goal.MaxTokens > 0 {
+			b.maxTokens = goal.MaxTokens
+		}
+	}
+	return b
+}
+
+// chargeBudget records one LLM turn against the loop budget. Its cost is
+// charged to the run by the metered provider.
+func (e *Executor) chargeBudget(b *loopBudget, resp *llm.ChatResponse) {
+	b.turns++
+	if resp == nil {
+		return
+	}
+	b.tokens += resp.InputTokens + resp.OutputTokens
+}
+
+// chargeCost adds the estimated cost of one LLM call to the run cost.
+func (e *Executor) chargeCost(resp *llm.ChatResponse) {
+	if resp == nil {
+		return
+	}
+	cost := float64(resp.InputTokens)/1_000_000*e.inputCostPer1M +
+		float64(resp.OutputTokens)/1_000_000*e.outputCostPer1M
+	if cost > 0 {
+		e.costMu.Lock()
+		e.runCost += cost
+		e.costMu.Unlock()
+	}
+}
+
+// costExceeded returns why the run cost limit is spent, or "".
+func (e *Executor) costExceeded() string {
+	if e.maxCostPerRun <= 0 {
+		return ""
+	}
+	if cost := e.RunCost(); cost >= e.maxCostPerRun {
+		return fmt.Sprintf("run cost limit reached ($%.4f/$%.4f)", cost, e.maxCostPerRun)
+	}
+	return ""
+}
+
+// meteredProvider charges every call made on behalf of a run to the run
+// cost of the executor in ctx, and refuses calls once its limit is spent.
+// Calls without a run in ctx pass through uncharged.
+type meteredProvider struct {
+	llm.Provider
+}
+
+// MeterProvider wraps a provider so its calls count toward the run cost
+// limit: goal turns, supervision, output repairs, compaction summaries
+// and security triage alike. The executor meters the providers in its
+// Config; callers wrap the others (supervisor, small LLM) themselves.
+// Wrapping twice is harmless.
+func MeterProvider(p llm.Provider) llm.Provider {
+	if p == nil {
+		return nil
+	}
+	if _, ok := p.(*meteredProvider); ok {
+		return p
+	}
+	return &meteredProvider{p}
+}
+
+func (p *meteredProvider) Chat(ctx context.Context, req llm.ChatRequest) (*llm.ChatResponse, error) {
+	e, _ := ctx.Value(ctxKeyExecutor).(*Executor)
+	if e == nil {
+		return p.Provider.Chat(ctx, req)
+	}
+	if reason := e.costExceeded(); reason != "" {
+		return nil, fmt.Errorf("%w: %s", ErrBudgetExceeded, reason)
+	}
+	resp, err := p.Provider.Chat(ctx, req)
+	if err == nil {
+		e.chargeCost(resp)
+	}
+	return resp, err
+}
+
+// meteredFactory meters the providers of every profile.
+type meteredFactory struct {
+	llm.ProviderFactory
+}
+
+func (f meteredFactory) GetProvider(profile string) (llm.Provider, error) {
+	p, err := f.ProviderFactory.GetProvider(profile)
+	return MeterProvider(p), err
+}
+
+// RunCost returns the estimated cost (USD) spent by the current run.
+func (e *Executor) RunCost() float64 {
+	e.costMu.Lock()
+	defer e.costMu.Unlock()
+	return e.runCost
+}
+
+// resetRunCost clears the run-wide cost at the start of a workflow run.
+func (e *Executor) resetRunCost() {
+	e.costMu.Lock()
+	e.runCost = 0
+	e.costMu.Unlock()
+}
+
+// budgetExceeded returns which limit the loop has hit ("turns", "tokens"
+// or "cost") and a human-readable reason, or "" if it is within budget.
+func (e *Executor) budgetExceeded(b *loopBudget) (limit, reason string) {
+	if b.maxTurns > 0 && b.turns >= b.maxTurns {
+		return "turns", fmt.Sprintf("turn limit reached (%d/%d turns)", b.turns, b.maxTurns)
+	}
+	if b.maxTokens > 0 && b.tokens >= b.maxTokens {
+		return "tokens", fmt.Sprintf("token limit reached (%d/%d tokens)", b.tokens, b.maxTokens)
+	}
+	if reason := e.costExceeded(); reason != "" {
+		return "cost", reason
+	}
+	return "", ""
+}
+
+// wrapUpOverBudget records the budget breach and gives the model one last
+// turn to summarize its work. role is empty for a goal's own loop and set
+// for sub-agents. Tools stay defined so providers accept the tool history,
+// but any tool calls in the reply are ignored.
+//
+// The run cost limit gets no wrap-up turn: the money is spent, so the loop
+// fails, and with it the run, before another paid call is made.
+func (e *Executor) wrapUpOverBudget(ctx context.Context, provider llm.Provider, role string, b *loopBudget, limit, reason string, messages []llm.Message, toolDefs []llm.ToolDef) (string, error) {
+	e.logger.Warn("budget exceeded", map[string]any{
+		"goal":   e.goalName(ctx),
+		"role":   role,
+		"limit":  limit,
+		"turns":  b.turns,
+		"tokens": b.tokens,
+	})
+	e.logBudgetExceeded(ctx, role, limit, reason, b)
+	e.hooks.Fire(ctx, hooks.BudgetExceeded, map[string]any{
+		"goal":   e.goalName(ctx),
+		"role":   role,
+		"limit":  limit,
+		"reason": reason,
+		"turns":  b.turns,
+		"tokens": b.tokens,
+		"cost":   e.RunCost(),
+	})
+	if limit == "cost" {
+		return "", fmt.Errorf("%w: %s", ErrBudgetExceeded, reason)
+	}
+
+	wrapUp := fmt.Sprintf(BudgetWrapUpPrompt, reason)
+	messages = append(messages, llm.Message{Role: "user", Content: wrapUp})
+	e.logEvent(ctx, session.EventUser, wrapUp)
+
+	llmStart := time.Now()
+	resp, err := provider.Chat(ctx, llm.ChatRequest{
+		Messages: messages,
+		Tools:    toolDefs,
+	})
+	llmDuration := time.Since(llmStart)
+	if err != nil {
+		e.hooks.Fire(ctx, hooks.LLMError, map[string]any{"error": err})
+		return "", fmt.Errorf("LLM error during budget wrap-up: %w", err)
+	}
+	e.logLLMCall(ctx, session.EventAssistant, messages, resp, llmDuration)
+	e.recordLLMMetrics(resp, llmDuration)
+	e.chargeBudget(b, resp)
+	return resp.Content, nil
+}
@@ -2,10 +2,13 @@ package executor
 
 import (
 	"github.com/vinayprograms/agent/internal/checkpoint"
+	"github.com/vinayprograms/agent/internal/dataflow"
 	"github.com/vinayprograms/agent/internal/hooks"
 	"github.com/vinayprograms/agent/internal/session"
 	"github.com/vinayprograms/agent/internal/skills"
+	"github.com/vinayprograms/agent/internal/snapshot"
 	"github.com/vinayprograms/agent/internal/supervision"
+	"github.com/vinayprograms/agent/internal/toolmeta"
 	"github.com/vinayprograms/agentkit/llm"
 	"github.com/vinayprograms/agentkit/mcp"
 	"github.com/vinayprograms/agentkit/policy"
@@ -26,6 +29,11 @@ type Config struct {
 	Registry        *tools.Registry
 	Policy          *policy.Policy
 
+	// SharedRegistry marks Registry as already wired by another executor
+	// (serve mode running tasks concurrently). The registry's spawn_agent
+	// callback is left as is; it routes to whichever executor makes the call.
+	SharedRegistry bool
+
 	// Debug mode — when true, logs full content (prompts, responses, tool outputs).
 	Debug bool
 
@@ -40,21 +48,69 @@ type Config struct {
 	SessionManager    session.SessionManager
 	PersistentSession bool
 
+	// Resume skips goals completed by an interrupted run (see ResumeFromSession).
+	Resume *Resume
+
 	// Supervision
 	CheckpointStore checkpoint.CheckpointStore
 	Supervisor      supervision.Supervisor
 	HumanAvailable  bool
 	HumanInputChan  chan string
 
+	// Workspace snapshots taken at each pre-checkpoint (nil = none).
+	// RestoreOnReorient rolls the workspace back to the step's snapshot
+	// before a REORIENT re-executes it.
+	Snapshots         *snapshot.Store
+	RestoreOnReorient bool
+
+	// ActiveGoals counts the goals running in the workspace. Executors
+	// sharing a workspace (per-task executors of a service) share it, so a
+	// restore never rolls back files another task is working on. nil = a
+	// counter of this executor's own.
+	ActiveGoals *ActiveGoals
+
+	// DryRun replaces tools with local or external side effects by stubs
+	// that record the call in a plan (see Executor.Plan) instead of
+	// executing it. Read-only tools run normally.
+	DryRun bool
+
 	// Security
 	SecurityVerifier      *security.Verifier
 	SecurityResearchScope string
 
+	// Data flow rules from policy.toml: sensitivity labels of tool results,
+	// exposure of tools, and which flows between them are denied.
+	// Checked against blocks registered with SecurityVerifier. Nil = no rules.
+	FlowPolicy *dataflow.Policy
+
+	// Tool metadata declared in policy.toml and MCP server config: how far
+	// tool output is trusted and which calls may run in parallel.
+	// Nil = built-in defaults.
+	ToolMeta *toolmeta.Catalog
+
 	// Timeouts for network operations (seconds). Zero means use default.
 	TimeoutMCP       int
 	TimeoutWebSearch int
 	TimeoutWebFetch  int
 
+	// Budget limits for tool-use loops. Zero means unlimited.
+	// Goals can override MaxTurns and MaxTokensPerGoal in the Agentfile.
+	MaxTurns         int
+	MaxTokensPerGoal int
+	MaxCostPerRun    float64 // USD; cost is computed from the per-1M prices below
+	InputCostPer1M   float64
+	OutputCostPer1M  float64
+
+	// Context-window management. When a loop's estimated prompt size crosses
+	// CompactAt of the model's window, older tool results are compacted:
+	// summarized with ContextSummarizer and/or moved to ContextStore.
+	// Zero values use the defaults in context.go.
+	ContextWindows    map[string]int // model name or prefix -> window (tokens)
+	CompactAt         float64
+	KeepRecent        int
+	ContextSummarizer tools.Summarizer
+	ContextStore      tools.MemoryStore
+
 	// Observation extraction for semantic memory
 	ObservationExtractor ObservationExtractor
 	ObservationStore     ObservationStore
@@ -0,0 +1,218 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/vinayprograms/agentkit/llm"
+)
+
+// Context-window defaults.
+const (
+	defaultContextWindow = 128_000 // tokens, for models not in any table
+	defaultCompactAt     = 0.75    // fraction of the window that triggers compaction
+	defaultKeepRecent    = 4       // latest tool results kept verbatim
+	minCompactChars      = 1000    // tool results smaller than this are not worth compacting
+	compactPreviewChars  = 300     // head kept when a result is truncated
+)
+
+// defaultContextWindows maps model name prefixes to context windows (tokens).
+// Config entries take precedence; the longest matching prefix wins.
+var defaultContextWindows = map[string]int{
+	"claude":  200_000,
+	"gpt-4o":  128_000,
+	"gpt-4.1": 1_000_000,
+	"gpt-5":   400_000,
+	"o3":      200_000,
+	"o4":      200_000,
+	"gemini":  1_000_000,
+	"mistral": 128_000,
+	"llama":   128_000,
+}
+
+// compactQuestion is what the summarizer is asked about a compacted tool result.
+const compactQuestion = "Summarize this tool output for an agent that already used it. " +
+	"Keep every fact, path, identifier, number and error the agent may still need; drop repetition and boilerplate."
+
+// contextWindow returns the context window for a model.
+func (e *Executor) contextWindow(model string) int {
+	if n := longestPrefixMatch(e.contextWindows, model); n > 0 {
+		return n
+	}
+	if n := longestPrefixMatch(defaultContextWindows, model); n > 0 {
+		return n
+	}
+	return defaultContextWindow
+}
+
+// longestPrefixMatch returns the value of the longest key that model starts with.
+func longestPrefixMatch(windows map[string]int, model string) int {
+	best, bestLen := 0, -1
+	for prefix, n := range windows {
+		if strings.HasPrefix(model, prefix) && len(prefix) > bestLen {
+			best, bestLen = n, len(prefix)
+		}
+	}
+	return best
+}
+
+// estimateTokens approximates the token count of messages (~4 chars/token).
+func estimateTokens(messages []llm.Message) int {
+	chars := 0
+	for _, m := range messages {
+		chars += len(m.Content)
+		for _, tc := range m.ToolCalls {
+			args, _ := json.Marshal(tc.Args)
+			chars += len(tc.Name) + len(args)
+		}
+	}
+	return chars/4 + 4*len(messages)
+}
+
+// contextManager keeps one tool-use loop's messages within the model's
+// context window by compacting older tool results.
+type contextManager struct {
+	e    *Executor
+	role string // empty for a goal's own loop, set for sub-agents
+
+	model        string // reported by the provider
+	lastTokens   int    // provider-reported input tokens of the last request
+	lastMessages int    // len(messages) of the last request
+	compacted    map[string]bool
+}
+
+// newContextManager creates a context manager for one tool-use loop.
+func (e *Executor) newContextManager(role string) *contextManager {
+	return &contextManager{e: e, role: role, compacted: make(map[string]bool)}
+}
+
+// observe records the provider-reported usage for the request just sent.
+func (cm *contextManager) observe(messages []llm.Message, resp *llm.ChatResponse) {
+	if resp == nil {
+		return
+	}
+	if resp.Model != "" {
+		cm.model = resp.Model
+	}
+	if resp.InputTokens > 0 {
+		cm.lastTokens = resp.InputTokens + resp.CacheReadInputTokens + resp.CacheCreationInputTokens
+		cm.lastMessages = len(messages)
+	}
+}
+
+// estimate returns the estimated prompt size of messages. It builds on the
+// provider's count for the last request when one is available.
+func (cm *contextManager) estimate(messages []llm.Message) int {
+	if cm.lastTokens > 0 && cm.lastMessages <= len(messages) {
+		return cm.lastTokens + estimateTokens(messages[cm.lastMessages:])
+	}
+	return estimateTokens(messages)
+}
+
+// fit compacts older tool results in place once messages cross the
+// compaction threshold. The most recent tool results are left intact.
+func (cm *contextManager) fit(ctx context.Context, messages []llm.Message) {
+	window := cm.e.contextWindow(cm.model)
+	threshold := int(float64(window) * cm.e.compactAt)
+	before := cm.estimate(messages)
+	if before < threshold {
+		return
+	}
+
+	// Tool results eligible for compaction, oldest first
+	var toolIdx []int
+	for i, m := range messages {
+		if m.Role == "tool" {
+			toolIdx = append(toolIdx, i)
+		}
+	}
+	if len(toolIdx) <= cm.e.keepRecent {
+		return
+	}
+	toolIdx = toolIdx[:len(toolIdx)-cm.e.keepRecent]
+
+	toolNames := make(map[string]string)
+	for _, m := range messages {
+		for _, tc := range m.ToolCalls {
+			toolNames[tc.ID] = tc.Name
+		}
+	}
+
+	var dropped []string
+	after := before
+	for _, i := range toolIdx {
+		if after < threshold {
+			break
+		}
+		m := &messages[i]
+		if cm.compacted[m.ToolCallID] || len(m.Content) < minCompactChars {
+			continue
+		}
+		name := toolNames[m.ToolCallID]
+		replacement, how := cm.compact(ctx, name, m.ToolCallID, m.Content)
+		dropped = append(dropped, fmt.Sprintf("%s (%s): %d -> %d chars, %s",
+			name, m.ToolCallID, len(m.Content), len(replacement), how))
+		after -= (len(m.Content) - len(replacement)) / 4
+		m.Content = replacement
+		cm.compacted[m.ToolCallID] = true
+	}
+	if len(dropped) == 0 {
+		return
+	}
+
+	// Provider counts no longer match the compacted messages
+	cm.lastTokens = 0
+	after = cm.estimate(messages)
+
+	cm.e.logger.Info("context compacted", map[string]any{
+		"goal":          cm.e.goalName(ctx),
+		"role":          cm.role,
+		"tool_results":  len(dropped),
+		"tokens_before": before,
+		"tokens_after":  after,
+		"window":        window,
+	})
+	cm.e.logContextCompacted(ctx, cm.role, before, after, window, dropped)
+}
+
+// compact shrinks one tool result. The full text goes to the context store
+// when one is configured, and is replaced by a summary from the context
+// summarizer, or by a truncated preview if there is no summarizer.
+func (cm *contextManager) compact(ctx context.Context, toolName, toolCallID, content string) (string, string) {
+	var ref string
+	if cm.e.contextStore != nil {
+		key := fmt.Sprintf("context/%s/%s", cm.e.goalName(ctx), toolCallID)
+		if err := cm.e.contextStore.Set(key, content); err == nil {
+			ref = key
+		}
+	}
+
+	var body, how string
+	if cm.e.contextSummarizer != nil {
+		if summary, err := cm.e.contextSummarizer.Summarize(ctx, content, compactQuestion); err == nil && summary != "" {
+			body, how = summary, "summarized"
+		}
+	}
+	if body == "" {
+		preview := content
+		if len(preview) > compactPreviewChars {
+			// Cut on a rune boundary, not inside a multi-byte character
+			cut := compactPreviewChars
+			for cut > 0 && !utf8.RuneStart(preview[cut]) {
+				cut--
+			}
+			preview = preview[:cut]
+		}
+		body, how = preview+"\n...", "truncated"
+	}
+
+	header := fmt.Sprintf("[compacted %s result, %d chars originally]", toolName, len(content))
+	if ref != "" {
+		how += ", stored in scratchpad"
+		return fmt.Sprintf("%s\n%s\n[full result: scratchpad_read key %q]", header, body, ref), how
+	}
+	return fmt.Sprintf("%s\n%s", header, body), how
+}
@@ -39,16 +39,16 @@ func (e *Executor) executeConvergeGoal(ctx context.Context, goal *agentfile.Goal
 		"goal": goal.Name,
 	})
 
-	// Set current goal for logging
-	e.currentGoal = goal.Name
-
 	// Determine supervision status
 	supervised := e.isSupervised(goal)
 	humanRequired := e.requiresHuman(goal)
-	e.currentGoalSupervised = supervised
+
+	// Set current goal for logging
+	ctx = withGoal(ctx, goal.Name, supervised)
+	e.setCurrentGoal(goal.Name, supervised)
 
 	// Build initial prompt for COMMIT phase
-	initialPrompt := e.buildConvergePrompt(goal, nil, 1)
+	initialPrompt := e.buildConvergePrompt(ctx, goal, nil, 1)
 
 	// State captured by the execute closure and used by the post-checkpoint closure
 	var iterations []ConvergenceIteration
@@ -60,7 +60,7 @@ func (e *Executor) executeConvergeGoal(ctx context.Context, goal *agentfile.Goal
 		ctx,
 		supervision.PipelineRequest{
 			StepID:        goal.Name,
-			GoalName:      e.goalOutcome(goal.Name),
+			GoalName:      e.goalOutcome(ctx, goal.Name),
 			Supervised:    supervised,
 			HumanRequired: humanRequired,
 		},
@@ -77,9 +77,9 @@ func (e *Executor) executeConvergeGoal(ctx context.Context, goal *agentfile.Goal
 					"iteration": i,
 				})
 
-				e.logEvent(session.EventSystem, fmt.Sprintf("Convergence iteration %d for goal %q", i, goal.Name))
+				e.logEvent(ctx, session.EventSystem, fmt.Sprintf("Convergence iteration %d for goal %q", i, goal.Name))
 
-				prompt := e.buildConvergePrompt(goal, iterations, i)
+				prompt := e.buildConvergePrompt(ctx, goal, iterations, i)
 
 				output, iterErr := e.executeConvergeIteration(ctx, goal, prompt)
 				if iterErr != nil {
@@ -92,7 +92,7 @@ func (e *Executor) executeConvergeGoal(ctx context.Context, goal *agentfile.Goal
 						"goal":       goal.Name,
 						"iterations": i,
 					})
-					e.logEvent(session.EventSystem, fmt.Sprintf("Goal %q converged after %d iterations", goal.Name, i))
+					e.logEvent(ctx, session.EventSystem, fmt.Sprintf("Goal %q converged after %d iterations", goal.Name, i))
 					converged = true
 					iterationCount = i
 					break
@@ -108,7 +108,7 @@ func (e *Executor) executeConvergeGoal(ctx context.Context, goal *agentfile.Goal
 					"goal":  goal.Name,
 					"limit": maxIterations,
 				})
-				e.logEvent(session.EventWarning, fmt.Sprintf("Goal %q did not converge within limit (used all iterations)", goal.Name))
+				e.logEvent(ctx, session.EventWarning, fmt.Sprintf("Goal %q did not converge within limit (used all iterations)", goal.Name))
 				e.trackConvergenceFailure(goal.Name, maxIterations)
 			}
 
@@ -138,7 +138,8 @@ func (e *Executor) executeConvergeGoal(ctx context.Context, goal *agentfile.Goal
 			"goal":       goal.Name,
 			"correction": pipelineResult.Correction,
 		})
-		correctionPrompt := e.buildConvergePromptWithCorrection(goal, iterations, iterationCount+1, pipelineResult.Correction)
+		e.restoreWorkspace(ctx, goal.Name, pipelineResult.Snapshot)
+		correctionPrompt := e.buildConvergePromptWithCorrection(ctx, goal, iterations, iterationCount+1, pipelineResult.Correction)
 		correctedOutput, corrErr := e.executeConvergeIteration(ctx, goal, correctionPrompt)
 		if corrErr != nil {
 			return nil, fmt.Errorf("correction iteration failed: %w", corrErr)
@@ -163,13 +164,14 @@ func (e *Executor) getConvergeLimit(goal *agentfile.Goal) int {
 	}
 	if goal.WithinVar != "" {
 		// Look up variable value
-		if val, ok := e.outputs[goal.WithinVar]; ok {
+		inputs, outputs := e.varsSnapshot()
+		if val, ok := outputs[goal.WithinVar]; ok {
 			if n, err := strconv.Atoi(val); err == nil {
 				return n
 			}
 		}
 		// Also check inputs
-		if val, ok := e.inputs[goal.WithinVar]; ok {
+		if val, ok := inputs[goal.WithinVar]; ok {
 			if n, err := strconv.Atoi(val); err == nil {
 				return n
 			}
@@ -179,12 +181,13 @@ func (e *Executor) getConvergeLimit(goal *agentfile.Goal) int {
 }
 
 // buildConvergePrompt builds the XML prompt for a convergence iteration.
-func (e *Executor) buildConvergePrompt(goal *agentfile.Goal, iterations []ConvergenceIteration, currentIteration int) string {
+func (e *Executor) buildConvergePrompt(ctx context.Context, goal *agentfile.Goal, iterations []ConvergenceIteration, currentIteration int) string {
 	xmlBuilder := NewXMLContextBuilder(e.workflow.Name)
 	xmlBuilder.SetConvergenceMode()
 
 	// Add prior goal outputs to context
-	for goalName, output := range e.outputs {
+	_, outputs := e.varsSnapshot()
+	for goalName, output := range outputs {
 		xmlBuilder.AddPriorGoal(goalName, output)
 	}
 
@@ -194,11 +197,11 @@ func (e *Executor) buildConvergePrompt(goal *agentfile.Goal, iterations []Conver
 	}
 
 	// Set current goal with interpolated description
-	goalDescription := e.interpolate(goal.Outcome)
+	goalDescription := e.interpolate(ctx, goal.Outcome)
 
 	// Add structured output instruction if outputs are declared
 	if len(goal.Outputs) > 0 {
-		goalDescription += "\n\n" + buildStructuredOutputInstruction(goal.Outputs)
+		goalDescription += "\n\n" + buildGoalOutputInstruction(goal)
 	}
 
 	xmlBuilder.SetCurrentGoal(goal.Name, goalDescription)
@@ -207,11 +210,12 @@ func (e *Executor) buildConvergePrompt(goal *agentfile.Goal, iterations []Conver
 }
 
 // buildConvergePromptWithCorrection builds prompt with supervisor correction.
-func (e *Executor) buildConvergePromptWithCorrection(goal *agentfile.Goal, iterations []ConvergenceIteration, currentIteration int, correction string) string {
+func (e *Executor) buildConvergePromptWithCorrection(ctx context.Context, goal *agentfile.Goal, iterations []ConvergenceIteration, currentIteration int, correction string) string {
 	xmlBuilder := NewXMLContextBuilder(e.workflow.Name)
 	xmlBuilder.SetConvergenceMode()
 
-	for goalName, output := range e.outputs {
+	_, outputs := e.varsSnapshot()
+	for goalName, output := range outputs {
 		xmlBuilder.AddPriorGoal(goalName, output)
 	}
 
@@ -219,9 +223,9 @@ func (e *Executor) buildConvergePromptWithCorrection(goal *agentfile.Goal, itera
 		xmlBuilder.AddConvergenceIteration(iter.N, iter.Output)
 	}
 
-	goalDescription := e.interpolate(goal.Outcome)
+	goalDescription := e.interpolate(ctx, goal.Outcome)
 	if len(goal.Outputs) > 0 {
-		goalDescription += "\n\n" + buildStructuredOutputInstruction(goal.Outputs)
+		goalDescription += "\n\n" + buildGoalOutputInstruction(goal)
 	}
 
 	xmlBuilder.SetCurrentGoal(goal.Name, goalDescription)
@@ -241,8 +245,6 @@ func (e *Executor) executeConvergeIteration(ctx context.Context, goal *agentfile
 	}
 
 	// Single-agent execution
-	e.currentGoal = goal.Name
-
 	// Use executePhase which handles tools, thinking, etc.
 	output, _, _, err := e.executePhase(ctx, goal, prompt)
 	if err != nil {
@@ -254,10 +256,8 @@ func (e *Executor) executeConvergeIteration(ctx context.Context, goal *agentfile
 
 // executeConvergeMultiAgent handles multi-agent execution within a convergence loop.
 func (e *Executor) executeConvergeMultiAgent(ctx context.Context, goal *agentfile.Goal, prompt string) (string, error) {
-	// Store convergence context so executeSimpleParallel can use it
-	e.convergenceContext = prompt
-	defer func() { e.convergenceContext = "" }()
-	
+	// Pass convergence context so executeSimpleParallel can use it
+	ctx = context.WithValue(ctx, ctxKeyConvergence, prompt)
 	return e.executeMultiAgentGoal(ctx, goal)
 }
 
@@ -141,7 +141,7 @@ func TestConvergeGoal_ContextBuilding(t *testing.T) {
 	
 	// Override to capture prompts (we can test the context building separately)
 	iterations := []ConvergenceIteration{}
-	prompt := exec.buildConvergePrompt(&wf.Goals[0], iterations, 1)
+	prompt := exec.buildConvergePrompt(context.Background(), &wf.Goals[0], iterations, 1)
 	prompts = append(prompts, prompt)
 
 	// First iteration should have convergence-instruction
@@ -154,7 +154,7 @@ func TestConvergeGoal_ContextBuilding(t *testing.T) {
 
 	// Second iteration should have first output in history
 	iterations = append(iterations, ConvergenceIteration{N: 1, Output: "First iteration output"})
-	prompt = exec.buildConvergePrompt(&wf.Goals[0], iterations, 2)
+	prompt = exec.buildConvergePrompt(context.Background(), &wf.Goals[0], iterations, 2)
 
 	if !strings.Contains(prompt, "<convergence-history>") {
 		t.Error("expected convergence-history in prompt")
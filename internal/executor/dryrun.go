@@ -0,0 +1,194 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/vinayprograms/agent/internal/checkpoint"
+	"github.com/vinayprograms/agent/internal/toolmeta"
+	"github.com/vinayprograms/agentkit/llm"
+)
+
+// Plan is the outcome of a dry run: what each goal set out to do (its
+// COMMIT intent) and the side-effecting tool calls it would have made.
+type Plan struct {
+	mu    sync.Mutex
+	Goals []*PlanGoal `json:"goals"`
+}
+
+// PlanGoal is the part of a plan contributed by one goal.
+type PlanGoal struct {
+	Goal           string          `json:"goal"`
+	Interpretation string          `json:"interpretation,omitempty"`
+	Approach       string          `json:"approach,omitempty"`
+	ScopeIn        []string        `json:"scope_in,omitempty"`
+	ScopeOut       []string        `json:"scope_out,omitempty"`
+	Actions        []PlannedAction `json:"actions,omitempty"`
+}
+
+// PlannedAction is a side-effecting tool call that was recorded instead
+// of executed.
+type PlannedAction struct {
+	Tool    string         `json:"tool"`
+	Summary string         `json:"summary"`
+	Args    map[string]any `json:"args,omitempty"`
+	Agent   string         `json:"agent,omitempty"`  // sub-agent role, empty for the main agent
+	Denied  string         `json:"denied,omitempty"` // policy reason, if the real run would refuse the call
+}
+
+// Mutations returns the number of recorded calls the policy would allow.
+func (p *Plan) Mutations() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := 0
+	for _, g := range p.Goals {
+		for _, a := range g.Actions {
+			if a.Denied == "" {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// goal returns the entry for a goal, adding it in execution order.
+// Callers hold p.mu.
+func (p *Plan) goal(name string) *PlanGoal {
+	for _, g := range p.Goals {
+		if g.Goal == name {
+			return g
+		}
+	}
+	g := &PlanGoal{Goal: name}
+	p.Goals = append(p.Goals, g)
+	return g
+}
+
+// Plan returns the plan recorded by a dry run, or nil for a real run.
+func (e *Executor) Plan() *Plan {
+	return e.plan
+}
+
+// dryRunExempt lists tools with side effects that still run in a dry run:
+// sub-agents make their own tool calls, which are simulated in turn, and
+// the scratchpad lives only as long as the session.
+var dryRunExempt = map[string]bool{
+	"spawn_agent":      true,
+	"spawn_agents":     true,
+	"scratchpad_write": true,
+}
+
+// simulates reports whether a dry run replaces the call with a recording
+// stub. Tools declaring local or external side effects are simulated,
+// except bash commands that only read (git status, ls); MCP tools without
+// declared side effects run normally.
+func (e *Executor) simulates(tc llm.ToolCallResponse) bool {
+	if e.plan == nil || dryRunExempt[tc.Name] {
+		return false
+	}
+	if tc.Name == "bash" {
+		command, _ := tc.Args["command"].(string)
+		if toolmeta.ReadOnlyCommand(command) {
+			return false
+		}
+	}
+	switch e.toolMeta.Lookup(tc.Name).SideEffects {
+	case toolmeta.EffectsLocal, toolmeta.EffectsExternal:
+		return true
+	}
+	return false
+}
+
+// planIntent records the COMMIT phase of a goal as its intent in the plan.
+func (e *Executor) planIntent(goal string, pre *checkpoint.PreCheckpoint) {
+	if e.plan == nil || pre == nil {
+		return
+	}
+	e.plan.mu.Lock()
+	defer e.plan.mu.Unlock()
+	g := e.plan.goal(goal)
+	g.Interpretation = pre.Interpretation
+	g.Approach = pre.Approach
+	g.ScopeIn = pre.ScopeIn
+	g.ScopeOut = pre.ScopeOut
+}
+
+// simulateTool records a side-effecting call in the plan instead of
+// executing it. Paths and commands are still checked against policy, so
+// a call the real run would refuse fails here too.
+func (e *Executor) simulateTool(ctx context.Context, tc llm.ToolCallResponse) (any, error) {
+	action := PlannedAction{
+		Tool:    tc.Name,
+		Summary: describeCall(tc),
+		Args:    tc.Args,
+		Denied:  e.dryRunDenied(tc),
+	}
+	if role := getAgentIdentity(ctx).Role; role != "main" {
+		action.Agent = role
+	}
+	goal := e.goalName(ctx)
+
+	e.plan.mu.Lock()
+	g := e.plan.goal(goal)
+	g.Actions = append(g.Actions, action)
+	e.plan.mu.Unlock()
+	e.logPlannedAction(goal, action)
+
+	if action.Denied != "" {
+		return nil, fmt.Errorf("policy denied: %s", action.Denied)
+	}
+	return fmt.Sprintf("[dry run] %s was recorded in the plan, not executed. Continue as if it succeeded.", action.Summary), nil
+}
+
+// dryRunDenied runs the deterministic policy checks of a call: the
+// command for bash, and any path arguments for other tools. It returns
+// the reason for a denial, or "" if the call would be allowed.
+func (e *Executor) dryRunDenied(tc llm.ToolCallResponse) string {
+	if e.policy == nil {
+		return ""
+	}
+	if tc.Name == "bash" {
+		command, _ := tc.Args["command"].(string)
+		if ok, reason := e.policy.CheckCommand(tc.Name, command); !ok {
+			return reason
+		}
+		return ""
+	}
+	for _, key := range []string{"path", "source", "destination"} {
+		path, _ := tc.Args[key].(string)
+		if path == "" {
+			continue
+		}
+		if !filepath.IsAbs(path) && e.policy.Workspace != "" {
+			path = filepath.Join(e.policy.Workspace, path)
+		}
+		if ok, reason := e.policy.CheckPath(tc.Name, path); !ok {
+			return reason
+		}
+	}
+	return ""
+}
+
+// describeCall summarizes a tool call in one line for the plan.
+func describeCall(tc llm.ToolCallResponse) string {
+	arg := func(key string) string {
+		s, _ := tc.Args[key].(string)
+		return s
+	}
+	switch tc.Name {
+	case "write":
+		return fmt.Sprintf("write %s (%d bytes)", arg("path"), len(arg("content")))
+	case "bash":
+		return "bash: " + truncateForLog(arg("command"), 200)
+	case "mv", "cp":
+		return fmt.Sprintf("%s %s -> %s", tc.Name, arg("source"), arg("destination"))
+	}
+	if path := arg("path"); path != "" {
+		return tc.Name + " " + path
+	}
+	args, _ := json.Marshal(tc.Args)
+	return tc.Name + " " + truncateForLog(string(args), 200)
+}
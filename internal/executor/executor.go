@@ -6,17 +6,21 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/vinayprograms/agent/internal/agentfile"
 	"github.com/vinayprograms/agent/internal/checkpoint"
+	"github.com/vinayprograms/agent/internal/dataflow"
 	"github.com/vinayprograms/agent/internal/hooks"
 	"github.com/vinayprograms/agent/internal/session"
 	"github.com/vinayprograms/agent/internal/skills"
+	"github.com/vinayprograms/agent/internal/snapshot"
 	"github.com/vinayprograms/agent/internal/step"
 	"github.com/vinayprograms/agent/internal/supervision"
+	"github.com/vinayprograms/agent/internal/toolmeta"
 	"github.com/vinayprograms/agentkit/llm"
 	"github.com/vinayprograms/agentkit/logging"
 	"github.com/vinayprograms/agentkit/mcp"
@@ -43,12 +47,16 @@ type ObservationStore interface {
 	QueryRelevantObservations(ctx context.Context, query string, limit int) ([]any, error)
 }
 
-// Context keys for agent identity (thread-safe via context propagation)
+// Context keys for agent identity and goal attribution (thread-safe via context propagation)
 type ctxKey int
 
 const (
 	ctxKeyAgentName ctxKey = iota
 	ctxKeyAgentRole
+	ctxKeyGoal
+	ctxKeyGoalSupervised
+	ctxKeyConvergence
+	ctxKeyExecutor
 )
 
 // AgentIdentity holds agent name and role for logging/attribution.
@@ -76,6 +84,49 @@ func getAgentIdentity(ctx context.Context) AgentIdentity {
 	return id
 }
 
+// withGoal returns a context attributed to the given goal.
+// Goals in a PARALLEL step run concurrently, so attribution travels with
+// the context rather than living on the Executor.
+func withGoal(ctx context.Context, name string, supervised bool) context.Context {
+	ctx = context.WithValue(ctx, ctxKeyGoal, name)
+	ctx = context.WithValue(ctx, ctxKeyGoalSupervised, supervised)
+	return ctx
+}
+
+// goalName returns the goal attributed to ctx, falling back to the most
+// recently started goal.
+func (e *Executor) goalName(ctx context.Context) string {
+	if name, ok := ctx.Value(ctxKeyGoal).(string); ok {
+		return name
+	}
+	return e.currentGoalName()
+}
+
+// goalSupervised reports whether the goal attributed to ctx is supervised.
+func (e *Executor) goalSupervised(ctx context.Context) bool {
+	if supervised, ok := ctx.Value(ctxKeyGoalSupervised).(bool); ok {
+		return supervised
+	}
+	e.goalMu.RLock()
+	defer e.goalMu.RUnlock()
+	return e.currentGoalSupervised
+}
+
+// setCurrentGoal records the most recently started goal.
+func (e *Executor) setCurrentGoal(name string, supervised bool) {
+	e.goalMu.Lock()
+	defer e.goalMu.Unlock()
+	e.currentGoal = name
+	e.currentGoalSupervised = supervised
+}
+
+// currentGoalName returns the most recently started goal.
+func (e *Executor) currentGoalName() string {
+	e.goalMu.RLock()
+	defer e.goalMu.RUnlock()
+	return e.currentGoal
+}
+
 type Status string
 
 const (
@@ -87,6 +138,7 @@ const (
 type Result struct {
 	Status     Status
 	Outputs    map[string]string
+	Values     map[string]any // typed structured output fields, decoded from JSON
 	Iterations map[string]int
 	Error      string
 }
@@ -114,13 +166,17 @@ type Executor struct {
 	// Session logging
 	session               *session.Session
 	sessionManager        session.SessionManager
-	persistentSession     bool // When true, Run() does not close the session (serve mode)
+	persistentSession     bool    // When true, Run() does not close the session (serve mode)
+	resume                *Resume // progress of an interrupted run (nil for fresh runs)
 	currentGoal           string
-	currentGoalSupervised bool // Whether the current goal is supervised (inherited by sub-agents)
+	currentGoalSupervised bool         // Whether the current goal is supervised (inherited by sub-agents)
+	goalMu                sync.RWMutex // protects currentGoal and currentGoalSupervised
 
 	// State
 	inputs  map[string]string
 	outputs map[string]string
+	values  map[string]any // decoded structured output fields of the current run
+	varsMu  sync.RWMutex   // protects inputs, outputs and values (goals may run in parallel)
 
 	// Supervision support
 	checkpointStore checkpoint.CheckpointStore
@@ -128,6 +184,14 @@ type Executor struct {
 	humanAvailable  bool
 	humanInputChan  chan string
 
+	// Workspace snapshots at pre-checkpoints (nil = off)
+	snapshots         *snapshot.Store
+	restoreOnReorient bool
+	activeGoals       *ActiveGoals // goals running in the workspace, across executors sharing it
+
+	// Dry run: side-effecting calls are recorded here, not executed (nil = real run)
+	plan *Plan
+
 	// Hooks for cross-cutting concerns (logging, telemetry, metrics).
 	// Multiple listeners can subscribe to each event type.
 	hooks *hooks.Registry
@@ -135,11 +199,36 @@ type Executor struct {
 	// Security verifier
 	securityVerifier *security.Verifier
 
+	// Data flow rules and the sensitivity labels of registered blocks
+	flowPolicy *dataflow.Policy
+	flowBlocks map[string]flowBlock // block ID -> labeled content
+	flowSeq    int                  // IDs of flow blocks kept without a verifier
+	flowMu     sync.Mutex           // protects flowBlocks and flowSeq
+
+	// Tool metadata: output trust and scheduling (nil = built-in defaults)
+	toolMeta *toolmeta.Catalog
+
 	// Timeouts for network operations (seconds)
 	timeoutMCP       int
 	timeoutWebSearch int
 	timeoutWebFetch  int
 
+	// Budget limits and run-wide cost spent so far
+	maxTurns         int
+	maxTokensPerGoal int
+	maxCostPerRun    float64
+	inputCostPer1M   float64
+	outputCostPer1M  float64
+	runCost          float64
+	costMu           sync.Mutex // protects runCost
+
+	// Context-window management
+	contextWindows    map[string]int
+	compactAt         float64
+	keepRecent        int
+	contextSummarizer tools.Summarizer
+	contextStore      tools.MemoryStore
+
 	// Goal timing tracking
 	goalStartTimes map[string]time.Time
 
@@ -152,7 +241,6 @@ type Executor struct {
 
 	// Convergence tracking
 	convergenceFailures map[string]int // goals that hit WITHIN limit without converging
-	convergenceContext  string         // current convergence history (for multi-agent goals)
 	mu                  sync.Mutex     // protects convergenceFailures
 
 	// Metrics collector for heartbeat reporting (optional, set by serve mode)
@@ -264,6 +352,11 @@ func New(cfg Config) *Executor {
 	if provider == nil && factory != nil {
 		provider, _ = factory.GetProvider("")
 	}
+	// Every call counts toward the run cost limit
+	provider = MeterProvider(provider)
+	if factory != nil {
+		factory = meteredFactory{factory}
+	}
 
 	hk := cfg.Hooks
 	if hk == nil {
@@ -284,17 +377,33 @@ func New(cfg Config) *Executor {
 		session:               cfg.Session,
 		sessionManager:        cfg.SessionManager,
 		persistentSession:     cfg.PersistentSession,
+		resume:                cfg.Resume,
 		outputs:               make(map[string]string),
 		checkpointStore:       cfg.CheckpointStore,
 		supervisor:            cfg.Supervisor,
 		humanAvailable:        cfg.HumanAvailable,
+		snapshots:             cfg.Snapshots,
+		restoreOnReorient:     cfg.RestoreOnReorient,
+		activeGoals:           cfg.ActiveGoals,
 		humanInputChan:        cfg.HumanInputChan,
 		hooks:                 hk,
 		securityVerifier:      cfg.SecurityVerifier,
+		flowPolicy:            cfg.FlowPolicy,
+		toolMeta:              cfg.ToolMeta,
 		securityResearchScope: cfg.SecurityResearchScope,
 		timeoutMCP:            cfg.TimeoutMCP,
 		timeoutWebSearch:      cfg.TimeoutWebSearch,
 		timeoutWebFetch:       cfg.TimeoutWebFetch,
+		maxTurns:              cfg.MaxTurns,
+		maxTokensPerGoal:      cfg.MaxTokensPerGoal,
+		maxCostPerRun:         cfg.MaxCostPerRun,
+		inputCostPer1M:        cfg.InputCostPer1M,
+		outputCostPer1M:       cfg.OutputCostPer1M,
+		contextWindows:        cfg.ContextWindows,
+		compactAt:             cfg.CompactAt,
+		keepRecent:            cfg.KeepRecent,
+		contextSummarizer:     cfg.ContextSummarizer,
+		contextStore:          cfg.ContextStore,
 		goalStartTimes:        make(map[string]time.Time),
 		observationExtractor:  cfg.ObservationExtractor,
 		observationStore:      cfg.ObservationStore,
@@ -304,6 +413,19 @@ func New(cfg Config) *Executor {
 		workspaceContext:      cfg.WorkspaceContext,
 	}
 
+	if e.compactAt <= 0 {
+		e.compactAt = defaultCompactAt
+	}
+	if e.keepRecent <= 0 {
+		e.keepRecent = defaultKeepRecent
+	}
+	if e.activeGoals == nil {
+		e.activeGoals = &ActiveGoals{}
+	}
+	if cfg.DryRun {
+		e.plan = &Plan{}
+	}
+
 	// Start session writer if session + manager provided.
 	if e.session != nil && e.sessionManager != nil {
 		e.session.Start(e.sessionManager)
@@ -311,7 +433,7 @@ func New(cfg Config) *Executor {
 
 	// Build supervision pipeline if both store and supervisor are available.
 	if e.supervisor != nil && e.checkpointStore != nil {
-		e.pipeline = supervision.NewPipeline(supervision.PipelineConfig{
+		pcfg := supervision.PipelineConfig{
 			Store:      e.checkpointStore,
 			Supervisor: e.supervisor,
 			Logger:     e.logger,
@@ -321,10 +443,16 @@ func New(cfg Config) *Executor {
 					"step_id": stepID, "phase": phase, "data": data,
 				})
 			},
-		})
+		}
+		if e.snapshots != nil {
+			pcfg.Snapshots = e.snapshots
+		}
+		e.pipeline = supervision.NewPipeline(pcfg)
 	}
 
-	e.initSpawner()
+	if !cfg.SharedRegistry {
+		e.initSpawner()
+	}
 	return e
 }
 
@@ -386,23 +514,36 @@ func (e *Executor) extractAndStoreObservations(ctx context.Context, stepName, st
 
 // verifyToolCall checks a tool call against the security verifier if configured.
 func (e *Executor) verifyToolCall(ctx context.Context, toolName string, args map[string]any) ([]string, error) {
+	// Flow rules are deterministic, so they run before the verifier's tiers,
+	// and apply with or without a verifier
+	flowBlocks, deniedBlock, violation := e.checkFlow(toolName, args)
+	if violation != nil {
+		e.logFlowDenied(ctx, toolName, violation, deniedBlock, flowBlocks)
+		e.logSecurityDecision(ctx, toolName, "deny", violation.String(), "", "flow")
+		if e.metricsCollector != nil {
+			e.metricsCollector.RecordSupervision(false)
+		}
+		return nil, fmt.Errorf("security: %s", violation)
+	}
 	if e.securityVerifier == nil {
-		return nil, nil // No security verifier configured
+		return flowBlocks, nil // No security verifier configured
 	}
 
 	// Use agent role from context for block filtering in multi-agent scenarios
 	agentID := getAgentIdentity(ctx)
 	agentContext := agentID.Role
-	result, err := e.securityVerifier.VerifyToolCall(ctx, toolName, args, e.currentGoal, agentContext)
+	result, err := e.securityVerifier.VerifyToolCall(ctx, toolName, args, e.goalName(ctx), agentContext)
 	if err != nil {
 		return nil, fmt.Errorf("security verification error: %w", err)
 	}
 
 	// Collect related blocks for taint propagation when registering tool results
-	var relatedBlocks []string
+	relatedBlocks := flowBlocks
 	if result.Tier1 != nil {
 		for _, b := range result.Tier1.RelatedBlocks {
-			relatedBlocks = append(relatedBlocks, b.ID)
+			if !slices.Contains(relatedBlocks, b.ID) {
+				relatedBlocks = append(relatedBlocks, b.ID)
+			}
 		}
 	}
 
@@ -416,7 +557,7 @@ func (e *Executor) verifyToolCall(ctx context.Context, toolName string, args map
 		for _, b := range result.Tier1.RelatedBlocks {
 			relatedBlockIDs = append(relatedBlockIDs, b.ID)
 		}
-		e.logSecurityStatic(toolName, blockID, relatedBlockIDs, result.Tier1.Pass, result.Tier1.Reasons, result.Tier1.SkipReason, result.TaintLineage)
+		e.logSecurityStatic(ctx, toolName, blockID, relatedBlockIDs, result.Tier1.Pass, result.Tier1.Reasons, result.Tier1.SkipReason, result.TaintLineage)
 	}
 
 	if result.Tier2 != nil {
@@ -429,7 +570,7 @@ func (e *Executor) verifyToolCall(ctx context.Context, toolName string, args map
 		if !result.Tier2.Suspicious {
 			skipReason = "triage_benign"
 		}
-		e.logSecurityTriage(toolName, blockID, result.Tier2.Suspicious, "triage", result.Tier2.LatencyMs, result.Tier2.InputTokens, result.Tier2.OutputTokens, skipReason)
+		e.logSecurityTriage(ctx, toolName, blockID, result.Tier2.Suspicious, "triage", result.Tier2.LatencyMs, result.Tier2.InputTokens, result.Tier2.OutputTokens, skipReason)
 	}
 
 	if result.Tier3 != nil {
@@ -437,7 +578,7 @@ func (e *Executor) verifyToolCall(ctx context.Context, toolName string, args map
 		if result.Tier1 != nil && result.Tier1.Block != nil {
 			blockID = result.Tier1.Block.ID
 		}
-		e.logSecuritySupervisor(toolName, blockID, string(result.Tier3.Verdict), result.Tier3.Reason, "supervisor", result.Tier3.LatencyMs, result.Tier3.InputTokens, result.Tier3.OutputTokens)
+		e.logSecuritySupervisor(ctx, toolName, blockID, string(result.Tier3.Verdict), result.Tier3.Reason, "supervisor", result.Tier3.LatencyMs, result.Tier3.InputTokens, result.Tier3.OutputTokens)
 	}
 
 	// Determine check path - accurately reflect which tiers actually ran
@@ -454,14 +595,14 @@ func (e *Executor) verifyToolCall(ctx context.Context, toolName string, args map
 	}
 
 	if !result.Allowed {
-		e.logSecurityDecision(toolName, "deny", result.DenyReason, "", checkPath)
+		e.logSecurityDecision(ctx, toolName, "deny", result.DenyReason, "", checkPath)
 		if e.metricsCollector != nil {
 			e.metricsCollector.RecordSupervision(false)
 		}
 		return nil, fmt.Errorf("security: %s", result.DenyReason)
 	}
 
-	e.logSecurityDecision(toolName, "allow", "verified", "", checkPath)
+	e.logSecurityDecision(ctx, toolName, "allow", "verified", "", checkPath)
 	if e.metricsCollector != nil {
 		e.metricsCollector.RecordSupervision(true)
 	}
@@ -475,8 +616,15 @@ func (e *Executor) AddUntrustedContent(ctx context.Context, content, source stri
 
 // AddUntrustedContentWithTaint registers untrusted content with explicit taint lineage.
 func (e *Executor) AddUntrustedContentWithTaint(ctx context.Context, content, source string, taintedBy []string) {
+	e.addContentBlock(ctx, security.TrustUntrusted, content, source, taintedBy, nil)
+}
+
+// addContentBlock registers content with the security verifier and logs the
+// block. labels are the content's sensitivity labels; the block also inherits
+// the labels of the blocks that tainted it.
+func (e *Executor) addContentBlock(ctx context.Context, trust security.TrustLevel, content, source string, taintedBy, labels []string) *security.Block {
 	if e.securityVerifier == nil {
-		return
+		return nil
 	}
 	// Use agent role from context for block association in multi-agent scenarios
 	agentID := getAgentIdentity(ctx)
@@ -489,7 +637,7 @@ func (e *Executor) AddUntrustedContentWithTaint(ctx context.Context, content, so
 	}
 
 	block := e.securityVerifier.AddBlockWithTaint(
-		security.TrustUntrusted,
+		trust,
 		security.TypeData,
 		true,
 		content,
@@ -498,25 +646,36 @@ func (e *Executor) AddUntrustedContentWithTaint(ctx context.Context, content, so
 		eventSeq,
 		taintedBy, // Parent blocks that influenced this content
 	)
+	labels = e.labelBlock(block.ID, content, source, labels, taintedBy)
 
 	// Log to session with XML representation including taint info
 	taintAttr := ""
 	if len(taintedBy) > 0 {
 		taintAttr = fmt.Sprintf(` tainted-by="%s"`, strings.Join(taintedBy, ","))
 	}
-	xmlBlock := fmt.Sprintf(`<block id="%s" trust="untrusted" type="data" source="%s" mutable="true" agent="%s"%s>%s</block>`,
-		block.ID, source, agentContext, taintAttr, truncateForLog(content, 200))
+	if len(labels) > 0 {
+		taintAttr += fmt.Sprintf(` labels="%s"`, strings.Join(labels, ","))
+	}
+	xmlBlock := fmt.Sprintf(`<block id="%s" trust="%s" type="data" source="%s" mutable="true" agent="%s"%s>%s</block>`,
+		block.ID, trust, source, agentContext, taintAttr, truncateForLog(content, 200))
 	entropy := security.ShannonEntropy([]byte(content))
-	e.logSecurityBlockWithTaint(block.ID, "untrusted", "data", source, xmlBlock, entropy, taintedBy)
+	e.logSecurityBlockWithTaint(ctx, block.ID, string(trust), "data", source, xmlBlock, entropy, taintedBy, labels)
+	return block
 }
 
 // initSpawner wires the tool registry's spawn callback to this executor.
+// Executors sharing the registry (see Config.SharedRegistry) are routed to
+// through the context, so a spawn runs in the executor whose goal asked for it.
 func (e *Executor) initSpawner() {
 	if e.registry == nil {
 		return
 	}
 	e.registry.SetSpawner(func(ctx context.Context, role, task string, outputs []string) (string, error) {
-		return e.spawnDynamicAgent(ctx, role, task, outputs)
+		owner := e
+		if caller, ok := ctx.Value(ctxKeyExecutor).(*Executor); ok {
+			owner = caller
+		}
+		return owner.spawnDynamicAgent(ctx, role, task, outputs)
 	})
 }
 
@@ -582,6 +741,7 @@ func (e *Executor) Run(ctx context.Context, inputs map[string]string) (*Result,
 
 	// Set main agent identity in context (workflow name as both name and role)
 	ctx = withAgentIdentity(ctx, workflowName, "main")
+	ctx = context.WithValue(ctx, ctxKeyExecutor, e)
 
 	// Pre-flight check for SUPERVISED HUMAN requirements
 	if err := e.PreFlight(); err != nil {
@@ -590,6 +750,12 @@ func (e *Executor) Run(ctx context.Context, inputs map[string]string) (*Result,
 		return &Result{Status: StatusFailed, Error: err.Error()}, err
 	}
 
+	// Cost budget is per run; serve mode reuses the executor across tasks
+	e.resetRunCost()
+	e.varsMu.Lock()
+	e.values = nil
+	e.varsMu.Unlock()
+
 	// Bind inputs
 	if err := e.bindInputs(inputs); err != nil {
 		e.logger.ExecutionComplete(workflowName, time.Since(startTime), string(StatusFailed))
@@ -599,19 +765,33 @@ func (e *Executor) Run(ctx context.Context, inputs map[string]string) (*Result,
 
 	// Build and execute the step graph
 	graph := step.BuildGraph(e.workflow, e)
-	state := step.NewState(e.inputs)
+	boundInputs, _ := e.varsSnapshot()
+	state := step.NewState(boundInputs)
+	if e.resume != nil {
+		e.resume.seed(state)
+	}
 
 	if err := graph.Execute(ctx, state); err != nil {
 		e.logger.ExecutionComplete(workflowName, time.Since(startTime), string(StatusFailed))
 		e.endWorkflowSpan(workflowSpan, string(StatusFailed), err)
-		return &Result{Status: StatusFailed, Error: err.Error()}, err
+		// Report outputs from goals that completed before the failure
+		_, partial := state.Snapshot()
+		return &Result{Status: StatusFailed, Outputs: partial, Values: e.valuesSnapshot(), Error: err.Error()}, err
 	}
 
-	// Collect outputs
+	// Collect outputs and iteration counts (CONVERGE failures + LOOP steps)
+	iterations := e.GetConvergenceFailures()
+	for name, n := range state.Iterations {
+		if iterations == nil {
+			iterations = make(map[string]int)
+		}
+		iterations[name] = n
+	}
 	result := &Result{
 		Status:     StatusComplete,
 		Outputs:    state.Outputs,
-		Iterations: e.GetConvergenceFailures(),
+		Values:     e.valuesSnapshot(),
+		Iterations: iterations,
 	}
 	e.logger.ExecutionComplete(workflowName, time.Since(startTime), string(StatusComplete))
 	e.endWorkflowSpan(workflowSpan, string(StatusComplete), nil)
@@ -642,32 +822,58 @@ func (e *Executor) ExecuteGoal(ctx context.Context, goalName string, state *step
 	if goal == nil {
 		return fmt.Errorf("goal %q not found in workflow", goalName)
 	}
+	if e.resumeGoal(ctx, goalName) {
+		return nil
+	}
 
 	// Sync state from step.State to executor's internal state
-	for k, v := range state.Inputs {
+	inputs, outputs := state.Snapshot()
+	e.varsMu.Lock()
+	for k, v := range inputs {
 		if _, exists := e.inputs[k]; !exists {
 			e.inputs[k] = v
 		}
 	}
-	for k, v := range state.Outputs {
+	for k, v := range outputs {
 		e.outputs[k] = v
 	}
+	e.varsMu.Unlock()
 
-	result, err := e.executeGoalWithTracking(ctx, goal)
+	result, err := e.executeGoalWithPolicy(ctx, goal)
 	if err != nil {
+		if goal.OnFailure != "" && ctx.Err() == nil {
+			return e.runFallback(ctx, goal, err, state)
+		}
 		return err
 	}
 
-	// Store output in step state
-	state.Outputs[goalName] = result.Output
-	e.outputs[goalName] = result.Output
+	// Store output (and structured fields, so WHEN clauses can test them) in step state
+	state.SetOutput(goalName, result.Output)
+	for field, value := range result.Fields {
+		state.SetOutput(field, value)
+	}
+	state.SetToolCalls(goalName, result.ToolCallsMade)
+	e.setOutput(goalName, result.Output)
 
 	return nil
 }
 
+// SkipGoal records a goal skipped because its WHEN clause was false.
+// This implements step.GoalSkipper.
+func (e *Executor) SkipGoal(ctx context.Context, goalName, reason string) {
+	e.logger.Info("skipping goal", map[string]any{
+		"goal":   goalName,
+		"reason": reason,
+	})
+	e.logGoalSkipped(goalName, reason)
+	e.hooks.Fire(ctx, hooks.GoalSkipped, map[string]any{"name": goalName, "reason": reason})
+	e.flushSession()
+}
+
 // GoalResult contains the result of executing a goal.
 type GoalResult struct {
 	Output        string
+	Fields        map[string]string // structured output fields (after ->)
 	ToolCallsMade bool
 }
 
@@ -696,11 +902,11 @@ func (e *Executor) requiresHuman(goal *agentfile.Goal) bool {
 
 // goalOutcome returns the interpolated outcome description for a goal by name, falling back to the name itself.
 // Handles goals defined inline, from a file (FROM path.md), or from an agent skill.
-func (e *Executor) goalOutcome(name string) string {
+func (e *Executor) goalOutcome(ctx context.Context, name string) string {
 	for _, g := range e.workflow.Goals {
 		if g.Name == name {
 			if g.Outcome != "" {
-				return e.interpolate(g.Outcome)
+				return e.interpolate(ctx, g.Outcome)
 			}
 			break
 		}
@@ -712,6 +918,12 @@ func (e *Executor) goalOutcome(name string) string {
 // Phases: COMMIT -> EXECUTE -> RECONCILE -> SUPERVISE
 // All steps capture checkpoints; only supervised steps run RECONCILE/SUPERVISE.
 func (e *Executor) executeGoalWithTracking(ctx context.Context, goal *agentfile.Goal) (*GoalResult, error) {
+	// Attribute everything below to this goal (and record it for logging)
+	ctx = withGoal(ctx, goal.Name, e.isSupervised(goal))
+	e.setCurrentGoal(goal.Name, e.isSupervised(goal))
+	e.activeGoals.enter()
+	defer e.activeGoals.leave()
+
 	// Log goal start
 	e.logGoalStart(goal.Name)
 
@@ -724,19 +936,14 @@ func (e *Executor) executeGoalWithTracking(ctx context.Context, goal *agentfile.
 			return nil, err
 		}
 		// Parse structured output if declared
-		if len(goal.Outputs) > 0 {
-			parsedOutputs, err := parseStructuredOutput(result.Output, goal.Outputs)
-			if err != nil {
-				e.logEvent(session.EventSystem, fmt.Sprintf("Warning: failed to parse structured output: %v", err))
-			} else {
-				for field, value := range parsedOutputs {
-					e.outputs[field] = value
-				}
-			}
+		output, fields, err := e.storeStructuredOutput(ctx, goal, result.Output)
+		if err != nil {
+			return nil, err
 		}
-		e.logGoalEnd(goal.Name, result.Output)
+		e.recordOutputs(goal.Name, output, fields)
+		e.logGoalEnd(goal.Name, output)
 		e.flushSession()
-		return &GoalResult{Output: result.Output, ToolCallsMade: false}, nil
+		return &GoalResult{Output: output, Fields: fields, ToolCallsMade: false}, nil
 	}
 
 	// Check for multi-agent execution
@@ -746,51 +953,55 @@ func (e *Executor) executeGoalWithTracking(ctx context.Context, goal *agentfile.
 			return nil, err
 		}
 		// Parse structured output if declared (same as regular goals)
-		if len(goal.Outputs) > 0 {
-			parsedOutputs, err := parseStructuredOutput(output, goal.Outputs)
-			if err != nil {
-				e.logEvent(session.EventSystem, fmt.Sprintf("Warning: failed to parse structured output: %v", err))
-			} else {
-				for field, value := range parsedOutputs {
-					e.outputs[field] = value
-				}
-			}
+		output, fields, err := e.storeStructuredOutput(ctx, goal, output)
+		if err != nil {
+			return nil, err
 		}
+		e.recordOutputs(goal.Name, output, fields)
 		e.logGoalEnd(goal.Name, output)
 		e.flushSession()
-		return &GoalResult{Output: output, ToolCallsMade: false}, nil
+		return &GoalResult{Output: output, Fields: fields, ToolCallsMade: false}, nil
 	}
 
 	// Build XML-structured prompt with context from previous goals
 	xmlBuilder := NewXMLContextBuilder(e.workflow.Name)
 
 	// Add prior goal outputs to context
-	for goalName, output := range e.outputs {
+	_, priorOutputs := e.varsSnapshot()
+	for goalName, output := range priorOutputs {
 		xmlBuilder.AddPriorGoal(goalName, output)
 	}
 
 	// Set current goal with interpolated description
-	goalDescription := e.interpolate(goal.Outcome)
+	goalDescription := e.interpolate(ctx, goal.Outcome)
 
 	// Add structured output instruction if outputs are declared
 	if len(goal.Outputs) > 0 {
-		goalDescription += "\n\n" + buildStructuredOutputInstruction(goal.Outputs)
+		goalDescription += "\n\n" + buildGoalOutputInstruction(goal)
 	}
 
 	xmlBuilder.SetCurrentGoal(goal.Name, goalDescription)
 
+	// Let the agent know it may signal convergence when repeated by a LOOP
+	if iter, ok := step.LoopIterationFromContext(ctx); ok {
+		xmlBuilder.SetLoopIteration(iter.Step, iter.N)
+		e.logEvent(ctx, session.EventSystem, fmt.Sprintf("Loop %q iteration %d for goal %q", iter.Step, iter.N, goal.Name))
+	}
+
 	// Build the XML prompt
 	prompt := xmlBuilder.Build()
 
-	// Set current goal for logging
-	e.currentGoal = goal.Name
-
 	// Determine supervision status
 	supervised := e.isSupervised(goal)
 	humanRequired := e.requiresHuman(goal)
 
-	// Track supervision status for sub-agents spawned during this goal
-	e.currentGoalSupervised = supervised
+	// A dry run declares intent for every goal, supervised or not, so the
+	// plan shows what each goal set out to do
+	var intent *checkpoint.PreCheckpoint
+	if e.plan != nil {
+		intent = e.commitPhase(ctx, goal, prompt)
+		e.planIntent(goal.Name, intent)
+	}
 
 	// Run through the supervision pipeline (or just execute if unsupervised)
 	pipelineResult, err := e.getPipeline().Run(
@@ -803,6 +1014,9 @@ func (e *Executor) executeGoalWithTracking(ctx context.Context, goal *agentfile.
 		},
 		// COMMIT: declare intent
 		func(ctx context.Context) *checkpoint.PreCheckpoint {
+			if intent != nil {
+				return intent
+			}
 			return e.commitPhase(ctx, goal, prompt)
 		},
 		// EXECUTE: do the work
@@ -829,6 +1043,7 @@ func (e *Executor) executeGoalWithTracking(ctx context.Context, goal *agentfile.
 			"goal":       goal.Name,
 			"correction": pipelineResult.Correction,
 		})
+		e.restoreWorkspace(ctx, goal.Name, pipelineResult.Snapshot)
 		xmlBuilder.SetCorrection(pipelineResult.Correction)
 		correctedPrompt := xmlBuilder.Build()
 		output, _, toolCallsMade, err = e.executePhase(ctx, goal, correctedPrompt)
@@ -841,22 +1056,17 @@ func (e *Executor) executeGoalWithTracking(ctx context.Context, goal *agentfile.
 	}
 
 	// Parse structured output if declared
-	if len(goal.Outputs) > 0 {
-		parsedOutputs, err := parseStructuredOutput(output, goal.Outputs)
-		if err != nil {
-			e.logEvent(session.EventSystem, fmt.Sprintf("Warning: failed to parse structured output: %v", err))
-		} else {
-			for field, value := range parsedOutputs {
-				e.outputs[field] = value
-			}
-		}
+	output, fields, err := e.storeStructuredOutput(ctx, goal, output)
+	if err != nil {
+		return nil, err
 	}
 
 	e.hooks.Fire(ctx, hooks.GoalComplete, map[string]any{"name": goal.Name, "output": output})
 	e.extractAndStoreObservations(ctx, goal.Name, "GOAL", output)
+	e.recordOutputs(goal.Name, output, fields)
 	e.logGoalEnd(goal.Name, output)
 	e.flushSession()
-	return &GoalResult{Output: output, ToolCallsMade: toolCallsMade}, nil
+	return &GoalResult{Output: output, Fields: fields, ToolCallsMade: toolCallsMade}, nil
 }
 
 // commitPhase asks the agent to declare its intent before execution.
@@ -990,8 +1200,8 @@ func (e *Executor) executePhase(ctx context.Context, goal *agentfile.Goal, promp
 	}
 
 	// Log initial messages
-	e.logEvent(session.EventSystem, systemMsg)
-	e.logEvent(session.EventUser, prompt)
+	e.logEvent(ctx, session.EventSystem, systemMsg)
+	e.logEvent(ctx, session.EventUser, prompt)
 
 	// Get tool definitions (built-in + MCP)
 	toolDefs := e.getAllToolDefinitions()
@@ -1002,8 +1212,29 @@ func (e *Executor) executePhase(ctx context.Context, goal *agentfile.Goal, promp
 	// Track tools used
 	toolsUsedMap := make(map[string]bool)
 
+	// Turn/token/cost limits for this goal
+	budget := e.goalBudget(goal)
+
+	// Keeps messages within the model's context window
+	window := e.newContextManager("")
+
 	// Execute goal loop
 	for {
+		// Out of budget — ask the model to wrap up instead of continuing
+		if limit, reason := e.budgetExceeded(budget); limit != "" {
+			output, err := e.wrapUpOverBudget(ctx, e.provider, "", budget, limit, reason, messages, toolDefs)
+			if err != nil {
+				e.logPhaseExecute(goal.Name, "error", time.Since(start).Milliseconds())
+				return "", nil, toolCallsMade, err
+			}
+			for tool := range toolsUsedMap {
+				toolsUsed = append(toolsUsed, tool)
+			}
+			e.logPhaseExecute(goal.Name, "budget_exceeded", time.Since(start).Milliseconds())
+			return output, toolsUsed, toolCallsMade, nil
+		}
+
+		window.fit(ctx, messages)
 		llmStart := time.Now()
 		resp, err := e.provider.Chat(ctx, llm.ChatRequest{
 			Messages: messages,
@@ -1019,6 +1250,8 @@ func (e *Executor) executePhase(ctx context.Context, goal *agentfile.Goal, promp
 		// Log full LLM interaction (for -vv replay)
 		e.logLLMCall(ctx, session.EventAssistant, messages, resp, llmDuration)
 		e.recordLLMMetrics(resp, llmDuration)
+		e.chargeBudget(budget, resp)
+		window.observe(messages, resp)
 
 		// Check for skill activation in response
 		if skill := e.checkSkillActivation(resp.Content); skill != nil {
@@ -1032,7 +1265,7 @@ func (e *Executor) executePhase(ctx context.Context, goal *agentfile.Goal, promp
 				Role:    "user",
 				Content: skillMsg,
 			})
-			e.logEvent(session.EventUser, skillMsg)
+			e.logEvent(ctx, session.EventUser, skillMsg)
 			continue
 		}
 
@@ -1052,7 +1285,7 @@ func (e *Executor) executePhase(ctx context.Context, goal *agentfile.Goal, promp
 					Role:    "user",
 					Content: interruptBlock,
 				})
-				e.logEvent(session.EventUser, interruptBlock)
+				e.logEvent(ctx, session.EventUser, interruptBlock)
 				continue
 			}
 			// No interrupts, no tool calls — execution complete
@@ -1088,7 +1321,7 @@ func (e *Executor) executePhase(ctx context.Context, goal *agentfile.Goal, promp
 				Role:    "user",
 				Content: interruptBlock,
 			})
-			e.logEvent(session.EventUser, interruptBlock)
+			e.logEvent(ctx, session.EventUser, interruptBlock)
 		}
 	}
 }
@@ -1212,15 +1445,13 @@ func (e *Executor) executeMultiAgentGoal(ctx context.Context, goal *agentfile.Go
 	}
 
 	// Set current goal for logging and sub-agent inheritance
-	e.currentGoal = goal.Name
-
-	// Determine supervision status
 	supervised := e.isSupervised(goal)
-	e.currentGoalSupervised = supervised
+	ctx = withGoal(ctx, goal.Name, supervised)
+	e.setCurrentGoal(goal.Name, supervised)
 
 	// Build prompt description for checkpoint
 	prompt := fmt.Sprintf("Execute goal %q using agents: %v\nOutcome: %s",
-		goal.Name, goal.UsingAgent, e.interpolate(goal.Outcome))
+		goal.Name, goal.UsingAgent, e.interpolate(ctx, goal.Outcome))
 
 	// ============================================
 	// PHASE 1: COMMIT - Declare intent for multi-agent goal
@@ -1228,6 +1459,7 @@ func (e *Executor) executeMultiAgentGoal(ctx context.Context, goal *agentfile.Go
 	var preCheckpoint *checkpoint.PreCheckpoint
 	if supervised && e.checkpointStore != nil {
 		preCheckpoint = e.commitPhase(ctx, goal, prompt)
+		e.getPipeline().Snapshot(goal.Name, preCheckpoint)
 		if err := e.checkpointStore.SavePre(preCheckpoint); err != nil {
 			e.logger.Warn("failed to save pre-checkpoint", map[string]any{
 				"error": err.Error(),
@@ -1272,7 +1504,7 @@ func (e *Executor) executeMultiAgentGoal(ctx context.Context, goal *agentfile.Go
 	if supervised && e.supervisor != nil && preCheckpoint != nil && postCheckpoint != nil {
 		humanRequired := e.requiresHuman(goal)
 
-		goalDescription := e.interpolate(goal.Outcome)
+		goalDescription := e.interpolate(ctx, goal.Outcome)
 		reconcileStart := time.Now()
 		reconcileResult := e.supervisor.Reconcile(preCheckpoint, postCheckpoint)
 		reconcileDuration := time.Since(reconcileStart).Milliseconds()
@@ -1341,12 +1573,12 @@ func (e *Executor) executeSimpleParallel(ctx context.Context, goal *agentfile.Go
 		durationMs int64
 	}
 
-	task := e.interpolate(goal.Outcome)
+	task := e.interpolate(ctx, goal.Outcome)
 
 	// If we're in a convergence loop, use the convergence-aware prompt instead
 	// This includes the full XML context with convergence history
-	if e.convergenceContext != "" {
-		task = e.convergenceContext
+	if convergence, ok := ctx.Value(ctxKeyConvergence).(string); ok && convergence != "" {
+		task = convergence
 	}
 
 	// Build prior goals context from completed goals
@@ -1363,7 +1595,7 @@ func (e *Executor) executeSimpleParallel(ctx context.Context, goal *agentfile.Go
 
 			// Use agent's prompt as the role/persona, falling back to name
 			role := agent.Name
-			systemPrompt := e.interpolate(agent.Prompt) // Interpolate $vars in skill/prompt
+			systemPrompt := e.interpolate(ctx, agent.Prompt) // Interpolate $vars in skill/prompt
 			if systemPrompt == "" {
 				systemPrompt = fmt.Sprintf("You are a %s. Complete the task and return your findings.", role)
 			}
@@ -1399,7 +1631,7 @@ func (e *Executor) executeSimpleParallel(ctx context.Context, goal *agentfile.Go
 		}
 
 		// Log sub-agent completion
-		e.logSubAgentEnd(result.name, result.name, model, result.output, result.durationMs, result.err)
+		e.logSubAgentEnd(ctx, result.name, result.name, model, result.output, result.durationMs, result.err)
 
 		if result.err != nil {
 			return "", result.err
@@ -0,0 +1,79 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vinayprograms/agent/internal/agentfile"
+	"github.com/vinayprograms/agent/internal/step"
+)
+
+// executeGoalWithPolicy runs a goal under its RETRY and TIMEOUT modifiers.
+// Each attempt is logged as a goal_attempt event. If every attempt fails,
+// the last error is returned; ON FAILURE is handled by the caller.
+func (e *Executor) executeGoalWithPolicy(ctx context.Context, goal *agentfile.Goal) (*GoalResult, error) {
+	if !goal.HasFailurePolicy() {
+		return e.executeGoalWithTracking(ctx, goal)
+	}
+
+	attempts := goal.Retry + 1
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if goal.Timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, goal.Timeout)
+		}
+
+		start := time.Now()
+		result, err := e.executeGoalWithTracking(attemptCtx, goal)
+		if err != nil && ctx.Err() == nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("goal %q timed out after %s: %w", goal.Name, goal.Timeout, err)
+		}
+		cancel()
+
+		e.logGoalAttempt(goal.Name, attempt, attempts, time.Since(start), err)
+		if err == nil {
+			return result, nil
+		}
+		lastErr = err
+
+		// Cancelled by the caller or out of money: retrying won't help
+		if ctx.Err() != nil || errors.Is(err, ErrBudgetExceeded) {
+			return nil, err
+		}
+		if attempt < attempts {
+			e.logger.Warn("goal attempt failed, retrying", map[string]any{
+				"goal":    goal.Name,
+				"attempt": attempt,
+				"error":   err.Error(),
+			})
+		}
+	}
+	return nil, lastErr
+}
+
+// runFallback runs a failed goal's ON FAILURE goal. The fallback's output
+// stands in for the failed goal so later goals that reference it can continue.
+func (e *Executor) runFallback(ctx context.Context, goal *agentfile.Goal, cause error, state *step.State) error {
+	e.logGoalFallback(goal.Name, goal.OnFailure, cause)
+	e.logger.Warn("goal failed, running fallback", map[string]any{
+		"goal":     goal.Name,
+		"fallback": goal.OnFailure,
+		"error":    cause.Error(),
+	})
+
+	if err := e.ExecuteGoal(ctx, goal.OnFailure, state); err != nil {
+		return fmt.Errorf("goal %q failed (%v); fallback %q also failed: %w", goal.Name, cause, goal.OnFailure, err)
+	}
+
+	output, _ := state.Output(goal.OnFailure)
+	state.SetOutput(goal.Name, output)
+	e.setOutput(goal.Name, output)
+	return nil
+}
@@ -0,0 +1,134 @@
+package executor
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/vinayprograms/agent/internal/dataflow"
+	"github.com/vinayprograms/agent/internal/session"
+	"github.com/vinayprograms/agentkit/security"
+)
+
+// flowBlock is a labeled piece of content the flow rules follow. The
+// content is kept here rather than looked up in the security verifier so
+// the rules apply whether or not a verifier is configured.
+type flowBlock struct {
+	labels  []string
+	content string
+	source  string
+}
+
+// labelBlock records the sensitivity labels of a new block: its own and
+// those of the blocks that tainted it. Returns the recorded labels.
+func (e *Executor) labelBlock(blockID, content, source string, labels, taintedBy []string) []string {
+	e.flowMu.Lock()
+	defer e.flowMu.Unlock()
+	sets := [][]string{labels}
+	for _, id := range taintedBy {
+		sets = append(sets, e.flowBlocks[id].labels)
+	}
+	labels = dataflow.Merge(sets...)
+	if len(labels) == 0 {
+		return nil
+	}
+	if e.flowBlocks == nil {
+		e.flowBlocks = make(map[string]flowBlock)
+	}
+	e.flowBlocks[blockID] = flowBlock{labels: labels, content: content, source: source}
+	return labels
+}
+
+// addFlowBlock records a labeled tool result when no security verifier
+// assigns block IDs.
+func (e *Executor) addFlowBlock(content, source string, labels, taintedBy []string) {
+	e.flowMu.Lock()
+	e.flowSeq++
+	id := fmt.Sprintf("f%04d", e.flowSeq)
+	e.flowMu.Unlock()
+	e.labelBlock(id, content, source, labels, taintedBy)
+}
+
+// blockLabels returns the sensitivity labels of a block.
+func (e *Executor) blockLabels(blockID string) []string {
+	e.flowMu.Lock()
+	defer e.flowMu.Unlock()
+	return e.flowBlocks[blockID].labels
+}
+
+// inheritedLabels returns the union of the labels of blockIDs.
+func (e *Executor) inheritedLabels(blockIDs []string) []string {
+	e.flowMu.Lock()
+	defer e.flowMu.Unlock()
+	var sets [][]string
+	for _, id := range blockIDs {
+		sets = append(sets, e.flowBlocks[id].labels)
+	}
+	return dataflow.Merge(sets...)
+}
+
+// flowLineage returns the lineage of a labeled block: from the verifier
+// when one is configured, otherwise the block itself.
+func (e *Executor) flowLineage(blockID string) []session.TaintNode {
+	if e.securityVerifier != nil {
+		if node := e.securityVerifier.GetTaintLineage(blockID); node != nil {
+			return e.labelTaintNodes(convertTaintLineage([]*security.TaintLineageNode{node}))
+		}
+		return nil
+	}
+	e.flowMu.Lock()
+	defer e.flowMu.Unlock()
+	b, ok := e.flowBlocks[blockID]
+	if !ok {
+		return nil
+	}
+	return []session.TaintNode{{BlockID: blockID, Source: b.source, Labels: b.labels}}
+}
+
+// checkFlow finds the labeled blocks whose content appears in a tool call's
+// arguments and checks their flow into the tool against the flow rules.
+// Returns the matching block IDs and, for a denied flow, the offending block
+// and the violation.
+func (e *Executor) checkFlow(toolName string, args map[string]any) ([]string, string, *dataflow.Violation) {
+	if e.flowPolicy == nil {
+		return nil, "", nil
+	}
+	e.flowMu.Lock()
+	ids := make([]string, 0, len(e.flowBlocks))
+	contents := make(map[string]string, len(e.flowBlocks))
+	for id, b := range e.flowBlocks {
+		ids = append(ids, id)
+		contents[id] = b.content
+	}
+	e.flowMu.Unlock()
+	if len(ids) == 0 {
+		return nil, "", nil
+	}
+	sort.Strings(ids)
+
+	exposure := e.flowPolicy.Exposure(toolName)
+	argsStr := fmt.Sprintf("%v", args)
+	var matched []string
+	var denied string
+	var violation *dataflow.Violation
+	for _, id := range ids {
+		if !dataflow.Contains(argsStr, contents[id]) {
+			continue
+		}
+		matched = append(matched, id)
+		if violation == nil {
+			if v := e.flowPolicy.Check(e.blockLabels(id), exposure); v != nil {
+				denied, violation = id, v
+			}
+		}
+	}
+	return matched, denied, violation
+}
+
+// labelTaintNodes fills in the sensitivity labels of a lineage tree.
+func (e *Executor) labelTaintNodes(nodes []session.TaintNode) []session.TaintNode {
+	for i := range nodes {
+		nodes[i].Labels = e.blockLabels(nodes[i].BlockID)
+		nodes[i].TaintedBy = e.labelTaintNodes(nodes[i].TaintedBy)
+	}
+	return nodes
+}
@@ -1,6 +1,7 @@
 package executor
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"regexp"
@@ -85,14 +86,16 @@ func extractJSON(content string) string {
 
 // interpolate replaces variable placeholders in text.
 // Warns about unresolved variables that might indicate Agentfile bugs.
-func (e *Executor) interpolate(text string) string {
+func (e *Executor) interpolate(ctx context.Context, text string) string {
+	inputs, outputs := e.varsSnapshot()
+
 	// Replace input variables
-	for name, value := range e.inputs {
+	for name, value := range inputs {
 		text = strings.ReplaceAll(text, "$"+name, value)
 	}
 
 	// Replace goal output variables
-	for name, value := range e.outputs {
+	for name, value := range outputs {
 		text = strings.ReplaceAll(text, "$"+name, value)
 	}
 
@@ -103,10 +106,10 @@ func (e *Executor) interpolate(text string) string {
 	re := regexp.MustCompile(`\$([a-zA-Z_][a-zA-Z0-9_]*)`)
 	text = re.ReplaceAllStringFunc(text, func(match string) string {
 		varName := strings.TrimPrefix(match, "$")
-		if val, ok := e.inputs[varName]; ok {
+		if val, ok := inputs[varName]; ok {
 			return val
 		}
-		if val, ok := e.outputs[varName]; ok {
+		if val, ok := outputs[varName]; ok {
 			return val
 		}
 		unresolved = append(unresolved, varName)
@@ -120,12 +123,34 @@ func (e *Executor) interpolate(text string) string {
 			"hint":      "ensure prior goals output these variables with -> syntax",
 		})
 		// Also log to session for replay visibility
-		e.logEvent(session.EventWarning, fmt.Sprintf("Unresolved variables: %v (ensure prior goals output these with -> syntax)", unresolved))
+		e.logEvent(ctx, session.EventWarning, fmt.Sprintf("Unresolved variables: %v (ensure prior goals output these with -> syntax)", unresolved))
 	}
 
 	return text
 }
 
+// varsSnapshot returns copies of the executor's inputs and goal outputs.
+func (e *Executor) varsSnapshot() (inputs, outputs map[string]string) {
+	e.varsMu.RLock()
+	defer e.varsMu.RUnlock()
+	inputs = make(map[string]string, len(e.inputs))
+	for k, v := range e.inputs {
+		inputs[k] = v
+	}
+	outputs = make(map[string]string, len(e.outputs))
+	for k, v := range e.outputs {
+		outputs[k] = v
+	}
+	return inputs, outputs
+}
+
+// setOutput records a goal output or structured output field.
+func (e *Executor) setOutput(name, value string) {
+	e.varsMu.Lock()
+	defer e.varsMu.Unlock()
+	e.outputs[name] = value
+}
+
 func (e *Executor) findGoal(name string) *agentfile.Goal {
 	for i := range e.workflow.Goals {
 		if e.workflow.Goals[i].Name == name {
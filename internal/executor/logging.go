@@ -6,27 +6,35 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/vinayprograms/agent/internal/dataflow"
 	"github.com/vinayprograms/agent/internal/session"
 	"github.com/vinayprograms/agentkit/llm"
 	"github.com/vinayprograms/agentkit/security"
 )
 
 // logEvent logs a generic event to the session.
-func (e *Executor) logEvent(eventType, content string) {
+func (e *Executor) logEvent(ctx context.Context, eventType, content string) {
 	if e.session == nil {
 		return
 	}
 	e.session.AddEvent(session.Event{
 		Type:      eventType,
-		Goal:      e.currentGoal,
+		Goal:      e.goalName(ctx),
 		Content:   content,
 		Timestamp: time.Now(),
 	})
 }
 
 // LogBashSecurity logs a bash security decision to the session.
-// This is called by the bash security checker callback.
-func (e *Executor) LogBashSecurity(command, step string, allowed bool, reason string, durationMs int64, inputTokens, outputTokens int) {
+// This is called by the bash tool's security callbacks. Executors sharing
+// the tool registry (see Config.SharedRegistry) are routed to through ctx,
+// like spawns, so the decision lands in the session of the executor that
+// ran the command.
+func (e *Executor) LogBashSecurity(ctx context.Context, command, step string, allowed bool, reason string, durationMs int64, inputTokens, outputTokens int) {
+	if caller, ok := ctx.Value(ctxKeyExecutor).(*Executor); ok && caller != e {
+		caller.LogBashSecurity(ctx, command, step, allowed, reason, durationMs, inputTokens, outputTokens)
+		return
+	}
 	if e.session == nil {
 		return
 	}
@@ -45,7 +53,7 @@ func (e *Executor) LogBashSecurity(command, step string, allowed bool, reason st
 
 	e.session.AddEvent(session.Event{
 		Type:       session.EventBashSecurity,
-		Goal:       e.currentGoal,
+		Goal:       e.goalName(ctx),
 		Content:    content,
 		DurationMs: durationMs,
 		Timestamp:  time.Now(),
@@ -85,7 +93,7 @@ func (e *Executor) logToolCall(ctx context.Context, name string, args map[string
 	e.session.AddEvent(session.Event{
 		Type:          session.EventToolCall,
 		CorrelationID: corrID,
-		Goal:          e.currentGoal,
+		Goal:          e.goalName(ctx),
 		Tool:          name,
 		Args:          args,
 		Agent:         agentID.Name,
@@ -127,7 +135,7 @@ func (e *Executor) logToolResult(ctx context.Context, name string, args map[stri
 	event := session.Event{
 		Type:          session.EventToolResult,
 		CorrelationID: corrID,
-		Goal:          e.currentGoal,
+		Goal:          e.goalName(ctx),
 		Tool:          name,
 		Args:          args,
 		Content:       content,
@@ -172,7 +180,7 @@ func (e *Executor) logLLMCall(ctx context.Context, eventType string, messages []
 
 	e.session.AddEvent(session.Event{
 		Type:       eventType,
-		Goal:       e.currentGoal,
+		Goal:       e.goalName(ctx),
 		Content:    content,
 		DurationMs: duration.Milliseconds(),
 		Agent:      agentID.Name,
@@ -187,7 +195,6 @@ func (e *Executor) logGoalStart(goalName string) {
 	if e.session == nil {
 		return
 	}
-	e.currentGoal = goalName
 	e.session.AddEvent(session.Event{
 		Type:      session.EventGoalStart,
 		Goal:      goalName,
@@ -221,6 +228,95 @@ func (e *Executor) logGoalEnd(goalName, output string) {
 	})
 }
 
+// logGoalSkipped logs a goal that was not run because its WHEN clause was false.
+func (e *Executor) logGoalSkipped(goalName, reason string) {
+	if e.session == nil {
+		return
+	}
+	e.session.AddEvent(session.Event{
+		Type:      session.EventGoalSkipped,
+		Goal:      goalName,
+		Content:   reason,
+		Timestamp: time.Now(),
+	})
+}
+
+// logGoalAttempt logs one attempt of a goal with a RETRY/TIMEOUT policy.
+func (e *Executor) logGoalAttempt(goalName string, attempt, attempts int, duration time.Duration, err error) {
+	if e.session == nil {
+		return
+	}
+	success := err == nil
+	event := session.Event{
+		Type:       session.EventGoalAttempt,
+		Goal:       goalName,
+		Content:    fmt.Sprintf("Attempt %d/%d", attempt, attempts),
+		Success:    &success,
+		DurationMs: duration.Milliseconds(),
+		Timestamp:  time.Now(),
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	e.session.AddEvent(event)
+}
+
+// logGoalFallback logs that a failed goal is handing over to its ON FAILURE goal.
+func (e *Executor) logGoalFallback(goalName, fallback string, cause error) {
+	if e.session == nil {
+		return
+	}
+	e.session.AddEvent(session.Event{
+		Type:      session.EventGoalFallback,
+		Goal:      goalName,
+		Content:   fmt.Sprintf("Running fallback goal: %s", fallback),
+		Error:     cause.Error(),
+		Timestamp: time.Now(),
+	})
+}
+
+// logBudgetExceeded logs that a tool-use loop ran out of budget.
+// role is empty for a goal's own loop and set for sub-agents.
+func (e *Executor) logBudgetExceeded(ctx context.Context, role, limit, reason string, b *loopBudget) {
+	if e.session == nil {
+		return
+	}
+	e.session.AddEvent(session.Event{
+		Type:      session.EventBudgetExceeded,
+		Goal:      e.goalName(ctx),
+		Content:   reason,
+		Timestamp: time.Now(),
+		Meta: &session.EventMeta{
+			SubAgentRole: role,
+			Limit:        limit,
+			Turns:        b.turns,
+			Tokens:       b.tokens,
+			CostUSD:      e.RunCost(),
+		},
+	})
+}
+
+// logContextCompacted logs that older tool results were compacted to keep
+// a loop within the model's context window.
+func (e *Executor) logContextCompacted(ctx context.Context, role string, before, after, window int, compacted []string) {
+	if e.session == nil {
+		return
+	}
+	e.session.AddEvent(session.Event{
+		Type:      session.EventContextCompacted,
+		Goal:      e.goalName(ctx),
+		Content:   fmt.Sprintf("Compacted %d tool result(s): ~%d -> ~%d tokens", len(compacted), before, after),
+		Timestamp: time.Now(),
+		Meta: &session.EventMeta{
+			SubAgentRole:  role,
+			TokensBefore:  before,
+			TokensAfter:   after,
+			ContextWindow: window,
+			Compacted:     compacted,
+		},
+	})
+}
+
 // logPhaseCommit logs the COMMIT phase of goal execution.
 func (e *Executor) logPhaseCommit(goal, commitment, confidence string, durationMs int64) {
 	if e.session == nil {
@@ -350,13 +446,35 @@ func (e *Executor) logCheckpoint(checkpointType, goal, step, checkpointID string
 	})
 }
 
+// logPlannedAction logs a tool call a dry run recorded instead of
+// executing. The arguments are in the preceding tool_call event.
+func (e *Executor) logPlannedAction(goal string, action PlannedAction) {
+	if e.session == nil {
+		return
+	}
+	meta := &session.EventMeta{Action: "simulate"}
+	if action.Denied != "" {
+		meta = &session.EventMeta{Action: "deny", Reason: action.Denied}
+	}
+	e.session.AddEvent(session.Event{
+		Type:      session.EventPlannedAction,
+		Tool:      action.Tool,
+		Goal:      goal,
+		AgentRole: action.Agent,
+		Content:   action.Summary,
+		Timestamp: time.Now(),
+		Meta:      meta,
+	})
+}
+
 // logSecurityBlock logs when a content block is registered for security tracking.
-func (e *Executor) logSecurityBlock(blockID, trust, blockType, source, xmlBlock string, entropy float64) {
-	e.logSecurityBlockWithTaint(blockID, trust, blockType, source, xmlBlock, entropy, nil)
+func (e *Executor) logSecurityBlock(ctx context.Context, blockID, trust, blockType, source, xmlBlock string, entropy float64) {
+	e.logSecurityBlockWithTaint(ctx, blockID, trust, blockType, source, xmlBlock, entropy, nil, nil)
 }
 
-// logSecurityBlockWithTaint logs a content block with taint lineage.
-func (e *Executor) logSecurityBlockWithTaint(blockID, trust, blockType, source, xmlBlock string, entropy float64, taintedBy []string) {
+// logSecurityBlockWithTaint logs a content block with taint lineage and
+// sensitivity labels.
+func (e *Executor) logSecurityBlockWithTaint(ctx context.Context, blockID, trust, blockType, source, xmlBlock string, entropy float64, taintedBy, labels []string) {
 	if e.session == nil {
 		return
 	}
@@ -369,7 +487,7 @@ func (e *Executor) logSecurityBlockWithTaint(blockID, trust, blockType, source,
 
 	e.session.AddEvent(session.Event{
 		Type:      session.EventSecurityBlock,
-		Goal:      e.currentGoal,
+		Goal:      e.goalName(ctx),
 		Content:   content,
 		Timestamp: time.Now(),
 		Meta: &session.EventMeta{
@@ -378,19 +496,20 @@ func (e *Executor) logSecurityBlockWithTaint(blockID, trust, blockType, source,
 			BlockType: blockType,
 			Source:    source,
 			Entropy:   entropy,
+			Labels:    labels,
 		},
 	})
 }
 
 // logSecurityStatic logs a static security check result.
-func (e *Executor) logSecurityStatic(tool, blockID string, relatedBlockIDs []string, pass bool, flags []string, skipReason string, taintLineage []*security.TaintLineageNode) {
+func (e *Executor) logSecurityStatic(ctx context.Context, tool, blockID string, relatedBlockIDs []string, pass bool, flags []string, skipReason string, taintLineage []*security.TaintLineageNode) {
 	if e.session == nil {
 		return
 	}
 	e.session.AddEvent(session.Event{
 		Type:      session.EventSecurityStatic,
 		Tool:      tool,
-		Goal:      e.currentGoal,
+		Goal:      e.goalName(ctx),
 		Timestamp: time.Now(),
 		Meta: &session.EventMeta{
 			CheckName:     "static",
@@ -419,9 +538,11 @@ func convertTaintLineage(nodes []*security.TaintLineageNode) []session.TaintNode
 // convertTaintNode converts a single taint node.
 func convertTaintNode(n *security.TaintLineageNode) session.TaintNode {
 	node := session.TaintNode{
-		BlockID: n.BlockID,
-		Trust:   string(n.Trust),
-		Source:  n.Source,
+		BlockID:  n.BlockID,
+		Trust:    string(n.Trust),
+		Source:   n.Source,
+		EventSeq: n.EventSeq,
+		Depth:    n.Depth,
 	}
 	if len(n.TaintedBy) > 0 {
 		node.TaintedBy = make([]session.TaintNode, len(n.TaintedBy))
@@ -433,12 +554,12 @@ func convertTaintNode(n *security.TaintLineageNode) session.TaintNode {
 }
 
 // logSecurityTriage logs LLM triage check to session.
-func (e *Executor) logSecurityTriage(tool, blockID string, suspicious bool, model string, latencyMs int64, inputTokens, outputTokens int, skipReason string) {
-	e.logSecurityTriageWithDetails(tool, blockID, suspicious, model, latencyMs, inputTokens, outputTokens, "", "", "", skipReason)
+func (e *Executor) logSecurityTriage(ctx context.Context, tool, blockID string, suspicious bool, model string, latencyMs int64, inputTokens, outputTokens int, skipReason string) {
+	e.logSecurityTriageWithDetails(ctx, tool, blockID, suspicious, model, latencyMs, inputTokens, outputTokens, "", "", "", skipReason)
 }
 
 // logSecurityTriageWithDetails logs LLM triage with full details.
-func (e *Executor) logSecurityTriageWithDetails(tool, blockID string, suspicious bool, model string, latencyMs int64, inputTokens, outputTokens int, prompt, response, thinking, skipReason string) {
+func (e *Executor) logSecurityTriageWithDetails(ctx context.Context, tool, blockID string, suspicious bool, model string, latencyMs int64, inputTokens, outputTokens int, prompt, response, thinking, skipReason string) {
 	if e.session == nil {
 		return
 	}
@@ -464,7 +585,7 @@ func (e *Executor) logSecurityTriageWithDetails(tool, blockID string, suspicious
 	e.session.AddEvent(session.Event{
 		Type:       session.EventSecurityTriage,
 		Tool:       tool,
-		Goal:       e.currentGoal,
+		Goal:       e.goalName(ctx),
 		DurationMs: latencyMs,
 		Timestamp:  time.Now(),
 		Meta:       meta,
@@ -472,12 +593,12 @@ func (e *Executor) logSecurityTriageWithDetails(tool, blockID string, suspicious
 }
 
 // logSecuritySupervisor logs supervisor review to session.
-func (e *Executor) logSecuritySupervisor(tool, blockID, verdict, reason, model string, latencyMs int64, inputTokens, outputTokens int) {
-	e.logSecuritySupervisorWithDetails(tool, blockID, verdict, reason, model, latencyMs, inputTokens, outputTokens, "", "", "")
+func (e *Executor) logSecuritySupervisor(ctx context.Context, tool, blockID, verdict, reason, model string, latencyMs int64, inputTokens, outputTokens int) {
+	e.logSecuritySupervisorWithDetails(ctx, tool, blockID, verdict, reason, model, latencyMs, inputTokens, outputTokens, "", "", "")
 }
 
 // logSecuritySupervisorWithDetails logs supervisor review with full LLM details.
-func (e *Executor) logSecuritySupervisorWithDetails(tool, blockID, verdict, reason, model string, latencyMs int64, inputTokens, outputTokens int, prompt, response, thinking string) {
+func (e *Executor) logSecuritySupervisorWithDetails(ctx context.Context, tool, blockID, verdict, reason, model string, latencyMs int64, inputTokens, outputTokens int, prompt, response, thinking string) {
 	if e.session == nil {
 		return
 	}
@@ -504,7 +625,7 @@ func (e *Executor) logSecuritySupervisorWithDetails(tool, blockID, verdict, reas
 	e.session.AddEvent(session.Event{
 		Type:       session.EventSecuritySupervisor,
 		Tool:       tool,
-		Goal:       e.currentGoal,
+		Goal:       e.goalName(ctx),
 		DurationMs: latencyMs,
 		Timestamp:  time.Now(),
 		Meta:       meta,
@@ -512,14 +633,14 @@ func (e *Executor) logSecuritySupervisorWithDetails(tool, blockID, verdict, reas
 }
 
 // logSecurityDecision logs final security decision to session.
-func (e *Executor) logSecurityDecision(tool, action, reason, trust, checkPath string) {
+func (e *Executor) logSecurityDecision(ctx context.Context, tool, action, reason, trust, checkPath string) {
 	if e.session == nil {
 		return
 	}
 	e.session.AddEvent(session.Event{
 		Type:      session.EventSecurityDecision,
 		Tool:      tool,
-		Goal:      e.currentGoal,
+		Goal:      e.goalName(ctx),
 		Timestamp: time.Now(),
 		Meta: &session.EventMeta{
 			Action:    action,
@@ -530,8 +651,33 @@ func (e *Executor) logSecurityDecision(tool, action, reason, trust, checkPath st
 	})
 }
 
+// logFlowDenied logs a tool call denied by the data flow rules, with the
+// lineage of the offending block for replay.
+func (e *Executor) logFlowDenied(ctx context.Context, tool string, v *dataflow.Violation, blockID string, relatedBlockIDs []string) {
+	if e.session == nil {
+		return
+	}
+	lineage := e.flowLineage(blockID)
+	e.session.AddEvent(session.Event{
+		Type:      session.EventFlowDenied,
+		Tool:      tool,
+		Goal:      e.goalName(ctx),
+		Content:   v.String(),
+		Timestamp: time.Now(),
+		Meta: &session.EventMeta{
+			Action:        "deny",
+			BlockID:       blockID,
+			RelatedBlocks: relatedBlockIDs,
+			TaintLineage:  lineage,
+			Labels:        e.blockLabels(blockID),
+			Exposure:      v.Exposure,
+			FlowRule:      v.Rule.String(),
+		},
+	})
+}
+
 // logSubAgentStart logs the start of a sub-agent execution.
-func (e *Executor) logSubAgentStart(name, role, model, task string, inputs map[string]string) {
+func (e *Executor) logSubAgentStart(ctx context.Context, name, role, model, task string, inputs map[string]string) {
 	if e.session == nil {
 		return
 	}
@@ -550,7 +696,7 @@ func (e *Executor) logSubAgentStart(name, role, model, task string, inputs map[s
 
 	e.session.AddEvent(session.Event{
 		Type:      session.EventSubAgentStart,
-		Goal:      e.currentGoal,
+		Goal:      e.goalName(ctx),
 		Agent:     name,
 		AgentRole: role,
 		Timestamp: time.Now(),
@@ -559,7 +705,7 @@ func (e *Executor) logSubAgentStart(name, role, model, task string, inputs map[s
 }
 
 // logSubAgentEnd logs the end of a sub-agent execution.
-func (e *Executor) logSubAgentEnd(name, role, model, output string, durationMs int64, err error) {
+func (e *Executor) logSubAgentEnd(ctx context.Context, name, role, model, output string, durationMs int64, err error) {
 	if e.session == nil {
 		return
 	}
@@ -583,7 +729,7 @@ func (e *Executor) logSubAgentEnd(name, role, model, output string, durationMs i
 
 	e.session.AddEvent(session.Event{
 		Type:       session.EventSubAgentEnd,
-		Goal:       e.currentGoal,
+		Goal:       e.goalName(ctx),
 		Agent:      name,
 		AgentRole:  role,
 		DurationMs: durationMs,
@@ -0,0 +1,351 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vinayprograms/agent/internal/agentfile"
+	"github.com/vinayprograms/agent/internal/session"
+	"github.com/vinayprograms/agentkit/llm"
+)
+
+// maxOutputRepairs is how many times the model may fix structured output
+// that does not match the goal's declared fields before the goal fails.
+const maxOutputRepairs = 2
+
+// buildGoalOutputInstruction tells the model what structured output a goal
+// expects, including declared types and the SCHEMA if there is one.
+func buildGoalOutputInstruction(goal *agentfile.Goal) string {
+	if !goal.HasTypedOutputs() {
+		return buildStructuredOutputInstruction(goal.Outputs)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Return your response as a JSON object with the following fields:\n")
+	for _, name := range goal.Outputs {
+		fmt.Fprintf(&sb, "- %s: %s\n", name, describeOutputType(goal.FieldType(name)))
+	}
+	if goal.Schema != nil {
+		schema, _ := json.MarshalIndent(goal.Schema, "", "  ")
+		fmt.Fprintf(&sb, "\nThe object must validate against this JSON Schema:\n%s\n", schema)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// describeOutputType renders a field type for the model.
+func describeOutputType(t agentfile.OutputType) string {
+	switch t.Kind {
+	case agentfile.OutputList:
+		return "JSON array"
+	case agentfile.OutputObject:
+		return "JSON object"
+	case agentfile.OutputBool:
+		return "true or false"
+	case agentfile.OutputEnum:
+		return "one of " + strings.Join(t.Enum, ", ")
+	}
+	return t.Kind
+}
+
+// validateStructuredOutput parses a goal's output against its declared
+// fields. It returns the fields rendered as strings (non-string values as
+// JSON), the decoded values, and a list of problems if the output does not
+// match. Without a SCHEMA every declared field is required; with one, the
+// schema's "required" list decides.
+func validateStructuredOutput(goal *agentfile.Goal, content string) (map[string]string, map[string]any, []string) {
+	jsonStr := extractJSON(content)
+	if jsonStr == "" {
+		return nil, nil, []string{"response does not contain a JSON object"}
+	}
+	var raw map[string]any
+	if err := json.Unmarshal([]byte(jsonStr), &raw); err != nil {
+		return nil, nil, []string{fmt.Sprintf("invalid JSON: %v", err)}
+	}
+
+	var problems []string
+	fields := make(map[string]string)
+	values := make(map[string]any)
+	for _, name := range goal.Outputs {
+		val, ok := raw[name]
+		if !ok {
+			if goal.Schema == nil {
+				problems = append(problems, fmt.Sprintf("missing field %q", name))
+			}
+			continue
+		}
+		if t, typed := goal.OutputTypes[name]; typed {
+			if problem := checkOutputType(name, val, t); problem != "" {
+				problems = append(problems, problem)
+				continue
+			}
+		}
+		fields[name] = renderOutputValue(val)
+		values[name] = val
+	}
+	if goal.Schema != nil {
+		problems = append(problems, validateSchema("$", raw, goal.Schema)...)
+	}
+	return fields, values, problems
+}
+
+// checkOutputType checks a decoded JSON value against a declared field type.
+// Returns a description of the mismatch, or "".
+func checkOutputType(name string, val any, t agentfile.OutputType) string {
+	ok := true
+	switch t.Kind {
+	case agentfile.OutputString:
+		_, ok = val.(string)
+	case agentfile.OutputNumber:
+		_, ok = val.(float64)
+	case agentfile.OutputInteger:
+		n, isNum := val.(float64)
+		ok = isNum && n == math.Trunc(n)
+	case agentfile.OutputBool:
+		_, ok = val.(bool)
+	case agentfile.OutputList:
+		_, ok = val.([]any)
+	case agentfile.OutputObject:
+		_, ok = val.(map[string]any)
+	case agentfile.OutputEnum:
+		ok = containsValue(t.Enum, val)
+	}
+	if ok {
+		return ""
+	}
+	return fmt.Sprintf("field %q must be %s, got %s", name, describeOutputType(t), renderOutputValue(val))
+}
+
+// containsValue reports whether a scalar JSON value is one of the allowed values.
+func containsValue(allowed []string, val any) bool {
+	switch val.(type) {
+	case string, float64, bool:
+	default:
+		return false
+	}
+	s := renderOutputValue(val)
+	for _, a := range allowed {
+		if a == s {
+			return true
+		}
+	}
+	return false
+}
+
+// renderOutputValue renders a field for string outputs and interpolation:
+// strings as-is, everything else as JSON.
+func renderOutputValue(val any) string {
+	if s, ok := val.(string); ok {
+		return s
+	}
+	data, _ := json.Marshal(val)
+	return string(data)
+}
+
+// validateSchema checks a value against the subset of JSON Schema that
+// describes output shapes: type, enum, properties, required and items.
+func validateSchema(path string, val any, schema map[string]any) []string {
+	if t, ok := schema["type"]; ok && !matchesSchemaType(val, t) {
+		return []string{fmt.Sprintf("%s must be of type %v, got %s", path, t, renderOutputValue(val))}
+	}
+	if values, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, v := range values {
+			if reflect.DeepEqual(v, val) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return []string{fmt.Sprintf("%s must be one of %s, got %s", path, renderOutputValue(values), renderOutputValue(val))}
+		}
+	}
+
+	var problems []string
+	switch v := val.(type) {
+	case map[string]any:
+		if required, ok := schema["required"].([]any); ok {
+			for _, r := range required {
+				name, _ := r.(string)
+				if _, present := v[name]; !present {
+					problems = append(problems, fmt.Sprintf("%s is missing required field %q", path, name))
+				}
+			}
+		}
+		props, _ := schema["properties"].(map[string]any)
+		names := make([]string, 0, len(props))
+		for name := range props {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			sub, _ := props[name].(map[string]any)
+			if fieldVal, present := v[name]; present && sub != nil {
+				problems = append(problems, validateSchema(schemaPath(path, name), fieldVal, sub)...)
+			}
+		}
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				problems = append(problems, validateSchema(fmt.Sprintf("%s[%d]", path, i), item, items)...)
+			}
+		}
+	}
+	return problems
+}
+
+// schemaPath extends a problem path with a property name.
+func schemaPath(path, name string) string {
+	if path == "$" {
+		return name
+	}
+	return path + "." + name
+}
+
+// matchesSchemaType reports whether val has the JSON Schema type t, which
+// may be a single type name or a list of them.
+func matchesSchemaType(val any, t any) bool {
+	if list, ok := t.([]any); ok {
+		for _, item := range list {
+			if matchesSchemaType(val, item) {
+				return true
+			}
+		}
+		return false
+	}
+	switch t {
+	case "string":
+		_, ok := val.(string)
+		return ok
+	case "number":
+		_, ok := val.(float64)
+		return ok
+	case "integer":
+		n, ok := val.(float64)
+		return ok && n == math.Trunc(n)
+	case "boolean":
+		_, ok := val.(bool)
+		return ok
+	case "array":
+		_, ok := val.([]any)
+		return ok
+	case "object":
+		_, ok := val.(map[string]any)
+		return ok
+	case "null":
+		return val == nil
+	}
+	return true // unknown types are not enforced
+}
+
+// storeStructuredOutput parses the fields declared with -> from a goal's
+// output and stores them as variables for later goals. Output that does not
+// match gets repair turns; if it still does not match, goals with declared
+// types or a SCHEMA fail, while untyped goals fall back to lenient parsing.
+// Returns the (possibly repaired) output and the fields.
+func (e *Executor) storeStructuredOutput(ctx context.Context, goal *agentfile.Goal, output string) (string, map[string]string, error) {
+	if len(goal.Outputs) == 0 {
+		return output, nil, nil
+	}
+
+	fields, values, problems := validateStructuredOutput(goal, output)
+	for attempt := 1; len(problems) > 0 && attempt <= maxOutputRepairs; attempt++ {
+		e.logger.Warn("structured output does not match", map[string]any{
+			"goal":     goal.Name,
+			"problems": problems,
+			"repair":   attempt,
+		})
+		e.logEvent(ctx, session.EventSystem, fmt.Sprintf("Output of goal %q does not match its declared fields (repair %d/%d): %s",
+			goal.Name, attempt, maxOutputRepairs, strings.Join(problems, "; ")))
+		repaired, err := e.repairOutput(ctx, goal, output, problems)
+		if err != nil {
+			e.logger.Warn("output repair failed", map[string]any{"goal": goal.Name, "error": err.Error()})
+			break
+		}
+		output = repaired
+		fields, values, problems = validateStructuredOutput(goal, output)
+	}
+
+	if len(problems) > 0 {
+		if goal.HasTypedOutputs() {
+			return "", nil, fmt.Errorf("goal %q output does not match its declared types: %s", goal.Name, strings.Join(problems, "; "))
+		}
+		e.logEvent(ctx, session.EventWarning, fmt.Sprintf("Goal %q output does not match its declared fields, storing it as text: %s",
+			goal.Name, strings.Join(problems, "; ")))
+		fields, _ = parseStructuredOutput(output, goal.Outputs)
+		values = nil
+	}
+
+	for field, value := range fields {
+		e.setOutput(field, value)
+	}
+	e.setValues(values)
+	return output, fields, nil
+}
+
+// repairOutput asks the model to correct output that failed validation.
+func (e *Executor) repairOutput(ctx context.Context, goal *agentfile.Goal, output string, problems []string) (string, error) {
+	prompt := fmt.Sprintf(`Your response to goal %q does not match the required output format.
+
+PROBLEMS:
+- %s
+
+REQUIRED FORMAT:
+%s
+
+YOUR RESPONSE:
+%s
+
+Respond with only the corrected JSON object, keeping the content of your response.`,
+		goal.Name, strings.Join(problems, "\n- "), buildGoalOutputInstruction(goal), output)
+
+	messages := []llm.Message{
+		{Role: "system", Content: "You correct structured output so it matches a required format."},
+		{Role: "user", Content: prompt},
+	}
+	e.logEvent(ctx, session.EventUser, prompt)
+
+	start := time.Now()
+	resp, err := e.provider.Chat(ctx, llm.ChatRequest{Messages: messages})
+	duration := time.Since(start)
+	if err != nil {
+		return "", fmt.Errorf("LLM error: %w", err)
+	}
+	e.logLLMCall(ctx, session.EventAssistant, messages, resp, duration)
+	e.recordLLMMetrics(resp, duration)
+	return resp.Content, nil
+}
+
+// setValues records decoded structured output values for Result.Values.
+func (e *Executor) setValues(values map[string]any) {
+	if len(values) == 0 {
+		return
+	}
+	e.varsMu.Lock()
+	defer e.varsMu.Unlock()
+	if e.values == nil {
+		e.values = make(map[string]any)
+	}
+	for k, v := range values {
+		e.values[k] = v
+	}
+}
+
+// valuesSnapshot returns a copy of the decoded structured output values.
+func (e *Executor) valuesSnapshot() map[string]any {
+	e.varsMu.RLock()
+	defer e.varsMu.RUnlock()
+	if len(e.values) == 0 {
+		return nil
+	}
+	values := make(map[string]any, len(e.values))
+	for k, v := range e.values {
+		values[k] = v
+	}
+	return values
+}
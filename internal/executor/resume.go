@@ -0,0 +1,93 @@
+package executor
+
+import (
+	"context"
+	"sync"
+
+	"github.com/vinayprograms/agent/internal/hooks"
+	"github.com/vinayprograms/agent/internal/session"
+	"github.com/vinayprograms/agent/internal/step"
+)
+
+// Resume carries the progress of an interrupted run so it can continue
+// where it stopped. Completed goals are skipped and their outputs restored.
+type Resume struct {
+	mu        sync.Mutex
+	completed map[string]int    // goal -> goal_end events not yet replayed
+	outputs   map[string]string // goal outputs and structured fields
+}
+
+// ResumeFromSession rebuilds run progress from a session: goals with a
+// goal_end event are complete, and their outputs come from the session's
+// recorded outputs (goal_end content is only kept in debug mode).
+func ResumeFromSession(sess *session.Session) *Resume {
+	r := &Resume{
+		completed: make(map[string]int),
+		outputs:   make(map[string]string),
+	}
+	for _, evt := range sess.Events {
+		if evt.Type == session.EventGoalEnd && evt.Goal != "" {
+			r.completed[evt.Goal]++
+		}
+	}
+	for k, v := range sess.Outputs {
+		r.outputs[k] = v
+	}
+	return r
+}
+
+// Completed returns the number of distinct goals that will be skipped.
+func (r *Resume) Completed() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.completed)
+}
+
+// take reports whether goal completed in the earlier run, consuming one
+// completion so a goal repeated by a LOOP only skips the runs it finished.
+func (r *Resume) take(goal string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := r.completed[goal]
+	if n == 0 {
+		return false
+	}
+	if n == 1 {
+		delete(r.completed, goal)
+	} else {
+		r.completed[goal] = n - 1
+	}
+	return true
+}
+
+// seed copies the recorded outputs into a fresh run state.
+func (r *Resume) seed(state *step.State) {
+	for k, v := range r.outputs {
+		state.SetOutput(k, v)
+	}
+}
+
+// resumeGoal skips a goal that completed before the run was interrupted.
+// Returns false if the goal still has to run.
+func (e *Executor) resumeGoal(ctx context.Context, goalName string) bool {
+	if e.resume == nil || !e.resume.take(goalName) {
+		return false
+	}
+	e.setOutput(goalName, e.resume.outputs[goalName])
+	e.logger.Info("skipping goal completed before resume", map[string]any{"goal": goalName})
+	e.logEvent(ctx, session.EventSystem, "Resumed: goal "+goalName+" already completed")
+	e.hooks.Fire(ctx, hooks.GoalSkipped, map[string]any{"name": goalName, "reason": "completed before resume"})
+	return true
+}
+
+// recordOutputs saves a goal's output and structured fields in the session,
+// so the run can be resumed after a crash.
+func (e *Executor) recordOutputs(goalName, output string, fields map[string]string) {
+	if e.session == nil {
+		return
+	}
+	e.session.SetOutput(goalName, output)
+	for field, value := range fields {
+		e.session.SetOutput(field, value)
+	}
+}
@@ -17,7 +17,8 @@ import (
 
 func (e *Executor) buildPriorGoalsContext() []GoalOutput {
 	var priorGoals []GoalOutput
-	for goalName, output := range e.outputs {
+	_, outputs := e.varsSnapshot()
+	for goalName, output := range outputs {
 		priorGoals = append(priorGoals, GoalOutput{
 			ID:     goalName,
 			Output: output,
@@ -50,20 +51,20 @@ func (e *Executor) spawnDynamicAgent(ctx context.Context, role, task string, out
 	if len(outputs) > 0 {
 		taskDescription += "\n\n" + buildStructuredOutputInstruction(outputs)
 	}
-	userPrompt := BuildTaskContext(role, e.currentGoal, taskDescription)
+	userPrompt := BuildTaskContext(role, e.goalName(ctx), taskDescription)
 
 	// Log the spawn
 	e.hooks.Fire(ctx, hooks.SubAgentStart, map[string]any{"name": role, "input": map[string]string{"task": task}})
 
 	// Sub-agents inherit supervision from their parent goal
-	supervised := e.currentGoalSupervised
+	supervised := e.goalSupervised(ctx)
 
 	// Run through the supervision pipeline
 	pipelineResult, err := e.getPipeline().Run(
 		ctx,
 		supervision.PipelineRequest{
 			StepID:        fmt.Sprintf("subagent:%s", role),
-			GoalName:      e.goalOutcome(e.currentGoal),
+			GoalName:      e.goalOutcome(ctx, e.goalName(ctx)),
 			Supervised:    supervised,
 			HumanRequired: false, // Dynamic sub-agents don't require human approval
 		},
@@ -94,7 +95,8 @@ func (e *Executor) spawnDynamicAgent(ctx context.Context, role, task string, out
 			"role":       role,
 			"correction": pipelineResult.Correction,
 		})
-		correctedTask := BuildTaskContextWithCorrection(role, e.currentGoal, taskDescription, pipelineResult.Correction)
+		e.restoreWorkspace(ctx, fmt.Sprintf("subagent:%s", role), pipelineResult.Snapshot)
+		correctedTask := BuildTaskContextWithCorrection(role, e.goalName(ctx), taskDescription, pipelineResult.Correction)
 		output, _, err = e.subAgentExecutePhaseWithProvider(ctx, e.provider, role, systemPrompt, correctedTask)
 		if err != nil {
 			return "", err
@@ -145,20 +147,17 @@ func (e *Executor) spawnAgentWithPrompt(ctx context.Context, role, systemPrompt,
 	}
 	var userPrompt string
 	if len(priorGoals) > 0 {
-		userPrompt = BuildTaskContextWithPriorGoals(role, e.currentGoal, taskDescription, priorGoals)
+		userPrompt = BuildTaskContextWithPriorGoals(role, e.goalName(ctx), taskDescription, priorGoals)
 	} else {
-		userPrompt = BuildTaskContext(role, e.currentGoal, taskDescription)
+		userPrompt = BuildTaskContext(role, e.goalName(ctx), taskDescription)
 	}
 
 	// Log the spawn
-	inputs := make(map[string]string)
-	for k, v := range e.inputs {
+	inputs, goalOutputs := e.varsSnapshot()
+	for k, v := range goalOutputs {
 		inputs[k] = v
 	}
-	for k, v := range e.outputs {
-		inputs[k] = v
-	}
-	e.logSubAgentStart(role, role, profile, task, inputs)
+	e.logSubAgentStart(ctx, role, role, profile, task, inputs)
 
 	e.hooks.Fire(ctx, hooks.SubAgentStart, map[string]any{"name": role, "input": map[string]string{"task": task}})
 
@@ -175,14 +174,14 @@ func (e *Executor) spawnAgentWithPrompt(ctx context.Context, role, systemPrompt,
 	}()
 
 	// Agent is supervised if: agent has SUPERVISED flag OR parent goal is supervised
-	supervised := agentSupervised || e.currentGoalSupervised
+	supervised := agentSupervised || e.goalSupervised(ctx)
 
 	// Run through the supervision pipeline
 	pipelineResult, err := e.getPipeline().Run(
 		ctx,
 		supervision.PipelineRequest{
 			StepID:        fmt.Sprintf("subagent:%s", role),
-			GoalName:      e.goalOutcome(e.currentGoal),
+			GoalName:      e.goalOutcome(ctx, e.goalName(ctx)),
 			Supervised:    supervised,
 			HumanRequired: false,
 		},
@@ -209,7 +208,8 @@ func (e *Executor) spawnAgentWithPrompt(ctx context.Context, role, systemPrompt,
 	// Handle supervision verdict
 	switch pipelineResult.Verdict {
 	case supervision.VerdictReorient:
-		correctedTask := BuildTaskContextWithCorrection(role, e.currentGoal, taskDescription, pipelineResult.Correction)
+		e.restoreWorkspace(ctx, fmt.Sprintf("subagent:%s", role), pipelineResult.Snapshot)
+		correctedTask := BuildTaskContextWithCorrection(role, e.goalName(ctx), taskDescription, pipelineResult.Correction)
 		output, _, err = e.subAgentExecutePhaseWithProvider(ctx, provider, role, systemPrompt, correctedTask)
 		if err != nil {
 			return "", err
@@ -261,24 +261,30 @@ func (e *Executor) subAgentExecutePhaseWithProvider(ctx context.Context, provide
 
 	toolsUsedMap := make(map[string]bool)
 
-	// Sub-agent turn limit to prevent infinite loops.
-	const maxSubAgentTurns = 30
-	turn := 0
+	// Sub-agents get the budget of the goal spawning them; without a turn
+	// limit they still stop after defaultSubAgentTurns to prevent infinite loops.
+	budget := e.goalBudget(e.findGoal(e.goalName(ctx)))
+	if budget.maxTurns == 0 {
+		budget.maxTurns = defaultSubAgentTurns
+	}
+	window := e.newContextManager(role)
 
 	// Execute sub-agent loop
 	for {
-		turn++
-		if turn > maxSubAgentTurns {
-			e.logger.Warn("sub-agent hit turn limit", map[string]any{
-				"role":  role,
-				"turns": maxSubAgentTurns,
-			})
-			e.logger.PhaseComplete("EXECUTE", role, stepID, time.Since(start), "turn_limit")
+		if limit, reason := e.budgetExceeded(budget); limit != "" {
+			output, err := e.wrapUpOverBudget(ctx, provider, role, budget, limit, reason, messages, toolDefs)
+			if err != nil {
+				e.logger.PhaseComplete("EXECUTE", role, stepID, time.Since(start), "error")
+				return "", nil, fmt.Errorf("sub-agent %w", err)
+			}
 			for tool := range toolsUsedMap {
 				toolsUsed = append(toolsUsed, tool)
 			}
-			return "Sub-agent reached maximum turn limit. Returning partial results.", toolsUsed, nil
+			e.logger.PhaseComplete("EXECUTE", role, stepID, time.Since(start), "budget_exceeded")
+			return output, toolsUsed, nil
 		}
+
+		window.fit(ctx, messages)
 		llmStart := time.Now()
 		resp, err := provider.Chat(ctx, llm.ChatRequest{
 			Messages: messages,
@@ -292,6 +298,8 @@ func (e *Executor) subAgentExecutePhaseWithProvider(ctx context.Context, provide
 
 		// Log full LLM interaction (for -vv replay)
 		e.logLLMCall(ctx, session.EventAssistant, messages, resp, llmDuration)
+		e.chargeBudget(budget, resp)
+		window.observe(messages, resp)
 
 		// No tool calls = sub-agent complete
 		if len(resp.ToolCalls) == 0 {
@@ -11,6 +11,7 @@ import (
 
 	"github.com/vinayprograms/agent/internal/hooks"
 	"github.com/vinayprograms/agentkit/llm"
+	"github.com/vinayprograms/agentkit/security"
 )
 
 // concurrencyLimit returns the maximum number of concurrent tool executions.
@@ -90,9 +91,9 @@ func (e *Executor) executeTool(ctx context.Context, tc llm.ToolCallResponse) (an
 		duration := time.Since(start)
 		e.logToolResult(ctx, tc.Name, tc.Args, corrID, result, err, duration)
 
-		// MCP tools return external content - register as untrusted
+		// MCP tools return external content - untrusted unless declared otherwise
 		if err == nil && result != nil {
-			e.registerUntrustedResult(ctx, tc.Name, result, relatedBlocks)
+			e.registerToolResult(ctx, tc.Name, result, relatedBlocks)
 		}
 		return result, err
 	}
@@ -121,15 +122,21 @@ func (e *Executor) executeTool(ctx context.Context, tc llm.ToolCallResponse) (an
 		return nil, err
 	}
 
-	result, err := tool.Execute(ctx, tc.Args)
+	var result any
+	if e.simulates(tc) {
+		result, err = e.simulateTool(ctx, tc)
+	} else {
+		result, err = tool.Execute(ctx, tc.Args)
+	}
 	duration := time.Since(start)
 
 	// Log the tool result
 	e.logToolResult(ctx, tc.Name, tc.Args, corrID, result, err, duration)
 
-	// Register external tool results as untrusted content
-	if err == nil && result != nil && isExternalTool(tc.Name) {
-		e.registerUntrustedResult(ctx, tc.Name, result, relatedBlocks)
+	// Register results per the tool's trust, and labeled results so the
+	// flow rules can follow them
+	if err == nil && result != nil {
+		e.registerToolResult(ctx, tc.Name, result, relatedBlocks)
 	}
 
 	if err != nil {
@@ -141,20 +148,23 @@ func (e *Executor) executeTool(ctx context.Context, tc llm.ToolCallResponse) (an
 	return result, err
 }
 
-// isExternalTool returns true if the tool fetches external/untrusted content.
-func isExternalTool(name string) bool {
-	externalTools := map[string]bool{
-		"web_fetch":  true,
-		"web_search": true,
-	}
-	return externalTools[name]
-}
-
-// registerUntrustedResult registers tool result as untrusted content block.
-func (e *Executor) registerUntrustedResult(ctx context.Context, toolName string, result any, relatedBlocks []string) {
-	if e.securityVerifier == nil {
+// registerToolResult registers a tool result as a content block with the
+// trust declared for the tool (see toolmeta). Results of trusted tools are
+// only registered, as vetted, when they carry sensitivity labels, from the
+// flow policy or inherited from the blocks used in the call. Without a
+// verifier only labeled results are kept, for the flow rules.
+func (e *Executor) registerToolResult(ctx context.Context, toolName string, result any, relatedBlocks []string) {
+	trust := security.TrustLevel(e.toolMeta.Lookup(toolName).Trust)
+	labels := e.flowPolicy.Labels(toolName)
+	if e.securityVerifier == nil && len(labels) == 0 && len(e.inheritedLabels(relatedBlocks)) == 0 {
 		return
 	}
+	if trust == security.TrustTrusted {
+		if len(labels) == 0 && len(e.inheritedLabels(relatedBlocks)) == 0 {
+			return
+		}
+		trust = security.TrustVetted
+	}
 
 	// Convert result to string for block registration
 	var content string
@@ -177,9 +187,13 @@ func (e *Executor) registerUntrustedResult(ctx context.Context, toolName string,
 		return
 	}
 
-	// Register as untrusted content block with taint from influencing blocks
+	// Register with taint from influencing blocks
 	source := fmt.Sprintf("tool:%s", toolName)
-	e.AddUntrustedContentWithTaint(ctx, content, source, relatedBlocks)
+	if e.securityVerifier == nil {
+		e.addFlowBlock(content, source, labels, relatedBlocks)
+		return
+	}
+	e.addContentBlock(ctx, trust, content, source, relatedBlocks, labels)
 }
 
 // toolResult holds the result of a parallel tool execution.
@@ -189,34 +203,10 @@ type toolResult struct {
 	content string
 }
 
-// asyncTools are fire-and-forget tools that don't need to block the LLM turn.
-// They execute in background and always return "OK" immediately.
-var asyncTools = map[string]bool{
-	"remember":  true, // Writes to memory - result not needed for turn
-	"scratchpad_write": true, // Writes to scratchpad - result not needed for turn
-}
-
-// serializeTools must NOT be parallelized - they have side effects or are expensive.
-// These run sequentially in the order the LLM requested.
-var serializeTools = map[string]bool{
-	"write":        true, // File writes - potential conflicts
-	"bash":         true, // Arbitrary side effects - unpredictable
-	"spawn_agents": true, // Expensive resource creation
-}
-
-// isAsyncTool returns true if the tool can be executed asynchronously.
-func isAsyncTool(name string) bool {
-	return asyncTools[name]
-}
-
-// isSerializeTool returns true if the tool must run sequentially.
-func isSerializeTool(name string) bool {
-	return serializeTools[name]
-}
-
 // executeToolsParallel executes multiple tool calls concurrently and returns
 // messages in the original order. Async tools (remember, scratchpad_write)
-// fire in background and return immediately with "OK".
+// fire in background and return immediately with "OK"; tools that aren't
+// parallel-safe (write, bash, ...) run one at a time in the order requested.
 // Concurrency is limited based on CPU count to avoid overwhelming resources.
 func (e *Executor) executeToolsParallel(ctx context.Context, toolCalls []llm.ToolCallResponse) []llm.Message {
 	if len(toolCalls) == 0 {
@@ -251,10 +241,11 @@ func (e *Executor) executeToolsParallel(ctx context.Context, toolCalls []llm.Too
 	var serializeCalls []int // indices of tools that must run sequentially
 	var parallelCalls []int  // indices of tools that can run in parallel
 	for i, tc := range toolCalls {
+		meta := e.toolMeta.Lookup(tc.Name)
 		switch {
-		case isAsyncTool(tc.Name):
+		case meta.Async:
 			asyncCalls = append(asyncCalls, i)
-		case isSerializeTool(tc.Name):
+		case !meta.Parallel:
 			serializeCalls = append(serializeCalls, i)
 		default:
 			parallelCalls = append(parallelCalls, i)
@@ -396,6 +387,10 @@ func (e *Executor) executeMCPTool(ctx context.Context, tc llm.ToolCallResponse)
 		}
 	}
 
+	if e.simulates(tc) {
+		return e.simulateTool(ctx, tc)
+	}
+
 	result, err := e.mcpManager.CallTool(ctx, server, toolName, tc.Args)
 	if err != nil {
 		return nil, err
@@ -1,11 +1,15 @@
 package executor
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync/atomic"
+
+	"github.com/vinayprograms/agent/internal/session"
 )
 
 // projectSignature maps marker files to their project type description.
@@ -257,3 +261,52 @@ func buildTreeLines(root, dir string, depth, maxDepth int, lines *[]string) {
 		}
 	}
 }
+
+// ActiveGoals counts the goals running in a workspace. The zero value is
+// ready to use.
+type ActiveGoals struct {
+	n atomic.Int32
+}
+
+func (a *ActiveGoals) enter()       { a.n.Add(1) }
+func (a *ActiveGoals) leave()       { a.n.Add(-1) }
+func (a *ActiveGoals) count() int32 { return a.n.Load() }
+
+// restoreWorkspace rolls the workspace back to the snapshot taken at a
+// step's pre-checkpoint, before REORIENT re-executes the step. It does
+// nothing unless RestoreOnReorient is set and a snapshot was taken, and it
+// leaves the workspace alone while other goals (PARALLEL siblings or
+// concurrent service tasks) or sub-agents are working in it: the restore
+// would delete or revert their files.
+func (e *Executor) restoreWorkspace(ctx context.Context, stepID, snapshotID string) {
+	if !e.restoreOnReorient || e.snapshots == nil || snapshotID == "" {
+		return
+	}
+	goals, subAgents := e.activeGoals.count(), atomic.LoadInt32(&e.activeSubAgents)
+	if goals > 1 || subAgents > 1 {
+		e.logger.Warn("workspace not restored: shared with running work", map[string]any{
+			"step":       stepID,
+			"goals":      goals,
+			"sub_agents": subAgents,
+		})
+		e.logEvent(ctx, session.EventWarning, fmt.Sprintf("Workspace not restored for %q: %d goals and %d sub-agents are running in it", stepID, goals, subAgents))
+		return
+	}
+	res, err := e.snapshots.Restore(snapshotID)
+	if err != nil {
+		e.logger.Warn("failed to restore workspace", map[string]any{
+			"step":     stepID,
+			"snapshot": snapshotID,
+			"error":    err.Error(),
+		})
+		e.logEvent(ctx, session.EventWarning, fmt.Sprintf("Workspace restore to snapshot %s failed: %v", snapshotID, err))
+		return
+	}
+	e.logger.Info("workspace restored", map[string]any{
+		"step":     stepID,
+		"snapshot": snapshotID,
+		"written":  len(res.Written),
+		"removed":  len(res.Removed),
+	})
+	e.logCheckpoint("restore", stepID, "", snapshotID)
+}
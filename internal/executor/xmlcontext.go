@@ -40,6 +40,8 @@ type XMLContextBuilder struct {
 	discussContributions  []AgentContribution
 	discussTaskID         string
 	isConverge            bool
+	loopStep              string // enclosing LOOP step name (empty if not looping)
+	loopIteration         int    // current LOOP iteration (1-indexed)
 	currentGoal           struct {
 		id          string
 		description string
@@ -65,6 +67,12 @@ func (b *XMLContextBuilder) SetConvergenceMode() {
 	b.isConverge = true
 }
 
+// SetLoopIteration marks the goal as running inside a LOOP step iteration.
+func (b *XMLContextBuilder) SetLoopIteration(stepName string, n int) {
+	b.loopStep = stepName
+	b.loopIteration = n
+}
+
 // AddConvergenceIteration adds a completed convergence iteration to the context.
 func (b *XMLContextBuilder) AddConvergenceIteration(n int, output string) {
 	b.convergenceIterations = append(b.convergenceIterations, ConvergenceIteration{N: n, Output: output})
@@ -152,6 +160,14 @@ func (b *XMLContextBuilder) Build() string {
 		buf.WriteString("</convergence-instruction>\n")
 	}
 
+	// Add loop instruction if the goal is repeated by a LOOP step
+	if b.loopStep != "" {
+		buf.WriteString(fmt.Sprintf("\n<loop-instruction step=%q iteration=\"%d\">\n", escapeXML(b.loopStep), b.loopIteration))
+		buf.WriteString("This goal is repeated as part of a loop. Your previous output for this goal, if any, is in <context>.\n")
+		buf.WriteString("Continue improving on it. When no further work is needed, output ONLY the word: CONVERGED\n")
+		buf.WriteString("</loop-instruction>\n")
+	}
+
 	// Add correction if present (escape to prevent injection from supervisor LLM)
 	if b.correction != "" {
 		buf.WriteString("\n<correction source=\"supervisor\">\n")
@@ -15,6 +15,7 @@ import (
 const (
 	GoalStart        = "goal.start"
 	GoalComplete     = "goal.complete"
+	GoalSkipped      = "goal.skipped"
 	ToolCall         = "tool.call"
 	ToolError        = "tool.error"
 	LLMError         = "llm.error"
@@ -23,6 +24,7 @@ const (
 	SubAgentStart    = "subagent.start"
 	SubAgentComplete = "subagent.complete"
 	SupervisionEvent = "supervision.event"
+	BudgetExceeded   = "budget.exceeded"
 )
 
 // Event carries data for a hook invocation.
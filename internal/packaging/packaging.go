@@ -19,6 +19,8 @@ import (
 	"sort"
 	"strings"
 	"time"
+
+	"github.com/vinayprograms/agent/internal/agentfile"
 )
 
 // Manifest represents the public API of an agent package.
@@ -54,8 +56,9 @@ type Input struct {
 
 // Output represents a package output.
 type Output struct {
-	Type        string `json:"type,omitempty"`
-	Description string `json:"description,omitempty"`
+	Type        string   `json:"type,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
 }
 
 // Requirements represents runtime requirements.
@@ -168,7 +171,7 @@ func loadOrCreateManifest(sourceDir string, opts PackOptions) (*Manifest, error)
 			return nil, fmt.Errorf("invalid manifest.json: %w", err)
 		}
 		// Still extract data from Agentfile to merge (name, version, inputs, requires)
-		extracted := &Manifest{Inputs: make(map[string]Input)}
+		extracted := &Manifest{Inputs: make(map[string]Input), Outputs: make(map[string]Output)}
 		if err := extractManifestFromAgentfile(sourceDir, extracted); err == nil {
 			// Use Agentfile NAME/VERSION if manifest doesn't have them
 			if manifest.Name == "" {
@@ -187,6 +190,16 @@ func loadOrCreateManifest(sourceDir string, opts PackOptions) (*Manifest, error)
 					}
 				}
 			}
+			// Merge outputs (Agentfile outputs fill in missing)
+			if manifest.Outputs == nil {
+				manifest.Outputs = extracted.Outputs
+			} else {
+				for name, output := range extracted.Outputs {
+					if _, exists := manifest.Outputs[name]; !exists {
+						manifest.Outputs[name] = output
+					}
+				}
+			}
 			// Merge requires (combine profiles)
 			if extracted.Requires != nil && len(extracted.Requires.Profiles) > 0 {
 				if manifest.Requires == nil {
@@ -296,6 +309,29 @@ func extractManifestFromAgentfile(sourceDir string, manifest *Manifest) error {
 		}
 	}
 
+	// Outputs come from goal -> declarations and SCHEMA files. VERSION is
+	// only known to packaging, so it is blanked for the parser. Agentfiles
+	// the parser rejects still package; they just declare no outputs.
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "VERSION ") {
+			lines[i] = ""
+		}
+	}
+	if wf, err := agentfile.ParseString(strings.Join(lines, "\n")); err == nil {
+		for i := range wf.Goals {
+			goal := &wf.Goals[i]
+			if goal.SchemaPath != "" {
+				if err := agentfile.LoadGoalSchema(goal, sourceDir); err != nil {
+					return fmt.Errorf("line %d: failed to load schema %q: %w", goal.Line, goal.SchemaPath, err)
+				}
+			}
+			for _, name := range goal.Outputs {
+				t := goal.FieldType(name)
+				manifest.Outputs[name] = Output{Type: t.Kind, Enum: t.Enum}
+			}
+		}
+	}
+
 	if manifest.Name == "" {
 		return fmt.Errorf("Agentfile missing NAME")
 	}
@@ -300,6 +300,43 @@ RUN main USING review`
 	}
 }
 
+func TestExtractTypedOutputs(t *testing.T) {
+	tmpDir := t.TempDir()
+	agentDir := filepath.Join(tmpDir, "test-agent")
+	os.MkdirAll(agentDir, 0755)
+
+	agentfile := `NAME output-test
+VERSION 1.0.0
+GOAL review "Review" -> score:number, tags:list, verdict:enum(pass, fail), notes
+GOAL audit "Audit" SCHEMA audit.json
+RUN main USING review, audit`
+	os.WriteFile(filepath.Join(agentDir, "Agentfile"), []byte(agentfile), 0644)
+	os.WriteFile(filepath.Join(agentDir, "audit.json"),
+		[]byte(`{"type": "object", "properties": {"passed": {"type": "boolean"}}}`), 0644)
+
+	pkg, err := Pack(PackOptions{
+		SourceDir:  agentDir,
+		OutputPath: filepath.Join(tmpDir, "output-test.agent"),
+	})
+	if err != nil {
+		t.Fatalf("Pack: %v", err)
+	}
+
+	outputs := pkg.Manifest.Outputs
+	if len(outputs) != 5 {
+		t.Fatalf("expected 5 outputs, got %v", outputs)
+	}
+	if outputs["score"].Type != "number" || outputs["tags"].Type != "list" || outputs["notes"].Type != "string" {
+		t.Errorf("unexpected output types: %v", outputs)
+	}
+	if outputs["verdict"].Type != "enum" || strings.Join(outputs["verdict"].Enum, ",") != "pass,fail" {
+		t.Errorf("unexpected verdict output: %+v", outputs["verdict"])
+	}
+	if outputs["passed"].Type != "bool" {
+		t.Errorf("expected schema output type bool, got %q", outputs["passed"].Type)
+	}
+}
+
 func TestDeterministicPacking(t *testing.T) {
 	tmpDir := t.TempDir()
 	agentDir := filepath.Join(tmpDir, "test-agent")
@@ -29,6 +29,16 @@ func (r *Replayer) formatEvent(seq int, event *session.Event, lastGoal *string)
 		r.fmtGoalStart(seqNum, ts)
 	case session.EventGoalEnd:
 		r.fmtGoalEnd(seqNum, ts, event)
+	case session.EventGoalSkipped:
+		r.fmtGoalSkipped(seqNum, ts, event)
+	case session.EventGoalAttempt:
+		r.fmtGoalAttempt(seqNum, ts, event)
+	case session.EventGoalFallback:
+		r.fmtGoalFallback(seqNum, ts, event)
+	case session.EventBudgetExceeded:
+		r.fmtBudgetExceeded(seqNum, ts, event)
+	case session.EventContextCompacted:
+		r.fmtContextCompacted(seqNum, ts, event)
 	case session.EventSubAgentStart:
 		r.fmtSubAgentStart(seqNum, ts, event)
 	case session.EventSubAgentEnd:
@@ -65,6 +75,10 @@ func (r *Replayer) formatEvent(seq int, event *session.Event, lastGoal *string)
 		r.fmtCheckpoint(seqNum, ts, event)
 	case session.EventBashSecurity:
 		r.fmtBashSecurity(seqNum, ts, event)
+	case session.EventFlowDenied:
+		r.fmtFlowDenied(seqNum, ts, event)
+	case session.EventPlannedAction:
+		r.fmtPlannedAction(seqNum, ts, event)
 	case session.EventWarning:
 		r.fmtWarning(seqNum, ts, event)
 	default:
@@ -95,6 +109,65 @@ func (r *Replayer) fmtGoalEnd(seqNum, ts string, event *session.Event) {
 	}
 }
 
+func (r *Replayer) fmtGoalSkipped(seqNum, ts string, event *session.Event) {
+	fmt.Fprintf(r.output, "%s │ %s │ %s %s\n", seqNum, ts,
+		flowStyle.Render("GOAL SKIPPED"),
+		dimStyle.Render(event.Content))
+}
+
+func (r *Replayer) fmtGoalAttempt(seqNum, ts string, event *session.Event) {
+	status := successStyle.Render("✓")
+	if event.Success != nil && !*event.Success {
+		status = errorStyle.Render("✗")
+	}
+	fmt.Fprintf(r.output, "%s │ %s │ %s %s %s\n", seqNum, ts,
+		flowStyle.Render("GOAL "+strings.ToUpper(event.Content)),
+		status,
+		dimStyle.Render(fmt.Sprintf("(%dms)", event.DurationMs)))
+	if event.Error != "" {
+		fmt.Fprintf(r.output, "      │          │   %s\n", errorStyle.Render(event.Error))
+	}
+}
+
+func (r *Replayer) fmtGoalFallback(seqNum, ts string, event *session.Event) {
+	fmt.Fprintf(r.output, "%s │ %s │ %s %s\n", seqNum, ts,
+		flowStyle.Render("GOAL FAILED"),
+		dimStyle.Render(event.Content))
+	if event.Error != "" {
+		fmt.Fprintf(r.output, "      │          │   %s\n", errorStyle.Render(event.Error))
+	}
+}
+
+func (r *Replayer) fmtBudgetExceeded(seqNum, ts string, event *session.Event) {
+	label := "BUDGET EXCEEDED"
+	if event.Meta != nil && event.Meta.SubAgentRole != "" {
+		label += " (" + event.Meta.SubAgentRole + ")"
+	}
+	fmt.Fprintf(r.output, "%s │ %s │ %s %s\n", seqNum, ts,
+		errorStyle.Render(label),
+		dimStyle.Render(event.Content))
+	if r.verbosity >= 1 && event.Meta != nil {
+		fmt.Fprintf(r.output, "      │          │   %s\n", dimStyle.Render(fmt.Sprintf(
+			"turns: %d  tokens: %d  run cost: $%.4f", event.Meta.Turns, event.Meta.Tokens, event.Meta.CostUSD)))
+	}
+}
+
+func (r *Replayer) fmtContextCompacted(seqNum, ts string, event *session.Event) {
+	label := "CONTEXT COMPACTED"
+	if event.Meta != nil && event.Meta.SubAgentRole != "" {
+		label += " (" + event.Meta.SubAgentRole + ")"
+	}
+	fmt.Fprintf(r.output, "%s │ %s │ %s %s\n", seqNum, ts,
+		flowStyle.Render(label),
+		dimStyle.Render(event.Content))
+	if event.Meta == nil {
+		return
+	}
+	for _, item := range event.Meta.Compacted {
+		fmt.Fprintf(r.output, "      │          │   %s\n", dimStyle.Render("- "+item))
+	}
+}
+
 func (r *Replayer) fmtSubAgentStart(seqNum, ts string, event *session.Event) {
 	if event.Meta == nil {
 		return
@@ -316,11 +389,19 @@ func (r *Replayer) fmtSecurityBlock(seqNum, ts string, event *session.Event) {
 	} else if event.Tool != "" {
 		sourceInfo = dimStyle.Render(fmt.Sprintf(" ← %s", event.Tool))
 	}
-	fmt.Fprintf(r.output, "%s │ %s │ %s %s %s%s\n", seqNum, ts,
-		securityStyle.Render("SECURITY: untrusted content"),
+	trust := event.Meta.Trust
+	if trust == "" {
+		trust = "untrusted"
+	}
+	labels := ""
+	if len(event.Meta.Labels) > 0 {
+		labels = " " + warnStyle.Render("{"+strings.Join(event.Meta.Labels, ", ")+"}")
+	}
+	fmt.Fprintf(r.output, "%s │ %s │ %s %s %s%s%s\n", seqNum, ts,
+		securityStyle.Render("SECURITY: "+trust+" content"),
 		valueStyle.Render(event.Meta.BlockID),
 		dimStyle.Render(fmt.Sprintf("(entropy=%.2f)", event.Meta.Entropy)),
-		sourceInfo)
+		labels, sourceInfo)
 	if len(event.Meta.RelatedBlocks) > 0 {
 		fmt.Fprintf(r.output, "      │          │   %s %s\n",
 			securityStyle.Render("tainted by:"),
@@ -432,14 +513,71 @@ func (r *Replayer) fmtSecurityDecision(seqNum, ts string, event *session.Event)
 	}
 }
 
+// fmtFlowDenied shows a call denied by the data flow rules and the path the
+// data took: the offending block's lineage, ending at the denied tool.
+func (r *Replayer) fmtFlowDenied(seqNum, ts string, event *session.Event) {
+	if event.Meta == nil {
+		return
+	}
+	exposure := event.Meta.Exposure
+	if exposure == "" {
+		exposure = "unlabeled"
+	}
+	fmt.Fprintf(r.output, "%s │ %s │ %s %s %s\n", seqNum, ts,
+		securityStyle.Render("SECURITY: flow"),
+		r.actionStyle("deny").Render("DENY"),
+		dimStyle.Render(fmt.Sprintf("[%s → %s (%s)]", strings.Join(event.Meta.Labels, ", "), event.Tool, exposure)))
+	if event.Meta.FlowRule != "" {
+		fmt.Fprintf(r.output, "      │          │   %s\n",
+			dimStyle.Render("rule: "+event.Meta.FlowRule))
+	}
+	if len(event.Meta.TaintLineage) == 0 {
+		return
+	}
+	fmt.Fprintf(r.output, "      │          │   %s\n", securityStyle.Render("flow path:"))
+	for _, node := range event.Meta.TaintLineage {
+		r.printTaintNode(node, 0)
+	}
+	fmt.Fprintf(r.output, "      │          │     %s %s %s\n",
+		errorStyle.Render("➜"),
+		valueStyle.Render(event.Tool),
+		warnStyle.Render(fmt.Sprintf("[%s]", exposure)))
+}
+
 func (r *Replayer) fmtCheckpoint(seqNum, ts string, event *session.Event) {
-	if event.Meta != nil {
+	if event.Meta == nil {
+		return
+	}
+	switch event.Meta.CheckpointType {
+	case "snapshot", "restore":
+		// Workspace snapshot taken before the step, or restored for REORIENT
+		fmt.Fprintf(r.output, "%s │ %s │ %s %s %s %s\n", seqNum, ts,
+			dimStyle.Render("CHECKPOINT:"),
+			valueStyle.Render(event.Meta.CheckpointType),
+			labelStyle.Render(event.Meta.CheckpointID),
+			dimStyle.Render("("+event.Goal+")"))
+	default:
 		fmt.Fprintf(r.output, "%s │ %s │ %s %s\n", seqNum, ts,
 			dimStyle.Render("CHECKPOINT:"),
 			valueStyle.Render(event.Meta.CheckpointType))
 	}
 }
 
+// fmtPlannedAction shows a call a dry run recorded instead of executing.
+func (r *Replayer) fmtPlannedAction(seqNum, ts string, event *session.Event) {
+	status := warnStyle.Render("PLANNED")
+	if event.Meta != nil && event.Meta.Action == "deny" {
+		status = errorStyle.Render("DENY")
+	}
+	fmt.Fprintf(r.output, "%s │ %s │ %s %s %s\n", seqNum, ts,
+		toolStyle.Render("DRY RUN:"),
+		status,
+		valueStyle.Render(event.Content))
+	if event.Meta != nil && event.Meta.Reason != "" {
+		fmt.Fprintf(r.output, "      │          │   %s\n", errorStyle.Render(event.Meta.Reason))
+	}
+}
+
 func (r *Replayer) fmtBashSecurity(seqNum, ts string, event *session.Event) {
 	step := "check"
 	action := "allow"
@@ -134,13 +134,18 @@ func (r *Replayer) printTaintNode(node session.TaintNode, depth int) {
 	if node.EventSeq > 0 {
 		seqInfo = dimStyle.Render(fmt.Sprintf(" (seq:%d)", node.EventSeq))
 	}
+	labels := ""
+	if len(node.Labels) > 0 {
+		labels = " " + warnStyle.Render("{"+strings.Join(node.Labels, ", ")+"}")
+	}
 
-	fmt.Fprintf(r.output, "      │          │     %s%s %s %s %s%s\n",
+	fmt.Fprintf(r.output, "      │          │     %s%s %s %s %s%s%s\n",
 		indent,
 		securityStyle.Render(prefix),
 		securityStyle.Render(node.BlockID),
 		trustColor.Render(fmt.Sprintf("[%s]", node.Trust)),
 		dimStyle.Render(node.Source),
+		labels,
 		seqInfo)
 
 	for _, parent := range node.TaintedBy {
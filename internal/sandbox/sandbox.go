@@ -0,0 +1,221 @@
+// Package sandbox runs bash commands in an isolated Linux environment. The
+// filesystem is read-only outside the workspace (and a private /tmp), the
+// network is cut off unless the policy allows it, and CPU, memory, process
+// and file size limits apply to every command.
+//
+// Two backends are available: "namespaces" sets up user, mount, PID and
+// network namespaces itself by re-executing the agent binary as the
+// sandbox init (see Init), and "bwrap" uses bubblewrap. Both run without
+// root. The sandbox is configured in the [bash] table of policy.toml.
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Backends.
+const (
+	None       = "none"       // commands run unconfined
+	Bwrap      = "bwrap"      // bubblewrap
+	Namespaces = "namespaces" // built-in namespace setup
+	Docker     = "docker"     // left to the built-in bash tool
+)
+
+// DefaultTimeout is the wall time of a command, in seconds, unless the
+// policy sets timeout.
+const DefaultTimeout = 120
+
+// Config is the sandbox part of the [bash] table of policy.toml.
+type Config struct {
+	Backend       string   `toml:"sandbox"`
+	Network       bool     `toml:"network"`          // allow network access
+	Writable      []string `toml:"writable"`         // writable directories besides the workspace and /tmp
+	CPUSeconds    int      `toml:"cpu_seconds"`      // CPU time per process (RLIMIT_CPU)
+	MemoryMB      int      `toml:"memory_mb"`        // address space per process (RLIMIT_AS)
+	MaxProcesses  int      `toml:"max_processes"`    // processes of the user (RLIMIT_NPROC)
+	MaxFileSizeMB int      `toml:"max_file_size_mb"` // size of any file written (RLIMIT_FSIZE)
+	Timeout       int      `toml:"timeout"`          // wall time per command in seconds
+}
+
+// ParsePolicy reads the sandbox configuration from policy.toml content. It
+// returns nil when bash has no sandbox, or uses docker, which the built-in
+// bash tool runs itself.
+func ParsePolicy(content string) (*Config, error) {
+	var doc struct {
+		Bash *Config `toml:"bash"`
+	}
+	if _, err := toml.Decode(content, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse policy: %w", err)
+	}
+	cfg := doc.Bash
+	if cfg == nil {
+		return nil, nil
+	}
+	switch cfg.Backend {
+	case "", None, Docker:
+		return nil, nil
+	case Bwrap, Namespaces:
+	default:
+		return nil, fmt.Errorf("bash sandbox must be none, bwrap, namespaces or docker, got %q", cfg.Backend)
+	}
+	if cfg.CPUSeconds < 0 || cfg.MemoryMB < 0 || cfg.MaxProcesses < 0 || cfg.MaxFileSizeMB < 0 || cfg.Timeout < 0 {
+		return nil, fmt.Errorf("bash sandbox limits must not be negative")
+	}
+	for _, p := range cfg.Writable {
+		if !filepath.IsAbs(p) {
+			return nil, fmt.Errorf("bash sandbox writable path must be absolute, got %q", p)
+		}
+	}
+	return cfg, nil
+}
+
+// Sandbox runs commands confined to a workspace.
+type Sandbox struct {
+	cfg       Config
+	workspace string
+}
+
+// New returns a sandbox for the workspace and checks that its backend
+// works on this host, so a run fails up front rather than on the first
+// command.
+func New(cfg Config, workspace string) (*Sandbox, error) {
+	if workspace == "" {
+		workspace = "."
+	}
+	abs, err := filepath.Abs(workspace)
+	if err != nil {
+		return nil, err
+	}
+	if abs == "/" {
+		return nil, fmt.Errorf("sandbox: workspace cannot be /")
+	}
+	s := &Sandbox{cfg: cfg, workspace: abs}
+
+	switch cfg.Backend {
+	case Bwrap:
+		if _, err := exec.LookPath("bwrap"); err != nil {
+			return nil, fmt.Errorf("sandbox: bwrap is not installed")
+		}
+	case Namespaces:
+	default:
+		return nil, fmt.Errorf("sandbox: unsupported backend %q", cfg.Backend)
+	}
+	res, err := s.Run(context.Background(), "true")
+	if err != nil {
+		return nil, fmt.Errorf("sandbox: %s backend unavailable: %w", cfg.Backend, err)
+	}
+	if res.ExitCode != 0 {
+		return nil, fmt.Errorf("sandbox: %s backend unavailable: %s", cfg.Backend, strings.TrimSpace(res.Stderr))
+	}
+	return s, nil
+}
+
+// Config returns the sandbox configuration.
+func (s *Sandbox) Config() Config {
+	return s.cfg
+}
+
+// Result is the outcome of a sandboxed command.
+type Result struct {
+	Stdout    string
+	Stderr    string
+	ExitCode  int
+	Violation string // how the command ran into the sandbox, "" if it didn't
+}
+
+// ErrTimeout is returned when a command runs out of wall time.
+var ErrTimeout = errors.New("command timed out")
+
+// Run runs a bash command in the sandbox with the workspace as working
+// directory.
+func (s *Sandbox) Run(ctx context.Context, command string) (*Result, error) {
+	timeout := s.cfg.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	cmd, err := s.command(ctx, command)
+	if err != nil {
+		return nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = time.Second
+
+	err = cmd.Run()
+	res := &Result{Stdout: stdout.String(), Stderr: stderr.String()}
+	if ctx.Err() == context.DeadlineExceeded {
+		res.ExitCode = -1
+		res.Violation = fmt.Sprintf("wall time limit of %ds exceeded", timeout)
+		return res, ErrTimeout
+	}
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return nil, fmt.Errorf("failed to execute command: %w", err)
+	}
+	res.ExitCode = cmd.ProcessState.ExitCode()
+	res.Violation = s.violation(cmd.ProcessState, res.Stderr)
+	return res, nil
+}
+
+// writable returns the directories mounted read-write: the workspace and
+// the configured writable paths.
+func (s *Sandbox) writable() []string {
+	return append([]string{s.workspace}, s.cfg.Writable...)
+}
+
+// violation explains how a finished command ran into the sandbox, from how
+// it exited and its error output. It returns "" if it didn't.
+func (s *Sandbox) violation(state *os.ProcessState, stderr string) string {
+	if v := s.limitViolation(state); v != "" {
+		return v
+	}
+	switch {
+	case strings.Contains(stderr, "Read-only file system"):
+		return "write outside the workspace blocked (read-only file system)"
+	case !s.cfg.Network && containsAny(stderr, networkErrors):
+		return "network access blocked"
+	case s.cfg.MemoryMB > 0 && containsAny(stderr, memoryErrors):
+		return fmt.Sprintf("memory limit of %d MB exceeded", s.cfg.MemoryMB)
+	case s.cfg.MaxProcesses > 0 && strings.Contains(stderr, "fork: ") && strings.Contains(stderr, "Resource temporarily unavailable"):
+		return fmt.Sprintf("process limit of %d exceeded", s.cfg.MaxProcesses)
+	}
+	return ""
+}
+
+// Error output of commands denied the network.
+var networkErrors = []string{
+	"Network is unreachable",
+	"Could not resolve host",
+	"Temporary failure in name resolution",
+	"Name or service not known",
+}
+
+// Error output of commands out of address space.
+var memoryErrors = []string{
+	"Cannot allocate memory",
+	"out of memory",
+	"memory exhausted",
+}
+
+func containsAny(s string, substrs []string) bool {
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
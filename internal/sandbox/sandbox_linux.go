@@ -0,0 +1,394 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// initArg is argv[0] of the agent binary re-executed as the sandbox init.
+const initArg = "agent-sandbox-init"
+
+// initSpec is what the sandbox init needs to confine a command.
+type initSpec struct {
+	Writable []string `json:"writable"`
+	Dir      string   `json:"dir"`
+	Network  bool     `json:"network"`
+	Limits   []limit  `json:"limits"`
+}
+
+// limit is a resource limit applied to sandboxed processes.
+type limit struct {
+	Resource int    `json:"resource"`
+	Value    uint64 `json:"value"`
+	ulimit   string // bash ulimit flag
+	scale    uint64 // value per ulimit unit
+}
+
+func (s *Sandbox) limits() []limit {
+	var limits []limit
+	if s.cfg.CPUSeconds > 0 {
+		limits = append(limits, limit{unix.RLIMIT_CPU, uint64(s.cfg.CPUSeconds), "-t", 1})
+	}
+	if s.cfg.MemoryMB > 0 {
+		limits = append(limits, limit{unix.RLIMIT_AS, uint64(s.cfg.MemoryMB) << 20, "-v", 1 << 10})
+	}
+	if s.cfg.MaxProcesses > 0 {
+		limits = append(limits, limit{unix.RLIMIT_NPROC, uint64(s.cfg.MaxProcesses), "-u", 1})
+	}
+	if s.cfg.MaxFileSizeMB > 0 {
+		limits = append(limits, limit{unix.RLIMIT_FSIZE, uint64(s.cfg.MaxFileSizeMB) << 20, "-f", 1 << 10})
+	}
+	return limits
+}
+
+// limitViolation reports a command killed for exceeding a limit, directly
+// or as reported by the shell in its exit status (128 + signal).
+func (s *Sandbox) limitViolation(state *os.ProcessState) string {
+	var sig syscall.Signal
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		sig = ws.Signal()
+	} else if code := state.ExitCode(); code > 128 && code < 128+65 {
+		sig = syscall.Signal(code - 128)
+	}
+	switch {
+	case sig == syscall.SIGXCPU && s.cfg.CPUSeconds > 0:
+		return fmt.Sprintf("CPU limit of %ds exceeded", s.cfg.CPUSeconds)
+	case sig == syscall.SIGXFSZ && s.cfg.MaxFileSizeMB > 0:
+		return fmt.Sprintf("file size limit of %d MB exceeded", s.cfg.MaxFileSizeMB)
+	}
+	return ""
+}
+
+// passedEnv lists the environment variables sandboxed commands inherit.
+// Everything else, API keys and whatever .env loaded included, stays out.
+var passedEnv = []string{"PATH", "HOME", "LANG", "TERM"}
+
+// command builds the process running a command in the sandbox.
+func (s *Sandbox) command(ctx context.Context, command string) (*exec.Cmd, error) {
+	var cmd *exec.Cmd
+	if s.cfg.Backend == Bwrap {
+		cmd = s.bwrapCommand(ctx, command)
+	} else {
+		var err error
+		if cmd, err = s.namespaceCommand(ctx, command); err != nil {
+			return nil, err
+		}
+	}
+	cmd.Env = commandEnv()
+	return cmd, nil
+}
+
+// commandEnv returns the minimal environment of sandboxed commands: the
+// variables in passedEnv that are set.
+func commandEnv() []string {
+	env := []string{} // not nil: a nil cmd.Env inherits everything
+	for _, name := range passedEnv {
+		if v, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+v)
+		}
+	}
+	return env
+}
+
+// bwrapSystemDirs are the host directories a bubblewrap sandbox sees,
+// read-only: enough to run programs, and nothing of $HOME or /etc.
+var bwrapSystemDirs = []string{"/usr", "/lib", "/lib64", "/bin", "/etc/alternatives"}
+
+// bwrapCommand confines a command with bubblewrap. Only the system
+// directories and the writable directories are visible. Limits are set
+// with ulimit in the shell that runs the command.
+func (s *Sandbox) bwrapCommand(ctx context.Context, command string) *exec.Cmd {
+	var args []string
+	for _, dir := range bwrapSystemDirs {
+		args = append(args, "--ro-bind-try", dir, dir)
+	}
+	args = append(args,
+		"--dev", "/dev",
+		"--proc", "/proc",
+		"--tmpfs", "/tmp",
+	)
+	for _, dir := range s.writable() {
+		args = append(args, "--bind", dir, dir)
+	}
+	args = append(args, "--chdir", s.workspace, "--unshare-all")
+	if s.cfg.Network {
+		args = append(args, "--share-net")
+	}
+	args = append(args, "--die-with-parent", "--new-session", "--cap-drop", "ALL")
+
+	script := `exec bash -c "$1"`
+	var ulimits []string
+	for _, l := range s.limits() {
+		ulimits = append(ulimits, fmt.Sprintf("%s %d", l.ulimit, l.Value/l.scale))
+	}
+	if len(ulimits) > 0 {
+		script = "ulimit " + strings.Join(ulimits, " ") + " && " + script
+	}
+	args = append(args, "--", "bash", "-c", script, "bash", command)
+	return exec.CommandContext(ctx, "bwrap", args...)
+}
+
+// namespaceCommand re-executes the agent binary as the sandbox init in new
+// user, mount, PID, IPC and UTS namespaces, and a new network namespace
+// unless the network is allowed. The init sets up the filesystem and
+// limits, then runs the command.
+func (s *Sandbox) namespaceCommand(ctx context.Context, command string) (*exec.Cmd, error) {
+	spec, err := json.Marshal(initSpec{
+		Writable: s.writable(),
+		Dir:      s.workspace,
+		Network:  s.cfg.Network,
+		Limits:   s.limits(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	flags := unix.CLONE_NEWUSER | unix.CLONE_NEWNS | unix.CLONE_NEWPID | unix.CLONE_NEWIPC | unix.CLONE_NEWUTS
+	if !s.cfg.Network {
+		flags |= unix.CLONE_NEWNET
+	}
+	cmd := exec.CommandContext(ctx, "/proc/self/exe")
+	cmd.Args = []string{initArg, string(spec), command}
+	cmd.Dir = s.workspace
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  uintptr(flags),
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}},
+		Pdeathsig:   syscall.SIGKILL,
+	}
+	return cmd, nil
+}
+
+// Init runs the sandbox init if the process was started as one: it confines
+// itself, runs the command and exits with its status, or with 126 if the
+// sandbox can't be set up. In any other process it returns immediately.
+// Programs using the namespaces backend call it before any other setup,
+// in the first init of the main package (tests in TestMain).
+func Init() {
+	if len(os.Args) != 3 || os.Args[0] != initArg {
+		return
+	}
+	var spec initSpec
+	err := json.Unmarshal([]byte(os.Args[1]), &spec)
+	if err == nil {
+		err = confine(spec)
+	}
+	if err == nil {
+		var code int
+		if code, err = runCommand(os.Args[2]); err == nil {
+			os.Exit(code)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "sandbox: %v\n", err)
+	os.Exit(126)
+}
+
+// runCommand runs the command in a child and returns its exit status, the
+// shell way (128 + signal) if a signal ended it. The init stays PID 1 of
+// the namespace because PID 1 ignores signals it has no handler for, and
+// CPU and file size limits are enforced by signals.
+func runCommand(command string) (int, error) {
+	cmd := exec.Command("bash", "-c", command)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return 0, err
+	}
+	if ws, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal()), nil
+	}
+	return cmd.ProcessState.ExitCode(), nil
+}
+
+// confine sets up the sandbox from inside the new namespaces: everything
+// read-only except the writable directories and a private /tmp, a fresh
+// /proc, loopback networking, resource limits, and no capabilities.
+func confine(spec initSpec) error {
+	// Keep mount changes out of the parent namespace
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("making mounts private: %w", err)
+	}
+
+	// Hold on to the writable directories; /tmp may hide them below
+	fds := make([]int, len(spec.Writable))
+	for i, dir := range spec.Writable {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("creating %s: %w", dir, err)
+		}
+		fd, err := unix.Open(dir, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return fmt.Errorf("opening %s: %w", dir, err)
+		}
+		fds[i] = fd
+	}
+
+	mounts, err := mountPoints()
+	if err != nil {
+		return err
+	}
+	for _, mp := range mounts {
+		if err := remount(mp, true); err != nil && !skippable(mp, err) {
+			return fmt.Errorf("remounting %s read-only: %w", mp, err)
+		}
+	}
+	if err := unix.Mount("tmpfs", "/tmp", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=1777"); err != nil {
+		return fmt.Errorf("mounting /tmp: %w", err)
+	}
+	for i, dir := range spec.Writable {
+		// The mount point itself, for directories under the new /tmp
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("creating mount point %s: %w", dir, err)
+		}
+		src := fmt.Sprintf("/proc/self/fd/%d", fds[i])
+		if err := unix.Mount(src, dir, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+			return fmt.Errorf("binding %s: %w", dir, err)
+		}
+		if err := remount(dir, false); err != nil {
+			return fmt.Errorf("remounting %s writable: %w", dir, err)
+		}
+		unix.Close(fds[i])
+	}
+	// A /proc for the new PID namespace; kernels that refuse it (a masked
+	// /proc in a container) leave the read-only host /proc in place.
+	unix.Mount("proc", "/proc", "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, "")
+
+	if !spec.Network {
+		if err := loopbackUp(); err != nil {
+			return fmt.Errorf("bringing up loopback: %w", err)
+		}
+	}
+	for _, l := range spec.Limits {
+		rlim := unix.Rlimit{Cur: l.Value, Max: l.Value}
+		if l.Resource == unix.RLIMIT_CPU {
+			rlim.Max++ // SIGXCPU first; SIGKILL a second later
+		}
+		if err := unix.Setrlimit(l.Resource, &rlim); err != nil {
+			return fmt.Errorf("setting limit %d: %w", l.Resource, err)
+		}
+	}
+	if err := dropCapabilities(); err != nil {
+		return err
+	}
+	return unix.Chdir(spec.Dir)
+}
+
+// mountPoints lists the mount points of the namespace.
+func mountPoints() ([]string, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var mounts []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) > 4 {
+			mounts = append(mounts, unescapeMountPath(fields[4]))
+		}
+	}
+	return mounts, sc.Err()
+}
+
+// unescapeMountPath decodes the octal escapes (\040 for a space) of
+// mountinfo paths.
+func unescapeMountPath(p string) string {
+	if !strings.Contains(p, `\`) {
+		return p
+	}
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		if p[i] == '\\' && i+3 < len(p) {
+			var c byte
+			if _, err := fmt.Sscanf(p[i+1:i+4], "%03o", &c); err == nil {
+				b.WriteByte(c)
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(p[i])
+	}
+	return b.String()
+}
+
+// remount changes a mount to read-only or read-write, keeping the flags
+// the kernel won't let an unprivileged namespace clear.
+func remount(mp string, readonly bool) error {
+	var st unix.Statfs_t
+	if err := unix.Statfs(mp, &st); err != nil {
+		return err
+	}
+	flags := uintptr(unix.MS_BIND | unix.MS_REMOUNT)
+	for _, f := range []struct{ st, ms uintptr }{
+		{unix.ST_NOSUID, unix.MS_NOSUID},
+		{unix.ST_NODEV, unix.MS_NODEV},
+		{unix.ST_NOEXEC, unix.MS_NOEXEC},
+		{unix.ST_NOATIME, unix.MS_NOATIME},
+		{unix.ST_NODIRATIME, unix.MS_NODIRATIME},
+		{unix.ST_RELATIME, unix.MS_RELATIME},
+	} {
+		if uintptr(st.Flags)&f.st != 0 {
+			flags |= f.ms
+		}
+	}
+	if readonly {
+		flags |= unix.MS_RDONLY
+	}
+	return unix.Mount("", mp, "", flags, "")
+}
+
+// skippable reports whether a mount that can't be remounted can be left
+// alone: mounts under /proc and /sys (replaced or not writable anyway),
+// and mount points that no longer exist. Any other failure, a permission
+// error included, would leave a writable mount and aborts the command.
+func skippable(mp string, err error) bool {
+	if mp == "/proc" || strings.HasPrefix(mp, "/proc/") || mp == "/sys" || strings.HasPrefix(mp, "/sys/") {
+		return true
+	}
+	return err == unix.ENOENT
+}
+
+// loopbackUp brings up lo in a new network namespace, so commands can
+// still reach servers they start themselves.
+func loopbackUp() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	ifr, err := unix.NewIfreq("lo")
+	if err != nil {
+		return err
+	}
+	if err := unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifr); err != nil {
+		return err
+	}
+	ifr.SetUint16(ifr.Uint16() | unix.IFF_UP)
+	return unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifr)
+}
+
+// dropCapabilities empties the capability bounding set, so the command
+// can't regain the namespace's capabilities (and undo the mounts) even as
+// root, and sets no_new_privs.
+func dropCapabilities() error {
+	for c := 0; ; c++ {
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(c), 0, 0, 0); err != nil {
+			if err == unix.EINVAL {
+				break
+			}
+			return fmt.Errorf("dropping capability %d: %w", c, err)
+		}
+	}
+	return unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0)
+}
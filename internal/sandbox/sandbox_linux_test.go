@@ -0,0 +1,132 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// newSandbox returns a namespaces sandbox, skipping the test where the
+// host doesn't allow unprivileged user namespaces.
+func newSandbox(t *testing.T, cfg Config) (*Sandbox, string) {
+	t.Helper()
+	cfg.Backend = Namespaces
+	ws := t.TempDir()
+	s, err := New(cfg, ws)
+	if err != nil {
+		t.Skipf("namespaces unavailable: %v", err)
+	}
+	return s, ws
+}
+
+func run(t *testing.T, s *Sandbox, command string) *Result {
+	t.Helper()
+	res, err := s.Run(context.Background(), command)
+	if err != nil {
+		t.Fatalf("Run(%q): %v", command, err)
+	}
+	return res
+}
+
+func TestSandbox_Filesystem(t *testing.T) {
+	s, ws := newSandbox(t, Config{})
+	hostTmp := t.TempDir()
+	os.WriteFile(filepath.Join(hostTmp, "secret.txt"), []byte("secret"), 0644)
+
+	if res := run(t, s, "pwd && echo built > out.txt"); res.ExitCode != 0 || strings.TrimSpace(res.Stdout) != ws {
+		t.Fatalf("expected command to run in the workspace, got %+v", res)
+	}
+	if data, _ := os.ReadFile(filepath.Join(ws, "out.txt")); string(data) != "built\n" {
+		t.Errorf("expected workspace write to persist, got %q", data)
+	}
+
+	res := run(t, s, "touch /usr/sandbox-test")
+	if res.ExitCode == 0 || res.Violation == "" || !strings.Contains(res.Violation, "read-only") {
+		t.Errorf("expected write outside the workspace blocked, got %+v", res)
+	}
+	if _, err := os.Stat("/usr/sandbox-test"); err == nil {
+		os.Remove("/usr/sandbox-test")
+		t.Error("write outside the workspace reached the host")
+	}
+
+	if res := run(t, s, "cat "+filepath.Join(hostTmp, "secret.txt")); res.ExitCode == 0 {
+		t.Errorf("expected a private /tmp, read %q", res.Stdout)
+	}
+	if res := run(t, s, "head -c 64 /proc/1/cmdline"); !strings.HasPrefix(res.Stdout, initArg) {
+		t.Errorf("expected a new PID namespace with the sandbox init as PID 1, got %q", res.Stdout)
+	}
+}
+
+func TestSandbox_Network(t *testing.T) {
+	s, _ := newSandbox(t, Config{})
+	res := run(t, s, "exec 3<>/dev/tcp/192.0.2.1/80")
+	if res.ExitCode == 0 || res.Violation != "network access blocked" {
+		t.Errorf("expected network blocked, got %+v", res)
+	}
+}
+
+func TestSandbox_Limits(t *testing.T) {
+	s, _ := newSandbox(t, Config{CPUSeconds: 1, MaxFileSizeMB: 1, Timeout: 5})
+	if res := run(t, s, "while :; do :; done"); res.Violation != "CPU limit of 1s exceeded" {
+		t.Errorf("expected CPU limit, got %+v", res)
+	}
+	if res := run(t, s, "head -c 2000000 /dev/zero > big.bin"); res.Violation != "file size limit of 1 MB exceeded" {
+		t.Errorf("expected file size limit, got %+v", res)
+	}
+
+	s, _ = newSandbox(t, Config{Timeout: 1})
+	res, err := s.Run(context.Background(), "sleep 10")
+	if !errors.Is(err, ErrTimeout) || res.Violation != "wall time limit of 1s exceeded" {
+		t.Errorf("expected timeout, got %+v, %v", res, err)
+	}
+}
+
+func TestSandbox_Environment(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "sk-test-secret")
+	s, _ := newSandbox(t, Config{})
+	res := run(t, s, "env")
+	if strings.Contains(res.Stdout, "sk-test-secret") {
+		t.Errorf("expected the agent's environment kept out of the sandbox, got:\n%s", res.Stdout)
+	}
+	if !strings.Contains(res.Stdout, "PATH="+os.Getenv("PATH")+"\n") {
+		t.Errorf("expected PATH passed to the sandbox, got:\n%s", res.Stdout)
+	}
+}
+
+func TestSandbox_BwrapBinds(t *testing.T) {
+	ws := t.TempDir()
+	extra := filepath.Join(t.TempDir(), "cache")
+	s := &Sandbox{cfg: Config{Backend: Bwrap, Writable: []string{extra}}, workspace: ws}
+	args := strings.Join(s.bwrapCommand(context.Background(), "true").Args, " ")
+	if strings.Contains(args, "--ro-bind / /") || strings.Contains(args, "--ro-bind-try / /") {
+		t.Errorf("expected the host root kept out of the sandbox, got %s", args)
+	}
+	home, _ := os.UserHomeDir()
+	if home != "" && strings.Contains(args, " "+home+" ") {
+		t.Errorf("expected $HOME kept out of the sandbox, got %s", args)
+	}
+	for _, want := range []string{"--ro-bind-try /usr /usr", "--bind " + ws + " " + ws, "--bind " + extra + " " + extra} {
+		if !strings.Contains(args, want) {
+			t.Errorf("expected %q in %s", want, args)
+		}
+	}
+}
+
+func TestSkippable(t *testing.T) {
+	if !skippable("/gone", unix.ENOENT) {
+		t.Error("expected a missing mount point skipped")
+	}
+	if skippable("/home", unix.EACCES) {
+		t.Error("expected a permission error to abort, not leave the mount writable")
+	}
+	if !skippable("/proc/sys", unix.EPERM) {
+		t.Error("expected mounts under /proc skipped")
+	}
+}
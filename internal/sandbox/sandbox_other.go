@@ -0,0 +1,21 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// Init does nothing outside Linux; see the Linux build.
+func Init() {}
+
+func (s *Sandbox) command(ctx context.Context, command string) (*exec.Cmd, error) {
+	return nil, fmt.Errorf("the bash sandbox requires Linux")
+}
+
+func (s *Sandbox) limitViolation(state *os.ProcessState) string {
+	return ""
+}
@@ -0,0 +1,43 @@
+package sandbox
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	Init()
+	os.Exit(m.Run())
+}
+
+func TestParsePolicy(t *testing.T) {
+	cfg, err := ParsePolicy(`
+[bash]
+enabled = true
+sandbox = "namespaces"
+cpu_seconds = 30
+memory_mb = 512
+writable = ["/var/cache/build"]
+`)
+	if err != nil {
+		t.Fatalf("ParsePolicy: %v", err)
+	}
+	if cfg.Backend != Namespaces || cfg.CPUSeconds != 30 || cfg.MemoryMB != 512 || cfg.Network {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+
+	for _, content := range []string{"", "[bash]\nenabled = true\n", "[bash]\nsandbox = \"none\"\n", "[bash]\nsandbox = \"docker\"\n"} {
+		if cfg, err := ParsePolicy(content); cfg != nil || err != nil {
+			t.Errorf("expected no sandbox for %q, got %+v, %v", content, cfg, err)
+		}
+	}
+	for _, content := range []string{
+		"[bash]\nsandbox = \"chroot\"\n",
+		"[bash]\nsandbox = \"bwrap\"\nmemory_mb = -1\n",
+		"[bash]\nsandbox = \"bwrap\"\nwritable = [\"cache\"]\n",
+	} {
+		if _, err := ParsePolicy(content); err == nil {
+			t.Errorf("expected error for %q", content)
+		}
+	}
+}
@@ -37,8 +37,17 @@ const (
 	EventToolResult = "tool_result" // Tool completed
 
 	// Goal events
-	EventGoalStart = "goal_start"
-	EventGoalEnd   = "goal_end"
+	EventGoalStart    = "goal_start"
+	EventGoalEnd      = "goal_end"
+	EventGoalSkipped  = "goal_skipped"  // WHEN clause was false
+	EventGoalAttempt  = "goal_attempt"  // One attempt of a goal with RETRY/TIMEOUT
+	EventGoalFallback = "goal_fallback" // Goal failed, running its ON FAILURE goal
+
+	// Budget events
+	EventBudgetExceeded = "budget_exceeded" // Turn, token, or cost limit reached
+
+	// Context-window events
+	EventContextCompacted = "context_compacted" // Older tool results compacted to fit the window
 
 	// Workflow events
 	EventWorkflowStart = "workflow_start"
@@ -58,6 +67,10 @@ const (
 	EventSecuritySupervisor = "security_supervisor" // Full supervisor review
 	EventSecurityDecision   = "security_decision"   // Final decision
 	EventBashSecurity       = "bash_security"       // Bash command security check
+	EventFlowDenied         = "flow_denied"         // Sensitive data would reach a tool the flow rules deny
+
+	// Dry run events
+	EventPlannedAction = "planned_action" // Side-effecting tool call recorded instead of executed
 
 	// Sub-agent events
 	EventSubAgentStart = "subagent_start" // Sub-agent spawned
@@ -153,6 +166,7 @@ type TaintNode struct {
 	Source    string      `json:"source"`               // Where content came from
 	EventSeq  uint64      `json:"event_seq,omitempty"`  // Event sequence when block was created
 	Depth     int         `json:"depth,omitempty"`      // Depth in the taint tree (0 = root)
+	Labels    []string    `json:"labels,omitempty"`     // Sensitivity labels (pii, financial, ...)
 	TaintedBy []TaintNode `json:"tainted_by,omitempty"` // Parent blocks that influenced this block
 }
 
@@ -193,6 +207,11 @@ type EventMeta struct {
 	SkipReason    string   `json:"skip_reason,omitempty"`    // Why escalation was skipped (e.g., "low_risk_tool", "no_untrusted_content", "triage_benign")
 	XMLBlock   string   `json:"xml,omitempty"`        // Full XML block for forensic tools
 
+	// Data flow
+	Labels   []string `json:"labels,omitempty"`    // Sensitivity labels of the data (public, internal, pii, financial, credentials)
+	Exposure string   `json:"exposure,omitempty"`  // Exposure of the receiving tool (local, internal, external-private, external-public)
+	FlowRule string   `json:"flow_rule,omitempty"` // Flow rule that denied the call
+
 	// Deprecated: use CheckName/CheckPath instead
 	Tier     int    `json:"tier,omitempty"`      // 1=static, 2=triage, 3=supervisor
 	Tiers    string `json:"tiers,omitempty"`     // Old tier path format
@@ -210,6 +229,18 @@ type EventMeta struct {
 	SubAgentOutput string            `json:"subagent_output,omitempty"` // Full output from sub-agent
 	SubAgentInputs map[string]string `json:"subagent_inputs,omitempty"` // Inputs passed to sub-agent
 
+	// Budget
+	Limit   string  `json:"limit,omitempty"`    // Budget limit hit: turns, tokens, cost
+	Turns   int     `json:"turns,omitempty"`    // LLM turns spent by the loop
+	Tokens  int     `json:"tokens,omitempty"`   // Tokens spent by the loop
+	CostUSD float64 `json:"cost_usd,omitempty"` // Estimated run cost so far
+
+	// Context compaction
+	TokensBefore  int      `json:"tokens_before,omitempty"`  // Estimated prompt tokens before compaction
+	TokensAfter   int      `json:"tokens_after,omitempty"`   // Estimated prompt tokens after compaction
+	ContextWindow int      `json:"context_window,omitempty"` // Model context window (tokens)
+	Compacted     []string `json:"compacted,omitempty"`      // What was compacted: tool (id): size change, method
+
 	// LLM details
 	Model     string `json:"model,omitempty"`      // Model used
 	LatencyMs int64  `json:"latency_ms,omitempty"` // LLM call latency
@@ -363,6 +394,20 @@ func (s *Session) persistBatch(batch []Event) {
 	}
 }
 
+// SetOutput records a goal output so an interrupted run can be resumed.
+// The map is replaced rather than mutated, since the writer may be
+// persisting the previous one.
+func (s *Session) SetOutput(name, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	outputs := make(map[string]string, len(s.Outputs)+1)
+	for k, v := range s.Outputs {
+		outputs[k] = v
+	}
+	outputs[name] = value
+	s.Outputs = outputs
+}
+
 // StartCorrelation generates a new correlation ID for linking related events.
 func (s *Session) StartCorrelation() string {
 	b := make([]byte, 4)
@@ -579,12 +624,15 @@ func (s *FileStore) Save(sess *Session) error {
 	s.writtenEvents[sess.ID] = len(sess.Events)
 
 	// Append footer (most recent footer wins on load)
+	sess.mu.Lock()
+	outputs := sess.Outputs
+	sess.mu.Unlock()
 	footer := JSONLRecord{
 		RecordType: RecordTypeFooter,
 		Status:     sess.Status,
 		Result:     sess.Result,
 		Error:      sess.Error,
-		Outputs:    sess.Outputs,
+		Outputs:    outputs,
 		State:      sess.State,
 		UpdatedAt:  sess.UpdatedAt,
 	}
@@ -621,7 +669,15 @@ func (s *FileStore) Load(id string) (*Session, error) {
 	// Try JSONL first
 	jsonlPath := filepath.Join(s.dir, id+".jsonl")
 	if _, err := os.Stat(jsonlPath); err == nil {
-		return s.loadJSONL(jsonlPath)
+		sess, err := s.loadJSONL(jsonlPath)
+		if err != nil {
+			return nil, err
+		}
+		// Loaded events are already on disk; later saves append after them
+		s.mu.Lock()
+		s.writtenEvents[sess.ID] = len(sess.Events)
+		s.mu.Unlock()
+		return sess, nil
 	}
 
 	// Fall back to legacy JSON
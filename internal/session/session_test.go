@@ -495,3 +495,46 @@ func TestFileStore_LargeLine(t *testing.T) {
 		t.Errorf("content size mismatch: got %d bytes", len(loaded.Events[0].Content))
 	}
 }
+
+// A session loaded for resume keeps appending after its existing events
+func TestFileStore_ResumeAppends(t *testing.T) {
+	tmpDir := t.TempDir()
+	store, _ := NewFileStore(tmpDir)
+
+	sess := &Session{ID: "resume-test", WorkflowName: "wf", State: map[string]interface{}{}, CreatedAt: time.Now()}
+	sess.AddEvent(Event{Type: EventGoalEnd, Goal: "fetch"})
+	sess.SetOutput("fetch", "42 rows")
+	if err := store.Save(sess); err != nil {
+		t.Fatalf("save error: %v", err)
+	}
+
+	// Reload with a fresh store, as a new process would
+	store, _ = NewFileStore(tmpDir)
+	loaded, err := store.Load("resume-test")
+	if err != nil {
+		t.Fatalf("load error: %v", err)
+	}
+	if loaded.Outputs["fetch"] != "42 rows" {
+		t.Errorf("expected recorded output, got %v", loaded.Outputs)
+	}
+
+	loaded.AddEvent(Event{Type: EventGoalEnd, Goal: "report"})
+	loaded.SetOutput("report", "done")
+	if err := store.Save(loaded); err != nil {
+		t.Fatalf("save error: %v", err)
+	}
+
+	again, err := store.Load("resume-test")
+	if err != nil {
+		t.Fatalf("load error: %v", err)
+	}
+	if len(again.Events) != 2 {
+		t.Fatalf("expected 2 events (no duplicates), got %d", len(again.Events))
+	}
+	if again.Events[1].SeqID != 2 {
+		t.Errorf("expected sequence to continue at 2, got %d", again.Events[1].SeqID)
+	}
+	if again.Outputs["fetch"] != "42 rows" || again.Outputs["report"] != "done" {
+		t.Errorf("unexpected outputs: %v", again.Outputs)
+	}
+}
@@ -2112,7 +2112,8 @@ func (m Model) generatePolicyTOML() string {
 	if m.config.AllowBash {
 		// Recommend sandbox for production/team scenarios
 		if m.config.Scenario == ScenarioProduction || m.config.Scenario == ScenarioTeam {
-			sb.WriteString("# Sandbox: restrict bash to workspace only (requires bwrap or docker)\n")
+			sb.WriteString("# Sandbox: restrict bash to workspace only (Linux namespaces, bwrap or docker)\n")
+			sb.WriteString("# sandbox = \"namespaces\" # built in - no root or extra install needed\n")
 			sb.WriteString("# sandbox = \"bwrap\"  # bubblewrap - lightweight, no root needed\n")
 			sb.WriteString("# sandbox = \"docker\" # run in container - more isolation\n")
 		}
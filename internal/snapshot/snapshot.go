@@ -0,0 +1,539 @@
+// Package snapshot keeps restorable copies of the agent's workspace.
+//
+// File contents are stored once, by SHA-256, under objects/; each snapshot
+// is a manifest of the workspace's files, directories and symlinks. Taking a
+// snapshot only copies files that changed since the previous one, and
+// restoring one makes the workspace match its manifest again.
+package snapshot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultExclude lists paths left out of snapshots unless configured
+// otherwise: version control data and dependency trees, which tools
+// rebuild and which would dominate the store.
+var DefaultExclude = []string{".git", "node_modules"}
+
+// DefaultMaxFileSize is the largest file copied into a snapshot. Larger
+// files are recorded as skipped and left alone on restore.
+const DefaultMaxFileSize = 50 << 20
+
+// File is a regular file or symlink in a snapshot.
+type File struct {
+	Path    string      `json:"path"` // slash-separated, relative to the workspace
+	Mode    fs.FileMode `json:"mode"`
+	Size    int64       `json:"size,omitempty"`
+	ModTime time.Time   `json:"mod_time"`
+	Hash    string      `json:"hash,omitempty"` // content hash (regular files)
+	Link    string      `json:"link,omitempty"` // target (symlinks)
+}
+
+// Snapshot is the manifest of one workspace snapshot.
+type Snapshot struct {
+	ID        string    `json:"id"`   // sequence number within the store, e.g. "0003"
+	Step      string    `json:"step"` // step that was about to run (checkpoint step ID)
+	Workspace string    `json:"workspace"`
+	Exclude   []string  `json:"exclude"`           // restore leaves these paths alone too
+	Protect   []string  `json:"protect,omitempty"` // absolute paths left alone, e.g. the agent's state
+	Timestamp time.Time `json:"timestamp"`
+	Dirs      []string  `json:"dirs,omitempty"`
+	Files     []File    `json:"files,omitempty"`
+	Skipped   []string  `json:"skipped,omitempty"` // files over the size limit
+}
+
+// Options configures a Store.
+type Options struct {
+	Exclude     []string // base names or relative paths (globs); nil = DefaultExclude
+	MaxFileSize int64    // bytes; 0 = DefaultMaxFileSize
+
+	// Protect lists absolute paths never snapshotted or restored, such as
+	// the agent's state location when it lies inside the workspace:
+	// sessions and checkpoints written after a snapshot must survive a
+	// restore. The store's own directory is always protected.
+	Protect []string
+}
+
+// Store takes and restores snapshots of one workspace. It is safe for
+// concurrent use.
+type Store struct {
+	dir         string
+	workspace   string
+	exclude     []string
+	protect     []string // absolute
+	maxFileSize int64
+
+	mu   sync.Mutex
+	last map[string]File // files of the latest snapshot, to skip rehashing
+}
+
+// NewStore creates a store in dir for snapshots of workspace.
+func NewStore(dir, workspace string, opts Options) (*Store, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "objects"), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	absDir, _ := filepath.Abs(dir)
+	abs, err := filepath.Abs(workspace)
+	if err != nil {
+		return nil, fmt.Errorf("invalid workspace %q: %w", workspace, err)
+	}
+	s := &Store{
+		dir:         absDir,
+		workspace:   abs,
+		exclude:     opts.Exclude,
+		maxFileSize: opts.MaxFileSize,
+	}
+	for _, p := range opts.Protect {
+		// Only paths inside the workspace matter; one holding the whole
+		// workspace would leave nothing to snapshot
+		if p, err := filepath.Abs(p); err == nil && p != abs && within(p, abs) {
+			s.protect = append(s.protect, p)
+		}
+	}
+	if s.exclude == nil {
+		s.exclude = DefaultExclude
+	}
+	if s.maxFileSize <= 0 {
+		s.maxFileSize = DefaultMaxFileSize
+	}
+	return s, nil
+}
+
+// Open opens an existing store on the workspace recorded in its latest
+// snapshot.
+func Open(dir string) (*Store, error) {
+	if _, err := os.Stat(filepath.Join(dir, "objects")); err != nil {
+		return nil, fmt.Errorf("no snapshots in %s", dir)
+	}
+	list, err := (&Store{dir: dir}).List()
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("no snapshots in %s", dir)
+	}
+	latest := list[len(list)-1]
+	return NewStore(dir, latest.Workspace, Options{Exclude: latest.Exclude, Protect: latest.Protect})
+}
+
+// Workspace returns the directory the store snapshots.
+func (s *Store) Workspace() string {
+	return s.workspace
+}
+
+// Take snapshots the workspace before step runs.
+func (s *Store) Take(step string) (*Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+	snap := &Snapshot{
+		ID:        nextID(ids),
+		Step:      step,
+		Workspace: s.workspace,
+		Exclude:   s.exclude,
+		Protect:   s.protect,
+		Timestamp: time.Now(),
+	}
+	if s.last == nil && len(ids) > 0 {
+		if prev, err := s.load(ids[len(ids)-1]); err == nil {
+			s.last = fileIndex(prev)
+		}
+	}
+
+	err = filepath.WalkDir(s.workspace, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(s.workspace, p)
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if s.excluded(s.exclude, rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			snap.Dirs = append(snap.Dirs, rel)
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		f := File{Path: rel, Mode: info.Mode(), Size: info.Size(), ModTime: info.ModTime()}
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			if f.Link, err = os.Readlink(p); err != nil {
+				return err
+			}
+			f.Size = 0
+		case !info.Mode().IsRegular():
+			return nil // sockets, pipes, devices
+		case info.Size() > s.maxFileSize:
+			snap.Skipped = append(snap.Skipped, rel)
+			return nil
+		default:
+			if prev, ok := s.last[rel]; ok && prev.Hash != "" && prev.Size == f.Size && prev.ModTime.Equal(f.ModTime) {
+				f.Hash = prev.Hash
+			} else if f.Hash, err = s.store(p); err != nil {
+				return err
+			}
+		}
+		snap.Files = append(snap.Files, f)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("snapshot of %s: %w", s.workspace, err)
+	}
+
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(s.dir, snap.ID+".json"), data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	s.last = fileIndex(snap)
+	return snap, nil
+}
+
+// RestoreResult summarizes a restore.
+type RestoreResult struct {
+	Written []string // files recreated or reverted
+	Removed []string // files and directories created after the snapshot
+}
+
+// Restore makes the workspace match snapshot id: changed and deleted files
+// are written back, and files created since are removed. Excluded paths and
+// files skipped for size are left alone.
+func (s *Store) Restore(id string) (*RestoreResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snap, err := s.load(id)
+	if err != nil {
+		return nil, err
+	}
+	want := fileIndex(snap)
+	dirs := make(map[string]bool, len(snap.Dirs))
+	for _, d := range snap.Dirs {
+		dirs[d] = true
+	}
+	keep := make(map[string]bool, len(snap.Skipped))
+	for _, p := range snap.Skipped {
+		keep[p] = true
+	}
+	exclude := snap.Exclude
+	if exclude == nil {
+		exclude = s.exclude
+	}
+	res := &RestoreResult{}
+
+	// Remove what didn't exist, collecting directories to prune afterwards
+	var extraDirs []string
+	err = filepath.WalkDir(s.workspace, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(s.workspace, p)
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if s.excluded(exclude, rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if !dirs[rel] {
+				extraDirs = append(extraDirs, rel)
+			}
+			return nil
+		}
+		if _, ok := want[rel]; ok || keep[rel] {
+			return nil
+		}
+		if err := os.Remove(p); err != nil {
+			return err
+		}
+		res.Removed = append(res.Removed, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("restore of %s: %w", s.workspace, err)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(extraDirs)))
+	for _, rel := range extraDirs {
+		// Only empty directories go; one holding excluded or skipped files stays
+		if os.Remove(filepath.Join(s.workspace, filepath.FromSlash(rel))) == nil {
+			res.Removed = append(res.Removed, rel+"/")
+		}
+	}
+
+	for _, rel := range snap.Dirs {
+		if err := os.MkdirAll(filepath.Join(s.workspace, filepath.FromSlash(rel)), 0755); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range snap.Files {
+		written, err := s.restoreFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("restore %s: %w", f.Path, err)
+		}
+		if written {
+			res.Written = append(res.Written, f.Path)
+		}
+	}
+	s.last = want
+	return res, nil
+}
+
+// restoreFile writes f back unless the workspace already has it.
+func (s *Store) restoreFile(f File) (bool, error) {
+	p := filepath.Join(s.workspace, filepath.FromSlash(f.Path))
+	info, err := os.Lstat(p)
+	if err == nil {
+		switch {
+		case f.Link != "":
+			if target, _ := os.Readlink(p); info.Mode()&fs.ModeSymlink != 0 && target == f.Link {
+				return false, nil
+			}
+		case info.Mode().IsRegular() && info.Size() == f.Size:
+			if info.ModTime().Equal(f.ModTime) {
+				return false, nil
+			}
+			if h, err := hashFile(p); err == nil && h == f.Hash {
+				return false, nil
+			}
+		}
+		if err := os.RemoveAll(p); err != nil {
+			return false, err
+		}
+	}
+
+	if f.Link != "" {
+		return true, os.Symlink(f.Link, p)
+	}
+	src, err := os.Open(s.objectPath(f.Hash))
+	if err != nil {
+		return false, fmt.Errorf("missing object %s: %w", f.Hash, err)
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode.Perm())
+	if err != nil {
+		return false, err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return false, err
+	}
+	if err := dst.Close(); err != nil {
+		return false, err
+	}
+	os.Chmod(p, f.Mode.Perm())
+	os.Chtimes(p, f.ModTime, f.ModTime)
+	return true, nil
+}
+
+// List returns the store's snapshots, oldest first.
+func (s *Store) List() ([]*Snapshot, error) {
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*Snapshot, 0, len(ids))
+	for _, id := range ids {
+		snap, err := s.load(id)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, snap)
+	}
+	return list, nil
+}
+
+// Find resolves a snapshot by ID or step. A step that ran more than once
+// (loops, retries, sub-agents with the same role) resolves to its latest
+// snapshot.
+func (s *Store) Find(ref string) (*Snapshot, error) {
+	list, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(list) - 1; i >= 0; i-- {
+		if list[i].ID == ref || list[i].Step == ref {
+			return list[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no snapshot for step %q", ref)
+}
+
+// excluded reports whether a workspace path matches one of patterns.
+func (s *Store) excluded(patterns []string, rel string) bool {
+	base := path.Base(rel)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, base); ok {
+			return true
+		}
+	}
+	// The store itself and other protected paths may live in the workspace.
+	// A directory on the way to one is walked; its other entries are not
+	// protected.
+	p := filepath.Join(s.workspace, filepath.FromSlash(rel))
+	if within(p, s.dir) {
+		return true
+	}
+	for _, protected := range s.protect {
+		if within(p, protected) {
+			return true
+		}
+	}
+	return false
+}
+
+// within reports whether p is dir or inside it.
+func within(p, dir string) bool {
+	return p == dir || strings.HasPrefix(p, dir+string(filepath.Separator))
+}
+
+// store copies a file into the object store and returns its hash.
+func (s *Store) store(p string) (string, error) {
+	h, err := hashFile(p)
+	if err != nil {
+		return "", err
+	}
+	obj := s.objectPath(h)
+	if _, err := os.Stat(obj); err == nil {
+		return h, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(obj), 0755); err != nil {
+		return "", err
+	}
+	src, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(obj), ".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return h, os.Rename(tmp.Name(), obj)
+}
+
+func (s *Store) objectPath(hash string) string {
+	return filepath.Join(s.dir, "objects", hash[:2], hash[2:])
+}
+
+// ids returns the IDs of saved snapshots in order. IDs are sequence
+// numbers padded to four digits, so they are compared as numbers: 10000
+// comes after 9999.
+func (s *Store) ids() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".json") {
+			ids = append(ids, strings.TrimSuffix(e.Name(), ".json"))
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return idLess(ids[i], ids[j]) })
+	return ids, nil
+}
+
+// idLess orders snapshot IDs numerically; names that aren't numbers sort
+// after the numbered ones.
+func idLess(a, b string) bool {
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return na < nb
+	case errA == nil || errB == nil:
+		return errA == nil
+	}
+	return a < b
+}
+
+// nextID returns the ID after the highest numbered one in ids.
+func nextID(ids []string) string {
+	last := 0
+	for _, id := range ids {
+		if n, err := strconv.Atoi(id); err == nil && n > last {
+			last = n
+		}
+	}
+	return fmt.Sprintf("%04d", last+1)
+}
+
+func (s *Store) load(id string) (*Snapshot, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, id+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("snapshot %s not found", id)
+		}
+		return nil, err
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("snapshot %s: %w", id, err)
+	}
+	return &snap, nil
+}
+
+func fileIndex(snap *Snapshot) map[string]File {
+	m := make(map[string]File, len(snap.Files))
+	for _, f := range snap.Files {
+		m[f.Path] = f
+	}
+	return m
+}
+
+func hashFile(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,249 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, root, rel, content string) {
+	t.Helper()
+	p := filepath.Join(root, rel)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, root, rel string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(root, rel))
+	if err != nil {
+		t.Fatalf("read %s: %v", rel, err)
+	}
+	return string(data)
+}
+
+func exists(root, rel string) bool {
+	_, err := os.Lstat(filepath.Join(root, rel))
+	return err == nil
+}
+
+func TestStore_TakeAndRestore(t *testing.T) {
+	ws := t.TempDir()
+	writeFile(t, ws, "main.go", "package main\n")
+	writeFile(t, ws, "docs/README.md", "# docs\n")
+	writeFile(t, ws, ".git/HEAD", "ref: refs/heads/main\n")
+	os.MkdirAll(filepath.Join(ws, "empty"), 0755)
+	os.Symlink("main.go", filepath.Join(ws, "link.go"))
+
+	s, err := NewStore(filepath.Join(t.TempDir(), "snapshots"), ws, Options{})
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	snap, err := s.Take("build")
+	if err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+	if snap.ID != "0001" || snap.Step != "build" || len(snap.Files) != 3 {
+		t.Fatalf("unexpected snapshot: %+v", snap)
+	}
+
+	// Damage the workspace
+	writeFile(t, ws, "main.go", "package broken\n")
+	os.Remove(filepath.Join(ws, "docs/README.md"))
+	writeFile(t, ws, "gen/out.txt", "generated\n")
+	writeFile(t, ws, ".git/HEAD", "ref: refs/heads/other\n")
+	os.Remove(filepath.Join(ws, "empty"))
+	os.Remove(filepath.Join(ws, "link.go"))
+
+	res, err := s.Restore(snap.ID)
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if got := readFile(t, ws, "main.go"); got != "package main\n" {
+		t.Errorf("main.go not restored: %q", got)
+	}
+	if got := readFile(t, ws, "docs/README.md"); got != "# docs\n" {
+		t.Errorf("README not restored: %q", got)
+	}
+	if exists(ws, "gen/out.txt") || exists(ws, "gen") {
+		t.Error("files created after the snapshot should be removed")
+	}
+	if !exists(ws, "empty") {
+		t.Error("empty directory should be recreated")
+	}
+	if target, _ := os.Readlink(filepath.Join(ws, "link.go")); target != "main.go" {
+		t.Errorf("symlink not restored, got %q", target)
+	}
+	if got := readFile(t, ws, ".git/HEAD"); got != "ref: refs/heads/other\n" {
+		t.Error("excluded paths should be left alone")
+	}
+	sort.Strings(res.Written)
+	if strings.Join(res.Written, ",") != "docs/README.md,link.go,main.go" {
+		t.Errorf("unexpected written files: %v", res.Written)
+	}
+
+	// Restoring again changes nothing
+	res, err = s.Restore(snap.ID)
+	if err != nil || len(res.Written) != 0 || len(res.Removed) != 0 {
+		t.Errorf("expected no-op restore, got %+v, %v", res, err)
+	}
+}
+
+func TestStore_Protect(t *testing.T) {
+	ws := t.TempDir()
+	writeFile(t, ws, "main.go", "package main\n")
+	writeFile(t, ws, ".agent/sessions/run/s1.jsonl", "{}\n")
+	state := filepath.Join(ws, ".agent")
+
+	s, err := NewStore(filepath.Join(state, "sessions", "run", "snapshots", "s1"), ws, Options{Protect: []string{state, filepath.Dir(ws)}})
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	snap, err := s.Take("build")
+	if err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+	if len(snap.Files) != 1 || snap.Files[0].Path != "main.go" {
+		t.Fatalf("expected only main.go in the snapshot, got %+v", snap.Files)
+	}
+
+	// State written after the snapshot survives a restore
+	writeFile(t, ws, ".agent/sessions/run/s1.jsonl", "{}\n{}\n")
+	writeFile(t, ws, ".agent/sessions/run/checkpoints/s1/build.json", "{}")
+	writeFile(t, ws, "gen.txt", "generated\n")
+	if _, err := s.Restore(snap.ID); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if exists(ws, "gen.txt") {
+		t.Error("files created after the snapshot should be removed")
+	}
+	if !exists(ws, ".agent/sessions/run/checkpoints/s1/build.json") || readFile(t, ws, ".agent/sessions/run/s1.jsonl") != "{}\n{}\n" {
+		t.Error("protected state should be left alone")
+	}
+
+	// Rollback reopens the store with the same protection
+	reopened, err := Open(filepath.Join(state, "sessions", "run", "snapshots", "s1"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	writeFile(t, ws, ".agent/tasks/t1.json", "{}")
+	if _, err := reopened.Restore(snap.ID); err != nil || !exists(ws, ".agent/tasks/t1.json") {
+		t.Errorf("expected protected state kept after reopening, err=%v", err)
+	}
+}
+
+func TestStore_DedupAndFind(t *testing.T) {
+	ws := t.TempDir()
+	writeFile(t, ws, "a.txt", "same")
+	writeFile(t, ws, "b.txt", "same")
+	dir := filepath.Join(t.TempDir(), "snapshots")
+	s, err := NewStore(dir, ws, Options{MaxFileSize: 10})
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	writeFile(t, ws, "big.bin", strings.Repeat("x", 11))
+
+	first, _ := s.Take("fetch")
+	if len(first.Skipped) != 1 || first.Skipped[0] != "big.bin" {
+		t.Errorf("expected big.bin to be skipped, got %v", first.Skipped)
+	}
+	writeFile(t, ws, "a.txt", "changed")
+	s.Take("analyze")
+	s.Take("fetch")
+
+	var objects int
+	filepath.Walk(filepath.Join(dir, "objects"), func(p string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			objects++
+		}
+		return nil
+	})
+	if objects != 2 {
+		t.Errorf("expected 2 stored objects (same and changed), got %d", objects)
+	}
+
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if reopened.Workspace() != s.Workspace() {
+		t.Errorf("expected workspace %s, got %s", s.Workspace(), reopened.Workspace())
+	}
+	snap, err := reopened.Find("fetch")
+	if err != nil || snap.ID != "0003" {
+		t.Errorf("expected latest fetch snapshot 0003, got %+v, %v", snap, err)
+	}
+	if snap, err := reopened.Find("0001"); err != nil || snap.Step != "fetch" {
+		t.Errorf("expected lookup by ID, got %+v, %v", snap, err)
+	}
+	if _, err := reopened.Find("report"); err == nil {
+		t.Error("expected error for unknown step")
+	}
+
+	writeFile(t, ws, "big.bin", strings.Repeat("y", 11))
+	if _, err := reopened.Restore("0001"); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if readFile(t, ws, "a.txt") != "same" || readFile(t, ws, "big.bin") != strings.Repeat("y", 11) {
+		t.Error("expected a.txt restored and skipped big.bin left alone")
+	}
+}
+
+func TestStore_IDsPastFourDigits(t *testing.T) {
+	ws := t.TempDir()
+	writeFile(t, ws, "a.txt", "one")
+	dir := filepath.Join(t.TempDir(), "snapshots")
+	s, err := NewStore(dir, ws, Options{})
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	first, err := s.Take("fetch")
+	if err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+
+	// A long-running session that has reached snapshot 9999
+	first.ID = "9999"
+	data, err := json.Marshal(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "9999.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	next, err := s.Take("analyze")
+	if err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+	if next.ID != "10000" {
+		t.Errorf("expected ID 10000 after 9999, got %s", next.ID)
+	}
+	list, err := s.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	var order []string
+	for _, snap := range list {
+		order = append(order, snap.ID)
+	}
+	if strings.Join(order, ",") != "0001,9999,10000" {
+		t.Errorf("expected numeric order, got %v", order)
+	}
+	if snap, err := s.Find("analyze"); err != nil || snap.ID != "10000" {
+		t.Errorf("expected latest analyze snapshot 10000, got %+v, %v", snap, err)
+	}
+}
+
+func TestOpen_Empty(t *testing.T) {
+	if _, err := Open(t.TempDir()); err == nil {
+		t.Error("expected error opening a directory without snapshots")
+	}
+}
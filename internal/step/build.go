@@ -4,10 +4,31 @@ import "github.com/vinayprograms/agent/internal/agentfile"
 
 // BuildGraph converts an Agentfile workflow into a composable step graph.
 func BuildGraph(workflow *agentfile.Workflow, executor GoalExecutor) Step {
+	// Goals with a WHEN clause are checked before they run, whatever the step type
+	conditions := make(map[string]*agentfile.Condition)
+	for _, g := range workflow.Goals {
+		if g.When != nil {
+			conditions[g.Name] = g.When
+		}
+	}
+	if len(conditions) > 0 {
+		executor = &conditionalExecutor{GoalExecutor: executor, conditions: conditions}
+	}
+
 	var steps []Step
 	for _, s := range workflow.Steps {
-		if s.Type == agentfile.StepRUN {
-			steps = append(steps, NewRunStep(s.Name, s.UsingGoals, executor))
+		switch s.Type {
+		case agentfile.StepRUN:
+			steps = append(steps, NewRunStep(s.Name, s.UsingGoals, s.When, executor))
+		case agentfile.StepLOOP:
+			limit := 0
+			if s.WithinLimit != nil {
+				limit = *s.WithinLimit
+			}
+			steps = append(steps, NewLoopStep(s.Name, s.UsingGoals, limit, s.WithinVar, executor))
+		case agentfile.StepPARALLEL:
+			deps := workflow.GoalDependencies(s.UsingGoals)
+			steps = append(steps, NewParallelStep(s.Name, s.UsingGoals, deps, executor))
 		}
 	}
 	if len(steps) == 1 {
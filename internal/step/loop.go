@@ -0,0 +1,130 @@
+package step
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ConvergedSignal is the explicit output a goal returns to end a LOOP early.
+const ConvergedSignal = "CONVERGED"
+
+// loopCtxKey is the context key for the active loop iteration.
+type loopCtxKey struct{}
+
+// LoopIteration identifies the LOOP step and iteration a goal is running in.
+type LoopIteration struct {
+	Step string // LOOP step name
+	N    int    // iteration number (1-indexed)
+}
+
+// LoopIterationFromContext returns the loop iteration a goal is executing in.
+// The second value is false when the goal is not running inside a LOOP.
+func LoopIterationFromContext(ctx context.Context) (LoopIteration, bool) {
+	it, ok := ctx.Value(loopCtxKey{}).(LoopIteration)
+	return it, ok
+}
+
+// LoopStep repeats a named group of goals until they converge or the
+// WITHIN limit is reached. Convergence is detected when:
+//   - a goal outputs the CONVERGED signal (explicit),
+//   - no goal made tool calls during the iteration (implicit), or
+//   - goal outputs are unchanged from the previous iteration (no progress).
+type LoopStep struct {
+	name      string
+	goalNames []string
+	limit     int    // literal WITHIN limit (0 if variable)
+	limitVar  string // WITHIN variable name, resolved from state at execution
+	executor  GoalExecutor
+}
+
+// NewLoopStep creates a step that repeats the given goals within a limit.
+// If limitVar is set, the limit is resolved from state outputs or inputs.
+func NewLoopStep(name string, goalNames []string, limit int, limitVar string, executor GoalExecutor) *LoopStep {
+	return &LoopStep{name: name, goalNames: goalNames, limit: limit, limitVar: limitVar, executor: executor}
+}
+
+func (l *LoopStep) Name() string { return l.name }
+
+func (l *LoopStep) Execute(ctx context.Context, state *State) error {
+	limit, err := l.resolveLimit(state)
+	if err != nil {
+		return fmt.Errorf("LOOP step %q: %w", l.name, err)
+	}
+	if limit <= 0 {
+		return fmt.Errorf("LOOP step %q: WITHIN limit must be > 0", l.name)
+	}
+
+	for i := 1; i <= limit; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		previous := make(map[string]string, len(l.goalNames))
+		for _, goalName := range l.goalNames {
+			if out, ok := state.Output(goalName); ok {
+				previous[goalName] = out
+			}
+		}
+
+		iterCtx := context.WithValue(ctx, loopCtxKey{}, LoopIteration{Step: l.name, N: i})
+		explicit := false
+		toolCalls := false
+		for _, goalName := range l.goalNames {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := l.executor.ExecuteGoal(iterCtx, goalName, state); err != nil {
+				return fmt.Errorf("LOOP step %q iteration %d: %w", l.name, i, err)
+			}
+			if out, _ := state.Output(goalName); strings.TrimSpace(out) == ConvergedSignal {
+				// Keep the last substantive output, not the signal itself.
+				// Converging on the first run leaves nothing to keep, so
+				// the output is empty.
+				state.SetOutput(goalName, previous[goalName])
+				explicit = true
+				break
+			}
+			if state.MadeToolCalls(goalName) {
+				toolCalls = true
+			}
+		}
+		state.SetIterations(l.name, i)
+
+		if explicit || !toolCalls || l.unchanged(previous, state) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// resolveLimit returns the literal WITHIN limit or looks up the variable.
+func (l *LoopStep) resolveLimit(state *State) (int, error) {
+	if l.limitVar == "" {
+		return l.limit, nil
+	}
+	val, ok := state.Output(l.limitVar)
+	if !ok {
+		val, ok = state.Input(l.limitVar)
+	}
+	if !ok {
+		return 0, fmt.Errorf("WITHIN $%s is not set", l.limitVar)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(val))
+	if err != nil {
+		return 0, fmt.Errorf("WITHIN $%s is %q, not a number", l.limitVar, val)
+	}
+	return n, nil
+}
+
+// unchanged reports whether every goal output matches the previous iteration.
+func (l *LoopStep) unchanged(previous map[string]string, state *State) bool {
+	for _, goalName := range l.goalNames {
+		prev, ok := previous[goalName]
+		if out, _ := state.Output(goalName); !ok || prev != out {
+			return false
+		}
+	}
+	return true
+}
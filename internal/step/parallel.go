@@ -0,0 +1,80 @@
+package step
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// ParallelStep runs a named group of goals as a dependency DAG.
+// Each goal starts as soon as the goals it depends on have completed, so
+// goals that don't reference each other's outputs run concurrently.
+// The first failure cancels the remaining goals.
+type ParallelStep struct {
+	name      string
+	goalNames []string
+	deps      map[string][]string // goal -> goals it waits for
+	executor  GoalExecutor
+}
+
+// NewParallelStep creates a step that runs the given goals concurrently,
+// ordering them by deps. The dependency graph must be acyclic.
+func NewParallelStep(name string, goalNames []string, deps map[string][]string, executor GoalExecutor) *ParallelStep {
+	return &ParallelStep{name: name, goalNames: goalNames, deps: deps, executor: executor}
+}
+
+func (p *ParallelStep) Name() string { return p.name }
+
+func (p *ParallelStep) Execute(ctx context.Context, state *State) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(map[string]chan struct{}, len(p.goalNames))
+	for _, goalName := range p.goalNames {
+		done[goalName] = make(chan struct{})
+	}
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for _, goalName := range p.goalNames {
+		wg.Add(1)
+		go func(goalName string) {
+			defer wg.Done()
+			for _, dep := range p.deps[goalName] {
+				ch, ok := done[dep]
+				if !ok {
+					continue // not part of this step; already satisfied
+				}
+				select {
+				case <-ch:
+				case <-runCtx.Done():
+					return
+				}
+			}
+			if runCtx.Err() != nil {
+				return
+			}
+			if err := p.executor.ExecuteGoal(runCtx, goalName, state); err != nil {
+				errOnce.Do(func() {
+					firstErr = fmt.Errorf("PARALLEL step %q goal %q: %w", p.name, goalName, err)
+					cancel()
+				})
+				return
+			}
+			close(done[goalName])
+		}(goalName)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
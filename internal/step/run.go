@@ -1,6 +1,11 @@
 package step
 
-import "context"
+import (
+	"context"
+	"fmt"
+
+	"github.com/vinayprograms/agent/internal/agentfile"
+)
 
 // GoalExecutor is the interface that the executor provides to run individual goals.
 type GoalExecutor interface {
@@ -11,17 +16,33 @@ type GoalExecutor interface {
 type RunStep struct {
 	name      string
 	goalNames []string
+	when      *agentfile.Condition // nil if unconditional
 	executor  GoalExecutor
 }
 
 // NewRunStep creates a step that runs the given goals in sequence.
-func NewRunStep(name string, goalNames []string, executor GoalExecutor) *RunStep {
-	return &RunStep{name: name, goalNames: goalNames, executor: executor}
+// If when is set and evaluates to false, every goal in the step is skipped.
+func NewRunStep(name string, goalNames []string, when *agentfile.Condition, executor GoalExecutor) *RunStep {
+	return &RunStep{name: name, goalNames: goalNames, when: when, executor: executor}
 }
 
 func (r *RunStep) Name() string { return r.name }
 
 func (r *RunStep) Execute(ctx context.Context, state *State) error {
+	if r.when != nil {
+		run, err := evalWhen(r.when, state)
+		if err != nil {
+			return fmt.Errorf("RUN step %q: %w", r.name, err)
+		}
+		if !run {
+			reason := fmt.Sprintf("RUN step %q: WHEN %s is false", r.name, r.when)
+			for _, goalName := range r.goalNames {
+				skipGoal(ctx, r.executor, goalName, reason)
+			}
+			return nil
+		}
+	}
+
 	for _, goalName := range r.goalNames {
 		if err := ctx.Err(); err != nil {
 			return err
@@ -1,26 +1,98 @@
 // Package step provides composable workflow step interfaces.
 //
 // Each step in a workflow implements the Step interface. Steps can be
-// composed using Sequence to build a complete workflow graph.
+// composed using Sequence to build a complete workflow graph. RunStep
+// executes its goals once; LoopStep repeats them until convergence;
+// ParallelStep runs independent goals concurrently.
 package step
 
-import "context"
+import (
+	"context"
+	"sync"
+)
 
 // State carries data between workflow steps.
 // Inputs are provided at the start; outputs accumulate as steps execute.
+// Goals may run concurrently, so steps and executors must use the accessor
+// methods while the graph is executing. The maps may be read directly once
+// execution has finished.
 type State struct {
-	Inputs  map[string]string
-	Outputs map[string]string
+	mu         sync.RWMutex
+	Inputs     map[string]string
+	Outputs    map[string]string
+	ToolCalls  map[string]bool // goal name -> whether its last execution made tool calls
+	Iterations map[string]int  // LOOP step name -> iterations executed
 }
 
 // NewState creates a State with the given inputs.
 func NewState(inputs map[string]string) *State {
 	return &State{
-		Inputs:  inputs,
-		Outputs: make(map[string]string),
+		Inputs:     inputs,
+		Outputs:    make(map[string]string),
+		ToolCalls:  make(map[string]bool),
+		Iterations: make(map[string]int),
 	}
 }
 
+// Input returns the named input.
+func (s *State) Input(name string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.Inputs[name]
+	return v, ok
+}
+
+// Output returns the named goal output.
+func (s *State) Output(name string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.Outputs[name]
+	return v, ok
+}
+
+// SetOutput records a goal output.
+func (s *State) SetOutput(name, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Outputs[name] = value
+}
+
+// Snapshot returns copies of the current inputs and outputs.
+func (s *State) Snapshot() (inputs, outputs map[string]string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	inputs = make(map[string]string, len(s.Inputs))
+	for k, v := range s.Inputs {
+		inputs[k] = v
+	}
+	outputs = make(map[string]string, len(s.Outputs))
+	for k, v := range s.Outputs {
+		outputs[k] = v
+	}
+	return inputs, outputs
+}
+
+// MadeToolCalls reports whether the goal's last execution made tool calls.
+func (s *State) MadeToolCalls(goalName string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ToolCalls[goalName]
+}
+
+// SetToolCalls records whether the goal's last execution made tool calls.
+func (s *State) SetToolCalls(goalName string, made bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ToolCalls[goalName] = made
+}
+
+// SetIterations records how many iterations a LOOP step executed.
+func (s *State) SetIterations(stepName string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Iterations[stepName] = n
+}
+
 // Step is a single unit of workflow execution.
 type Step interface {
 	// Name returns the step's identifier.
@@ -0,0 +1,60 @@
+package step
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vinayprograms/agent/internal/agentfile"
+)
+
+// GoalSkipper is implemented by executors that record goals skipped by a
+// WHEN clause (e.g. as session events for replay).
+type GoalSkipper interface {
+	SkipGoal(ctx context.Context, goalName, reason string)
+}
+
+// evalWhen evaluates a WHEN clause against state outputs, then inputs.
+func evalWhen(cond *agentfile.Condition, state *State) (bool, error) {
+	return cond.Eval(func(name string) (string, bool) {
+		if val, ok := state.Output(name); ok {
+			return val, true
+		}
+		return state.Input(name)
+	})
+}
+
+// skipGoal reports a skipped goal to the executor if it records skips.
+func skipGoal(ctx context.Context, executor GoalExecutor, goalName, reason string) {
+	if skipper, ok := executor.(GoalSkipper); ok {
+		skipper.SkipGoal(ctx, goalName, reason)
+	}
+}
+
+// conditionalExecutor wraps a GoalExecutor, skipping goals whose WHEN
+// clause evaluates to false. It applies inside every step type.
+type conditionalExecutor struct {
+	GoalExecutor
+	conditions map[string]*agentfile.Condition
+}
+
+func (c *conditionalExecutor) ExecuteGoal(ctx context.Context, goalName string, state *State) error {
+	cond, ok := c.conditions[goalName]
+	if !ok {
+		return c.GoalExecutor.ExecuteGoal(ctx, goalName, state)
+	}
+	run, err := evalWhen(cond, state)
+	if err != nil {
+		return fmt.Errorf("goal %q: %w", goalName, err)
+	}
+	if !run {
+		skipGoal(ctx, c.GoalExecutor, goalName, fmt.Sprintf("WHEN %s is false", cond))
+		state.SetToolCalls(goalName, false)
+		return nil
+	}
+	return c.GoalExecutor.ExecuteGoal(ctx, goalName, state)
+}
+
+// SkipGoal forwards skips to the wrapped executor.
+func (c *conditionalExecutor) SkipGoal(ctx context.Context, goalName, reason string) {
+	skipGoal(ctx, c.GoalExecutor, goalName, reason)
+}
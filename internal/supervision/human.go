@@ -0,0 +1,116 @@
+package supervision
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vinayprograms/agent/internal/checkpoint"
+)
+
+// Human responses sent on the human input channel. Any other text is
+// refused and the human is asked again.
+const (
+	HumanApprove = "approve"
+	HumanReject  = "reject"
+	HumanCorrect = "correct"
+)
+
+// HumanRequest describes a decision the supervisor needs from a human.
+// It is passed to the HumanRequestHook when the supervisor starts waiting;
+// the answer is expected on Reply, or on the human input channel when the
+// supervisor asks one step at a time.
+type HumanRequest struct {
+	StepID         string   `json:"step_id"`
+	Goal           string   `json:"goal"`
+	Question       string   `json:"question,omitempty"`       // supervisor's question (PAUSE)
+	Recommendation Verdict  `json:"recommendation"`           // supervisor's own verdict
+	Correction     string   `json:"correction,omitempty"`     // supervisor's suggested correction
+	Triggers       []string `json:"triggers,omitempty"`       // reconcile triggers that fired
+	Diff           string   `json:"diff"`                     // committed intent vs reported outcome
+	HumanRequired  bool     `json:"human_required,omitempty"` // SUPERVISED HUMAN (no timeout fallback)
+	Retry          string   `json:"retry,omitempty"`          // why the previous answer was refused
+
+	Pre  *checkpoint.PreCheckpoint  `json:"-"`
+	Post *checkpoint.PostCheckpoint `json:"-"`
+
+	Reply chan<- string   `json:"-"` // answers to this request (nil: the human input channel)
+	Done  <-chan struct{} `json:"-"` // closed once the supervisor stops waiting
+}
+
+// HumanRequestHook is called when the supervisor needs a human decision.
+// It must not block; the answer is delivered on the human input channel.
+type HumanRequestHook func(req HumanRequest)
+
+// HumanDecision is a parsed human response.
+type HumanDecision struct {
+	Verdict    Verdict // CONTINUE (approve) or REORIENT (correct)
+	Correction string  // guidance for REORIENT
+	Rejected   bool    // human rejected the step; the workflow should stop
+	Reason     string  // optional rejection reason
+}
+
+// ParseHumanResponse interprets a line of human input:
+//
+//	approve | a | yes | y | continue   -> CONTINUE
+//	reject [reason] | r [reason]       -> rejected
+//	correct <guidance> | c <guidance>  -> REORIENT with guidance
+//
+// A separator after the keyword (":" or whitespace) is optional. Any other
+// text, and correct without guidance, is an error; the human must be asked
+// again rather than have a typo re-run the step.
+func ParseHumanResponse(input string) (HumanDecision, error) {
+	input = strings.TrimSpace(input)
+	keyword, rest := splitHumanKeyword(input)
+
+	switch strings.ToLower(keyword) {
+	case HumanApprove, "a", "yes", "y", "continue", "approved":
+		return HumanDecision{Verdict: VerdictContinue}, nil
+	case HumanReject, "r", "no", "n", "rejected":
+		return HumanDecision{Rejected: true, Reason: rest}, nil
+	case HumanCorrect, "c":
+		if rest == "" {
+			return HumanDecision{}, fmt.Errorf("correct requires guidance")
+		}
+		return HumanDecision{Verdict: VerdictReorient, Correction: rest}, nil
+	}
+	return HumanDecision{}, fmt.Errorf("unrecognized response %q (want approve, reject <reason> or correct <guidance>)", input)
+}
+
+// splitHumanKeyword splits "keyword: rest" or "keyword rest".
+func splitHumanKeyword(input string) (string, string) {
+	idx := strings.IndexAny(input, ": \t")
+	if idx == -1 {
+		return input, ""
+	}
+	return input[:idx], strings.TrimSpace(strings.TrimLeft(input[idx:], ": \t"))
+}
+
+// CheckpointDiff renders what the agent committed to against what it
+// reported after execution, one line per item. Lines starting with "-" are
+// the commitment, "+" the outcome.
+func CheckpointDiff(pre *checkpoint.PreCheckpoint, post *checkpoint.PostCheckpoint) string {
+	var sb strings.Builder
+	if pre != nil {
+		writeDiffLine(&sb, "-", "interpretation", pre.Interpretation)
+		writeDiffLine(&sb, "-", "approach", pre.Approach)
+		writeDiffLine(&sb, "-", "predicted output", pre.PredictedOutput)
+		writeDiffLine(&sb, "-", "confidence", pre.Confidence)
+		writeDiffLine(&sb, "-", "out of scope", strings.Join(pre.ScopeOut, "; "))
+		writeDiffLine(&sb, "-", "assumptions", strings.Join(pre.Assumptions, "; "))
+	}
+	if post != nil {
+		writeDiffLine(&sb, "+", "met commitment", fmt.Sprintf("%v", post.MetCommitment))
+		writeDiffLine(&sb, "+", "deviations", strings.Join(post.Deviations, "; "))
+		writeDiffLine(&sb, "+", "concerns", strings.Join(post.Concerns, "; "))
+		writeDiffLine(&sb, "+", "unexpected", strings.Join(post.Unexpected, "; "))
+		writeDiffLine(&sb, "+", "tools used", strings.Join(post.ToolsUsed, ", "))
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+func writeDiffLine(sb *strings.Builder, sign, label, value string) {
+	if value == "" {
+		return
+	}
+	fmt.Fprintf(sb, "%s %s: %s\n", sign, label, value)
+}
@@ -6,6 +6,7 @@ import (
 	"context"
 
 	"github.com/vinayprograms/agent/internal/checkpoint"
+	"github.com/vinayprograms/agent/internal/snapshot"
 )
 
 // SuperviseRequest contains all inputs for the SUPERVISE phase.
@@ -27,3 +28,9 @@ type Supervisor interface {
 	// Supervise evaluates drift and decides whether to continue, reorient, or pause.
 	Supervise(ctx context.Context, req SuperviseRequest) (*checkpoint.SuperviseResult, error)
 }
+
+// Snapshotter takes workspace snapshots at pre-checkpoints, so a step's
+// changes can be undone. *snapshot.Store satisfies it.
+type Snapshotter interface {
+	Take(step string) (*snapshot.Snapshot, error)
+}
@@ -45,6 +45,7 @@ type PipelineConfig struct {
 	Logger     *logging.Logger // structured logger (for warnings)
 	Phase      PhaseLogger     // phase-level session logging
 	OnEvent    EventHook       // optional event callback
+	Snapshots  Snapshotter     // optional: snapshot the workspace at each pre-checkpoint
 }
 
 // PipelineRequest contains the inputs for a single pipeline run.
@@ -65,6 +66,10 @@ type PipelineResult struct {
 	Verdict    Verdict // VerdictContinue if no supervision ran
 	Correction string  // non-empty for REORIENT
 	Question   string  // non-empty for PAUSE
+
+	// Snapshot is the ID of the workspace snapshot taken at COMMIT
+	// ("" if none), for restoring the workspace before a REORIENT.
+	Snapshot string
 }
 
 // Pipeline manages the four-phase supervision flow:
@@ -112,9 +117,11 @@ func (p *Pipeline) Run(
 	// PHASE 1: COMMIT - Agent declares intent
 	// ============================================
 	var pre *checkpoint.PreCheckpoint
+	var snapshotID string
 	if supervised {
 		pre = commit(ctx)
 		if pre != nil {
+			snapshotID = p.Snapshot(req.StepID, pre)
 			if err := p.cfg.Store.SavePre(pre); err != nil {
 				p.warn("failed to save pre-checkpoint", map[string]any{
 					"step":  req.StepID,
@@ -132,7 +139,7 @@ func (p *Pipeline) Run(
 	// ============================================
 	execResult, execErr := execute(ctx)
 	if execErr != nil {
-		result := &PipelineResult{Verdict: VerdictContinue}
+		result := &PipelineResult{Verdict: VerdictContinue, Snapshot: snapshotID}
 		if execResult != nil {
 			result.Output = execResult.Output
 			result.ToolsUsed = execResult.ToolsUsed
@@ -171,6 +178,7 @@ func (p *Pipeline) Run(
 			ToolsUsed:     toolsUsed,
 			ToolCallsMade: toolCallsMade,
 			Verdict:       VerdictContinue,
+			Snapshot:      snapshotID,
 		}, nil
 	}
 
@@ -197,6 +205,7 @@ func (p *Pipeline) Run(
 			ToolsUsed:     toolsUsed,
 			ToolCallsMade: toolCallsMade,
 			Verdict:       VerdictContinue,
+			Snapshot:      snapshotID,
 		}, nil
 	}
 
@@ -222,6 +231,7 @@ func (p *Pipeline) Run(
 			ToolsUsed:     toolsUsed,
 			ToolCallsMade: toolCallsMade,
 			Verdict:       VerdictContinue,
+			Snapshot:      snapshotID,
 		}, fmt.Errorf("supervision failed: %w", err)
 	}
 
@@ -245,9 +255,36 @@ func (p *Pipeline) Run(
 		Verdict:       verdict,
 		Correction:    superviseResult.Correction,
 		Question:      superviseResult.Question,
+		Snapshot:      snapshotID,
 	}, nil
 }
 
+// Snapshot snapshots the workspace before a step executes and records the
+// snapshot ID in its pre-checkpoint's metadata. Returns "" if snapshots are
+// off or the snapshot failed; a failed snapshot doesn't stop the step.
+// Run calls it at COMMIT; steps supervised outside Run call it themselves.
+func (p *Pipeline) Snapshot(stepID string, pre *checkpoint.PreCheckpoint) string {
+	if p.cfg.Snapshots == nil {
+		return ""
+	}
+	snap, err := p.cfg.Snapshots.Take(stepID)
+	if err != nil {
+		p.warn("failed to snapshot workspace", map[string]any{
+			"step":  stepID,
+			"error": err.Error(),
+		})
+		return ""
+	}
+	if pre.Metadata == nil {
+		pre.Metadata = make(map[string]string)
+	}
+	pre.Metadata[checkpoint.MetaSnapshot] = snap.ID
+	if p.cfg.Phase != nil {
+		p.cfg.Phase.LogCheckpoint("snapshot", stepID, "", snap.ID)
+	}
+	return snap.ID
+}
+
 func (p *Pipeline) fireEvent(stepID, phase string, data any) {
 	if p.cfg.OnEvent != nil {
 		p.cfg.OnEvent(stepID, phase, data)
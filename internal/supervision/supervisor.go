@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/vinayprograms/agent/internal/checkpoint"
@@ -40,6 +41,9 @@ type LLMSupervisor struct {
 	humanAvailable    bool
 	humanInputChan    chan string
 	humanInputTimeout time.Duration
+	onHumanRequest    HumanRequestHook
+	concurrentHuman   bool
+	humanMu           sync.Mutex // one human prompt at a time (goals may run in parallel)
 }
 
 // Verify LLMSupervisor implements Supervisor.
@@ -51,6 +55,11 @@ type Config struct {
 	HumanAvailable    bool
 	HumanInputChan    chan string
 	HumanInputTimeout time.Duration
+	OnHumanRequest    HumanRequestHook // presents the request to the human (optional)
+
+	// ConcurrentHumanRequests lets several steps wait for the human at
+	// once. OnHumanRequest must then answer each request on its Reply.
+	ConcurrentHumanRequests bool
 }
 
 // NewLLMSupervisor creates a new LLM-based supervisor.
@@ -65,6 +74,8 @@ func NewLLMSupervisor(cfg Config) *LLMSupervisor {
 		humanAvailable:    cfg.HumanAvailable,
 		humanInputChan:    cfg.HumanInputChan,
 		humanInputTimeout: timeout,
+		onHumanRequest:    cfg.OnHumanRequest,
+		concurrentHuman:   cfg.ConcurrentHumanRequests,
 	}
 }
 
@@ -165,8 +176,8 @@ func (s *LLMSupervisor) Supervise(ctx context.Context, req SuperviseRequest) (*c
 	// Log initial verdict
 	s.logger.SupervisePhase("", pre.StepID, string(verdict), correction)
 
-	// Handle PAUSE verdict
-	if verdict == VerdictPause {
+	// SUPERVISED HUMAN always asks the human; otherwise only a PAUSE does
+	if verdict == VerdictPause || requiresHuman {
 		if requiresHuman && !s.humanAvailable {
 			// Hard fail - workflow requires human but none available
 			s.logger.SupervisorVerdict("", pre.StepID, "PAUSE_FAILED", "human required but unavailable", true)
@@ -174,32 +185,10 @@ func (s *LLMSupervisor) Supervise(ctx context.Context, req SuperviseRequest) (*c
 		}
 
 		if s.humanAvailable && s.humanInputChan != nil {
-			// Wait for human input
-			s.logger.Info("waiting for human input", map[string]interface{}{
-				"question": question,
-				"timeout":  s.humanInputTimeout.String(),
-			})
-
-			select {
-			case input := <-s.humanInputChan:
-				// Human provided input, reorient with it
-				result.Verdict = string(VerdictReorient)
-				result.Correction = input
-				s.logger.SupervisorVerdict("", pre.StepID, "REORIENT", "human provided input", true)
-			case <-time.After(s.humanInputTimeout):
-				if requiresHuman {
-					s.logger.SupervisorVerdict("", pre.StepID, "PAUSE_TIMEOUT", "human input timeout", true)
-					return nil, fmt.Errorf("human input timeout - workflow requires human approval")
-				}
-				// Timeout without required human - supervisor decides
-				s.logger.Warn("human input timeout, supervisor will decide", nil)
-				result.Verdict = string(VerdictContinue)
-				result.Correction = "Proceeding without human input (timeout). Review output carefully."
-				s.logger.SupervisorVerdict("", pre.StepID, "CONTINUE", "timeout fallback", false)
-			case <-ctx.Done():
-				return nil, ctx.Err()
+			if err := s.waitForHuman(ctx, req, result, verdict); err != nil {
+				return nil, err
 			}
-		} else if !requiresHuman {
+		} else if verdict == VerdictPause {
 			// No human available but not required - supervisor decides autonomously
 			s.logger.Warn("no human available, supervisor deciding autonomously", nil)
 			// Re-query with autonomous decision prompt
@@ -220,6 +209,92 @@ func (s *LLMSupervisor) Supervise(ctx context.Context, req SuperviseRequest) (*c
 	return result, nil
 }
 
+// waitForHuman presents the step to the human and applies their decision
+// to result, asking again after an unrecognized answer. Unless human
+// requests are concurrent, only one step waits for the human at a time.
+func (s *LLMSupervisor) waitForHuman(ctx context.Context, req SuperviseRequest, result *checkpoint.SuperviseResult, verdict Verdict) error {
+	answers := s.humanInputChan
+	var reply chan string
+	if s.concurrentHuman {
+		reply = make(chan string, 1)
+		answers = reply
+	} else {
+		s.humanMu.Lock()
+		defer s.humanMu.Unlock()
+	}
+	done := make(chan struct{})
+	defer close(done)
+
+	pre := req.Pre
+	s.logger.Info("waiting for human input", map[string]interface{}{
+		"step":     pre.StepID,
+		"question": result.Question,
+		"timeout":  s.humanInputTimeout.String(),
+	})
+	human := HumanRequest{
+		StepID:         pre.StepID,
+		Goal:           req.OriginalGoal,
+		Question:       result.Question,
+		Recommendation: verdict,
+		Correction:     result.Correction,
+		Triggers:       req.Triggers,
+		Diff:           CheckpointDiff(pre, req.Post),
+		HumanRequired:  req.HumanRequired,
+		Pre:            pre,
+		Post:           req.Post,
+		Reply:          reply,
+		Done:           done,
+	}
+	if s.onHumanRequest != nil {
+		s.onHumanRequest(human)
+	}
+
+	// The timeout covers the whole exchange, re-prompts included
+	timeout := time.NewTimer(s.humanInputTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case input := <-answers:
+			decision, err := ParseHumanResponse(input)
+			if err != nil {
+				s.logger.Warn("human response not understood, asking again", map[string]interface{}{
+					"step":  pre.StepID,
+					"error": err.Error(),
+				})
+				human.Retry = err.Error()
+				if s.onHumanRequest != nil {
+					s.onHumanRequest(human)
+				}
+				continue
+			}
+			if decision.Rejected {
+				s.logger.SupervisorVerdict("", pre.StepID, "REJECTED", decision.Reason, true)
+				if decision.Reason != "" {
+					return fmt.Errorf("step %q rejected by human: %s", pre.StepID, decision.Reason)
+				}
+				return fmt.Errorf("step %q rejected by human", pre.StepID)
+			}
+			result.Verdict = string(decision.Verdict)
+			result.Correction = decision.Correction
+			result.Question = ""
+			s.logger.SupervisorVerdict("", pre.StepID, result.Verdict, "human decision", true)
+		case <-timeout.C:
+			if req.HumanRequired {
+				s.logger.SupervisorVerdict("", pre.StepID, "PAUSE_TIMEOUT", "human input timeout", true)
+				return fmt.Errorf("human input timeout - workflow requires human approval")
+			}
+			// Timeout without required human - supervisor decides
+			s.logger.Warn("human input timeout, supervisor will decide", nil)
+			result.Verdict = string(VerdictContinue)
+			result.Correction = "Proceeding without human input (timeout). Review output carefully."
+			s.logger.SupervisorVerdict("", pre.StepID, "CONTINUE", "timeout fallback", false)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return nil
+	}
+}
+
 type autonomousDecision struct {
 	verdict    Verdict
 	correction string
@@ -1,10 +1,13 @@
 package supervision
 
 import (
+	"context"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/vinayprograms/agent/internal/checkpoint"
+	"github.com/vinayprograms/agentkit/llm"
 )
 
 func TestReconcile_NoTriggers(t *testing.T) {
@@ -282,3 +285,206 @@ func TestSupervisor_CustomTimeout(t *testing.T) {
 		t.Errorf("expected 10 second timeout, got %v", sup.humanInputTimeout)
 	}
 }
+
+func TestParseHumanResponse(t *testing.T) {
+	tests := []struct {
+		input      string
+		verdict    Verdict
+		correction string
+		rejected   bool
+		reason     string
+	}{
+		{"approve", VerdictContinue, "", false, ""},
+		{"  y ", VerdictContinue, "", false, ""},
+		{"reject", "", "", true, ""},
+		{"r: wrong files touched", "", "", true, "wrong files touched"},
+		{"correct only edit the README", VerdictReorient, "only edit the README", false, ""},
+		{"c: use the staging DB", VerdictReorient, "use the staging DB", false, ""},
+	}
+	for _, tt := range tests {
+		d, err := ParseHumanResponse(tt.input)
+		if err != nil {
+			t.Errorf("ParseHumanResponse(%q): %v", tt.input, err)
+			continue
+		}
+		if d.Verdict != tt.verdict || d.Correction != tt.correction || d.Rejected != tt.rejected || d.Reason != tt.reason {
+			t.Errorf("ParseHumanResponse(%q) = %+v", tt.input, d)
+		}
+	}
+
+	// Typos and free text must not re-run the step
+	for _, input := range []string{"please keep the public API", "aprove", "correct", "c:", ""} {
+		if d, err := ParseHumanResponse(input); err == nil {
+			t.Errorf("ParseHumanResponse(%q) = %+v, want error", input, d)
+		}
+	}
+}
+
+func TestCheckpointDiff(t *testing.T) {
+	pre := &checkpoint.PreCheckpoint{Interpretation: "update docs", Confidence: "high"}
+	post := &checkpoint.PostCheckpoint{MetCommitment: false, Deviations: []string{"edited code"}}
+
+	diff := CheckpointDiff(pre, post)
+	for _, want := range []string{"- interpretation: update docs", "- confidence: high", "+ met commitment: false", "+ deviations: edited code"} {
+		if !strings.Contains(diff, want) {
+			t.Errorf("diff missing %q:\n%s", want, diff)
+		}
+	}
+}
+
+func humanSupervisor(answer string, requests *[]HumanRequest) *LLMSupervisor {
+	provider := &llm.MockProvider{
+		ChatFunc: func(ctx context.Context, req llm.ChatRequest) (*llm.ChatResponse, error) {
+			return &llm.ChatResponse{Content: "VERDICT: CONTINUE\nCORRECTION: looks fine"}, nil
+		},
+	}
+	ch := make(chan string, 1)
+	return NewLLMSupervisor(Config{
+		Provider:          provider,
+		HumanAvailable:    true,
+		HumanInputChan:    ch,
+		HumanInputTimeout: time.Second,
+		OnHumanRequest: func(req HumanRequest) {
+			*requests = append(*requests, req)
+			ch <- answer
+		},
+	})
+}
+
+func TestSupervise_HumanRequiredAsksEvenOnContinue(t *testing.T) {
+	var requests []HumanRequest
+	sup := humanSupervisor("correct: stay inside docs/", &requests)
+
+	result, err := sup.Supervise(context.Background(), SuperviseRequest{
+		OriginalGoal:  "update docs",
+		Pre:           &checkpoint.PreCheckpoint{StepID: "docs", Interpretation: "update docs"},
+		Post:          &checkpoint.PostCheckpoint{StepID: "docs", MetCommitment: true},
+		HumanRequired: true,
+	})
+	if err != nil {
+		t.Fatalf("Supervise: %v", err)
+	}
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 human request, got %d", len(requests))
+	}
+	req := requests[0]
+	if req.StepID != "docs" || req.Recommendation != VerdictContinue || !req.HumanRequired {
+		t.Errorf("unexpected request: %+v", req)
+	}
+	if !strings.Contains(req.Diff, "interpretation: update docs") {
+		t.Errorf("request diff missing commitment: %q", req.Diff)
+	}
+	if result.Verdict != string(VerdictReorient) || result.Correction != "stay inside docs/" {
+		t.Errorf("expected REORIENT with human correction, got %s %q", result.Verdict, result.Correction)
+	}
+}
+
+func TestSupervise_HumanReject(t *testing.T) {
+	var requests []HumanRequest
+	sup := humanSupervisor("reject touches production", &requests)
+
+	_, err := sup.Supervise(context.Background(), SuperviseRequest{
+		Pre:           &checkpoint.PreCheckpoint{StepID: "deploy"},
+		Post:          &checkpoint.PostCheckpoint{StepID: "deploy"},
+		HumanRequired: true,
+	})
+	if err == nil || !strings.Contains(err.Error(), "rejected by human: touches production") {
+		t.Fatalf("expected rejection error, got %v", err)
+	}
+}
+
+func TestSupervise_HumanRepromptedOnUnrecognizedAnswer(t *testing.T) {
+	provider := &llm.MockProvider{
+		ChatFunc: func(ctx context.Context, req llm.ChatRequest) (*llm.ChatResponse, error) {
+			return &llm.ChatResponse{Content: "VERDICT: CONTINUE\nCORRECTION: looks fine"}, nil
+		},
+	}
+	answers := []string{"looks ok to me", "approve"}
+	var requests []HumanRequest
+	ch := make(chan string, 1)
+	sup := NewLLMSupervisor(Config{
+		Provider:          provider,
+		HumanAvailable:    true,
+		HumanInputChan:    ch,
+		HumanInputTimeout: time.Second,
+		OnHumanRequest: func(req HumanRequest) {
+			requests = append(requests, req)
+			ch <- answers[len(requests)-1]
+		},
+	})
+
+	result, err := sup.Supervise(context.Background(), SuperviseRequest{
+		Pre:           &checkpoint.PreCheckpoint{StepID: "deploy"},
+		Post:          &checkpoint.PostCheckpoint{StepID: "deploy"},
+		HumanRequired: true,
+	})
+	if err != nil {
+		t.Fatalf("Supervise: %v", err)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("expected the human to be asked twice, got %d", len(requests))
+	}
+	if requests[0].Retry != "" || !strings.Contains(requests[1].Retry, "looks ok to me") {
+		t.Errorf("expected the re-prompt to explain the refused answer, got %q / %q", requests[0].Retry, requests[1].Retry)
+	}
+	if result.Verdict != string(VerdictContinue) {
+		t.Errorf("expected CONTINUE, got %s %q", result.Verdict, result.Correction)
+	}
+}
+
+func TestSupervise_ConcurrentHumanRequests(t *testing.T) {
+	provider := &llm.MockProvider{
+		ChatFunc: func(ctx context.Context, req llm.ChatRequest) (*llm.ChatResponse, error) {
+			return &llm.ChatResponse{Content: "VERDICT: CONTINUE\nCORRECTION: looks fine"}, nil
+		},
+	}
+	requests := make(chan HumanRequest, 2)
+	sup := NewLLMSupervisor(Config{
+		Provider:                provider,
+		HumanAvailable:          true,
+		HumanInputChan:          make(chan string),
+		HumanInputTimeout:       time.Second,
+		OnHumanRequest:          func(req HumanRequest) { requests <- req },
+		ConcurrentHumanRequests: true,
+	})
+
+	results := make(chan string, 2)
+	for _, step := range []string{"a", "b"} {
+		go func() {
+			res, err := sup.Supervise(context.Background(), SuperviseRequest{
+				Pre:           &checkpoint.PreCheckpoint{StepID: step},
+				Post:          &checkpoint.PostCheckpoint{StepID: step},
+				HumanRequired: true,
+			})
+			if err != nil {
+				results <- step + ": " + err.Error()
+				return
+			}
+			results <- step + ": " + res.Correction
+		}()
+	}
+
+	// Both steps wait at once; each answer goes to its own step
+	pending := map[string]HumanRequest{}
+	for len(pending) < 2 {
+		select {
+		case req := <-requests:
+			pending[req.StepID] = req
+		case <-time.After(500 * time.Millisecond):
+			t.Fatalf("expected both steps waiting for the human, got %d", len(pending))
+		}
+	}
+	pending["b"].Reply <- "correct: only b"
+	pending["a"].Reply <- "correct: only a"
+	got := map[string]bool{<-results: true, <-results: true}
+	if !got["a: only a"] || !got["b: only b"] {
+		t.Errorf("answers reached the wrong steps: %v", got)
+	}
+	for _, req := range pending {
+		select {
+		case <-req.Done:
+		default:
+			t.Errorf("expected Done closed for step %s", req.StepID)
+		}
+	}
+}
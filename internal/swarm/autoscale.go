@@ -0,0 +1,93 @@
+package swarm
+
+import (
+	"fmt"
+	"time"
+)
+
+// Scale defaults applied to fields a policy leaves unset.
+const (
+	DefaultScaleTargetPending = 2
+	DefaultScaleDownLoad      = 0.25
+	DefaultScaleInterval      = 15 * time.Second
+	DefaultScaleCooldown      = time.Minute
+)
+
+// ScalePolicy controls how an agent's replica count follows its queue.
+type ScalePolicy struct {
+	TargetPending int     `yaml:"target_pending"`  // queued tasks per extra replica (default: 2)
+	ScaleDownLoad float64 `yaml:"scale_down_load"` // average load below which an idle queue sheds a replica (default: 0.25)
+	Interval      string  `yaml:"interval"`        // how often to evaluate (default: 15s)
+	Cooldown      string  `yaml:"cooldown"`        // minimum time between scaling actions (default: 1m)
+
+	interval time.Duration
+	cooldown time.Duration
+}
+
+// Validate parses the policy's durations and fills in defaults.
+func (p *ScalePolicy) Validate() error {
+	if p.TargetPending < 0 {
+		return fmt.Errorf("target_pending must not be negative")
+	}
+	if p.TargetPending == 0 {
+		p.TargetPending = DefaultScaleTargetPending
+	}
+	if p.ScaleDownLoad < 0 || p.ScaleDownLoad > 1 {
+		return fmt.Errorf("scale_down_load must be between 0 and 1, got %g", p.ScaleDownLoad)
+	}
+	if p.ScaleDownLoad == 0 {
+		p.ScaleDownLoad = DefaultScaleDownLoad
+	}
+	p.interval = DefaultScaleInterval
+	if p.Interval != "" {
+		d, err := time.ParseDuration(p.Interval)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid interval %q", p.Interval)
+		}
+		p.interval = d
+	}
+	p.cooldown = DefaultScaleCooldown
+	if p.Cooldown != "" {
+		d, err := time.ParseDuration(p.Cooldown)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid cooldown %q", p.Cooldown)
+		}
+		p.cooldown = d
+	}
+	return nil
+}
+
+// EvalInterval is how often the controller evaluates the policy.
+func (p *ScalePolicy) EvalInterval() time.Duration { return p.interval }
+
+// CooldownPeriod is the minimum time between two scaling actions.
+func (p *ScalePolicy) CooldownPeriod() time.Duration { return p.cooldown }
+
+// Decide returns the replica count to run, given the current count, the
+// tasks waiting in the capability's queue and the replicas' average load.
+// Waiting tasks add one replica per target_pending; an empty queue with
+// load below scale_down_load sheds one replica at a time. The result is
+// kept within [min, max].
+func (p *ScalePolicy) Decide(current, min, max int, pending uint64, avgLoad float64) (int, string) {
+	desired := current
+	reason := "steady"
+	switch {
+	case current < min:
+		desired, reason = min, "below min_replicas"
+	case current > max:
+		desired, reason = max, "above max_replicas"
+	case pending > 0 && pending >= uint64(p.TargetPending):
+		desired = current + int(pending/uint64(p.TargetPending))
+		reason = fmt.Sprintf("%d tasks waiting", pending)
+	case pending == 0 && avgLoad < p.ScaleDownLoad && current > min:
+		desired = current - 1
+		reason = fmt.Sprintf("queue empty, load %.2f", avgLoad)
+	}
+	if desired > max {
+		desired = max
+	}
+	if desired < min {
+		desired = min
+	}
+	return desired, reason
+}
@@ -0,0 +1,58 @@
+package swarm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScalePolicy_Decide(t *testing.T) {
+	p := &ScalePolicy{TargetPending: 2}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		current  int
+		pending  uint64
+		load     float64
+		expected int
+	}{
+		{"steady", 2, 0, 0.6, 2},
+		{"below target", 2, 1, 1, 2},
+		{"scale up", 2, 4, 1, 4},
+		{"capped at max", 2, 20, 1, 5},
+		{"scale down one at a time", 4, 0, 0.1, 3},
+		{"not below min", 1, 0, 0, 1},
+		{"raised to min", 0, 0, 0, 1},
+		{"lowered to max", 7, 0, 1, 5},
+	}
+	for _, tt := range tests {
+		got, reason := p.Decide(tt.current, 1, 5, tt.pending, tt.load)
+		if got != tt.expected {
+			t.Errorf("%s: Decide = %d (%s), want %d", tt.name, got, reason, tt.expected)
+		}
+	}
+}
+
+func TestScalePolicy_Validate(t *testing.T) {
+	p := &ScalePolicy{}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if p.TargetPending != DefaultScaleTargetPending || p.EvalInterval() != DefaultScaleInterval || p.CooldownPeriod() != DefaultScaleCooldown {
+		t.Errorf("expected defaults, got %+v", p)
+	}
+
+	p = &ScalePolicy{Interval: "5s", Cooldown: "0s"}
+	p.Validate()
+	if p.EvalInterval() != 5*time.Second || p.CooldownPeriod() != 0 {
+		t.Errorf("unexpected durations %s/%s", p.EvalInterval(), p.CooldownPeriod())
+	}
+
+	for _, bad := range []ScalePolicy{{TargetPending: -1}, {ScaleDownLoad: 2}, {Interval: "0s"}, {Cooldown: "later"}} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("expected error for %+v", bad)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package swarm
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -10,6 +11,15 @@ import (
 // StreamName is the single JetStream stream covering all swarm subjects.
 const StreamName = "SWARM"
 
+// streamSubjects are the subject families stored in the swarm stream.
+var streamSubjects = []string{
+	"discuss.>",
+	"work.>",
+	"done.>",
+	"heartbeat.>",
+	"dlq.>",
+}
+
 // EnsureStream creates the JetStream stream for the swarm if it doesn't exist.
 // All subject families are covered by a single stream — there is no reason
 // to selectively apply durability.
@@ -20,8 +30,16 @@ func EnsureStream(nc *nats.Conn) (nats.JetStreamContext, error) {
 	}
 
 	// Check if stream already exists
-	_, err = js.StreamInfo(StreamName)
+	info, err := js.StreamInfo(StreamName)
 	if err == nil {
+		// Streams created by older versions lack newer subject families
+		if missing := missingSubjects(info.Config.Subjects); len(missing) > 0 {
+			cfg := info.Config
+			cfg.Subjects = append(cfg.Subjects, missing...)
+			if _, err := js.UpdateStream(&cfg); err != nil {
+				return nil, fmt.Errorf("update stream %s: %w", StreamName, err)
+			}
+		}
 		return js, nil // Already exists
 	}
 
@@ -29,13 +47,8 @@ func EnsureStream(nc *nats.Conn) (nats.JetStreamContext, error) {
 	// LimitsPolicy retains messages until MaxAge, independent of consumer state.
 	// This supports both replay (catch-up) and durable pull consumers for work distribution.
 	_, err = js.AddStream(&nats.StreamConfig{
-		Name: StreamName,
-		Subjects: []string{
-			"discuss.>",
-			"work.>",
-			"done.>",
-			"heartbeat.>",
-		},
+		Name:       StreamName,
+		Subjects:   streamSubjects,
 		Retention:  nats.LimitsPolicy,  // Keep messages until MaxAge
 		MaxAge:     24 * time.Hour,     // Swarm lifetime (generous — cleaned by `swarm purge`)
 		Storage:    nats.MemoryStorage, // Ephemeral — doesn't persist across server restarts
@@ -48,6 +61,23 @@ func EnsureStream(nc *nats.Conn) (nats.JetStreamContext, error) {
 	return js, nil
 }
 
+func missingSubjects(have []string) []string {
+	var missing []string
+	for _, subj := range streamSubjects {
+		found := false
+		for _, h := range have {
+			if h == subj {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, subj)
+		}
+	}
+	return missing
+}
+
 // EnsureWorkConsumer creates a durable pull consumer for a capability's work queue.
 // Each capability gets one consumer shared by all workers via pull-based delivery.
 // Workers call Fetch() to pull tasks — NATS tracks ack state per consumer,
@@ -73,6 +103,19 @@ func EnsureWorkConsumer(js nats.JetStreamContext, capability string) (*nats.Subs
 	return sub, nil
 }
 
+// PendingWork returns how many tasks wait in a capability's work queue,
+// not yet delivered to any worker. A queue with no consumer yet has none.
+func PendingWork(js nats.JetStreamContext, capability string) (uint64, error) {
+	info, err := js.ConsumerInfo(StreamName, fmt.Sprintf("work-%s", capability))
+	if errors.Is(err, nats.ErrConsumerNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("consumer info work-%s: %w", capability, err)
+	}
+	return info.NumPending, nil
+}
+
 // LastSequence returns the current last sequence number of the swarm stream.
 // Used by the REPLAY phase to determine the catch-up boundary.
 func LastSequence(js nats.JetStreamContext) (uint64, error) {
@@ -0,0 +1,334 @@
+package swarm
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultStageTimeout bounds a pipeline stage that doesn't set a timeout.
+const DefaultStageTimeout = 10 * time.Minute
+
+// Stage failure policies.
+const (
+	OnFailureFail     = "fail"     // stop the pipeline
+	OnFailureContinue = "continue" // dependents run with whatever succeeded
+	OnFailureSkip     = "skip"     // dependents are skipped, other branches go on
+)
+
+// Pipeline is a multi-stage task graph run by `swarm pipeline run`.
+type Pipeline struct {
+	Name   string            `yaml:"name"`
+	Inputs map[string]string `yaml:"inputs"` // run inputs with defaults, overridable at run time
+	Stages []*Stage          `yaml:"stages"`
+}
+
+// Stage is one step of a pipeline: a task for a capability, or one task per
+// item with fan_out.
+type Stage struct {
+	Name       string            `yaml:"name"`
+	Capability string            `yaml:"capability"`
+	Needs      []string          `yaml:"needs"`      // stages that must finish first (default: the previous stage)
+	Inputs     map[string]string `yaml:"inputs"`     // task inputs, may use {{ ... }} references
+	FanOut     *FanOut           `yaml:"fan_out"`    // run one task per item
+	Timeout    string            `yaml:"timeout"`    // whole stage, including retries (default: 10m)
+	Retries    int               `yaml:"retries"`    // resubmissions of a failed task (default: 0)
+	OnFailure  string            `yaml:"on_failure"` // fail (default), continue or skip
+
+	timeout time.Duration
+}
+
+// FanOut splits a stage into one task per item of a list.
+type FanOut struct {
+	Over        string `yaml:"over"`         // template yielding a JSON array or one item per line
+	As          string `yaml:"as"`           // reference name for the item (default: item)
+	MaxParallel int    `yaml:"max_parallel"` // tasks in flight at once (default: all)
+}
+
+// StageTimeout is the time the stage may take.
+func (s *Stage) StageTimeout() time.Duration { return s.timeout }
+
+// ItemName is the reference name of a fan-out stage's item.
+func (s *Stage) ItemName() string {
+	if s.FanOut == nil {
+		return ""
+	}
+	return s.FanOut.As
+}
+
+var stageName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+
+// templateRef matches {{ reference }} in stage inputs.
+var templateRef = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.-]+)\s*\}\}`)
+
+// ParsePipeline decodes and validates a pipeline file.
+func ParsePipeline(data []byte) (*Pipeline, error) {
+	var p Pipeline
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parse pipeline: %w", err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Validate fills in defaults and checks stage names, dependencies and
+// references. A stage may only reference stages it (transitively) needs.
+func (p *Pipeline) Validate() error {
+	if len(p.Stages) == 0 {
+		return fmt.Errorf("pipeline has no stages")
+	}
+	byName := map[string]*Stage{}
+	for i, s := range p.Stages {
+		if !stageName.MatchString(s.Name) {
+			return fmt.Errorf("stage %d: invalid name %q", i+1, s.Name)
+		}
+		if byName[s.Name] != nil {
+			return fmt.Errorf("duplicate stage %q", s.Name)
+		}
+		byName[s.Name] = s
+		if s.Capability == "" {
+			return fmt.Errorf("stage %q: capability is required", s.Name)
+		}
+		// Without needs, stages run in file order
+		if s.Needs == nil && i > 0 {
+			s.Needs = []string{p.Stages[i-1].Name}
+		}
+		switch s.OnFailure {
+		case "":
+			s.OnFailure = OnFailureFail
+		case OnFailureFail, OnFailureContinue, OnFailureSkip:
+		default:
+			return fmt.Errorf("stage %q: on_failure must be fail, continue or skip, got %q", s.Name, s.OnFailure)
+		}
+		if s.Retries < 0 {
+			return fmt.Errorf("stage %q: retries must not be negative", s.Name)
+		}
+		s.timeout = DefaultStageTimeout
+		if s.Timeout != "" {
+			d, err := time.ParseDuration(s.Timeout)
+			if err != nil || d <= 0 {
+				return fmt.Errorf("stage %q: invalid timeout %q", s.Name, s.Timeout)
+			}
+			s.timeout = d
+		}
+		if s.FanOut != nil {
+			if s.FanOut.Over == "" {
+				return fmt.Errorf("stage %q: fan_out.over is required", s.Name)
+			}
+			if s.FanOut.As == "" {
+				s.FanOut.As = "item"
+			}
+			if strings.ContainsAny(s.FanOut.As, ".") || s.FanOut.As == "inputs" || s.FanOut.As == "stages" {
+				return fmt.Errorf("stage %q: invalid fan_out.as %q", s.Name, s.FanOut.As)
+			}
+			if s.FanOut.MaxParallel < 0 {
+				return fmt.Errorf("stage %q: fan_out.max_parallel must not be negative", s.Name)
+			}
+		}
+	}
+
+	for _, s := range p.Stages {
+		for _, n := range s.Needs {
+			if byName[n] == nil {
+				return fmt.Errorf("stage %q needs unknown stage %q", s.Name, n)
+			}
+		}
+	}
+	if _, err := p.Order(); err != nil {
+		return err
+	}
+
+	for _, s := range p.Stages {
+		upstream := p.upstream(s, byName)
+		check := func(tmpl string, item string) error {
+			for _, m := range templateRef.FindAllStringSubmatch(tmpl, -1) {
+				if err := p.checkRef(m[1], item, upstream); err != nil {
+					return fmt.Errorf("stage %q: %w", s.Name, err)
+				}
+			}
+			return nil
+		}
+		if s.FanOut != nil {
+			if err := check(s.FanOut.Over, ""); err != nil {
+				return err
+			}
+		}
+		for _, v := range s.Inputs {
+			if err := check(v, s.ItemName()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkRef validates one template reference.
+func (p *Pipeline) checkRef(ref, item string, upstream map[string]bool) error {
+	parts := strings.Split(ref, ".")
+	switch {
+	case item != "" && ref == item:
+		return nil
+	case parts[0] == "inputs" && len(parts) == 2:
+		if _, ok := p.Inputs[parts[1]]; !ok {
+			return fmt.Errorf("{{%s}}: input %q is not declared in the pipeline's inputs", ref, parts[1])
+		}
+		return nil
+	case parts[0] == "stages" && (len(parts) == 3 && parts[2] == "output" || len(parts) == 4 && parts[2] == "outputs"):
+		if !upstream[parts[1]] {
+			return fmt.Errorf("{{%s}}: stage %q is not among this stage's needs", ref, parts[1])
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown reference {{%s}}", ref)
+}
+
+// upstream returns every stage s transitively needs.
+func (p *Pipeline) upstream(s *Stage, byName map[string]*Stage) map[string]bool {
+	seen := map[string]bool{}
+	var visit func(*Stage)
+	visit = func(st *Stage) {
+		for _, n := range st.Needs {
+			if !seen[n] {
+				seen[n] = true
+				visit(byName[n])
+			}
+		}
+	}
+	visit(s)
+	return seen
+}
+
+// Order returns the stages so that each comes after the stages it needs.
+func (p *Pipeline) Order() ([]*Stage, error) {
+	indegree := map[string]int{}
+	dependents := map[string][]*Stage{}
+	for _, s := range p.Stages {
+		indegree[s.Name] = len(s.Needs)
+		for _, n := range s.Needs {
+			dependents[n] = append(dependents[n], s)
+		}
+	}
+	var order, ready []*Stage
+	for _, s := range p.Stages {
+		if indegree[s.Name] == 0 {
+			ready = append(ready, s)
+		}
+	}
+	for len(ready) > 0 {
+		s := ready[0]
+		ready = ready[1:]
+		order = append(order, s)
+		for _, d := range dependents[s.Name] {
+			if indegree[d.Name]--; indegree[d.Name] == 0 {
+				ready = append(ready, d)
+			}
+		}
+	}
+	if len(order) != len(p.Stages) {
+		return nil, fmt.Errorf("pipeline stages form a cycle")
+	}
+	return order, nil
+}
+
+// PipelineState holds a run's inputs and the outputs of finished stages,
+// for rendering references. A fan-out stage's output is the list of its
+// tasks' outputs.
+type PipelineState struct {
+	Inputs  map[string]string
+	Outputs map[string]interface{}
+}
+
+// Render replaces {{ ... }} references in tmpl. vars supplies extra names
+// such as a fan-out item.
+func (st *PipelineState) Render(tmpl string, vars map[string]string) (string, error) {
+	var firstErr error
+	out := templateRef.ReplaceAllStringFunc(tmpl, func(m string) string {
+		ref := templateRef.FindStringSubmatch(m)[1]
+		v, err := st.resolve(ref, vars)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		return v
+	})
+	return out, firstErr
+}
+
+func (st *PipelineState) resolve(ref string, vars map[string]string) (string, error) {
+	if v, ok := vars[ref]; ok {
+		return v, nil
+	}
+	parts := strings.Split(ref, ".")
+	switch {
+	case parts[0] == "inputs" && len(parts) == 2:
+		v, ok := st.Inputs[parts[1]]
+		if !ok {
+			return "", fmt.Errorf("{{%s}}: no such input", ref)
+		}
+		return v, nil
+	case parts[0] == "stages" && len(parts) >= 3:
+		out, ok := st.Outputs[parts[1]]
+		if !ok {
+			return "", fmt.Errorf("{{%s}}: stage %q has no output", ref, parts[1])
+		}
+		if len(parts) == 3 {
+			return OutputText(out), nil
+		}
+		return OutputText(outputField(out, parts[3])), nil
+	}
+	return "", fmt.Errorf("unknown reference {{%s}}", ref)
+}
+
+// outputField picks one named output; from a fan-out stage, the list of
+// that output across its tasks.
+func outputField(out interface{}, key string) interface{} {
+	switch v := out.(type) {
+	case map[string]interface{}:
+		return v[key]
+	case []interface{}:
+		fields := make([]interface{}, 0, len(v))
+		for _, o := range v {
+			fields = append(fields, outputField(o, key))
+		}
+		return fields
+	}
+	return nil
+}
+
+// OutputText renders a task output for use as an input: strings as they
+// are, anything else as JSON.
+func OutputText(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// FanOutItems splits a rendered fan_out.over value into items: the elements
+// of a JSON array, or else its non-blank lines.
+func FanOutItems(s string) []string {
+	var arr []interface{}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(s)), &arr); err == nil {
+		items := make([]string, 0, len(arr))
+		for _, v := range arr {
+			items = append(items, OutputText(v))
+		}
+		return items
+	}
+	var items []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			items = append(items, line)
+		}
+	}
+	return items
+}
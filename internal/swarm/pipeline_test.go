@@ -0,0 +1,150 @@
+package swarm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPipeline = `
+name: release-notes
+inputs:
+  repo: example/repo
+stages:
+  - name: collect
+    capability: git
+    inputs:
+      task: "List merged PRs in {{ inputs.repo }}"
+  - name: summarize
+    capability: writer
+    fan_out:
+      over: "{{ stages.collect.outputs.prs }}"
+      max_parallel: 2
+    inputs:
+      task: "Summarize {{ item }}"
+    on_failure: continue
+    timeout: 2m
+  - name: notes
+    capability: editor
+    inputs:
+      task: "Combine {{ stages.summarize.output }}"
+`
+
+func TestParsePipeline(t *testing.T) {
+	p, err := ParsePipeline([]byte(testPipeline))
+	if err != nil {
+		t.Fatalf("ParsePipeline: %v", err)
+	}
+	if len(p.Stages) != 3 {
+		t.Fatalf("expected 3 stages, got %d", len(p.Stages))
+	}
+	collect, summarize, notes := p.Stages[0], p.Stages[1], p.Stages[2]
+	if len(collect.Needs) != 0 || !reflect.DeepEqual(summarize.Needs, []string{"collect"}) || !reflect.DeepEqual(notes.Needs, []string{"summarize"}) {
+		t.Errorf("expected stages in file order, got needs %v / %v / %v", collect.Needs, summarize.Needs, notes.Needs)
+	}
+	if collect.OnFailure != OnFailureFail || summarize.OnFailure != OnFailureContinue {
+		t.Errorf("unexpected failure policies %q, %q", collect.OnFailure, summarize.OnFailure)
+	}
+	if collect.StageTimeout() != DefaultStageTimeout || summarize.StageTimeout() != 2*time.Minute {
+		t.Errorf("unexpected timeouts %s, %s", collect.StageTimeout(), summarize.StageTimeout())
+	}
+	if summarize.ItemName() != "item" {
+		t.Errorf("expected default item name, got %q", summarize.ItemName())
+	}
+}
+
+func TestParsePipeline_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		yaml   string
+		errMsg string
+	}{
+		{"no stages", "name: x\n", "no stages"},
+		{"missing capability", "stages:\n  - name: a\n", "capability is required"},
+		{"duplicate", "stages:\n  - {name: a, capability: c}\n  - {name: a, capability: c}\n", "duplicate stage"},
+		{"unknown need", "stages:\n  - {name: a, capability: c, needs: [b]}\n", "unknown stage"},
+		{"cycle", "stages:\n  - {name: a, capability: c, needs: [b]}\n  - {name: b, capability: c, needs: [a]}\n", "cycle"},
+		{"bad policy", "stages:\n  - {name: a, capability: c, on_failure: retry}\n", "on_failure"},
+		{"bad timeout", "stages:\n  - {name: a, capability: c, timeout: soon}\n", "invalid timeout"},
+		{"undeclared input", "stages:\n  - name: a\n    capability: c\n    inputs: {task: \"{{ inputs.x }}\"}\n", "not declared"},
+		{"not upstream", "stages:\n  - {name: a, capability: c}\n  - name: b\n    capability: c\n    needs: []\n    inputs: {task: \"{{ stages.a.output }}\"}\n", "not among"},
+		{"item outside fan-out", "stages:\n  - name: a\n    capability: c\n    inputs: {task: \"{{ item }}\"}\n", "unknown reference"},
+	}
+	for _, tt := range tests {
+		_, err := ParsePipeline([]byte(tt.yaml))
+		if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.errMsg, err)
+		}
+	}
+}
+
+func TestPipeline_Order(t *testing.T) {
+	p, err := ParsePipeline([]byte(`
+stages:
+  - {name: join, capability: c, needs: [left, right]}
+  - {name: left, capability: c, needs: []}
+  - {name: right, capability: c, needs: []}
+`))
+	if err != nil {
+		t.Fatalf("ParsePipeline: %v", err)
+	}
+	order, err := p.Order()
+	if err != nil {
+		t.Fatalf("Order: %v", err)
+	}
+	var names []string
+	for _, s := range order {
+		names = append(names, s.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"left", "right", "join"}) {
+		t.Errorf("unexpected order %v", names)
+	}
+}
+
+func TestPipelineState_Render(t *testing.T) {
+	st := &PipelineState{
+		Inputs: map[string]string{"repo": "example/repo"},
+		Outputs: map[string]interface{}{
+			"collect":   map[string]interface{}{"prs": []interface{}{"#1", "#2"}, "count": 2.0},
+			"summarize": []interface{}{map[string]interface{}{"summary": "a"}, map[string]interface{}{"summary": "b"}},
+			"plain":     "text",
+		},
+	}
+	tests := []struct {
+		tmpl     string
+		expected string
+	}{
+		{"repo {{inputs.repo}}", "repo example/repo"},
+		{"{{ stages.collect.outputs.prs }}", `["#1","#2"]`},
+		{"{{ stages.collect.outputs.count }}", "2"},
+		{"{{ stages.summarize.outputs.summary }}", `["a","b"]`},
+		{"{{ stages.plain.output }}", "text"},
+		{"{{ item }}!", "x!"},
+	}
+	for _, tt := range tests {
+		got, err := st.Render(tt.tmpl, map[string]string{"item": "x"})
+		if err != nil {
+			t.Errorf("Render(%q): %v", tt.tmpl, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("Render(%q) = %q, want %q", tt.tmpl, got, tt.expected)
+		}
+	}
+	if _, err := st.Render("{{ stages.missing.output }}", nil); err == nil {
+		t.Error("expected error for a stage without output")
+	}
+}
+
+func TestFanOutItems(t *testing.T) {
+	if got := FanOutItems(`["a", {"b": 1}]`); !reflect.DeepEqual(got, []string{"a", `{"b":1}`}) {
+		t.Errorf("JSON array: got %v", got)
+	}
+	if got := FanOutItems("one\n\n  two  \n"); !reflect.DeepEqual(got, []string{"one", "two"}) {
+		t.Errorf("lines: got %v", got)
+	}
+	if got := FanOutItems("[]"); len(got) != 0 {
+		t.Errorf("empty array: got %v", got)
+	}
+}
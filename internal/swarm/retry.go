@@ -0,0 +1,112 @@
+package swarm
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vinayprograms/agentkit/tasks"
+)
+
+// Retry defaults applied to fields a policy leaves unset.
+const (
+	DefaultRetryBackoff    = 10 * time.Second
+	DefaultRetryMaxBackoff = 5 * time.Minute
+	DefaultRetryMultiplier = 2.0
+)
+
+// RetryPolicy controls how failed tasks of a capability are retried.
+type RetryPolicy struct {
+	MaxAttempts int      `yaml:"max_attempts"` // total attempts, including the first (default: 1, no retry)
+	Backoff     string   `yaml:"backoff"`      // delay before the second attempt (default: 10s)
+	MaxBackoff  string   `yaml:"max_backoff"`  // upper bound on the delay (default: 5m)
+	Multiplier  float64  `yaml:"multiplier"`   // delay growth per attempt (default: 2)
+	RetryOn     []string `yaml:"retry_on"`     // error substrings that are retryable (default: any failure)
+
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+// Validate parses the policy's durations and fills in defaults.
+func (p *RetryPolicy) Validate() error {
+	if p.MaxAttempts < 1 {
+		p.MaxAttempts = 1
+	}
+	if p.Multiplier == 0 {
+		p.Multiplier = DefaultRetryMultiplier
+	}
+	if p.Multiplier < 1 {
+		return fmt.Errorf("multiplier must be at least 1, got %g", p.Multiplier)
+	}
+	p.backoff = DefaultRetryBackoff
+	if p.Backoff != "" {
+		d, err := time.ParseDuration(p.Backoff)
+		if err != nil {
+			return fmt.Errorf("invalid backoff %q: %w", p.Backoff, err)
+		}
+		p.backoff = d
+	}
+	p.maxBackoff = DefaultRetryMaxBackoff
+	if p.MaxBackoff != "" {
+		d, err := time.ParseDuration(p.MaxBackoff)
+		if err != nil {
+			return fmt.Errorf("invalid max_backoff %q: %w", p.MaxBackoff, err)
+		}
+		p.maxBackoff = d
+	}
+	if p.maxBackoff < p.backoff {
+		p.maxBackoff = p.backoff
+	}
+	return nil
+}
+
+// Delay returns how long to wait before retrying a task whose given
+// attempt failed: backoff, growing by multiplier per attempt, capped at
+// max_backoff.
+func (p *RetryPolicy) Delay(attempt int) time.Duration {
+	d := float64(p.backoff)
+	for i := 1; i < attempt; i++ {
+		d *= p.Multiplier
+		if d >= float64(p.maxBackoff) {
+			return p.maxBackoff
+		}
+	}
+	return time.Duration(d)
+}
+
+// Retryable reports whether a failed result may be retried under the
+// policy. Without retry_on, every failure is retryable.
+func (p *RetryPolicy) Retryable(result *tasks.TaskResult) bool {
+	if result.Status == tasks.ResultSuccess {
+		return false
+	}
+	if len(p.RetryOn) == 0 {
+		return true
+	}
+	msg := strings.ToLower(result.Error + " " + string(result.Status))
+	for _, s := range p.RetryOn {
+		if strings.Contains(msg, strings.ToLower(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Exhausted reports whether the attempt was the last one allowed.
+func (p *RetryPolicy) Exhausted(attempt int) bool {
+	return attempt >= p.MaxAttempts
+}
+
+// DLQSubject is where tasks that will not be retried again are published.
+func DLQSubject(capability string) string {
+	return "dlq." + capability
+}
+
+// DeadLetter is a task that failed permanently, published on
+// dlq.<capability>.
+type DeadLetter struct {
+	Task     *tasks.TaskMessage `json:"task"`
+	Result   *tasks.TaskResult  `json:"result,omitempty"` // last result, if any attempt finished
+	Reason   string             `json:"reason"`
+	FailedAt time.Time          `json:"failed_at"`
+}
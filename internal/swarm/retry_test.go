@@ -0,0 +1,70 @@
+package swarm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vinayprograms/agentkit/tasks"
+)
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	p := &RetryPolicy{MaxAttempts: 5, Backoff: "1s", MaxBackoff: "5s"}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := p.Delay(i + 1); got != w {
+			t.Errorf("Delay(%d) = %s, want %s", i+1, got, w)
+		}
+	}
+	if p.Exhausted(4) || !p.Exhausted(5) {
+		t.Error("expected the fifth attempt to be the last")
+	}
+}
+
+func TestRetryPolicy_Defaults(t *testing.T) {
+	p := &RetryPolicy{}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if p.MaxAttempts != 1 || !p.Exhausted(1) {
+		t.Errorf("expected no retries by default, got max_attempts=%d", p.MaxAttempts)
+	}
+	if p.Delay(1) != DefaultRetryBackoff {
+		t.Errorf("expected default backoff, got %s", p.Delay(1))
+	}
+
+	for _, bad := range []RetryPolicy{{Backoff: "soon"}, {MaxBackoff: "1x"}, {Multiplier: 0.5}} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("expected error for %+v", bad)
+		}
+	}
+}
+
+func TestRetryPolicy_Retryable(t *testing.T) {
+	failed := func(msg string) *tasks.TaskResult {
+		r := tasks.NewTaskResult("t1", "a1", tasks.ResultFailed)
+		r.Error = msg
+		return r
+	}
+
+	any := &RetryPolicy{}
+	if !any.Retryable(failed("boom")) {
+		t.Error("without retry_on every failure is retryable")
+	}
+	if any.Retryable(tasks.NewTaskResult("t1", "a1", tasks.ResultSuccess)) {
+		t.Error("successful results are never retried")
+	}
+
+	some := &RetryPolicy{RetryOn: []string{"rate limit", "timeout"}}
+	if !some.Retryable(failed("LLM error: Rate limit exceeded")) {
+		t.Error("expected case-insensitive match on the error")
+	}
+	if !some.Retryable(tasks.NewTaskResult("t1", "a1", tasks.ResultTimeout)) {
+		t.Error("expected the timeout status to match")
+	}
+	if some.Retryable(failed("invalid input")) {
+		t.Error("errors outside retry_on are not retryable")
+	}
+}
@@ -0,0 +1,110 @@
+package toolmeta
+
+import "strings"
+
+// readOnlyCommands are programs that only read files and print. Programs
+// that can write through a plain argument (sed -i, uniq OUT, tee) or run
+// other programs (xargs, env, awk) are not among them; options that make
+// these write (sort -o, find -exec) are in writeFlags.
+var readOnlyCommands = map[string]bool{
+	"basename": true, "cat": true, "cmp": true, "cut": true, "date": true,
+	"df": true, "diff": true, "dirname": true, "du": true, "echo": true,
+	"egrep": true, "fgrep": true, "file": true, "find": true, "git": true,
+	"grep": true, "head": true, "id": true, "jq": true, "ls": true,
+	"md5sum": true, "nl": true, "printf": true, "pwd": true, "readlink": true,
+	"realpath": true, "rg": true, "sha1sum": true, "sha256sum": true,
+	"sort": true, "stat": true, "tail": true, "tr": true, "tree": true,
+	"true": true, "uname": true, "wc": true, "which": true, "whoami": true,
+}
+
+// readOnlyGit are git subcommands that don't change the repository.
+var readOnlyGit = map[string]bool{
+	"blame": true, "describe": true, "diff": true, "grep": true, "log": true,
+	"ls-files": true, "rev-parse": true, "shortlog": true, "show": true,
+	"status": true,
+}
+
+// ReadOnlyCommand reports whether a bash command only reads: every
+// command of a pipeline or list is a known read-only program, and nothing
+// is redirected or substituted. It errs towards false; a command it
+// doesn't know is assumed to have side effects.
+func ReadOnlyCommand(command string) bool {
+	if strings.TrimSpace(command) == "" || strings.ContainsAny(command, ">`\n") || strings.Contains(command, "$(") || strings.Contains(command, "<(") {
+		return false
+	}
+	for _, segment := range splitCommandList(command) {
+		if !readOnlySegment(strings.Fields(segment)) {
+			return false
+		}
+	}
+	return true
+}
+
+// splitCommandList splits a command on |, ||, && and ;. A lone & (a
+// background job) is kept in a segment, so the segment is rejected.
+func splitCommandList(command string) []string {
+	var segments []string
+	start := 0
+	for i := 0; i < len(command); i++ {
+		switch command[i] {
+		case '|', ';':
+		case '&':
+			if i+1 >= len(command) || command[i+1] != '&' {
+				continue
+			}
+		default:
+			continue
+		}
+		segments = append(segments, command[start:i])
+		if i+1 < len(command) && command[i+1] == command[i] {
+			i++
+		}
+		start = i + 1
+	}
+	return append(segments, command[start:])
+}
+
+func readOnlySegment(words []string) bool {
+	if len(words) == 0 || !readOnlyCommands[words[0]] {
+		return false
+	}
+	return readOnlyArgs(words[0], words[1:])
+}
+
+// writeFlags are the options that make a read-only program write, run
+// something or change the system. A single-letter option also matches
+// inside a cluster such as -no.
+var writeFlags = map[string][]string{
+	"date": {"-s", "--set"},
+	"file": {"-C", "--compile"},
+	"find": {"-delete", "-exec", "-execdir", "-ok", "-okdir", "-fprint", "-fls"},
+	"git":  {"--output", "--ext-diff", "--open-files-in-pager", "-O"},
+	"rg":   {"--pre"},
+	"sort": {"-o", "--output", "--compress-program"},
+	"tree": {"-o"},
+}
+
+// readOnlyArgs rejects the arguments that make a read-only program write
+// or run something.
+func readOnlyArgs(name string, args []string) bool {
+	if name == "git" {
+		// Global options (-c, -C, --exec-path) can run configured programs
+		if len(args) == 0 || strings.HasPrefix(args[0], "-") || !readOnlyGit[args[0]] {
+			return false
+		}
+	}
+	for _, arg := range args {
+		if arg == "&" {
+			return false
+		}
+		for _, flag := range writeFlags[name] {
+			if strings.HasPrefix(arg, flag) {
+				return false
+			}
+			if len(flag) == 2 && len(arg) > 1 && arg[0] == '-' && arg[1] != '-' && strings.Contains(arg[1:], flag[1:]) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,265 @@
+// Package toolmeta describes how tools behave: how far their output can be
+// trusted, what side effects they have, and whether they may run alongside
+// other tool calls. The executor uses it to register tool results with the
+// security verifier and to schedule the tool calls of an LLM turn.
+//
+// Built-in tools have defaults. MCP server config and policy.toml can
+// declare metadata for any tool; policy.toml has the last word.
+package toolmeta
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Trust levels of tool output, as in the security verifier's blocks.
+const (
+	Trusted   = "trusted"   // enters context as is
+	Vetted    = "vetted"    // tracked for taint, not escalated
+	Untrusted = "untrusted" // may carry injected instructions
+)
+
+// Side-effect classes.
+const (
+	EffectsNone     = "none"     // reads only
+	EffectsLocal    = "local"    // changes the workspace or agent state
+	EffectsExternal = "external" // acts outside the agent (processes, network, other agents)
+)
+
+// Meta is the resolved metadata of a tool.
+type Meta struct {
+	Trust       string // trust of the tool's output
+	SideEffects string // side-effect class ("" if unknown)
+	Parallel    bool   // may run concurrently with other calls of the same turn
+	Async       bool   // fire-and-forget; the LLM gets "OK" without waiting
+}
+
+// Decl is a declaration of tool metadata. Empty and nil fields keep the value
+// from a less specific declaration or the built-in default.
+type Decl struct {
+	Trust       string `toml:"trust,omitempty"`
+	SideEffects string `toml:"side_effects,omitempty"`
+	Parallel    *bool  `toml:"parallel,omitempty"` // default: true unless side_effects says otherwise
+	Async       *bool  `toml:"async,omitempty"`
+}
+
+// IsZero reports whether the declaration sets nothing.
+func (d Decl) IsZero() bool {
+	return d.Trust == "" && d.SideEffects == "" && d.Parallel == nil && d.Async == nil
+}
+
+// Validate checks trust and side-effect values.
+func (d Decl) Validate() error {
+	switch d.Trust {
+	case "", Trusted, Vetted, Untrusted:
+	default:
+		return fmt.Errorf("trust must be trusted, vetted or untrusted, got %q", d.Trust)
+	}
+	switch d.SideEffects {
+	case "", EffectsNone, EffectsLocal, EffectsExternal:
+	default:
+		return fmt.Errorf("side_effects must be none, local or external, got %q", d.SideEffects)
+	}
+	return nil
+}
+
+// apply overlays d on m. Declaring side effects without parallel makes a
+// tool with side effects run on its own.
+func (d Decl) apply(m Meta) Meta {
+	if d.Trust != "" {
+		m.Trust = d.Trust
+	}
+	if d.SideEffects != "" {
+		m.SideEffects = d.SideEffects
+		m.Parallel = d.SideEffects == EffectsNone
+	}
+	if d.Parallel != nil {
+		m.Parallel = *d.Parallel
+	}
+	if d.Async != nil {
+		m.Async = *d.Async
+	}
+	return m
+}
+
+// builtin holds the defaults of the built-in tools. Tools not listed here
+// are trusted and run in parallel; MCP tools are untrusted.
+var builtin = map[string]Meta{
+	// External content
+	"web_fetch":  {Trust: Untrusted, SideEffects: EffectsNone, Parallel: true},
+	"web_search": {Trust: Untrusted, SideEffects: EffectsNone, Parallel: true},
+
+	// Reads. File content may come from anywhere (a downloaded page, a
+	// cloned repo), so tools returning it are untrusted; listings are not.
+	"read": {Trust: Untrusted, SideEffects: EffectsNone, Parallel: true},
+	"grep": {Trust: Untrusted, SideEffects: EffectsNone, Parallel: true},
+	"glob": {Trust: Trusted, SideEffects: EffectsNone, Parallel: true},
+	"ls":   {Trust: Trusted, SideEffects: EffectsNone, Parallel: true},
+
+	// The scratchpad holds compacted tool results (see executor's
+	// contextManager), so reading it back is as untrusted as the original
+	"scratchpad_read": {Trust: Untrusted, SideEffects: EffectsNone, Parallel: true},
+
+	// Writes to memory and scratchpad; the result isn't needed for the turn
+	"remember":         {Trust: Trusted, SideEffects: EffectsLocal, Parallel: true, Async: true},
+	"scratchpad_write": {Trust: Trusted, SideEffects: EffectsLocal, Parallel: true, Async: true},
+
+	// Side effects or expensive; run one at a time in the order requested
+	"write":        {Trust: Trusted, SideEffects: EffectsLocal},
+	"spawn_agents": {Trust: Trusted, SideEffects: EffectsExternal},
+
+	// Side effects, but scheduled in parallel as they always have been;
+	// declare parallel = false in policy.toml to serialize them
+	"edit":     {Trust: Trusted, SideEffects: EffectsLocal, Parallel: true},
+	"patch":    {Trust: Trusted, SideEffects: EffectsLocal, Parallel: true},
+	"mkdir":    {Trust: Trusted, SideEffects: EffectsLocal, Parallel: true},
+	"mv":       {Trust: Trusted, SideEffects: EffectsLocal, Parallel: true},
+	"cp":       {Trust: Trusted, SideEffects: EffectsLocal, Parallel: true},
+	"rm":       {Trust: Trusted, SideEffects: EffectsLocal, Parallel: true},
+	"dispatch": {Trust: Trusted, SideEffects: EffectsExternal, Parallel: true},
+
+	// Output can carry anything the command touched: downloads (curl),
+	// files, remotes. Untrusted like other outside content.
+	"bash": {Trust: Untrusted, SideEffects: EffectsExternal},
+	"git":  {Trust: Untrusted, SideEffects: EffectsExternal, Parallel: true},
+}
+
+// Default returns the built-in metadata of a tool.
+func Default(tool string) Meta {
+	if m, ok := builtin[tool]; ok {
+		return m
+	}
+	if strings.HasPrefix(tool, "mcp_") {
+		return Meta{Trust: Untrusted, Parallel: true}
+	}
+	return Meta{Trust: Trusted, Parallel: true}
+}
+
+type entry struct {
+	pattern string
+	decl    Decl
+}
+
+// Catalog resolves tool metadata from the built-in defaults and
+// declarations. A nil Catalog has only the defaults.
+type Catalog struct {
+	entries []entry // applied in order; later entries win
+}
+
+// New returns an empty catalog.
+func New() *Catalog {
+	return &Catalog{}
+}
+
+// Declare adds a declaration for tools matching pattern (a tool name or
+// glob). It overrides earlier declarations for the same tools.
+func (c *Catalog) Declare(pattern string, d Decl) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid tool pattern %q", pattern)
+	}
+	if err := d.Validate(); err != nil {
+		return fmt.Errorf("%s: %w", pattern, err)
+	}
+	if !d.IsZero() {
+		c.entries = append(c.entries, entry{pattern, d})
+	}
+	return nil
+}
+
+// DeclareMCPServer adds the metadata from an MCP server's config: server
+// applies to all its tools, tools to single tools.
+func (c *Catalog) DeclareMCPServer(name string, server Decl, tools map[string]Decl) error {
+	if err := c.Declare("mcp_"+name+"_*", server); err != nil {
+		return fmt.Errorf("mcp server %s: %w", name, err)
+	}
+	for _, t := range sortedKeys(tools) {
+		if err := c.Declare("mcp_"+name+"_"+t, tools[t]); err != nil {
+			return fmt.Errorf("mcp server %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Lookup returns the metadata of a tool.
+func (c *Catalog) Lookup(tool string) Meta {
+	m := Default(tool)
+	if c == nil {
+		return m
+	}
+	for _, e := range c.entries {
+		if ok, _ := path.Match(e.pattern, tool); ok {
+			m = e.decl.apply(m)
+		}
+	}
+	return m
+}
+
+// metaKeys are the tool table keys that declare metadata.
+var metaKeys = []string{"trust", "side_effects", "parallel", "async"}
+
+// ParsePolicy adds the declarations in policy.toml's tool tables, e.g.
+//
+//	[bash]
+//	enabled = true
+//	trust = "untrusted"
+//
+// Exact tool names override globs, so [mcp_github_create_issue] overrides
+// ["mcp_github_*"] wherever it appears. Among globs matching the same
+// tool, the one declared later in the file wins.
+func (c *Catalog) ParsePolicy(content string) error {
+	var raw map[string]toml.Primitive
+	md, err := toml.Decode(content, &raw)
+	if err != nil {
+		return fmt.Errorf("failed to parse policy: %w", err)
+	}
+	var globs, names []string
+	decls := map[string]Decl{}
+	for _, k := range md.Keys() {
+		if len(k) != 1 {
+			continue
+		}
+		key := k[0]
+		var table map[string]interface{}
+		if md.PrimitiveDecode(raw[key], &table) != nil || !declaresMeta(table) {
+			continue
+		}
+		var d Decl
+		if err := md.PrimitiveDecode(raw[key], &d); err != nil {
+			return fmt.Errorf("policy [%s]: %w", key, err)
+		}
+		if strings.ContainsAny(key, "*?[") {
+			globs = append(globs, key)
+		} else {
+			names = append(names, key)
+		}
+		decls[key] = d
+	}
+	for _, p := range append(globs, names...) {
+		if err := c.Declare(p, decls[p]); err != nil {
+			return fmt.Errorf("policy: %w", err)
+		}
+	}
+	return nil
+}
+
+func declaresMeta(table map[string]interface{}) bool {
+	for _, k := range metaKeys {
+		if _, ok := table[k]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]Decl) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,214 @@
+package toolmeta
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDefault(t *testing.T) {
+	tests := []struct {
+		tool     string
+		expected Meta
+	}{
+		{"web_fetch", Meta{Trust: Untrusted, SideEffects: EffectsNone, Parallel: true}},
+		{"bash", Meta{Trust: Untrusted, SideEffects: EffectsExternal}},
+		{"git", Meta{Trust: Untrusted, SideEffects: EffectsExternal, Parallel: true}},
+		{"read", Meta{Trust: Untrusted, SideEffects: EffectsNone, Parallel: true}},
+		{"ls", Meta{Trust: Trusted, SideEffects: EffectsNone, Parallel: true}},
+		{"write", Meta{Trust: Trusted, SideEffects: EffectsLocal}},
+		{"edit", Meta{Trust: Trusted, SideEffects: EffectsLocal, Parallel: true}},
+		{"dispatch", Meta{Trust: Trusted, SideEffects: EffectsExternal, Parallel: true}},
+		{"remember", Meta{Trust: Trusted, SideEffects: EffectsLocal, Parallel: true, Async: true}},
+		{"mcp_github_list_issues", Meta{Trust: Untrusted, Parallel: true}},
+		{"custom_tool", Meta{Trust: Trusted, Parallel: true}},
+	}
+	for _, tt := range tests {
+		if got := Default(tt.tool); got != tt.expected {
+			t.Errorf("Default(%s) = %+v, want %+v", tt.tool, got, tt.expected)
+		}
+	}
+
+	var nilCatalog *Catalog
+	if got := nilCatalog.Lookup("bash"); got != Default("bash") {
+		t.Errorf("nil catalog should return defaults, got %+v", got)
+	}
+}
+
+func TestCatalog_ParsePolicy(t *testing.T) {
+	c := New()
+	err := c.ParsePolicy(`
+default_deny = true
+
+[mcp]
+default_deny = true
+allowed_tools = ["github:*"]
+
+[bash]
+enabled = true
+trust = "untrusted"
+
+[read]
+trust = "vetted"
+
+[tree]
+side_effects = "local"
+
+["mcp_github_*"]
+side_effects = "external"
+parallel = true
+
+[mcp_github_search]
+trust = "vetted"
+side_effects = "none"
+async = false
+
+[web_fetch]
+allow_domains = ["example.com"]
+`)
+	if err != nil {
+		t.Fatalf("ParsePolicy: %v", err)
+	}
+	tests := []struct {
+		tool     string
+		expected Meta
+	}{
+		{"bash", Meta{Trust: Untrusted, SideEffects: EffectsExternal}},
+		{"read", Meta{Trust: Vetted, SideEffects: EffectsNone, Parallel: true}},
+		{"tree", Meta{Trust: Trusted, SideEffects: EffectsLocal}},                                         // side effects imply serial
+		{"mcp_github_create_issue", Meta{Trust: Untrusted, SideEffects: EffectsExternal, Parallel: true}}, // explicit parallel wins
+		{"mcp_github_search", Meta{Trust: Vetted, SideEffects: EffectsNone, Parallel: true}},
+		{"web_fetch", Default("web_fetch")},
+	}
+	for _, tt := range tests {
+		if got := c.Lookup(tt.tool); got != tt.expected {
+			t.Errorf("Lookup(%s) = %+v, want %+v", tt.tool, got, tt.expected)
+		}
+	}
+}
+
+func TestCatalog_ParsePolicyPrecedence(t *testing.T) {
+	c := New()
+	err := c.ParsePolicy(`
+[mcp_github_search]
+trust = "trusted"
+
+["mcp_github_*"]
+trust = "vetted"
+
+["mcp_*"]
+trust = "untrusted"
+
+["mcp_*_search"]
+side_effects = "none"
+trust = "vetted"
+`)
+	if err != nil {
+		t.Fatalf("ParsePolicy: %v", err)
+	}
+	tests := []struct {
+		tool  string
+		trust string
+	}{
+		{"mcp_github_search", Trusted},         // exact name beats globs declared after it
+		{"mcp_github_create_issue", Untrusted}, // later glob wins over earlier glob
+		{"mcp_notes_search", Vetted},
+	}
+	for _, tt := range tests {
+		if got := c.Lookup(tt.tool); got.Trust != tt.trust {
+			t.Errorf("Lookup(%s).Trust = %s, want %s", tt.tool, got.Trust, tt.trust)
+		}
+	}
+}
+
+func TestCatalog_PolicyOverridesMCPConfig(t *testing.T) {
+	c := New()
+	async := true
+	err := c.DeclareMCPServer("notes", Decl{Trust: Trusted}, map[string]Decl{
+		"append": {SideEffects: EffectsLocal, Async: &async},
+	})
+	if err != nil {
+		t.Fatalf("DeclareMCPServer: %v", err)
+	}
+	if got := c.Lookup("mcp_notes_append"); got != (Meta{Trust: Trusted, SideEffects: EffectsLocal, Async: true}) {
+		t.Errorf("unexpected MCP config metadata %+v", got)
+	}
+	if err := c.ParsePolicy("[\"mcp_notes_*\"]\ntrust = \"untrusted\"\n"); err != nil {
+		t.Fatalf("ParsePolicy: %v", err)
+	}
+	if got := c.Lookup("mcp_notes_append"); got.Trust != Untrusted || !got.Async {
+		t.Errorf("expected policy to override trust only, got %+v", got)
+	}
+}
+
+func TestCatalog_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		errMsg string
+	}{
+		{"bad trust", "[bash]\ntrust = \"maybe\"\n", "trust must be"},
+		{"bad side effects", "[bash]\nside_effects = \"lots\"\n", "side_effects must be"},
+		{"bad type", "[bash]\nparallel = \"yes\"\n", "policy [bash]"},
+		{"bad pattern", "[\"mcp_[\"]\ntrust = \"vetted\"\n", "invalid tool pattern"},
+	}
+	for _, tt := range tests {
+		err := New().ParsePolicy(tt.policy)
+		if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.errMsg, err)
+		}
+	}
+	if err := New().DeclareMCPServer("x", Decl{Trust: "sure"}, nil); err == nil || !strings.Contains(err.Error(), "mcp server x") {
+		t.Errorf("expected MCP config error, got %v", err)
+	}
+}
+
+func TestReadOnlyCommand(t *testing.T) {
+	readOnly := []string{
+		"git status",
+		"git log --oneline -5",
+		"git diff HEAD~1 -- main.go",
+		"ls -la src/",
+		"cat go.mod | grep module",
+		"grep -rn TODO . && wc -l main.go",
+		"find . -name '*.go' -type f",
+		"sort -n sizes.txt | head -5",
+		"file -b image.png",
+	}
+	for _, cmd := range readOnly {
+		if !ReadOnlyCommand(cmd) {
+			t.Errorf("expected %q to be read-only", cmd)
+		}
+	}
+
+	sideEffects := []string{
+		"",
+		"rm -rf build",
+		"git commit -m wip",
+		"git -c core.pager=sh log",
+		"git diff --output=patch.diff",
+		"git branch new-feature",
+		"ls > files.txt",
+		"cat a.txt >> b.txt",
+		"echo $(touch x)",
+		"ls; rm x",
+		"ls && make",
+		"cat f | sh",
+		"cat f | tee out.txt",
+		"find . -name '*.tmp' -delete",
+		"find . -exec rm {} ;",
+		"sort -o sorted.txt data.txt",
+		"sort -no sorted.txt data.txt",
+		"sort --compress-program=./payload -S 1 data.txt",
+		"file -C -m magic",
+		"file --compile --magic-file magic",
+		"ls & rm x",
+		"npm install",
+		"FOO=1 ls",
+		"echo hi\nrm x",
+	}
+	for _, cmd := range sideEffects {
+		if ReadOnlyCommand(cmd) {
+			t.Errorf("expected %q to have side effects", cmd)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vinayprograms/agent/internal/sandbox"
+	"github.com/vinayprograms/agentkit/policy"
+	"github.com/vinayprograms/agentkit/tools"
+)
+
+// BashTool replaces agentkit's built-in bash whenever bash is enabled.
+// Commands pass the same security checks, with each decision reported
+// together with the context of the call that made it, so concurrent
+// executors sharing the tool registry each log their own commands.
+//
+// When policy.toml configures a sandbox, commands run confined: the
+// filesystem is read-only outside the workspace, the network is cut off
+// unless allowed, and resource limits apply. Without one they run through
+// the built-in bash.
+type BashTool struct {
+	policy  *policy.Policy
+	checker *policy.BashChecker
+	sandbox *sandbox.Sandbox
+	inner   tools.Tool // built-in bash, runs commands when sandbox is nil
+
+	// OnDecision is called after each security decision, like
+	// policy.BashChecker.OnDecision, with the context of the tool call.
+	OnDecision func(ctx context.Context, command, step string, allowed bool, reason string, durationMs int64, inputTokens, outputTokens int)
+
+	// OnViolation is called when a command runs into the sandbox (a
+	// blocked write or connection, or a resource limit), for auditing.
+	OnViolation func(ctx context.Context, command, reason string, durationMs int64)
+}
+
+// NewBash returns a bash tool running commands in sb. checker may be nil,
+// in which case commands are checked against the policy's allow and deny
+// lists only.
+func NewBash(pol *policy.Policy, checker *policy.BashChecker, sb *sandbox.Sandbox) *BashTool {
+	return &BashTool{policy: pol, checker: checker, sandbox: sb}
+}
+
+// WrapBash returns a bash tool that checks commands with checker and runs
+// them with inner, the built-in bash. inner should only re-run the
+// denylist (a BashChecker without an LLM checker), so that commands are
+// not checked by the LLM twice.
+func WrapBash(inner tools.Tool, pol *policy.Policy, checker *policy.BashChecker) *BashTool {
+	return &BashTool{policy: pol, checker: checker, inner: inner}
+}
+
+func (t *BashTool) Name() string { return "bash" }
+
+func (t *BashTool) Description() string {
+	if t.sandbox == nil {
+		return t.inner.Description()
+	}
+	cfg := t.sandbox.Config()
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = sandbox.DefaultTimeout
+	}
+	network := "There is no network access."
+	if cfg.Network {
+		network = "Network access is allowed."
+	}
+	return fmt.Sprintf("Execute a shell command in a sandbox. Only the workspace and /tmp are writable; /tmp is private and discarded after each command. %s Commands are killed after %d seconds. Do NOT start long-running servers or processes that block indefinitely. Use as last resort — prefer dedicated tools (read, write, edit, grep, glob, tree, git) when they cover the operation. Bash is best for: build commands, running tests, piping multiple commands, or operations no built-in tool handles.", network, timeout)
+}
+
+func (t *BashTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"command": map[string]interface{}{
+				"type":        "string",
+				"description": "Shell command to execute",
+			},
+		},
+		"required": []string{"command"},
+	}
+}
+
+func (t *BashTool) Execute(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	command, _ := args["command"].(string)
+	if command == "" {
+		return nil, fmt.Errorf("command is required")
+	}
+
+	// Same checks as the built-in bash: the BashChecker (denylist and LLM
+	// policy check), or the legacy policy check without one
+	if t.checker != nil {
+		allowed, reason, err := t.check(ctx, command)
+		if err != nil {
+			return nil, fmt.Errorf("bash security check error: %w", err)
+		}
+		if !allowed {
+			return nil, fmt.Errorf("command blocked: %s", reason)
+		}
+	} else if allowed, reason := t.policy.CheckCommand(t.Name(), command); !allowed {
+		return nil, fmt.Errorf("policy denied: %s", reason)
+	}
+
+	if t.sandbox == nil {
+		return t.inner.Execute(ctx, args)
+	}
+
+	start := time.Now()
+	res, err := t.sandbox.Run(ctx, command)
+	if res != nil && res.Violation != "" && t.OnViolation != nil {
+		t.OnViolation(ctx, command, res.Violation, time.Since(start).Milliseconds())
+	}
+	if errors.Is(err, sandbox.ErrTimeout) {
+		return nil, fmt.Errorf("command timed out")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tools.ExecResult{
+		Stdout:   res.Stdout,
+		Stderr:   res.Stderr,
+		ExitCode: res.ExitCode,
+	}, nil
+}
+
+// check runs the BashChecker with its decisions reported under ctx. The
+// checker is shared by concurrent calls, so each call uses its own copy.
+func (t *BashTool) check(ctx context.Context, command string) (bool, string, error) {
+	checker := *t.checker
+	checker.OnDecision = nil
+	if t.OnDecision != nil {
+		checker.OnDecision = func(command, step string, allowed bool, reason string, durationMs int64, inputTokens, outputTokens int) {
+			t.OnDecision(ctx, command, step, allowed, reason, durationMs, inputTokens, outputTokens)
+		}
+	}
+	return checker.Check(ctx, command)
+}